@@ -0,0 +1,48 @@
+package authority
+
+import (
+	. "fe/common"
+	"fmt"
+)
+
+// For every decryption key it derives, the authority signs a RatesAttestation, which binds the key (by the hash of
+// the encoded decryption params it serves) to the rates it has been derived for, and to the ciphers it is restricted
+// to. The server puts the attestation of the key it has billed with in the task's bundle, so that the customer can
+// check the rates without trusting the server.
+
+// attest signs the attestation of the decryption params derived for rates; missing marks the ciphers the params are
+// restricted from, and is nil for the params of all the ciphers
+func (t *Task) attest(decryptionParamsId UUID, decryptionParams FEDecryptionParams, rates []int, missing []bool) error {
+	data, err := Encode(decryptionParams)
+	if err != nil {
+		return fmt.Errorf("encoding decryption params failed: %s", err)
+	}
+
+	attestation := &RatesAttestation{
+		TaskId:             t.Id,
+		DecryptionParamsId: decryptionParamsId,
+		Scheme:             t.Scheme,
+		RatesHash:          HashRates(rates),
+		KeyHash:            Hash(data),
+	}
+	for idx, isMissing := range missing {
+		if isMissing {
+			attestation.MissingCiphers = append(attestation.MissingCiphers, idx)
+		}
+	}
+	if err = attestation.Sign(t.signer); err != nil {
+		return fmt.Errorf("signing attestation failed: %s", err)
+	}
+
+	t.attestations.Store(decryptionParamsId, attestation)
+	return nil
+}
+
+// GetAttestation returns the attestation of the decryption params with decryptionParamsId
+func (t *Task) GetAttestation(decryptionParamsId UUID) (*RatesAttestation, error) {
+	attestation, ok := t.attestations.Load(decryptionParamsId)
+	if !ok {
+		return nil, fmt.Errorf("attestation not found")
+	}
+	return attestation.(*RatesAttestation), nil
+}
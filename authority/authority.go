@@ -9,19 +9,53 @@ import (
 type Authority struct {
 	tasks sync.Map
 
+	// shares of the tasks whose master secret is split among share holders, by task id
+	shares sync.Map
+	// shareRates are the rates the partial keys of the shares have been derived for, by task id
+	shareRates sync.Map
+
 	*Host[Task]
+
+	// Authenticator authenticates the callers of the endpoints, see GetEndpoints; nil if they're unauthenticated
+	Authenticator *Authenticator
+	// shareHolderCredential is sent to the share holders by the dealer
+	shareHolderCredential string
+
+	config  *AuthorityConfig
+	metrics *authorityMetrics
 }
 
-func InitAuthority() *Authority {
-	authority := &Authority{}
-	authority.Host = InitHost[Task](AuthorityLogDir, AuthorityLogFilename, SensorTaskChanSize, authority.GetEndpoints())
-	return authority
+func InitAuthority(config *AuthorityConfig, clock Clock) (*Authority, error) {
+	var err error
+	authority := &Authority{config: config}
+	authority.Host, err = InitHost[Task](&config.HostConfig, clock, authority.GetEndpoints())
+	if err != nil {
+		return nil, err
+	}
+	authority.metrics = newAuthorityMetrics(authority.Metrics)
+
+	if authority.Authenticator, err = NewAuthenticator(&config.AuthConfig, authority.Clock); err != nil {
+		return nil, err
+	}
+	if authority.Authenticator == nil {
+		authority.Logger.Warn("no API keys or JWT secret are configured, the endpoints are unauthenticated")
+	}
+	authority.HttpServer.SetAuthenticator(authority.Authenticator)
+	if authority.shareHolderCredential, err = ReadCredentialFile(config.ShareHolderCredentialFile); err != nil {
+		return nil, err
+	}
+	return authority, nil
 }
 
 func (authority *Authority) AddTask(task *Task) {
 	authority.tasks.Store(task.Id, task)
 }
 
+// RemoveTask removes a task that hasn't been accepted by the task daemon
+func (authority *Authority) RemoveTask(taskId UUID) {
+	authority.tasks.Delete(taskId)
+}
+
 func (authority *Authority) GetTask(taskId UUID) (*Task, error) {
 	taskAny, exists := authority.tasks.Load(taskId)
 	if !exists {
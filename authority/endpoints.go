@@ -2,6 +2,7 @@ package authority
 
 import (
 	. "fe/common"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -14,11 +15,37 @@ func (authority *Authority) addTaskEndpoint(c *gin.Context) (ResponseType, int,
 	}
 
 	// create a task from TaskRequest
-	task := NewTask(taskRequest)
+	task := authority.NewTask(taskRequest)
+	if task.MinSampleValue > task.MaxSampleValue || task.MinRateValue > task.MaxRateValue {
+		return ErrorResponse, http.StatusBadRequest, "min sample and rate values can't be greater than the max values"
+	}
+	if err := CheckScheme(task.Scheme, task.EnableEncryption, len(task.SensorIds), task.BatchCnt); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+	if !UsesAuthority(task.Scheme) {
+		return ErrorResponse, http.StatusBadRequest, fmt.Sprintf("scheme %s doesn't use the authority", task.Scheme)
+	}
+	if task.Threshold > 0 {
+		if !SupportsThreshold(task.Scheme) {
+			return ErrorResponse, http.StatusBadRequest, fmt.Sprintf("scheme %s doesn't support the threshold mode", task.Scheme)
+		}
+		if task.Threshold > len(task.ShareHolders) {
+			return ErrorResponse, http.StatusBadRequest, fmt.Sprintf("threshold %d is greater than the share holder count %d", task.Threshold, len(task.ShareHolders))
+		}
+	}
 
-	// send task to TaskDaemon
+	if task.ProgressWindow != 0 {
+		if err := task.checkProgressWindow(); err != nil {
+			return ErrorResponse, http.StatusBadRequest, err.Error()
+		}
+	}
+
+	// send task to TaskDaemon; the task is removed if it isn't accepted, as it will never run
 	authority.AddTask(task)
-	authority.SendTaskToDaemon(task)
+	if err := authority.SendTaskToDaemon(task); err != nil {
+		authority.RemoveTask(task.Id)
+		return ErrorResponse, http.StatusServiceUnavailable, err
+	}
 
 	return NoResponse, http.StatusAccepted, nil
 }
@@ -34,12 +61,13 @@ func (authority *Authority) getTaskDetailsEndpoint(c *gin.Context) (ResponseType
 	// get task
 	task, err := authority.GetTask(taskId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
-	// send task to TaskDaemon
-	authority.AddTask(task)
-	authority.SendTaskToDaemon(task)
+	// send task to TaskDaemon again; it's already added
+	if err := authority.SendTaskToDaemon(task); err != nil {
+		return ErrorResponse, http.StatusServiceUnavailable, err
+	}
 
 	return NoResponse, http.StatusAccepted, nil
 }
@@ -56,7 +84,7 @@ func (authority *Authority) getSchemaParamsStatusEndpoint(c *gin.Context) (Respo
 	// get task
 	task, err := authority.GetTask(taskId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
 	status := task.GetSchemaParamsStatus()
@@ -73,17 +101,20 @@ func (authority *Authority) getEncryptionParamsEndpoint(c *gin.Context) (Respons
 		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
 	}
 
-	// get task
-	task, err := authority.GetTask(taskId)
-	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
-	}
-
 	sensorIdString := c.Param("sensorId")
 	sensorId, err := NewUUIDFromString(sensorIdString)
 	if err != nil {
 		return ErrorResponse, http.StatusBadRequest, "invalid sensor uuid"
 	}
+	if !AuthorizeSubject(c, RoleSensor, sensorId) {
+		return ErrorResponse, http.StatusForbidden, "the encryption params of another sensor can't be fetched"
+	}
+
+	// get task
+	task, err := authority.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err
+	}
 
 	// todo check that enc params are ready
 	feEncryptionParams, err := task.GetEncryptionParams(sensorId)
@@ -111,7 +142,7 @@ func (authority *Authority) addRatesEndpoint(c *gin.Context) (ResponseType, int,
 	// get task
 	task, err := authority.GetTask(taskId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
 	ratesBytes, err := c.GetRawData()
@@ -132,7 +163,10 @@ func (authority *Authority) addRatesEndpoint(c *gin.Context) (ResponseType, int,
 	return StringResponse, http.StatusAccepted, string(decryptionParamsId)
 }
 
-func (authority *Authority) getDecryptionParamsEndpoint(c *gin.Context) (ResponseType, int, any) {
+// addPartialRatesEndpoint derives a decryption key restricted to the ciphers the server has received
+//
+// endpoint: [POST] /tasks/:taskId/rates/partial
+func (authority *Authority) addPartialRatesEndpoint(c *gin.Context) (ResponseType, int, any) {
 
 	// get task uuid
 	taskIdString := c.Param("taskId")
@@ -144,9 +178,70 @@ func (authority *Authority) getDecryptionParamsEndpoint(c *gin.Context) (Respons
 	// get task
 	task, err := authority.GetTask(taskId)
 	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err
+	}
+
+	var request PartialRatesRequest
+	if err := c.BindJSON(&request); err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
 
+	decryptionParamsId, err := task.AddPartialDecryptionParams(request)
+	if err != nil {
+		task.logger.Warn("restricted key refused: %s", err)
+		return ErrorResponse, http.StatusForbidden, err.Error()
+	}
+
+	return StringResponse, http.StatusAccepted, string(decryptionParamsId)
+}
+
+// addPrefixRatesEndpoint derives a decryption key restricted to the first batches of every sensor
+//
+// endpoint: [POST] /tasks/:taskId/rates/prefix
+func (authority *Authority) addPrefixRatesEndpoint(c *gin.Context) (ResponseType, int, any) {
+
+	// get task uuid
+	taskIdString := c.Param("taskId")
+	taskId, err := NewUUIDFromString(taskIdString)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	// get task
+	task, err := authority.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err
+	}
+
+	var request PrefixRatesRequest
+	if err := c.BindJSON(&request); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	decryptionParamsId, err := task.AddPrefixDecryptionParams(request)
+	if err != nil {
+		task.logger.Warn("prefix key refused: %s", err)
+		return ErrorResponse, http.StatusForbidden, err.Error()
+	}
+
+	return StringResponse, http.StatusAccepted, string(decryptionParamsId)
+}
+
+func (authority *Authority) getDecryptionParamsEndpoint(c *gin.Context) (ResponseType, int, any) {
+
+	// get task uuid
+	taskIdString := c.Param("taskId")
+	taskId, err := NewUUIDFromString(taskIdString)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	// get task
+	task, err := authority.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err
+	}
+
 	// get decryptionKeyId
 	decryptionParamsIdString := c.Param("decryptionParamsId")
 	decryptionParamsId, err := NewUUIDFromString(decryptionParamsIdString)
@@ -167,6 +262,33 @@ func (authority *Authority) getDecryptionParamsEndpoint(c *gin.Context) (Respons
 	return DataResponse, http.StatusOK, data
 }
 
+// getAttestationEndpoint returns the signed RatesAttestation of the decryption params
+//
+// endpoint: [GET] /tasks/:taskId/decryption-params/:decryptionParamsId/attestation
+func (authority *Authority) getAttestationEndpoint(c *gin.Context) (ResponseType, int, any) {
+	taskId, err := NewUUIDFromString(c.Param("taskId"))
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	task, err := authority.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err.Error()
+	}
+
+	decryptionParamsId, err := NewUUIDFromString(c.Param("decryptionParamsId"))
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid decryption params id"
+	}
+
+	attestation, err := task.GetAttestation(decryptionParamsId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err.Error()
+	}
+
+	return JSONResponse, http.StatusOK, attestation
+}
+
 func (authority *Authority) getDecryptionParamsStatusEndpoint(c *gin.Context) (ResponseType, int, any) {
 
 	// get task uuid
@@ -179,7 +301,7 @@ func (authority *Authority) getDecryptionParamsStatusEndpoint(c *gin.Context) (R
 	// get task
 	task, err := authority.GetTask(taskId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
 	// get decryptionKeyId
@@ -195,24 +317,191 @@ func (authority *Authority) getDecryptionParamsStatusEndpoint(c *gin.Context) (R
 }
 
 func (authority *Authority) getUnapprovedRatesEndpoint(c *gin.Context) (ResponseType, int, any) {
-	return ErrorResponse, http.StatusInternalServerError, "not implemented"
+	return ErrorResponse, http.StatusNotImplemented, "not implemented"
 }
 
-func (authority *Authority) GetEndpoints() []Endpoint {
-	return []Endpoint{
+//region THRESHOLD endpoints
 
-		{"POST", "/task", authority.addTaskEndpoint},
-		//{"GET", "/task/:taskId", authority.getTaskDetailsEndpoint},
+// endpoint: [PUT] /tasks/:taskId/share
+func (authority *Authority) addShareEndpoint(c *gin.Context) (ResponseType, int, any) {
+	taskIdString := c.Param("taskId")
+	taskId, err := NewUUIDFromString(taskIdString)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
 
-		{"POST", "/rates/:taskId", authority.addRatesEndpoint},
+	shareBytes, err := c.GetRawData()
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
 
-		{"GET", "/rates", authority.getUnapprovedRatesEndpoint},
-		//{"POST", "/rates-approval/:taskId", authority.getApproveRatesEndpoint},
+	shareAny, err := Decode(shareBytes)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
 
-		{"GET", "/schema-status/:taskId", authority.getSchemaParamsStatusEndpoint},
-		{"GET", "/decryption-status/:taskId/:decryptionParamsId", authority.getDecryptionParamsStatusEndpoint},
+	share, ok := shareAny.(*ThresholdShare)
+	if !ok {
+		return ErrorResponse, http.StatusBadRequest, "invalid share"
+	}
 
-		{"GET", "/encryption/:taskId/:sensorId", authority.getEncryptionParamsEndpoint},
-		{"GET", "/decryption/:taskId/:decryptionParamsId", authority.getDecryptionParamsEndpoint},
+	if err = authority.AddShare(taskId, share); err != nil {
+		return ErrorResponse, http.StatusConflict, err.Error()
 	}
+
+	return NoResponse, http.StatusNoContent, nil
+}
+
+// endpoint: [POST] /tasks/:taskId/partial-keys
+func (authority *Authority) getPartialKeyEndpoint(c *gin.Context) (ResponseType, int, any) {
+	taskIdString := c.Param("taskId")
+	taskId, err := NewUUIDFromString(taskIdString)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	ratesBytes, err := c.GetRawData()
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	rates, err := Decode(ratesBytes)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	y, ok := rates.([]int)
+	if !ok {
+		return ErrorResponse, http.StatusBadRequest, "invalid rates"
+	}
+
+	partialKey, err := authority.DerivePartialKey(taskId, y)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	data, err := Encode(partialKey)
+	if err != nil {
+		return ErrorResponse, http.StatusInternalServerError, err
+	}
+
+	return DataResponse, http.StatusOK, data
+}
+
+// endpoint: [GET] /shares
+func (authority *Authority) getSharesEndpoint(c *gin.Context) (ResponseType, int, any) {
+	taskIds := authority.GetShareTaskIds()
+	return JSONResponse, http.StatusOK, ShareHolderStatus{
+		Shares:  len(taskIds),
+		TaskIds: taskIds,
+	}
+}
+
+//endregion
+
+// the roles of the endpoints, see Endpoint.Roles; the sensors are scoped to their own encryption params by the handler
+var (
+	serverRoles = []Role{RoleOperator, RoleServer}
+	sensorRoles = []Role{RoleOperator, RoleSensor}
+	dealerRoles = []Role{RoleOperator, RoleAuthority}
+)
+
+func (authority *Authority) GetEndpoints() []Endpoint {
+	return append(authority.getV1Endpoints(), authority.getDeprecatedEndpoints()...)
+}
+
+func (authority *Authority) getV1Endpoints() []Endpoint {
+	v1 := RouteGroup{Prefix: V1Prefix, Envelope: true}
+	tasks := v1.Group("/tasks")
+	decryption := tasks.Group("/:taskId/decryption-params/:decryptionParamsId")
+
+	endpoints := tasks.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: authority.addTaskEndpoint, Roles: serverRoles,
+			Summary: "add a task, whose schema params are set up", Request: AuthorityTaskRequest{}, Status: http.StatusAccepted},
+		{Method: "GET", Path: "/:taskId/schema-status", Handler: authority.getSchemaParamsStatusEndpoint, Roles: serverRoles,
+			Summary: "the status of the task's schema params", Response: BodyText},
+		{Method: "GET", Path: "/:taskId/sensors/:sensorId/encryption-params", Handler: authority.getEncryptionParamsEndpoint, Roles: sensorRoles,
+			Summary: "the encryption params of the sensor, gob encoded", Response: BodyOctetStream},
+		{Method: "POST", Path: "/:taskId/rates", Handler: authority.addRatesEndpoint, Roles: serverRoles,
+			Summary: "derive the decryption params for the gob encoded rates; the response is their id",
+			Request: BodyOctetStream, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "POST", Path: "/:taskId/rates/partial", Handler: authority.addPartialRatesEndpoint, Roles: serverRoles,
+			Summary: "derive the decryption params restricted to the received ciphers; the response is their id",
+			Request: PartialRatesRequest{}, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "POST", Path: "/:taskId/rates/prefix", Handler: authority.addPrefixRatesEndpoint, Roles: serverRoles,
+			Summary: "derive the decryption params of the running total; the response is their id",
+			Request: PrefixRatesRequest{}, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "PUT", Path: "/:taskId/share", Handler: authority.addShareEndpoint, Roles: dealerRoles,
+			Summary: "hold the gob encoded share of the task's master secret", Request: BodyOctetStream, Status: http.StatusNoContent},
+		{Method: "POST", Path: "/:taskId/partial-keys", Handler: authority.getPartialKeyEndpoint, Roles: serverRoles,
+			Summary: "derive the partial key of the share for the gob encoded rates", Request: BodyOctetStream, Response: BodyOctetStream},
+	})
+
+	endpoints = append(endpoints, decryption.Endpoints([]Endpoint{
+		{Method: "GET", Path: "/", Handler: authority.getDecryptionParamsEndpoint, Roles: serverRoles,
+			Summary: "the decryption params, gob encoded", Response: BodyOctetStream},
+		{Method: "GET", Path: "/status", Handler: authority.getDecryptionParamsStatusEndpoint, Roles: serverRoles,
+			Summary: "the status of the decryption params", Response: new(string)},
+		{Method: "GET", Path: "/attestation", Handler: authority.getAttestationEndpoint, Roles: serverRoles,
+			Summary: "the signed attestation of the rates of the decryption params", Response: RatesAttestation{}},
+	})...)
+
+	return append(endpoints, v1.Endpoints([]Endpoint{
+		{Method: "GET", Path: "/shares", Handler: authority.getSharesEndpoint, Roles: serverRoles,
+			Summary: "the shares held", Response: ShareHolderStatus{}},
+		{Method: "GET", Path: "/rates", Handler: authority.getUnapprovedRatesEndpoint, Roles: serverRoles,
+			Summary: "the rates waiting for approval (not implemented)"},
+	})...)
+}
+
+// getDeprecatedEndpoints returns the unversioned endpoints, which the /v1 ones replace
+func (authority *Authority) getDeprecatedEndpoints() []Endpoint {
+	deprecated := RouteGroup{Deprecated: true}
+	rates := deprecated.Group("/rates")
+	decryption := deprecated.Group("/decryption/:taskId/:decryptionParamsId")
+	threshold := deprecated.Group("/threshold")
+
+	endpoints := deprecated.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/task", Handler: authority.addTaskEndpoint, Roles: serverRoles,
+			Summary: "add a task, whose schema params are set up", Request: AuthorityTaskRequest{}, Status: http.StatusAccepted},
+		//{Method: "GET", Path: "/task/:taskId", Handler: authority.getTaskDetailsEndpoint},
+
+		{Method: "GET", Path: "/schema-status/:taskId", Handler: authority.getSchemaParamsStatusEndpoint, Roles: serverRoles,
+			Summary: "the status of the task's schema params", Response: BodyText},
+		{Method: "GET", Path: "/decryption-status/:taskId/:decryptionParamsId", Handler: authority.getDecryptionParamsStatusEndpoint, Roles: serverRoles,
+			Summary: "the status of the decryption params", Response: new(string)},
+		{Method: "GET", Path: "/encryption/:taskId/:sensorId", Handler: authority.getEncryptionParamsEndpoint, Roles: sensorRoles,
+			Summary: "the encryption params of the sensor, gob encoded", Response: BodyOctetStream},
+	})
+
+	endpoints = append(endpoints, rates.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/:taskId", Handler: authority.addRatesEndpoint, Roles: serverRoles,
+			Summary: "derive the decryption params for the gob encoded rates; the response is their id",
+			Request: BodyOctetStream, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "POST", Path: "/:taskId/partial", Handler: authority.addPartialRatesEndpoint, Roles: serverRoles,
+			Summary: "derive the decryption params restricted to the received ciphers; the response is their id",
+			Request: PartialRatesRequest{}, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "POST", Path: "/:taskId/prefix", Handler: authority.addPrefixRatesEndpoint, Roles: serverRoles,
+			Summary: "derive the decryption params of the running total; the response is their id",
+			Request: PrefixRatesRequest{}, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "GET", Path: "/", Handler: authority.getUnapprovedRatesEndpoint, Roles: serverRoles,
+			Summary: "the rates waiting for approval (not implemented)"},
+		//{Method: "POST", Path: "/rates-approval/:taskId", Handler: authority.getApproveRatesEndpoint},
+	})...)
+
+	endpoints = append(endpoints, decryption.Endpoints([]Endpoint{
+		{Method: "GET", Path: "/", Handler: authority.getDecryptionParamsEndpoint, Roles: serverRoles,
+			Summary: "the decryption params, gob encoded", Response: BodyOctetStream},
+		{Method: "GET", Path: "/attestation", Handler: authority.getAttestationEndpoint, Roles: serverRoles,
+			Summary: "the signed attestation of the rates of the decryption params", Response: RatesAttestation{}},
+	})...)
+
+	return append(endpoints, threshold.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/:taskId/share", Handler: authority.addShareEndpoint, Roles: dealerRoles,
+			Summary: "hold the gob encoded share of the task's master secret", Request: BodyOctetStream, Status: http.StatusNoContent},
+		{Method: "POST", Path: "/:taskId/partial-key", Handler: authority.getPartialKeyEndpoint, Roles: serverRoles,
+			Summary: "derive the partial key of the share for the gob encoded rates", Request: BodyOctetStream, Response: BodyOctetStream},
+		{Method: "GET", Path: "/shares", Handler: authority.getSharesEndpoint, Roles: serverRoles,
+			Summary: "the shares held", Response: ShareHolderStatus{}},
+	})...)
 }
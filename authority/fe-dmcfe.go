@@ -0,0 +1,142 @@
+package authority
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"math/big"
+	"time"
+)
+
+//region DMCFEParamGenerator
+
+// DMCFEParamGenerator generates params for SchemeDMCFE. Every sample of a batch is encrypted by its own client,
+// so a sensor has BatchSize clients, and batches are told apart by their labels. The authority sets up all
+// the clients, so it is trusted just like with the other schemes.
+type DMCFEParamGenerator struct {
+	SensorCnt        int
+	BatchesPerSensor int
+	BatchSize        int
+	Label            string
+	Bound            *big.Int // of the result of a batch
+	Clients          []*fullysec.DMCFEClient
+
+	DecryptionKeyTime time.Duration
+
+	metrics *authorityMetrics
+	logger  *Logger
+}
+
+// setDMCFEParams creates DMCFEParamGenerator for the Task, and sets up the DMCFE clients of all the sensors
+func (t *Task) setDMCFEParams() bool {
+	t.logger.Info("using DMCFE")
+	clientCnt := len(t.SensorIds) * t.BatchSize
+
+	feParams := &DMCFEParamGenerator{
+		SensorCnt:        len(t.SensorIds),
+		BatchesPerSensor: t.BatchCnt,
+		BatchSize:        t.BatchSize,
+		Label:            string(t.Id),
+		Bound:            DMCFEBound(clientCnt, ValueBound(t.MinSampleValue, t.MaxSampleValue), ValueBound(t.MinRateValue, t.MaxRateValue)),
+		Clients:          make([]*fullysec.DMCFEClient, clientCnt),
+		metrics:          t.metrics,
+		logger:           GetLogger("fe param generator", t.logger),
+	}
+	t.FEParamGenerator = feParams
+
+	t.logger.Info("generating FE Master Key")
+	start := time.Now()
+	err := feParams.setupClients()
+	t.MasterSecKeyGenerationTime = time.Since(start)
+	t.logger.Info("elapsed: %d ns", t.MasterSecKeyGenerationTime.Nanoseconds())
+	t.metrics.keyGenerationTime.ObserveDuration(t.MasterSecKeyGenerationTime, SchemeDMCFE)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("FE Master key generation failed")
+		return false
+	}
+
+	t.logger.Info("FE Master key generation succeeded")
+	return true
+}
+
+// setupClients creates all the clients, and sets their shares from the public keys of all the clients
+func (g *DMCFEParamGenerator) setupClients() error {
+	pubKeys := make([]*bn256.G1, len(g.Clients))
+	for idx := range g.Clients {
+		client, err := fullysec.NewDMCFEClient(idx)
+		if err != nil {
+			return err
+		}
+		g.Clients[idx] = client
+		pubKeys[idx] = client.ClientPubKey
+	}
+
+	for _, client := range g.Clients {
+		if err := client.SetShare(pubKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *DMCFEParamGenerator) Scheme() string {
+	return SchemeDMCFE
+}
+
+func (g *DMCFEParamGenerator) GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
+	if sensorIdx < 0 || sensorIdx >= g.SensorCnt {
+		return nil, fmt.Errorf("sensorIdx out of range (%d sensors, got %d )", g.SensorCnt, sensorIdx)
+	}
+
+	clientKeys := make(data.Matrix, g.BatchSize)
+	for idx := range clientKeys {
+		clientKeys[idx] = g.Clients[sensorIdx*g.BatchSize+idx].S
+	}
+
+	return &DMCFEEncryptionParams{
+		SensorIdx:  sensorIdx,
+		ClientKeys: clientKeys,
+		Label:      g.Label,
+	}, nil
+}
+
+func (g *DMCFEParamGenerator) GetDecryptionParams(y []int) FEDecryptionParams {
+	if len(y) != g.BatchesPerSensor*g.BatchSize {
+		g.logger.Error("invalid rates count: expected %d, got %d", g.BatchesPerSensor*g.BatchSize, len(y))
+		return nil
+	}
+
+	rates, err := DMCFERates(y, g.SensorCnt, g.BatchSize)
+	if err != nil {
+		g.logger.Err(err)
+		return nil
+	}
+
+	g.logger.Info("deriving decryption key")
+	start := time.Now()
+	keys, err := DeriveDMCFEKeyShares(g.Clients, rates)
+	elapsed := time.Since(start)
+	g.DecryptionKeyTime = elapsed
+	g.metrics.deriveKeyTime.ObserveDuration(elapsed, g.Scheme())
+	g.logger.Info("elapsed: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		g.logger.Err(err)
+		g.logger.Error("deriving decryption key failed")
+		return nil
+	}
+
+	return &DMCFEDecryptionParams{
+		SensorCnt:      g.SensorCnt,
+		BatchCnt:       g.BatchesPerSensor,
+		BatchSize:      g.BatchSize,
+		Bound:          g.Bound,
+		Label:          g.Label,
+		DecryptionKeys: keys,
+		Rates:          rates,
+	}
+}
+
+//endregion
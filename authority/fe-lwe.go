@@ -0,0 +1,107 @@
+package authority
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"math/big"
+	"time"
+)
+
+//region LWEParamGenerator
+
+// LWEParamGenerator generates params for SchemeLWE; as the schema is single-input, the task has a single sensor that
+// submits a single batch, as with SingleFEParamGenerator
+type LWEParamGenerator struct {
+	Schema *fullysec.LWE
+	SecKey data.Matrix
+	PubKey data.Matrix
+
+	DecryptionKeyTime time.Duration
+
+	metrics *authorityMetrics
+	logger  *Logger
+}
+
+// setLWEParams creates LWEParamGenerator for the Task, instantiates fullysec.LWE schema and generates master keys
+func (t *Task) setLWEParams() bool {
+	t.logger.Info("using LWE")
+	feParams := &LWEParamGenerator{
+		metrics: t.metrics,
+		logger:  GetLogger("fe param generator", t.logger),
+	}
+	t.FEParamGenerator = feParams
+
+	boundX, boundY := t.getBounds()
+
+	t.logger.Info("generating FE Scheme")
+	schema, err := fullysec.NewLWE(t.BatchSize, t.config.LWESecLevel, boundX, boundY)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("generating FE Scheme failed")
+		return false
+	}
+	feParams.Schema = schema
+
+	t.logger.Info("generating FE Master Key")
+	start := time.Now()
+	feParams.SecKey, err = schema.GenerateSecretKey()
+	if err == nil {
+		feParams.PubKey, err = schema.GeneratePublicKey(feParams.SecKey)
+	}
+	t.MasterSecKeyGenerationTime = time.Since(start)
+	t.logger.Info("elapsed: %d ns", t.MasterSecKeyGenerationTime.Nanoseconds())
+	t.metrics.keyGenerationTime.ObserveDuration(t.MasterSecKeyGenerationTime, SchemeLWE)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("FE Master key generation failed")
+		return false
+	}
+
+	t.logger.Info("FE Master key generation succeeded")
+	return true
+}
+
+func (g *LWEParamGenerator) Scheme() string {
+	return SchemeLWE
+}
+
+func (g *LWEParamGenerator) GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
+	if sensorIdx != 0 {
+		return nil, fmt.Errorf("requested EncryptionParams for sensorIdx %d for LWEParamGenerator", sensorIdx)
+	}
+
+	return &LWEEncryptionParams{
+		PubKey:       g.PubKey,
+		SchemaParams: g.Schema.Params,
+	}, nil
+}
+
+func (g *LWEParamGenerator) GetDecryptionParams(y []int) FEDecryptionParams {
+	bigY := make(data.Vector, len(y))
+	for idx, val := range y {
+		bigY[idx] = big.NewInt(int64(val))
+	}
+
+	g.logger.Info("deriving decryption key")
+	start := time.Now()
+	fk, err := g.Schema.DeriveKey(bigY, g.SecKey)
+	elapsed := time.Since(start)
+	g.DecryptionKeyTime = elapsed
+	g.metrics.deriveKeyTime.ObserveDuration(elapsed, g.Scheme())
+	g.logger.Info("elapsed: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		g.logger.Err(err)
+		g.logger.Error("deriving decryption key failed")
+		return nil
+	}
+
+	return &LWEDecryptionParams{
+		SchemaParams:  *g.Schema.Params,
+		DecryptionKey: fk,
+		Rates:         bigY,
+	}
+}
+
+//endregion
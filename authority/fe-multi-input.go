@@ -0,0 +1,233 @@
+package authority
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"slices"
+	"time"
+)
+
+//region DamgardMultiParamGenerator
+
+// DamgardMultiParamGenerator generates params for SchemeDamgardMulti; every batch of every sensor is a client
+// of the scheme, as with MultiFEParamGenerator
+type DamgardMultiParamGenerator struct {
+	SensorCnt        int
+	BatchesPerSensor int
+	Schema           *fullysec.DamgardMulti
+	SecKeys          *fullysec.DamgardMultiSecKeys
+
+	DecryptionKeyTime time.Duration
+
+	metrics *authorityMetrics
+	logger  *Logger
+}
+
+// setDamgardMultiParams creates DamgardMultiParamGenerator for the Task, instantiates fullysec.DamgardMulti schema
+// and generates master keys
+func (t *Task) setDamgardMultiParams() bool {
+	t.logger.Info("using DamgardMulti")
+	feParams := &DamgardMultiParamGenerator{
+		SensorCnt:        len(t.SensorIds),
+		BatchesPerSensor: t.BatchCnt,
+		metrics:          t.metrics,
+		logger:           GetLogger("fe param generator", t.logger),
+	}
+	t.FEParamGenerator = feParams
+
+	// the schema has a single bound for both samples and rates
+	boundX, boundY := t.getBounds()
+	bound := boundX
+	if boundY.Cmp(bound) > 0 {
+		bound = boundY
+	}
+
+	t.logger.Info("generating FE Scheme")
+	schema, err := fullysec.NewDamgardMultiPrecomp(feParams.SensorCnt*feParams.BatchesPerSensor, t.BatchSize,
+		t.config.DamgardModulusLength, bound)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("generating FE Scheme failed")
+		return false
+	}
+	feParams.Schema = schema
+
+	t.logger.Info("generating FE Master Key")
+	start := time.Now()
+	feParams.SecKeys, err = schema.GenerateMasterKeys()
+	t.MasterSecKeyGenerationTime = time.Since(start)
+	t.logger.Info("elapsed: %d ns", t.MasterSecKeyGenerationTime.Nanoseconds())
+	t.metrics.keyGenerationTime.ObserveDuration(t.MasterSecKeyGenerationTime, SchemeDamgardMulti)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("FE Master key generation failed")
+		return false
+	}
+
+	t.logger.Info("FE Master key generation succeeded")
+	return true
+}
+
+func (g *DamgardMultiParamGenerator) Scheme() string {
+	return SchemeDamgardMulti
+}
+
+func (g *DamgardMultiParamGenerator) GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
+	if sensorIdx < 0 || sensorIdx >= g.SensorCnt {
+		return nil, fmt.Errorf("sensorIdx out of range (%d sensors, got %d )", g.SensorCnt, sensorIdx)
+	}
+
+	from, to := sensorIdx*g.BatchesPerSensor, (sensorIdx+1)*g.BatchesPerSensor
+	return &DamgardMultiEncryptionParams{
+		IdxOffset:    from,
+		Bound:        g.Schema.Bound,
+		PubKeys:      g.SecKeys.Mpk[from:to],
+		Otps:         slices.Clone(g.SecKeys.Otp[from:to]), // the dealer discards them in the threshold mode
+		SchemaParams: g.Schema.Params,
+	}, nil
+}
+
+func (g *DamgardMultiParamGenerator) GetDecryptionParams(y []int) FEDecryptionParams {
+	if g.SecKeys.Msk == nil {
+		g.logger.Error("FE Master Key is split among share holders")
+		return nil
+	}
+
+	matrix, err := NewMatrix(g.BatchesPerSensor*g.SensorCnt, y, g.SensorCnt)
+	if err != nil {
+		g.logger.Err(err)
+		return nil
+	}
+
+	g.logger.Info("deriving decryption key")
+	start := time.Now()
+	fk, err := g.Schema.DeriveKey(g.SecKeys, matrix)
+	elapsed := time.Since(start)
+	g.DecryptionKeyTime = elapsed
+	g.metrics.deriveKeyTime.ObserveDuration(elapsed, g.Scheme())
+	g.logger.Info("elapsed: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		g.logger.Err(err)
+		g.logger.Error("deriving decryption key failed")
+		return nil
+	}
+
+	return &DamgardMultiDecryptionParams{
+		NumClients:    g.Schema.NumClients,
+		Bound:         g.Schema.Bound,
+		SchemaParams:  *g.Schema.Params,
+		DecryptionKey: fk,
+		Rates:         matrix,
+	}
+}
+
+//endregion
+
+//region PaillierMultiParamGenerator
+
+// PaillierMultiParamGenerator generates params for SchemePaillierMulti; every batch of every sensor is a client
+// of the scheme, as with MultiFEParamGenerator
+type PaillierMultiParamGenerator struct {
+	SensorCnt        int
+	BatchesPerSensor int
+	Schema           *fullysec.PaillierMulti
+	SecKeys          *fullysec.PaillierMultiSecKeys
+
+	DecryptionKeyTime time.Duration
+
+	metrics *authorityMetrics
+	logger  *Logger
+}
+
+// setPaillierMultiParams creates PaillierMultiParamGenerator for the Task, instantiates fullysec.PaillierMulti schema
+// and generates master keys
+func (t *Task) setPaillierMultiParams() bool {
+	t.logger.Info("using PaillierMulti")
+	feParams := &PaillierMultiParamGenerator{
+		SensorCnt:        len(t.SensorIds),
+		BatchesPerSensor: t.BatchCnt,
+		metrics:          t.metrics,
+		logger:           GetLogger("fe param generator", t.logger),
+	}
+	t.FEParamGenerator = feParams
+
+	boundX, boundY := t.getBounds()
+
+	t.logger.Info("generating FE Scheme")
+	schema, err := fullysec.NewPaillierMulti(feParams.SensorCnt*feParams.BatchesPerSensor, t.BatchSize,
+		t.config.PaillierLambda, t.config.PaillierBitLength, boundX, boundY)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("generating FE Scheme failed")
+		return false
+	}
+	feParams.Schema = schema
+
+	t.logger.Info("generating FE Master Key")
+	start := time.Now()
+	feParams.SecKeys, err = schema.GenerateMasterKeys()
+	t.MasterSecKeyGenerationTime = time.Since(start)
+	t.logger.Info("elapsed: %d ns", t.MasterSecKeyGenerationTime.Nanoseconds())
+	t.metrics.keyGenerationTime.ObserveDuration(t.MasterSecKeyGenerationTime, SchemePaillierMulti)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("FE Master key generation failed")
+		return false
+	}
+
+	t.logger.Info("FE Master key generation succeeded")
+	return true
+}
+
+func (g *PaillierMultiParamGenerator) Scheme() string {
+	return SchemePaillierMulti
+}
+
+func (g *PaillierMultiParamGenerator) GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
+	if sensorIdx < 0 || sensorIdx >= g.SensorCnt {
+		return nil, fmt.Errorf("sensorIdx out of range (%d sensors, got %d )", g.SensorCnt, sensorIdx)
+	}
+
+	from, to := sensorIdx*g.BatchesPerSensor, (sensorIdx+1)*g.BatchesPerSensor
+	return &PaillierMultiEncryptionParams{
+		IdxOffset:    from,
+		BoundX:       g.Schema.BoundX,
+		BoundY:       g.Schema.BoundY,
+		PubKeys:      g.SecKeys.Mpk[from:to],
+		Otps:         g.SecKeys.Otp[from:to],
+		SchemaParams: g.Schema.Params,
+	}, nil
+}
+
+func (g *PaillierMultiParamGenerator) GetDecryptionParams(y []int) FEDecryptionParams {
+	matrix, err := NewMatrix(g.BatchesPerSensor*g.SensorCnt, y, g.SensorCnt)
+	if err != nil {
+		g.logger.Err(err)
+		return nil
+	}
+
+	g.logger.Info("deriving decryption key")
+	start := time.Now()
+	fk, err := g.Schema.DeriveKey(g.SecKeys, matrix)
+	elapsed := time.Since(start)
+	g.DecryptionKeyTime = elapsed
+	g.metrics.deriveKeyTime.ObserveDuration(elapsed, g.Scheme())
+	g.logger.Info("elapsed: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		g.logger.Err(err)
+		g.logger.Error("deriving decryption key failed")
+		return nil
+	}
+
+	return &PaillierMultiDecryptionParams{
+		NumClients:    g.Schema.NumClients,
+		BoundX:        g.Schema.BoundX,
+		BoundY:        g.Schema.BoundY,
+		SchemaParams:  *g.Schema.Params,
+		DecryptionKey: fk,
+		Rates:         matrix,
+	}
+}
+
+//endregion
@@ -15,6 +15,7 @@ import (
 type FEParamGenerator interface {
 	GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error)
 	GetDecryptionParams(y []int) FEDecryptionParams
+	Scheme() string
 }
 
 //endregion
@@ -27,7 +28,12 @@ type SingleFEParamGenerator struct {
 
 	DecryptionKeyTime time.Duration
 
-	logger *Logger
+	metrics *authorityMetrics
+	logger  *Logger
+}
+
+func (g *SingleFEParamGenerator) Scheme() string {
+	return SchemeFHIPE
 }
 
 func (g *SingleFEParamGenerator) GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
@@ -54,6 +60,7 @@ func (g *SingleFEParamGenerator) GetDecryptionParams(y []int) FEDecryptionParams
 	fk, err := schema.DeriveKey(data.NewVector(bigY), g.SecKey)
 	elapsed := time.Since(start)
 	g.DecryptionKeyTime = elapsed
+	g.metrics.deriveKeyTime.ObserveDuration(elapsed, g.Scheme())
 	g.logger.Info("elapsed: %d ns", elapsed.Nanoseconds())
 	if err != nil {
 		g.logger.Err(err)
@@ -80,7 +87,12 @@ type MultiFEParamGenerator struct {
 
 	DecryptionKeyTime time.Duration
 
-	logger *Logger
+	metrics *authorityMetrics
+	logger  *Logger
+}
+
+func (g *MultiFEParamGenerator) Scheme() string {
+	return SchemeFHMultiIPE
 }
 
 func (g *MultiFEParamGenerator) GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
@@ -88,17 +100,18 @@ func (g *MultiFEParamGenerator) GetEncryptionParams(sensorIdx int) (FEEncryption
 		return nil, fmt.Errorf("sensorIdx out of range (%d sensors, got %d )", g.SensorCnt, sensorIdx)
 	}
 
+	// overwrite SchemaParams.NumClients with BatchesPerSensor, on a copy, as the decryption params need NumClients
+	// of all the sensors; this won't make a difference, as this param is not used in the encryption process !!!
+	schemaParams := *g.SchemaParams
+	schemaParams.NumClients = g.BatchesPerSensor
+
 	// every sensor submits batchCnt batches of samples, so it needs exactly BatchesPerSensor SecKeys
 	encryptionParams := &MultiFEEncryptionParams{
 		IdxOffset:    sensorIdx * g.BatchesPerSensor,
 		SecKeys:      g.SecKey.BHat[sensorIdx*g.BatchesPerSensor : (sensorIdx+1)*g.BatchesPerSensor],
-		SchemaParams: g.SchemaParams,
+		SchemaParams: &schemaParams,
 	}
 
-	// overwrite SchemaParams.NumClients with BatchesPerSensor
-	// this won't make a difference, as this param is not used in the encryption process !!!
-	encryptionParams.SchemaParams.NumClients = g.BatchesPerSensor
-
 	return encryptionParams, nil
 }
 
@@ -112,6 +125,7 @@ func (g *MultiFEParamGenerator) GetDecryptionParams(y []int) FEDecryptionParams
 	fk, err := schema.DeriveKey(matrix, g.SecKey)
 	elapsed := time.Since(start)
 	g.DecryptionKeyTime = elapsed
+	g.metrics.deriveKeyTime.ObserveDuration(elapsed, g.Scheme())
 	g.logger.Info("elapsed: %d ns", elapsed.Nanoseconds())
 	if err != nil {
 		g.logger.Err(err)
@@ -131,30 +145,37 @@ func (g *MultiFEParamGenerator) GetDecryptionParams(y []int) FEDecryptionParams
 // region DummyGenerator
 
 type DummyGenerator struct {
-	BatchCnt  int
-	BatchSize int
+	SensorCnt        int
+	BatchesPerSensor int
+	BatchSize        int
 
 	logger *Logger
 }
 
+func (g *DummyGenerator) Scheme() string {
+	return SchemeDummy
+}
+
 func (g *DummyGenerator) GetEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
-	if sensorIdx != 0 {
-		return nil, fmt.Errorf("requested EncryptionParams for sensorIdx %d for SingleFEParamGenerator", sensorIdx)
+	if sensorIdx < 0 || sensorIdx >= g.SensorCnt {
+		return nil, fmt.Errorf("sensorIdx out of range (%d sensors, got %d )", g.SensorCnt, sensorIdx)
 	}
 
-	return &DummyEncryptionParams{}, nil
+	return &DummyEncryptionParams{IdxOffset: sensorIdx * g.BatchesPerSensor}, nil
 }
 
 func (g *DummyGenerator) GetDecryptionParams(y []int) FEDecryptionParams {
-	matrix := make([][]*big.Int, g.BatchCnt)
-	for i := 0; i < g.BatchCnt; i++ {
+	// rates are the same for every sensor, as with MultiFEParamGenerator
+	batchCnt := g.SensorCnt * g.BatchesPerSensor
+	matrix := make([][]*big.Int, batchCnt)
+	for i := 0; i < batchCnt; i++ {
 		matrix[i] = make([]*big.Int, g.BatchSize)
 		for j := 0; j < g.BatchSize; j++ {
-			matrix[i][j] = big.NewInt(int64(y[i*g.BatchCnt+j]))
+			matrix[i][j] = big.NewInt(int64(y[(i%g.BatchesPerSensor)*g.BatchSize+j]))
 		}
 	}
 
-	return DummyDecryptionParams{BatchCnt: g.BatchCnt, Rates: matrix}
+	return &DummyDecryptionParams{BatchCnt: batchCnt, Rates: matrix}
 }
 
 //endregion
@@ -0,0 +1,20 @@
+package authority
+
+import (
+	. "fe/common"
+)
+
+// authorityMetrics are the metrics of the Authority, labeled by FE scheme
+type authorityMetrics struct {
+	keyGenerationTime *Histogram
+	deriveKeyTime     *Histogram
+}
+
+func newAuthorityMetrics(registry *MetricsRegistry) *authorityMetrics {
+	return &authorityMetrics{
+		keyGenerationTime: registry.NewHistogram("fe_keygen_duration_seconds", "Time spent generating FE master keys.",
+			DurationBuckets, "scheme"),
+		deriveKeyTime: registry.NewHistogram("fe_derive_key_duration_seconds", "Time spent deriving FE decryption keys.",
+			DurationBuckets, "scheme"),
+	}
+}
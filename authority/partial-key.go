@@ -0,0 +1,220 @@
+package authority
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"github.com/fentec-project/gofe/sample"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// When some batches of a task are never received, the key derived for all the ciphers can't decrypt the rest of
+// them, so the server asks for a key restricted to the received ciphers. As keys for different subsets of the
+// ciphers would reveal the inner products of the differences, at most one restricted key is derived per task, only
+// for the rates of the task's key, and only if enough ciphers have been received. The prefix keys of the running
+// total are restricted keys too (see progress.go), so the received ciphers after the last prefix must make at least
+// a window, if there are any.
+
+// PartialKeyGenerator is implemented by the FEParamGenerators that can derive keys restricted to a subset of
+// the ciphers
+type PartialKeyGenerator interface {
+	// GetPartialDecryptionParams derives the decryption params for rates y, with the missing ciphers' rates zeroed
+	GetPartialDecryptionParams(y []int, missing []bool) (FEDecryptionParams, error)
+}
+
+//region policy
+
+// AddPartialDecryptionParams checks the request against the authority's policy, and generates the decryption params
+// restricted to the received ciphers. Returns a UUID of the decryption params.
+func (t *Task) AddPartialDecryptionParams(request PartialRatesRequest) (UUID, error) {
+	if !t.config.AllowPartialKeys {
+		return "", fmt.Errorf("restricted keys are disabled")
+	}
+	generator, ok := t.FEParamGenerator.(PartialKeyGenerator)
+	if !ok {
+		return "", fmt.Errorf("scheme %s doesn't support restricted keys", t.Scheme)
+	}
+
+	if err := t.checkDerivedRates(request.Rates); err != nil {
+		return "", err
+	}
+
+	cipherCnt := len(t.SensorIds) * t.BatchCnt
+	missing := make([]bool, cipherCnt)
+	for _, idx := range request.MissingCiphers {
+		if idx < 0 || idx >= cipherCnt {
+			return "", fmt.Errorf("cipher no %d out of range (%d ciphers)", idx, cipherCnt)
+		}
+		if missing[idx] {
+			return "", fmt.Errorf("cipher no %d is listed as missing more than once", idx)
+		}
+		missing[idx] = true
+	}
+
+	receivedCnt := cipherCnt - len(request.MissingCiphers)
+	if coverage := float64(receivedCnt) / float64(cipherCnt); receivedCnt == 0 || coverage < t.config.MinPartialCoverage {
+		return "", fmt.Errorf("only %d of %d ciphers received, at least %g of them are required", receivedCnt, cipherCnt, t.config.MinPartialCoverage)
+	}
+
+	if lastPrefix := t.lastPrefix(); lastPrefix > 0 {
+		afterPrefixCnt := 0
+		for idx := range missing {
+			if !missing[idx] && idx%t.BatchCnt >= lastPrefix {
+				afterPrefixCnt++
+			}
+		}
+		if afterPrefixCnt > 0 && afterPrefixCnt < t.ProgressWindow {
+			return "", fmt.Errorf("only %d ciphers received after the running total of %d batches, at least %d are required", afterPrefixCnt, lastPrefix, t.ProgressWindow)
+		}
+	}
+
+	if !t.partialKeyRequested.CompareAndSwap(false, true) {
+		return "", fmt.Errorf("a restricted key has already been derived for the task")
+	}
+
+	t.logger.Info("deriving key restricted to %d of %d ciphers", receivedCnt, cipherCnt)
+	return t.deriveRestrictedParams(generator, request.Rates, missing), nil
+}
+
+// checkDerivedRates returns an error unless rates are the rates of the task's last decryption key
+func (t *Task) checkDerivedRates(rates []int) error {
+	t.ratesMutex.Lock()
+	derivedRates := t.derivedRates
+	t.ratesMutex.Unlock()
+	if derivedRates == nil {
+		return fmt.Errorf("no decryption key has been derived for the task")
+	}
+	if !slices.Equal(rates, derivedRates) {
+		return fmt.Errorf("rates differ from the rates of the task's decryption key")
+	}
+	return nil
+}
+
+// deriveRestrictedParams generates the decryption params restricted to the ciphers that aren't missing, in the
+// background, and returns their UUID
+func (t *Task) deriveRestrictedParams(generator PartialKeyGenerator, rates []int, missing []bool) UUID {
+	decryptionParamsId := NewUUID()
+	t.decryptionParamsStatus.Store(decryptionParamsId, StatusCreated)
+
+	go func(task *Task) {
+		decryptionParams, err := generator.GetPartialDecryptionParams(rates, missing)
+		if err != nil {
+			task.logger.Err(err)
+			task.decryptionParamsStatus.Store(decryptionParamsId, StatusError)
+			return
+		}
+		task.logger.Info("restricted decryption key derived successfully")
+		if err = task.attest(decryptionParamsId, decryptionParams, rates, missing); err != nil {
+			task.logger.Err(err)
+			task.decryptionParamsStatus.Store(decryptionParamsId, StatusError)
+			return
+		}
+
+		task.decryptionParamsStatus.Store(decryptionParamsId, StatusReady)
+		task.decryptionParams.Store(decryptionParamsId, decryptionParams)
+	}(t)
+
+	return decryptionParamsId
+}
+
+//endregion
+
+//region MultiFEParamGenerator
+
+func (g *MultiFEParamGenerator) GetPartialDecryptionParams(y []int, missing []bool) (FEDecryptionParams, error) {
+	matrix, err := NewMatrix(g.BatchesPerSensor*g.SensorCnt, y, g.SensorCnt)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range matrix {
+		if missing[idx] {
+			matrix[idx] = data.NewConstantVector(len(matrix[idx]), big.NewInt(0))
+		}
+	}
+
+	g.logger.Info("deriving restricted decryption key")
+	start := time.Now()
+	fk, err := deriveRestrictedFHMultiIPEKey(g.SchemaParams, matrix, g.SecKey, missing)
+	elapsed := time.Since(start)
+	g.metrics.deriveKeyTime.ObserveDuration(elapsed, g.Scheme())
+	g.logger.Info("elapsed: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		return nil, fmt.Errorf("deriving restricted decryption key failed: %s", err)
+	}
+
+	return &MultiFEDecryptionParams{
+		SchemaParams:  *g.SchemaParams,
+		DecryptionKey: fk,
+		PubKey:        g.PubKey,
+	}, nil
+}
+
+// deriveRestrictedFHMultiIPEKey is FHMultiIPE.DeriveKey, with the random gammas that cancel out in the sum of the
+// pairings spread only over the received ciphers; the parts of the key for the missing ciphers are zero
+func deriveRestrictedFHMultiIPEKey(params *MultiFESchemaParams, y data.Matrix, secKey *fullysec.FHMultiIPESecKey, missing []bool) (data.MatrixG2, error) {
+	gamma, err := data.NewRandomMatrix(params.SecLevel, params.NumClients, sample.NewUniform(bn256.Order))
+	if err != nil {
+		return nil, err
+	}
+
+	last := -1
+	for i := 0; i < params.NumClients; i++ {
+		if missing[i] {
+			for k := range gamma {
+				gamma[k][i] = big.NewInt(0)
+			}
+		} else {
+			last = i
+		}
+	}
+	if last == -1 {
+		return nil, fmt.Errorf("no ciphers received")
+	}
+
+	sum := big.NewInt(0)
+	for i := 0; i < last; i++ {
+		sum.Add(sum, gamma[0][i])
+	}
+	gamma[0][last] = sum.Neg(sum).Mod(sum, bn256.Order)
+
+	keyLen := 2*params.VecLen + 2*params.SecLevel + 1
+	keyMat := make(data.Matrix, params.NumClients)
+	var s *big.Int
+	for i := 0; i < params.NumClients; i++ {
+		keyMat[i] = data.NewConstantVector(keyLen, big.NewInt(0))
+		for j := 0; j < params.VecLen+params.SecLevel; j++ {
+			if j < params.VecLen {
+				s = y[i][j]
+			} else {
+				s = gamma[j-params.VecLen][i]
+			}
+
+			keyMat[i] = keyMat[i].Add(secKey.BStarHat[i][j].MulScalar(s))
+			keyMat[i] = keyMat[i].Mod(bn256.Order)
+		}
+	}
+
+	return keyMat.MulG2(), nil
+}
+
+//endregion
+
+//region DummyGenerator
+
+func (g *DummyGenerator) GetPartialDecryptionParams(y []int, missing []bool) (FEDecryptionParams, error) {
+	params := g.GetDecryptionParams(y).(*DummyDecryptionParams)
+	for idx := range params.Rates {
+		if missing[idx] {
+			for j := range params.Rates[idx] {
+				params.Rates[idx][j] = big.NewInt(0)
+			}
+		}
+	}
+	return params, nil
+}
+
+//endregion
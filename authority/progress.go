@@ -0,0 +1,77 @@
+package authority
+
+import (
+	. "fe/common"
+	"fmt"
+)
+
+// With the running total enabled, the server publishes the bill after every ProgressWindow batches, decrypted with
+// keys restricted to the first batches of every sensor (prefix keys). The difference of two consecutive prefix
+// results is the total of a window of all the sensors, so the window can't be shorter than MinProgressWindow, and
+// the prefix keys are derived only at the ends of the windows, once each, for the rates of the task's key.
+
+// checkProgressWindow returns an error if the running total of the task can't be enabled
+func (t *Task) checkProgressWindow() error {
+	if t.ProgressWindow < 0 {
+		return fmt.Errorf("progress window can't be negative")
+	}
+	if !SupportsProgress(t.Scheme) {
+		return fmt.Errorf("scheme %s doesn't support running totals", t.Scheme)
+	}
+	if t.ProgressWindow < t.config.MinProgressWindow {
+		return fmt.Errorf("progress window is %d batches, at least %d are required", t.ProgressWindow, t.config.MinProgressWindow)
+	}
+	if t.ProgressWindow >= t.BatchCnt {
+		return fmt.Errorf("progress window must be shorter than the task (%d batches)", t.BatchCnt)
+	}
+	return nil
+}
+
+// AddPrefixDecryptionParams checks the request against the task's progress window, and generates the decryption
+// params restricted to the first request.Batches batches of every sensor. Returns a UUID of the decryption params.
+func (t *Task) AddPrefixDecryptionParams(request PrefixRatesRequest) (UUID, error) {
+	if t.ProgressWindow == 0 {
+		return "", fmt.Errorf("running total isn't enabled for the task")
+	}
+	generator, ok := t.FEParamGenerator.(PartialKeyGenerator)
+	if !ok {
+		return "", fmt.Errorf("scheme %s doesn't support restricted keys", t.Scheme)
+	}
+
+	if request.Batches <= 0 || request.Batches >= t.BatchCnt || request.Batches%t.ProgressWindow != 0 {
+		return "", fmt.Errorf("prefix of %d batches isn't the end of a window of %d batches", request.Batches, t.ProgressWindow)
+	}
+	if err := t.checkDerivedRates(request.Rates); err != nil {
+		return "", err
+	}
+
+	t.ratesMutex.Lock()
+	derived := t.prefixKeys[request.Batches]
+	t.prefixKeys[request.Batches] = true
+	t.ratesMutex.Unlock()
+	if derived {
+		return "", fmt.Errorf("prefix key of %d batches has already been derived", request.Batches)
+	}
+
+	missing := make([]bool, len(t.SensorIds)*t.BatchCnt)
+	for idx := range missing {
+		missing[idx] = idx%t.BatchCnt >= request.Batches
+	}
+
+	t.logger.Info("deriving prefix key of %d of %d batches", request.Batches, t.BatchCnt)
+	return t.deriveRestrictedParams(generator, request.Rates, missing), nil
+}
+
+// lastPrefix returns the batch count of the longest prefix key derived for the task, or 0
+func (t *Task) lastPrefix() int {
+	t.ratesMutex.Lock()
+	defer t.ratesMutex.Unlock()
+
+	last := 0
+	for batches := range t.prefixKeys {
+		if batches > last {
+			last = batches
+		}
+	}
+	return last
+}
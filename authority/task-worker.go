@@ -1,14 +1,43 @@
 package authority
 
-// StartTaskWorker starts a taskWorker goroutine for provided Task
-func StartTaskWorker(task *Task) {
-	go taskWorker(task)
+import (
+	. "fe/common"
+	"fmt"
+)
+
+// StartTaskWorker starts a taskWorker as a Runnable goroutine for provided Task
+func StartTaskWorker(task *Task) *Runnable {
+	taskWorkerHandle := NewRunnable("task worker "+string(task.Id), task.clock, task.logger)
+	go taskWorker(taskWorkerHandle, task)
+	return taskWorkerHandle
 }
 
-// taskWorker submits Task to its sensors and derives the decryption key
-func taskWorker(task *Task) {
+// taskWorker generates FE schema params and master keys for the Task
+func taskWorker(r *Runnable, task *Task) {
+	if exiting := r.Start(); exiting {
+		r.Close()
+		return
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		// Generating FE params
+		done <- task.SetFEParams()
+	}()
 
-	// Generating FE params
-	_ = task.SetFEParams()
+	for {
+		select {
+		case ok := <-done:
+			if ok {
+				r.Done()
+			} else {
+				r.Fail(fmt.Errorf("generating fe params failed"))
+			}
 
+		case <-r.ExitChan:
+			// key generation can't be interrupted; if it is still in progress, it finishes in the background
+			r.Close()
+			return
+		}
+	}
 }
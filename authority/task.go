@@ -15,28 +15,55 @@ type Task struct {
 	Id     UUID   `json:"id"`
 	Status string `json:"status"`
 
-	SensorIds           []UUID `json:"sensorIds" default:"nil"`
+	SensorIds           []UUID `json:"sensor_ids" default:"nil"`
 	SensorFetchedParams []atomic.Bool
 
 	// creation parameters
 	BatchParams
 
+	// the bounds are fixed-point encoded, so samples and rates can be negative
+	MinSampleValue int
 	MaxSampleValue int
+	MinRateValue   int
 	MaxRateValue   int
 
 	EnableEncryption bool
+	Scheme           string
+
+	// ShareHolders are set only in the threshold mode
+	ShareHolders []IP
+	Threshold    int
+
+	// ProgressWindow is the number of batches between the prefix keys of the running total; 0 if it's disabled
+	ProgressWindow int
+
 	FEParamGenerator
 	schemaParamsStatus         atomic.Value
 	MasterSecKeyGenerationTime time.Duration
 
 	decryptionParams       sync.Map
 	decryptionParamsStatus sync.Map
-
-	logger *Logger
+	attestations           sync.Map // *RatesAttestation by decryption params id, see attestation.go
+
+	// derivedRates are the rates of the task's decryption key, which is derived only once; a key restricted to the
+	// received ciphers is derived only for them, and only once (see partial-key.go)
+	derivedRates        []int
+	ratesMutex          sync.Mutex
+	fullKeyRequested    atomic.Bool
+	partialKeyRequested atomic.Bool
+	prefixKeys          map[int]bool // by batch count, guarded by ratesMutex (see progress.go)
+
+	config  *AuthorityConfig
+	signer  *Signer
+	clock   Clock
+	metrics *authorityMetrics
+	logger  *Logger
+
+	shareHolderCredential string // see Authority.shareHolderCredential
 }
 
 // NewTask creates a new Task from common.AuthorityTaskRequest
-func NewTask(taskRequest AuthorityTaskRequest) *Task {
+func (authority *Authority) NewTask(taskRequest AuthorityTaskRequest) *Task {
 	task := &Task{
 		Id:                  taskRequest.Id,
 		Status:              "created",
@@ -45,22 +72,41 @@ func NewTask(taskRequest AuthorityTaskRequest) *Task {
 
 		BatchParams: taskRequest.BatchParams,
 
+		MinSampleValue: taskRequest.MinSampleValue,
 		MaxSampleValue: taskRequest.MaxSampleValue,
+		MinRateValue:   taskRequest.MinTariffValue,
 		MaxRateValue:   taskRequest.MaxTariffValue,
 
 		EnableEncryption: taskRequest.EnableEncryption,
+		Scheme:           taskRequest.Scheme,
 
-		logger: GetLoggerForFile("", string(taskRequest.Id)),
+		ShareHolders: taskRequest.ShareHolders,
+		Threshold:    taskRequest.Threshold,
+
+		ProgressWindow: taskRequest.ProgressWindow,
+		prefixKeys:     make(map[int]bool),
+
+		config:  authority.config,
+		signer:  authority.Signer,
+		clock:   authority.Clock,
+		metrics: authority.metrics,
+		logger:  GetLoggerForFile("", string(taskRequest.Id)).WithField(TaskIdField, taskRequest.Id),
+
+		shareHolderCredential: authority.shareHolderCredential,
+	}
+	if task.Scheme == "" {
+		task.Scheme = DefaultScheme(task.EnableEncryption, len(task.SensorIds), task.BatchCnt)
 	}
+
 	taskRequestJson, _ := json.MarshalIndent(taskRequest, "", "  ")
 	task.logger.Info("Task params: %s", string(taskRequestJson))
 	return task
 }
 
-// getBounds calculates vector element bounds needed for FE schema generation
+// getBounds calculates the bounds of the absolute values of vector elements needed for FE schema generation
 func (t *Task) getBounds() (*big.Int, *big.Int) {
-	boundX := big.NewInt(int64(t.MaxSampleValue))
-	boundY := big.NewInt(int64(t.MaxRateValue))
+	boundX := big.NewInt(int64(ValueBound(t.MinSampleValue, t.MaxSampleValue)))
+	boundY := big.NewInt(int64(ValueBound(t.MinRateValue, t.MaxRateValue)))
 	return boundX, boundY
 }
 
@@ -77,12 +123,27 @@ func (t *Task) SetFEParams() bool {
 	var ok bool
 	t.schemaParamsStatus.Store(StatusCreated)
 
-	if !t.EnableEncryption {
+	switch t.Scheme {
+	case SchemeDummy:
 		ok = t.setDummyParams()
-	} else if t.BatchCnt == 1 {
+	case SchemeFHIPE:
 		ok = t.setSingleFEParams()
-	} else {
+	case SchemeFHMultiIPE:
 		ok = t.setMultiFEParams()
+	case SchemeDamgardMulti:
+		ok = t.setDamgardMultiParams()
+	case SchemePaillierMulti:
+		ok = t.setPaillierMultiParams()
+	case SchemeLWE:
+		ok = t.setLWEParams()
+	case SchemeDMCFE:
+		ok = t.setDMCFEParams()
+	default:
+		t.logger.Error("unknown scheme %s", t.Scheme)
+	}
+
+	if ok && t.Threshold > 0 {
+		ok = t.distributeShares()
 	}
 
 	if ok {
@@ -99,6 +160,7 @@ func (t *Task) setSingleFEParams() bool {
 	t.logger.Info("using SingleFE")
 	feParams := new(SingleFEParamGenerator)
 	t.FEParamGenerator = feParams
+	feParams.metrics = t.metrics
 	feParams.logger = GetLogger("fe param generator", t.logger)
 	t.logger = GetLogger("fe param generator", t.logger)
 
@@ -124,6 +186,7 @@ func (t *Task) setSingleFEParams() bool {
 	feParams.SecKey, err = schema.GenerateMasterKey()
 	t.MasterSecKeyGenerationTime = time.Since(start)
 	t.logger.Info("elapsed: %d ns", t.MasterSecKeyGenerationTime.Nanoseconds())
+	t.metrics.keyGenerationTime.ObserveDuration(t.MasterSecKeyGenerationTime, SchemeFHIPE)
 	if err != nil {
 		t.logger.Err(err)
 		t.logger.Error("FE Master key generation failed")
@@ -138,6 +201,7 @@ func (t *Task) setSingleFEParams() bool {
 func (t *Task) setMultiFEParams() bool {
 	t.logger.Info("using MultiFE")
 	feParams := new(MultiFEParamGenerator)
+	feParams.metrics = t.metrics
 	feParams.logger = GetLogger("fe param generator", t.logger)
 	t.FEParamGenerator = feParams
 	t.logger = GetLogger("fe param generator", t.logger)
@@ -148,7 +212,7 @@ func (t *Task) setMultiFEParams() bool {
 
 	// generate FHIPE schema
 	t.logger.Info("generating FE Scheme")
-	schema := fullysec.NewFHMultiIPE(FHMultiIPESecLevel, vectorCnt, vectorLen, boundX, boundY)
+	schema := fullysec.NewFHMultiIPE(t.config.FHMultiIPESecLevel, vectorCnt, vectorLen, boundX, boundY)
 	t.logger.Info("setting FE Scheme Params")
 	feParams.SchemaParams = schema.Params
 	feParams.BatchesPerSensor = t.BatchCnt
@@ -160,6 +224,7 @@ func (t *Task) setMultiFEParams() bool {
 	msk, mpk, err := schema.GenerateKeys()
 	t.MasterSecKeyGenerationTime = time.Since(start)
 	t.logger.Info("elapsed: %d ns", t.MasterSecKeyGenerationTime.Nanoseconds())
+	t.metrics.keyGenerationTime.ObserveDuration(t.MasterSecKeyGenerationTime, SchemeFHMultiIPE)
 	if err != nil {
 		t.logger.Err(err)
 		t.logger.Error("FE Master key generation failed")
@@ -176,8 +241,9 @@ func (t *Task) setMultiFEParams() bool {
 func (t *Task) setDummyParams() bool {
 	t.logger.Info("encryption turned off")
 	t.FEParamGenerator = &DummyGenerator{
-		BatchCnt:  t.BatchCnt * len(t.SensorIds),
-		BatchSize: t.BatchSize,
+		SensorCnt:        len(t.SensorIds),
+		BatchesPerSensor: t.BatchCnt,
+		BatchSize:        t.BatchSize,
 	}
 	return true
 }
@@ -185,8 +251,15 @@ func (t *Task) setDummyParams() bool {
 // Submit sends the SensorTaskRequest to all Sensors in the Task's Customer (captured during SetSensors)
 func (t *Task) GetEncryptionParams(SensorId UUID) (FEEncryptionParams, error) {
 	sensorIdx, err := t.getSensorIdx(SensorId)
+	if err != nil {
+		return nil, err
+	}
 	t.logger.Info("sensor no %d fetched encryption params", sensorIdx)
 
+	if t.Threshold > 0 {
+		return t.getThresholdEncryptionParams(sensorIdx)
+	}
+
 	feEncryptionParams, err := t.FEParamGenerator.GetEncryptionParams(sensorIdx)
 	if err != nil {
 		t.logger.Err(err)
@@ -202,22 +275,35 @@ func (t *Task) GetEncryptionParams(SensorId UUID) (FEEncryptionParams, error) {
 // AddNewDecryptionParams generates new decryption params for the provided rates.
 // Returns a UUID of the decryption params.
 func (t *Task) AddNewDecryptionParams(rates []int) (UUID, error) {
-	// check rates count
-	if len(rates) != t.BatchCnt*t.BatchSize {
-		return "", fmt.Errorf("invalid rates count")
+	if err := t.checkRates(rates); err != nil {
+		return "", err
+	}
+
+	// keys for different rates would reveal the inner products of the samples with the differences of the rates
+	if !t.fullKeyRequested.CompareAndSwap(false, true) {
+		return "", fmt.Errorf("a decryption key has already been derived for the task")
 	}
 
-	// check bounds in rates
 	decryptionParamsId := NewUUID()
 	t.decryptionParamsStatus.Store(decryptionParamsId, StatusCreated)
 
 	go func(task *Task) {
 		decryptionParams := task.FEParamGenerator.GetDecryptionParams(rates)
 		if decryptionParams == nil {
-			t.decryptionParamsStatus.Store(decryptionParamsId, StatusError)
+			task.decryptionParamsStatus.Store(decryptionParamsId, StatusError)
+			task.fullKeyRequested.Store(false) // nothing has been derived, so the rates can be sent again
 			return
 		}
 		task.logger.Info("decryption key derived successfully")
+		if err := task.attest(decryptionParamsId, decryptionParams, rates, nil); err != nil {
+			task.logger.Err(err)
+			task.decryptionParamsStatus.Store(decryptionParamsId, StatusError)
+			return
+		}
+
+		task.ratesMutex.Lock()
+		task.derivedRates = rates
+		task.ratesMutex.Unlock()
 
 		task.decryptionParamsStatus.Store(decryptionParamsId, StatusReady)
 		task.decryptionParams.Store(decryptionParamsId, decryptionParams)
@@ -226,6 +312,23 @@ func (t *Task) AddNewDecryptionParams(rates []int) (UUID, error) {
 	return decryptionParamsId, nil
 }
 
+// checkRates returns an error if rates aren't a rate for every sample of a sensor, within the task's bounds
+func (t *Task) checkRates(rates []int) error {
+	return checkRates(rates, t.BatchCnt*t.BatchSize, t.MinRateValue, t.MaxRateValue)
+}
+
+func checkRates(rates []int, rateCnt, minRate, maxRate int) error {
+	if len(rates) != rateCnt {
+		return fmt.Errorf("invalid rates count")
+	}
+	for idx, rate := range rates {
+		if rate < minRate || rate > maxRate {
+			return fmt.Errorf("rate no %d out of bounds [%d, %d]", idx, minRate, maxRate)
+		}
+	}
+	return nil
+}
+
 // GetDecryptionParams returns FEDecryptionParams with the provided decryptionParamsId.
 func (t *Task) GetDecryptionParams(decryptionParamsId UUID) (FEDecryptionParams, error) {
 	t.logger.Info("server fetched decryption params")
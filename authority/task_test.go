@@ -0,0 +1,208 @@
+package authority
+
+import (
+	. "fe/common"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	GobInit()
+	os.Exit(m.Run())
+}
+
+// newTestTask returns a dummy Task of 2 sensors with 4 batches of 2 samples, whose rates are within [-5, 10]
+func newTestTask(t *testing.T, config *AuthorityConfig) *Task {
+	t.Helper()
+
+	signer, err := NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &Task{
+		Id:           NewUUID(),
+		SensorIds:    []UUID{"sensor-0", "sensor-1"},
+		BatchParams:  BatchParams{BatchCnt: 4, BatchSize: 2},
+		MinRateValue: -5,
+		MaxRateValue: 10,
+		Scheme:       SchemeDummy,
+		prefixKeys:   make(map[int]bool),
+		config:       config,
+		signer:       signer,
+		logger:       GetDiscardLogger(),
+	}
+	task.setDummyParams()
+	return task
+}
+
+// awaitStatus waits until the decryption params with decryptionParamsId are no longer being derived
+func awaitStatus(t *testing.T, task *Task, decryptionParamsId UUID) string {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if status := task.GetDecryptionParamsStatus(decryptionParamsId); status != StatusCreated {
+			return status
+		}
+	}
+	t.Fatal("decryption params not derived in time")
+	return ""
+}
+
+// deriveKey derives the task's decryption key for rates, and fails the test unless it's ready
+func deriveKey(t *testing.T, task *Task, rates []int) {
+	t.Helper()
+
+	decryptionParamsId, err := task.AddNewDecryptionParams(rates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := awaitStatus(t, task, decryptionParamsId); status != StatusReady {
+		t.Fatalf("decryption params are %s", status)
+	}
+}
+
+func TestAddNewDecryptionParams(t *testing.T) {
+	rates := []int{-5, 0, 1, 2, 3, 4, 5, 10}
+
+	t.Run("rates out of bounds", func(t *testing.T) {
+		task := newTestTask(t, DefaultAuthorityConfig())
+		for _, invalid := range [][]int{{-6, 0, 1, 2, 3, 4, 5, 10}, {-5, 0, 1, 2, 3, 4, 5, 11}, rates[:6]} {
+			if _, err := task.AddNewDecryptionParams(invalid); err == nil {
+				t.Errorf("key derived for rates %v", invalid)
+			}
+		}
+		// the rejected rates don't use up the task's key
+		deriveKey(t, task, rates)
+	})
+
+	t.Run("second key", func(t *testing.T) {
+		task := newTestTask(t, DefaultAuthorityConfig())
+		deriveKey(t, task, rates)
+		if _, err := task.AddNewDecryptionParams(rates); err == nil {
+			t.Error("key derived twice for the same rates")
+		}
+		if _, err := task.AddNewDecryptionParams([]int{1, 1, 1, 1, 1, 1, 1, 1}); err == nil {
+			t.Error("key derived for other rates")
+		}
+	})
+}
+
+func TestAddPartialDecryptionParams(t *testing.T) {
+	rates := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	config := DefaultAuthorityConfig()
+	config.AllowPartialKeys = true
+	config.MinPartialCoverage = 0.5
+
+	t.Run("disabled", func(t *testing.T) {
+		task := newTestTask(t, DefaultAuthorityConfig())
+		task.config.AllowPartialKeys = false
+		deriveKey(t, task, rates)
+		if _, err := task.AddPartialDecryptionParams(PartialRatesRequest{Rates: rates, MissingCiphers: []int{7}}); err == nil {
+			t.Error("restricted key derived while they are disabled")
+		}
+	})
+
+	t.Run("before the key", func(t *testing.T) {
+		task := newTestTask(t, config)
+		if _, err := task.AddPartialDecryptionParams(PartialRatesRequest{Rates: rates, MissingCiphers: []int{7}}); err == nil {
+			t.Error("restricted key derived before the task's key")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		request PartialRatesRequest
+		valid   bool
+	}{
+		{"received ciphers", PartialRatesRequest{Rates: rates, MissingCiphers: []int{3, 7}}, true},
+		{"other rates", PartialRatesRequest{Rates: []int{1, 1, 1, 1, 1, 1, 1, 1}, MissingCiphers: []int{7}}, false},
+		{"cipher out of range", PartialRatesRequest{Rates: rates, MissingCiphers: []int{8}}, false},
+		{"cipher listed twice", PartialRatesRequest{Rates: rates, MissingCiphers: []int{7, 7}}, false},
+		{"coverage too low", PartialRatesRequest{Rates: rates, MissingCiphers: []int{0, 1, 2, 3, 4}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := newTestTask(t, config)
+			deriveKey(t, task, rates)
+			_, err := task.AddPartialDecryptionParams(test.request)
+			if test.valid && err != nil {
+				t.Errorf("valid request rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid request accepted")
+			}
+		})
+	}
+
+	t.Run("second restricted key", func(t *testing.T) {
+		task := newTestTask(t, config)
+		deriveKey(t, task, rates)
+		if _, err := task.AddPartialDecryptionParams(PartialRatesRequest{Rates: rates, MissingCiphers: []int{7}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := task.AddPartialDecryptionParams(PartialRatesRequest{Rates: rates, MissingCiphers: []int{3}}); err == nil {
+			t.Error("restricted key derived twice")
+		}
+	})
+
+	t.Run("after a prefix key", func(t *testing.T) {
+		task := newTestTask(t, config)
+		task.ProgressWindow = 2
+		deriveKey(t, task, rates)
+		if _, err := task.AddPrefixDecryptionParams(PrefixRatesRequest{Rates: rates, Batches: 2}); err != nil {
+			t.Fatal(err)
+		}
+		// a single cipher received after the prefix would reveal its own total
+		if _, err := task.AddPartialDecryptionParams(PartialRatesRequest{Rates: rates, MissingCiphers: []int{2, 3, 7}}); err == nil {
+			t.Error("restricted key derived for less than a window after the prefix")
+		}
+	})
+}
+
+func TestAddPrefixDecryptionParams(t *testing.T) {
+	rates := []int{1, 2, 3, 4, 5, 6, 7, 8}
+
+	t.Run("disabled", func(t *testing.T) {
+		task := newTestTask(t, DefaultAuthorityConfig())
+		deriveKey(t, task, rates)
+		if _, err := task.AddPrefixDecryptionParams(PrefixRatesRequest{Rates: rates, Batches: 2}); err == nil {
+			t.Error("prefix key derived without a progress window")
+		}
+	})
+
+	tests := []struct {
+		name    string
+		request PrefixRatesRequest
+		valid   bool
+	}{
+		{"end of a window", PrefixRatesRequest{Rates: rates, Batches: 2}, true},
+		{"within a window", PrefixRatesRequest{Rates: rates, Batches: 1}, false},
+		{"whole task", PrefixRatesRequest{Rates: rates, Batches: 4}, false},
+		{"other rates", PrefixRatesRequest{Rates: []int{1, 1, 1, 1, 1, 1, 1, 1}, Batches: 2}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := newTestTask(t, DefaultAuthorityConfig())
+			task.ProgressWindow = 2
+			deriveKey(t, task, rates)
+			_, err := task.AddPrefixDecryptionParams(test.request)
+			if test.valid && err != nil {
+				t.Errorf("valid request rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid request accepted")
+			}
+		})
+	}
+
+	t.Run("second prefix key", func(t *testing.T) {
+		task := newTestTask(t, DefaultAuthorityConfig())
+		task.ProgressWindow = 2
+		deriveKey(t, task, rates)
+		if _, err := task.AddPrefixDecryptionParams(PrefixRatesRequest{Rates: rates, Batches: 2}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := task.AddPrefixDecryptionParams(PrefixRatesRequest{Rates: rates, Batches: 2}); err == nil {
+			t.Error("prefix key derived twice")
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package authority
+
+import (
+	"fe/client"
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"slices"
+	"time"
+)
+
+// In the threshold mode, the authority that generates the master keys of a task (the dealer) splits their secret
+// parts among the share holders, which are authority instances too, and then discards them; the server gets
+// partial keys from at least Threshold share holders and combines them into the decryption key. The sensors need the
+// one-time pads to encrypt, so the dealer hands them out once to every sensor before discarding them.
+//
+// A share holder derives partial keys for rates within the task's bounds only, and for a single set of rates, as the
+// dealer would for the full key (see AddNewDecryptionParams); restricted and prefix keys don't apply, as
+// SchemeDamgardMulti supports neither.
+
+//region dealer
+
+// distributeShares splits the master secret of the task among its share holders and discards it; only
+// SchemeDamgardMulti tasks can be split
+func (t *Task) distributeShares() bool {
+	feParams, ok := t.FEParamGenerator.(*DamgardMultiParamGenerator)
+	if !ok {
+		t.logger.Error("scheme %s doesn't support the threshold mode", t.Scheme)
+		return false
+	}
+
+	t.logger.Info("splitting FE Master Key among %d share holders, threshold %d", len(t.ShareHolders), t.Threshold)
+	shares, err := SplitDamgardMultiSecKeys(feParams.SecKeys, t.Threshold, len(t.ShareHolders), feParams.Schema.Params.Q)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("splitting FE Master Key failed")
+		return false
+	}
+
+	for idx, share := range shares {
+		share.SensorCnt = feParams.SensorCnt
+		share.BatchesPerSensor = feParams.BatchesPerSensor
+		share.BatchSize = t.BatchSize
+		share.MinRateValue = t.MinRateValue
+		share.MaxRateValue = t.MaxRateValue
+		share.Bound = feParams.Schema.Bound
+		share.SchemaParams = feParams.Schema.Params
+
+		shareHolder := t.newShareHolder(t.ShareHolders[idx])
+		if err = shareHolder.SendShare(t.Id, share); err != nil {
+			t.logger.Err(err)
+			t.logger.Error("sending share no %d to %s failed", share.Idx, t.ShareHolders[idx].String())
+			return false
+		}
+	}
+
+	// only the share holders can derive decryption keys from now on; the one-time pads are discarded once the sensors
+	// have fetched them (see getThresholdEncryptionParams)
+	feParams.SecKeys.Msk = nil
+	t.logger.Info("FE Master Key distributed to the share holders")
+	return true
+}
+
+// getThresholdEncryptionParams returns the encryption params of the sensor with sensorIdx, and discards the one-time
+// pads of its clients, so a sensor can fetch them only once
+func (t *Task) getThresholdEncryptionParams(sensorIdx int) (FEEncryptionParams, error) {
+	if status, _ := t.schemaParamsStatus.Load().(string); status != StatusReady {
+		return nil, fmt.Errorf("encryption params aren't ready")
+	}
+	feParams := t.FEParamGenerator.(*DamgardMultiParamGenerator)
+
+	if !t.SensorFetchedParams[sensorIdx].CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("sensor no %d has already fetched its encryption params", sensorIdx)
+	}
+	feEncryptionParams, err := feParams.GetEncryptionParams(sensorIdx)
+	if err != nil {
+		t.SensorFetchedParams[sensorIdx].Store(false)
+		return nil, err
+	}
+
+	for idx := sensorIdx * feParams.BatchesPerSensor; idx < (sensorIdx+1)*feParams.BatchesPerSensor; idx++ {
+		feParams.SecKeys.Otp[idx] = nil
+	}
+	t.logger.Info("one-time pads of sensor no %d discarded", sensorIdx)
+	return feEncryptionParams, nil
+}
+
+// shareHolder is a client of a share holder, used by the dealer
+type shareHolder struct {
+	*RemoteHttpServer
+}
+
+func (t *Task) newShareHolder(ip IP) *shareHolder {
+	return &shareHolder{
+		RemoteHttpServer: &RemoteHttpServer{
+			IP:         ip,
+			Logger:     GetLogger("http client", t.logger),
+			Credential: t.shareHolderCredential,
+		},
+	}
+}
+
+func (h *shareHolder) SendShare(taskId UUID, share *ThresholdShare) error {
+	return client.NewAuthority(h.ForTask(taskId)).AddShare(taskId, share)
+}
+
+//endregion
+
+//region share holder
+
+// AddShare stores the share of a task; a task can have only one share at a share holder
+func (authority *Authority) AddShare(taskId UUID, share *ThresholdShare) error {
+	if share.Idx < 1 || share.Threshold < 1 || share.SchemaParams == nil {
+		return fmt.Errorf("invalid share")
+	}
+	if _, loaded := authority.shares.LoadOrStore(taskId, share); loaded {
+		return fmt.Errorf("share of task %s is already set", taskId)
+	}
+	authority.HttpLogger.Info("share no %d of task %s stored", share.Idx, taskId)
+	return nil
+}
+
+// GetShareTaskIds returns the ids of the tasks whose shares the share holder holds
+func (authority *Authority) GetShareTaskIds() []UUID {
+	taskIds := make([]UUID, 0)
+	authority.shares.Range(func(key, _ any) bool {
+		taskIds = append(taskIds, key.(UUID))
+		return true
+	})
+	return taskIds
+}
+
+// DerivePartialKey derives a partial key for the rates from the share of the task; once a partial key is derived,
+// only the same rates are accepted
+func (authority *Authority) DerivePartialKey(taskId UUID, y []int) (*ThresholdPartialKey, error) {
+	shareAny, ok := authority.shares.Load(taskId)
+	if !ok {
+		return nil, fmt.Errorf("share of task %s not found", taskId)
+	}
+	share := shareAny.(*ThresholdShare)
+
+	if err := checkRates(y, share.BatchesPerSensor*share.BatchSize, share.MinRateValue, share.MaxRateValue); err != nil {
+		return nil, err
+	}
+	// keys for different rates would reveal the inner products of the samples with the differences of the rates
+	if derivedRates, loaded := authority.shareRates.LoadOrStore(taskId, slices.Clone(y)); loaded && !slices.Equal(y, derivedRates.([]int)) {
+		return nil, fmt.Errorf("rates differ from the rates of the task's partial key")
+	}
+
+	numClients := share.SensorCnt * share.BatchesPerSensor
+	matrix, err := NewMatrix(numClients, y, share.SensorCnt)
+	if err != nil {
+		return nil, err
+	}
+
+	// the schema params are copied, as the schema must not change the stored ones
+	schemaParams := *share.SchemaParams
+	schema := fullysec.NewDamgardMultiFromParams(numClients, share.Bound, &schemaParams)
+
+	start := time.Now()
+	fk, err := schema.DeriveKey(&fullysec.DamgardMultiSecKeys{Msk: share.Msk, Otp: share.Otp}, matrix)
+	elapsed := time.Since(start)
+	authority.metrics.deriveKeyTime.ObserveDuration(elapsed, SchemeDamgardMulti)
+	if err != nil {
+		return nil, err
+	}
+	authority.HttpLogger.Info("partial key of task %s derived in %d ns", taskId, elapsed.Nanoseconds())
+
+	return &ThresholdPartialKey{
+		Idx: share.Idx,
+		DecryptionParams: &DamgardMultiDecryptionParams{
+			NumClients:    numClients,
+			Bound:         share.Bound,
+			SchemaParams:  schemaParams,
+			DecryptionKey: fk,
+			Rates:         matrix,
+		},
+	}, nil
+}
+
+//endregion
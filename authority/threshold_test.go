@@ -0,0 +1,118 @@
+package authority
+
+import (
+	. "fe/common"
+	"sync/atomic"
+	"testing"
+)
+
+// newThresholdTask returns a SchemeDamgardMulti Task like newTestTask, with its master keys generated, whose
+// threshold is 2 of 3 share holders
+func newThresholdTask(t *testing.T) *Task {
+	t.Helper()
+
+	task := newTestTask(t, DefaultAuthorityConfig())
+	task.Scheme = SchemeDamgardMulti
+	task.MaxSampleValue = 100
+	task.Threshold = 2
+	task.ShareHolders = make([]IP, 3)
+	task.SensorFetchedParams = make([]atomic.Bool, len(task.SensorIds))
+	task.metrics = newAuthorityMetrics(NewMetricsRegistry())
+	if !task.setDamgardMultiParams() {
+		t.Fatal("generating master keys failed")
+	}
+	return task
+}
+
+// newShareHolder returns an Authority that holds the share no idx of the task's master secret
+func newShareHolder(t *testing.T, task *Task, idx int) *Authority {
+	t.Helper()
+
+	feParams := task.FEParamGenerator.(*DamgardMultiParamGenerator)
+	shares, err := SplitDamgardMultiSecKeys(feParams.SecKeys, task.Threshold, len(task.ShareHolders), feParams.Schema.Params.Q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	share := shares[idx]
+	share.SensorCnt = feParams.SensorCnt
+	share.BatchesPerSensor = feParams.BatchesPerSensor
+	share.BatchSize = task.BatchSize
+	share.MinRateValue = task.MinRateValue
+	share.MaxRateValue = task.MaxRateValue
+	share.Bound = feParams.Schema.Bound
+	share.SchemaParams = feParams.Schema.Params
+
+	authority := &Authority{
+		Host:    &Host[Task]{HttpServer: &HttpServer{HttpLogger: GetDiscardLogger()}},
+		metrics: newAuthorityMetrics(NewMetricsRegistry()),
+	}
+	if err = authority.AddShare(task.Id, share); err != nil {
+		t.Fatal(err)
+	}
+	return authority
+}
+
+func TestDerivePartialKey(t *testing.T) {
+	task := newThresholdTask(t)
+	rates := []int{-5, 0, 1, 2, 3, 4, 5, 10}
+
+	tests := []struct {
+		name  string
+		rates []int
+		valid bool
+	}{
+		{"rates out of bounds", []int{-6, 0, 1, 2, 3, 4, 5, 10}, false},
+		{"invalid rates count", rates[:6], false},
+		{"first rates", rates, true},
+		{"same rates again", rates, true},
+		{"other rates", []int{1, 1, 1, 1, 1, 1, 1, 1}, false},
+	}
+
+	shareHolder := newShareHolder(t, task, 0)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := shareHolder.DerivePartialKey(task.Id, test.rates)
+			if test.valid && err != nil {
+				t.Errorf("valid rates rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid rates accepted")
+			}
+		})
+	}
+
+	if _, err := shareHolder.DerivePartialKey(NewUUID(), rates); err == nil {
+		t.Error("partial key derived for a task without a share")
+	}
+}
+
+func TestThresholdEncryptionParams(t *testing.T) {
+	task := newThresholdTask(t)
+	feParams := task.FEParamGenerator.(*DamgardMultiParamGenerator)
+
+	if _, err := task.GetEncryptionParams("sensor-0"); err == nil {
+		t.Fatal("encryption params fetched before the shares are distributed")
+	}
+	task.schemaParamsStatus.Store(StatusReady)
+
+	params, err := task.GetEncryptionParams("sensor-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, otp := range params.(*DamgardMultiEncryptionParams).Otps {
+		if otp == nil {
+			t.Errorf("one-time pad of batch no %d missing from the encryption params", idx)
+		}
+	}
+
+	for idx, otp := range feParams.SecKeys.Otp {
+		if discarded := otp == nil; discarded != (idx < task.BatchCnt) {
+			t.Errorf("one-time pad of client no %d discarded: %t", idx, discarded)
+		}
+	}
+	if _, err = task.GetEncryptionParams("sensor-0"); err == nil {
+		t.Error("encryption params fetched twice")
+	}
+	if _, err = task.GetEncryptionParams("sensor-2"); err == nil {
+		t.Error("encryption params fetched for a sensor of another task")
+	}
+}
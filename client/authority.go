@@ -0,0 +1,150 @@
+package client
+
+import (
+	. "fe/common"
+)
+
+// Authority is the client of the /v1 API of an authority, or of a share holder of the threshold mode
+type Authority struct {
+	HostClient
+}
+
+func NewAuthority(remote *RemoteHttpServer) *Authority {
+	return &Authority{HostClient{remote}}
+}
+
+// AddTask adds the task, whose schema params are set up; see SchemaParamsStatus
+func (a *Authority) AddTask(request AuthorityTaskRequest) error {
+	return call(a.RemoteHttpServer, "POST", "/tasks", request, nil)
+}
+
+func (a *Authority) SchemaParamsStatus(taskId UUID) (string, error) {
+	var status string
+	if err := call(a.RemoteHttpServer, "GET", "/tasks/"+string(taskId)+"/schema-status", nil, &status); err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+func (a *Authority) EncryptionParams(taskId UUID, sensorId UUID) (FEEncryptionParams, error) {
+	data, err := callData(a.RemoteHttpServer, "GET", "/tasks/"+string(taskId)+"/sensors/"+string(sensorId)+"/encryption-params", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data)
+}
+
+//region rates
+
+// AddRates asks for the decryption params of the rates, and returns their id
+func (a *Authority) AddRates(taskId UUID, rates []int) (UUID, error) {
+	data, err := Encode(rates)
+	if err != nil {
+		return "", err
+	}
+
+	statusCode, responseBody, err := a.Do("POST", V1Prefix+"/tasks/"+string(taskId)+"/rates", BodyOctetStream, data, nil)
+	if err != nil {
+		return "", err
+	}
+	var decryptionParamsId UUID
+	if err = decode(statusCode, responseBody, &decryptionParamsId); err != nil {
+		return "", err
+	}
+	return decryptionParamsId, nil
+}
+
+// AddPartialRates asks for the decryption params restricted to the received ciphers; the authority may refuse them,
+// according to its policy
+func (a *Authority) AddPartialRates(taskId UUID, request PartialRatesRequest) (UUID, error) {
+	var decryptionParamsId UUID
+	if err := call(a.RemoteHttpServer, "POST", "/tasks/"+string(taskId)+"/rates/partial", request, &decryptionParamsId); err != nil {
+		return "", err
+	}
+	return decryptionParamsId, nil
+}
+
+// AddPrefixRates asks for the decryption params restricted to the first batches of every sensor
+func (a *Authority) AddPrefixRates(taskId UUID, request PrefixRatesRequest) (UUID, error) {
+	var decryptionParamsId UUID
+	if err := call(a.RemoteHttpServer, "POST", "/tasks/"+string(taskId)+"/rates/prefix", request, &decryptionParamsId); err != nil {
+		return "", err
+	}
+	return decryptionParamsId, nil
+}
+
+//endregion
+
+//region decryption params
+
+func decryptionParamsPath(taskId UUID, decryptionParamsId UUID) string {
+	return "/tasks/" + string(taskId) + "/decryption-params/" + string(decryptionParamsId)
+}
+
+func (a *Authority) DecryptionParamsStatus(taskId UUID, decryptionParamsId UUID) (string, error) {
+	var status string
+	if err := call(a.RemoteHttpServer, "GET", decryptionParamsPath(taskId, decryptionParamsId)+"/status", nil, &status); err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+// DecryptionParams returns the decryption params, and their encoding, which is attested by the authority
+func (a *Authority) DecryptionParams(taskId UUID, decryptionParamsId UUID) (FEDecryptionParams, []byte, error) {
+	data, err := callData(a.RemoteHttpServer, "GET", decryptionParamsPath(taskId, decryptionParamsId), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	decryptionParams, err := Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decryptionParams, data, nil
+}
+
+// Attestation returns the authority's signed attestation of the rates of the decryption params
+func (a *Authority) Attestation(taskId UUID, decryptionParamsId UUID) (*RatesAttestation, error) {
+	attestation := &RatesAttestation{}
+	if err := call(a.RemoteHttpServer, "GET", decryptionParamsPath(taskId, decryptionParamsId)+"/attestation", nil, attestation); err != nil {
+		return nil, err
+	}
+	return attestation, nil
+}
+
+//endregion
+
+//region threshold
+
+// AddShare sends the share of the task's master secret to the share holder
+func (a *Authority) AddShare(taskId UUID, share *ThresholdShare) error {
+	data, err := Encode(share)
+	if err != nil {
+		return err
+	}
+	_, err = callData(a.RemoteHttpServer, "PUT", "/tasks/"+string(taskId)+"/share", data, nil)
+	return err
+}
+
+// PartialKey returns the partial key the share holder derives for the rates from its share of the task
+func (a *Authority) PartialKey(taskId UUID, rates []int) (*ThresholdPartialKey, error) {
+	data, err := Encode(rates)
+	if err != nil {
+		return nil, err
+	}
+	data, err = callData(a.RemoteHttpServer, "POST", "/tasks/"+string(taskId)+"/partial-keys", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeGob[*ThresholdPartialKey](data)
+}
+
+// Shares returns the shares the share holder holds
+func (a *Authority) Shares() (*ShareHolderStatus, error) {
+	status := &ShareHolderStatus{}
+	if err := call(a.RemoteHttpServer, "GET", "/shares", nil, status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+//endregion
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"encoding/json"
+	. "fe/common"
+	"fmt"
+	"net/http"
+)
+
+// The clients call the /v1 APIs of the hosts (see common/api.go) for the hosts themselves, and for the tools: the
+// JSON responses are unwrapped from their envelopes, and the errors are returned as *APIError, whose Code is
+// machine-readable; the errors of the transport aren't. The gob encoded FE params are sent and returned as they
+// are. The requests are sent by a RemoteHttpServer, so that they carry its correlation id and credential; for the
+// requests of a task, the client is created for RemoteHttpServer.ForTask.
+
+// call sends the body, if it isn't nil, as JSON, and decodes the data of the response into out, if it isn't nil
+func call(remote *RemoteHttpServer, method string, path string, body any, out any) error {
+	var data []byte
+	contentType := ""
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+		contentType = BodyJSON
+	}
+
+	statusCode, responseBody, err := remote.Do(method, V1Prefix+path, contentType, data, nil)
+	if err != nil {
+		return err
+	}
+	return decode(statusCode, responseBody, out)
+}
+
+// callData sends the gob encoded body, and returns the gob encoded response
+func callData(remote *RemoteHttpServer, method string, path string, data []byte, headers map[string]string) ([]byte, error) {
+	contentType := ""
+	if data != nil {
+		contentType = BodyOctetStream
+	}
+
+	statusCode, responseBody, err := remote.Do(method, V1Prefix+path, contentType, data, headers)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkStatus(statusCode, responseBody); err != nil {
+		return nil, err
+	}
+	return responseBody, nil
+}
+
+// decode decodes the data of the response into out, or returns its error
+func decode(statusCode int, body []byte, out any) error {
+	if err := checkStatus(statusCode, body); err != nil {
+		return err
+	}
+	if out == nil || statusCode == http.StatusNoContent {
+		return nil
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("invalid response: %s", err)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("invalid response data: %s", err)
+	}
+	return nil
+}
+
+// checkStatus returns the *APIError of the response, if it isn't successful; the responses that aren't enveloped
+// (e.g. of a proxy) get the code of their status
+func checkStatus(statusCode int, body []byte) error {
+	if statusCode >= 200 && statusCode < 300 {
+		return nil
+	}
+
+	var envelope ErrorEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Error == nil {
+		return &APIError{Status: statusCode, Code: ErrorCodeForStatus(statusCode), Message: string(body)}
+	}
+	envelope.Error.Status = statusCode
+	return envelope.Error
+}
+
+// decodeGob decodes the gob encoded response into a T
+func decodeGob[T any](data []byte) (T, error) {
+	var value T
+	decoded, err := Decode(data)
+	if err != nil {
+		return value, err
+	}
+	value, ok := decoded.(T)
+	if !ok {
+		return value, fmt.Errorf("invalid response of type %T", decoded)
+	}
+	return value, nil
+}
+
+//region HostClient
+
+// HostClient is the client of the endpoints every host has
+type HostClient struct {
+	*RemoteHttpServer
+}
+
+// Clock answers an NTP-style exchange, see MeasureClockOffset
+func (h *HostClient) Clock() (*ClockSyncResponse, error) {
+	response := &ClockSyncResponse{}
+	if err := call(h.RemoteHttpServer, "GET", "/clock", nil, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// PublicKey returns the hex encoded key the host's signatures are verified with
+func (h *HostClient) PublicKey() (string, error) {
+	var response PublicKeyResponse
+	if err := call(h.RemoteHttpServer, "GET", "/public-key", nil, &response); err != nil {
+		return "", err
+	}
+	return response.PublicKey, nil
+}
+
+func (h *HostClient) LogLevel() (string, error) {
+	var response LogLevel
+	if err := call(h.RemoteHttpServer, "GET", "/log-level", nil, &response); err != nil {
+		return "", err
+	}
+	return response.Level, nil
+}
+
+func (h *HostClient) SetLogLevel(level string) error {
+	return call(h.RemoteHttpServer, "PUT", "/log-level", LogLevel{Level: level}, nil)
+}
+
+// MeasureClockOffset measures the offset of the host's clock from clock with samples exchanges; the exchange with
+// the shortest round trip is kept, as its offset is the least affected by the network
+func (h *HostClient) MeasureClockOffset(clock Clock, samples int) (ClockSync, error) {
+	var best ClockSync
+
+	for idx := 0; idx < samples; idx++ {
+		sent := clock.Now()
+		response, err := h.Clock()
+		received := clock.Now()
+		if err != nil {
+			return ClockSync{}, fmt.Errorf("clock sync failed: %s", err)
+		}
+
+		clockSync := NewClockSync(sent, *response, received)
+		if idx == 0 || clockSync.Delay < best.Delay {
+			best = clockSync
+		}
+	}
+
+	return best, nil
+}
+
+//endregion
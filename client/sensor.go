@@ -0,0 +1,100 @@
+package client
+
+import (
+	. "fe/common"
+)
+
+// Sensor is the client of the /v1 API of a sensor
+type Sensor struct {
+	HostClient
+}
+
+func NewSensor(remote *RemoteHttpServer) *Sensor {
+	return &Sensor{HostClient{remote}}
+}
+
+func (s *Sensor) SetServer(ip IP) error {
+	return call(s.RemoteHttpServer, "PUT", "/server", ip, nil)
+}
+
+// SetServerCredential sets the credential the sensor authenticates to the server with
+func (s *Sensor) SetServerCredential(credential string) error {
+	return call(s.RemoteHttpServer, "PUT", "/server/credential", CredentialRequest{Credential: credential}, nil)
+}
+
+// SetCustomer sets the customer of the sensor; the customer's audit token is returned only the first time
+func (s *Sensor) SetCustomer(customerId UUID) (*SensorCustomer, error) {
+	customer := &SensorCustomer{}
+	if err := call(s.RemoteHttpServer, "PUT", "/customer", SetCustomerRequest{CustomerId: customerId}, customer); err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+// Register makes the sensor add itself to its customer on its server
+func (s *Sensor) Register() error {
+	return call(s.RemoteHttpServer, "POST", "/registration", nil, nil)
+}
+
+func (s *Sensor) SubmitTask(request SensorTaskRequest) error {
+	return call(s.RemoteHttpServer, "POST", "/tasks", request, nil)
+}
+
+// Samples returns the samples of the task, disclosed to the customer with the audit token
+func (s *Sensor) Samples(taskId UUID, auditToken string) (*SampleDisclosure, error) {
+	// the audit token replaces the credential of the remote host, if any
+	remote := *s.RemoteHttpServer
+	remote.Credential = auditToken
+
+	disclosure := &SampleDisclosure{}
+	if err := call(&remote, "GET", "/tasks/"+string(taskId)+"/samples", nil, disclosure); err != nil {
+		return nil, err
+	}
+	return disclosure, nil
+}
+
+// Commitments returns the signed commitments of the task's submitted batches
+func (s *Sensor) Commitments(taskId UUID) ([]*BatchCommitment, error) {
+	commitments := make([]*BatchCommitment, 0)
+	if err := call(s.RemoteHttpServer, "GET", "/tasks/"+string(taskId)+"/commitments", nil, &commitments); err != nil {
+		return nil, err
+	}
+	return commitments, nil
+}
+
+//region decentralized DMCFE
+
+// DMCFEPubKeys returns the public keys of the sensor's DMCFE clients for the task
+func (s *Sensor) DMCFEPubKeys(taskId UUID) (*DMCFEPubKeys, error) {
+	data, err := callData(s.RemoteHttpServer, "GET", "/tasks/"+string(taskId)+"/dmcfe/pub-keys", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeGob[*DMCFEPubKeys](data)
+}
+
+// SetDMCFEPubKeys sends the public keys of all the DMCFE clients of the task
+func (s *Sensor) SetDMCFEPubKeys(taskId UUID, pubKeys *DMCFEPubKeys) error {
+	data, err := Encode(pubKeys)
+	if err != nil {
+		return err
+	}
+	_, err = callData(s.RemoteHttpServer, "PUT", "/tasks/"+string(taskId)+"/dmcfe/pub-keys", data, nil)
+	return err
+}
+
+// DMCFEKeyShares returns the key shares of the sensor's DMCFE clients for the rates; the sensor refuses to derive
+// key shares for rates it doesn't approve
+func (s *Sensor) DMCFEKeyShares(taskId UUID, rates []int) (*DMCFEKeyShares, error) {
+	data, err := Encode(rates)
+	if err != nil {
+		return nil, err
+	}
+	data, err = callData(s.RemoteHttpServer, "POST", "/tasks/"+string(taskId)+"/dmcfe/key-shares", data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return decodeGob[*DMCFEKeyShares](data)
+}
+
+//endregion
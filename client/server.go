@@ -0,0 +1,149 @@
+package client
+
+import (
+	. "fe/common"
+	"net/url"
+	"strconv"
+)
+
+// Server is the client of the /v1 API of the server. The responses whose types belong to the server (e.g. the
+// bundle of a task) are decoded into the values the callers pass, e.g. a *server.Bundle.
+type Server struct {
+	HostClient
+}
+
+func NewServer(remote *RemoteHttpServer) *Server {
+	return &Server{HostClient{remote}}
+}
+
+//region customers
+
+// CreateCustomer creates a customer; its API key is set only if the server is authenticated
+func (s *Server) CreateCustomer() (*CreatedCustomer, error) {
+	customer := &CreatedCustomer{}
+	if err := call(s.RemoteHttpServer, "POST", "/customers", nil, customer); err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+func (s *Server) Customer(customerId UUID) (*CustomerDetails, error) {
+	customer := &CustomerDetails{}
+	if err := call(s.RemoteHttpServer, "GET", "/customers/"+string(customerId), nil, customer); err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+// Statements decodes the billing statement of the customer's tasks that start in [from, to) (timestamps; 0 doesn't
+// bound the period) into statement, a *server.Statement
+func (s *Server) Statements(customerId UUID, from int64, to int64, statement any) error {
+	query := url.Values{}
+	if from != 0 {
+		query.Set("from", strconv.FormatInt(from, 10))
+	}
+	if to != 0 {
+		query.Set("to", strconv.FormatInt(to, 10))
+	}
+	return call(s.RemoteHttpServer, "GET", "/customers/"+string(customerId)+"/statements?"+query.Encode(), nil, statement)
+}
+
+// TaskStatement decodes the billing statement of the customer's task into statement, a *server.Statement
+func (s *Server) TaskStatement(customerId UUID, taskId UUID, statement any) error {
+	return call(s.RemoteHttpServer, "GET", "/customers/"+string(customerId)+"/statements?task="+string(taskId), nil, statement)
+}
+
+// AddSensor adds the sensor to the customer; a new sensor is issued its API key, if the server is authenticated,
+// otherwise the key is empty
+func (s *Server) AddSensor(customerId UUID, request RegisterSensorRequest) (string, error) {
+	var issued IssuedAPIKey
+	if err := call(s.RemoteHttpServer, "POST", "/customers/"+string(customerId)+"/sensors", request, &issued); err != nil {
+		return "", err
+	}
+	return issued.APIKey, nil
+}
+
+func (s *Server) RemoveSensor(customerId UUID, sensorId UUID) error {
+	return call(s.RemoteHttpServer, "DELETE", "/customers/"+string(customerId)+"/sensors/"+string(sensorId), nil, nil)
+}
+
+//endregion
+
+//region tasks
+
+// AddTask creates a task, and returns its id
+func (s *Server) AddTask(request ServerTaskRequest) (UUID, error) {
+	var taskId UUID
+	if err := call(s.RemoteHttpServer, "POST", "/tasks", request, &taskId); err != nil {
+		return "", err
+	}
+	return taskId, nil
+}
+
+// ValidateTask decodes the validation of the task into validation, a *server.TaskValidation
+func (s *Server) ValidateTask(request ServerTaskRequest, validation any) error {
+	return call(s.RemoteHttpServer, "POST", "/tasks/validate", request, validation)
+}
+
+func (s *Server) Task(taskId UUID) (*TaskDetails, error) {
+	details := &TaskDetails{}
+	if err := call(s.RemoteHttpServer, "GET", "/tasks/"+string(taskId), nil, details); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+func (s *Server) TaskProgress(taskId UUID) (*TaskProgress, error) {
+	progress := &TaskProgress{}
+	if err := call(s.RemoteHttpServer, "GET", "/tasks/"+string(taskId)+"/progress", nil, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// TaskBundle decodes the bundle of the task into bundle, a *server.Bundle
+func (s *Server) TaskBundle(taskId UUID, bundle any) error {
+	return call(s.RemoteHttpServer, "GET", "/tasks/"+string(taskId)+"/bundle", nil, bundle)
+}
+
+// SubmitCipher sends the encoded cipher of batch no batchIdx of the sensor, with its commitment, if it isn't nil
+func (s *Server) SubmitCipher(taskId UUID, sensorId UUID, batchIdx int, cipher []byte, commitment *BatchCommitment) error {
+	headers := make(map[string]string)
+	if commitment != nil {
+		headers[BatchCommitmentHeader] = commitment.HeaderValue()
+	}
+	path := "/tasks/" + string(taskId) + "/sensors/" + string(sensorId) + "/ciphers?batch=" + strconv.Itoa(batchIdx)
+	_, err := callData(s.RemoteHttpServer, "POST", path, cipher, headers)
+	return err
+}
+
+//endregion
+
+// AddTariff adds the tariff, a server.Tariff, and returns its id
+func (s *Server) AddTariff(tariff any) (UUID, error) {
+	var tariffId UUID
+	if err := call(s.RemoteHttpServer, "POST", "/tariffs", tariff, &tariffId); err != nil {
+		return "", err
+	}
+	return tariffId, nil
+}
+
+//region authority
+
+func (s *Server) SetAuthority(ip IP) error {
+	return call(s.RemoteHttpServer, "PUT", "/authority", ip, nil)
+}
+
+func (s *Server) AddShareHolder(ip IP) error {
+	return call(s.RemoteHttpServer, "POST", "/authority/share-holders", ip, nil)
+}
+
+func (s *Server) ShareHolders() (*ShareHolders, error) {
+	shareHolders := &ShareHolders{}
+	if err := call(s.RemoteHttpServer, "GET", "/authority/share-holders", nil, shareHolders); err != nil {
+		return nil, err
+	}
+	return shareHolders, nil
+}
+
+//endregion
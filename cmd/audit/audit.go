@@ -0,0 +1,113 @@
+package main
+
+import (
+	. "fe/common"
+	. "fe/server"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AuditConfig names the bundle of the task, and the samples the sensors have disclosed to the customer; the keys
+// that aren't pinned are taken from the bundle.
+type AuditConfig struct {
+	Bundle     string `yaml:"bundle" toml:"bundle" flag:"bundle" usage:"path of the bundle, as returned by GET /v1/tasks/:id/bundle"`
+	Samples    string `yaml:"samples" toml:"samples" flag:"samples" usage:"comma separated paths of the samples of every sensor, as returned by its GET /v1/tasks/:id/samples"`
+	ServerKey  string `yaml:"serverKey" toml:"serverKey" flag:"server-key" usage:"hex encoded public key of the server"`
+	SensorKeys string `yaml:"sensorKeys" toml:"sensorKeys" flag:"sensor-keys" usage:"comma separated sensorId=key pairs of the public keys of the sensors"`
+}
+
+func DefaultAuditConfig() *AuditConfig {
+	return &AuditConfig{}
+}
+
+func (c *AuditConfig) Validate() []error {
+	errs := make([]error, 0)
+
+	if c.Bundle == "" {
+		errs = append(errs, fmt.Errorf("bundle must be set"))
+	}
+	if c.Samples == "" {
+		errs = append(errs, fmt.Errorf("samples must be set"))
+	}
+	if _, err := ParseSensorKeys(c.SensorKeys); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = UnmarshalData(data, v); err != nil {
+		return fmt.Errorf("invalid %s: %s", path, err)
+	}
+	return nil
+}
+
+// AuditMain recomputes the result of a billed task from the samples disclosed by the sensors, and the rates and the
+// tariff of its bundle, and prints the outcome of every check; it exits with 1 if any of them fails.
+func AuditMain() int {
+	config := DefaultAuditConfig()
+	printOnly, err := LoadConfig(config, "audit", "FE_AUDIT", os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	if printOnly {
+		return 0
+	}
+
+	bundle := &Bundle{}
+	if err = readJSON(config.Bundle, bundle); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	disclosures := make([]*SampleDisclosure, 0)
+	for _, path := range strings.Split(config.Samples, ",") {
+		disclosure := &SampleDisclosure{}
+		if err = readJSON(strings.TrimSpace(path), disclosure); err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		disclosures = append(disclosures, disclosure)
+	}
+
+	sensorKeys, _ := ParseSensorKeys(config.SensorKeys)
+	keys := PinnedKeys{
+		Server:  config.ServerKey,
+		Sensors: sensorKeys,
+	}
+	if keys.Server == "" || len(keys.Sensors) < len(bundle.Sensors) {
+		fmt.Println("warning: not all the keys are pinned, the keys of the bundle are trusted")
+	}
+
+	statement := bundle.Statement
+	fmt.Printf("task %s of customer %s: %s (tariff %q)\n", statement.TaskId, statement.CustomerId, statement.Amount, bundle.Tariff.Description)
+
+	failed := 0
+	for _, check := range AuditSamples(bundle, disclosures, keys) {
+		if check.Err == nil {
+			fmt.Printf("  ok:     %s\n", check.Name)
+		} else {
+			failed++
+			fmt.Printf("  failed: %s: %s\n", check.Name, check.Err)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d checks failed\n", failed)
+		return 1
+	}
+	fmt.Println("the statement matches the samples")
+	return 0
+}
+
+func main() {
+	os.Exit(AuditMain())
+}
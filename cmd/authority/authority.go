@@ -4,30 +4,40 @@ import (
 	. "fe/authority"
 	. "fe/common"
 	"fmt"
+	"os"
 )
 
-func AuthorityMain() {
-	// todo add args
-
-	err := InitLogger("authority")
+// AuthorityMain runs the authority until it's shut down; it exits with 1 if it can't start, or if its http server
+// fails.
+func AuthorityMain() int {
+	config := DefaultAuthorityConfig()
+	printOnly, err := LoadConfig(config, "authority", "FE_AUTHORITY", os.Args[1:], os.Stdout)
 	if err != nil {
 		fmt.Println(err)
-		return
+		return 1
 	}
 
-	ip := IP{
-		Scheme: "http",
-		IPv4:   GetIPv4(),
-		Port:   "8082",
+	if printOnly {
+		return 0
 	}
 
 	GobInit()
 
-	authority := InitAuthority()
+	authority, err := InitAuthority(config, RealClock{})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
 	authority.StartTaskDaemon(StartTaskWorker)
-	authority.RunHttpServer(ip)
+	report := authority.Run(config.GetIP())
+	fmt.Printf("shut down; %s\n", report)
+	if report.HttpServerErr != nil {
+		return 1
+	}
+	return 0
 }
 
 func main() {
-	AuthorityMain()
+	os.Exit(AuthorityMain())
 }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	. "fe/common"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BenchMain runs the sweep: for every combination of scheme, sensor count, batch size and batch count, a new server,
+// authority and sensors are started in this process, a task is run on them, and its result is checked against the
+// samples and the rates; the timings of all runs are written to a CSV and/or JSON report.
+func BenchMain() int {
+	config := DefaultBenchConfig()
+	printOnly, err := LoadConfig(config, "bench", "FE_BENCH", os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	if printOnly {
+		return 0
+	}
+
+	batchSizes, _ := parseIntList(config.BatchSizes)
+	batchCnts, _ := parseIntList(config.BatchCnts)
+	sensorCnts, _ := parseIntList(config.SensorCnts)
+
+	results := make([]*runResult, 0)
+	failed := 0
+
+	for _, scheme := range strings.Split(config.Schemes, ",") {
+		for _, sensorCnt := range sensorCnts {
+			for _, batchSize := range batchSizes {
+				for _, batchCnt := range batchCnts {
+					for repetition := 1; repetition <= config.Repeat; repetition++ {
+						params := runParams{
+							Scheme:     strings.TrimSpace(scheme),
+							SensorCnt:  sensorCnt,
+							BatchSize:  batchSize,
+							BatchCnt:   batchCnt,
+							Repetition: repetition,
+						}
+
+						if !params.supported() {
+							if repetition == 1 {
+								fmt.Printf("skipped: %s (not supported by the scheme)\n", params)
+							}
+							continue
+						}
+
+						runName := fmt.Sprintf("%03d-%s-s%d-b%dx%d", len(results)+1, params.Scheme, sensorCnt, batchCnt, batchSize)
+						fmt.Printf("running: %s\n", params)
+						result := run(config, params, filepath.Join(config.LogDir, runName))
+						results = append(results, result)
+
+						switch {
+						case result.Error != "":
+							failed++
+							fmt.Printf("  failed: %s\n", result.Error)
+						case !result.Correct:
+							failed++
+							fmt.Printf("  incorrect result: expected %d, got %d\n", result.Expected, result.Result)
+						default:
+							fmt.Printf("  ok: result %d, keygen %.3fs, derive key %.3fs, encryption %.3fs, decryption %.3fs + %.3fs\n",
+								result.Result, result.KeyGenerationTime, result.DeriveKeyTime, result.EncryptionTime,
+								result.PartialDecryptionTime, result.DecryptionTime)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if config.Format == "csv" || config.Format == "both" {
+		if err = writeCSVReport(config.Output+".csv", results); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	if config.Format == "json" || config.Format == "both" {
+		if err = writeJSONReport(config.Output+".json", results); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	fmt.Printf("%d runs, %d failed; report written to %s\n", len(results), failed, config.Output)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(BenchMain())
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	. "fe/common"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BenchConfig defines the sweep that is run, and the settings of the hosts started for every run.
+type BenchConfig struct {
+	BatchSizes string `yaml:"batchSizes" toml:"batchSizes" flag:"batch-sizes" usage:"comma separated batch sizes to sweep over"`
+	BatchCnts  string `yaml:"batchCnts" toml:"batchCnts" flag:"batch-cnts" usage:"comma separated batch counts (per sensor) to sweep over"`
+	SensorCnts string `yaml:"sensorCnts" toml:"sensorCnts" flag:"sensor-cnts" usage:"comma separated sensor counts to sweep over"`
+	Schemes    string `yaml:"schemes" toml:"schemes" flag:"schemes" usage:"comma separated schemes to sweep over (fhipe, fh-multi-ipe, damgard-multi, paillier-multi, lwe, dmcfe, decentralized-dmcfe, dummy)"`
+	Repeat     int    `yaml:"repeat" toml:"repeat" flag:"repeat" usage:"number of runs for every combination of the sweep"`
+
+	SamplingPeriod int     `yaml:"samplingPeriod" toml:"samplingPeriod" flag:"sampling-period" usage:"sampling period of the tariff, in seconds"`
+	MinSampleValue float64 `yaml:"minSampleValue" toml:"minSampleValue" flag:"min-sample-value" usage:"min sample value of the tariff"`
+	MaxSampleValue float64 `yaml:"maxSampleValue" toml:"maxSampleValue" flag:"max-sample-value" usage:"max sample value of the tariff"`
+	MinTariffValue float64 `yaml:"minTariffValue" toml:"minTariffValue" flag:"min-tariff-value" usage:"min rate value of the tariff"`
+	MaxTariffValue float64 `yaml:"maxTariffValue" toml:"maxTariffValue" flag:"max-tariff-value" usage:"max rate value of the tariff"`
+	SampleScale    int     `yaml:"sampleScale" toml:"sampleScale" flag:"sample-scale" usage:"number of decimal digits of the samples"`
+	RateScale      int     `yaml:"rateScale" toml:"rateScale" flag:"rate-scale" usage:"number of decimal digits of the rates"`
+
+	StartDelay      Duration `yaml:"startDelay" toml:"startDelay" flag:"start-delay" usage:"time between creating a task and the start of sampling"`
+	PollingInterval Duration `yaml:"pollingInterval" toml:"pollingInterval" flag:"polling-interval" usage:"interval between polling for params, and for the result"`
+	ResultTimeout   Duration `yaml:"resultTimeout" toml:"resultTimeout" flag:"result-timeout" usage:"time given to a run to produce the result after sampling is finished"`
+
+	EncryptionWorkers int `yaml:"encryptionWorkers" toml:"encryptionWorkers" flag:"encryption-workers" usage:"maximum number of batches a sensor encrypts at once; 0 uses the number of CPUs"`
+	MaxQueuedBatches  int `yaml:"maxQueuedBatches" toml:"maxQueuedBatches" flag:"max-queued-batches" usage:"maximum number of batches waiting for encryption on a sensor, before samples are buffered by the sampler; 0 uses the sensor's default"`
+
+	DlogTableDir string `yaml:"dlogTableDir" toml:"dlogTableDir" flag:"dlog-table-dir" usage:"directory the discrete logarithm tables are cached in, and shared between the runs; if empty, every run builds its own tables"`
+
+	Output string `yaml:"output" toml:"output" flag:"output" usage:"path of the report, without extension"`
+	Format string `yaml:"format" toml:"format" flag:"format" usage:"format of the report (csv, json or both)"`
+
+	LogDir   string `yaml:"logDir" toml:"logDir" flag:"log-dir" usage:"directory for the logs of the hosts; every run logs to its own subdirectory"`
+	LogLevel string `yaml:"logLevel" toml:"logLevel" flag:"log-level" usage:"minimal level of messages logged by the hosts"`
+}
+
+func DefaultBenchConfig() *BenchConfig {
+	return &BenchConfig{
+		BatchSizes: "5",
+		BatchCnts:  "1,3",
+		SensorCnts: "1,2",
+		Schemes:    strings.Join([]string{SchemeFHIPE, SchemeFHMultiIPE, SchemeDummy}, ","),
+		Repeat:     1,
+
+		SamplingPeriod: 1,
+		MinSampleValue: 0,
+		MaxSampleValue: 300,
+		MinTariffValue: 0,
+		MaxTariffValue: 1000,
+		SampleScale:    0,
+		RateScale:      0,
+
+		StartDelay:      Duration(2 * time.Second),
+		PollingInterval: Duration(250 * time.Millisecond),
+		ResultTimeout:   Duration(2 * time.Minute),
+
+		Output: "bench-report",
+		Format: "both",
+
+		LogDir:   "logs/bench-logs",
+		LogLevel: "info",
+	}
+}
+
+func (c *BenchConfig) Validate() []error {
+	errs := make([]error, 0)
+
+	for name, list := range map[string]string{"batch sizes": c.BatchSizes, "batch counts": c.BatchCnts, "sensor counts": c.SensorCnts} {
+		if _, err := parseIntList(list); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %s", name, err))
+		}
+	}
+
+	for _, scheme := range strings.Split(c.Schemes, ",") {
+		if !isScheme(strings.TrimSpace(scheme)) {
+			errs = append(errs, fmt.Errorf("unknown scheme %q", scheme))
+		}
+	}
+
+	if c.Repeat < 1 {
+		errs = append(errs, fmt.Errorf("repeat must be at least 1, got %d", c.Repeat))
+	}
+
+	if c.SamplingPeriod < 1 {
+		errs = append(errs, fmt.Errorf("sampling period must be at least 1s, got %d", c.SamplingPeriod))
+	}
+
+	if c.MinSampleValue > c.MaxSampleValue || c.MinTariffValue > c.MaxTariffValue {
+		errs = append(errs, fmt.Errorf("min sample value and min tariff value can't be greater than the max values"))
+	}
+
+	if c.SampleScale < 0 || c.SampleScale > MaxFixedPointScale || c.RateScale < 0 || c.RateScale > MaxFixedPointScale {
+		errs = append(errs, fmt.Errorf("sample scale and rate scale must be in [0, %d]", MaxFixedPointScale))
+	}
+
+	if c.StartDelay < 0 || c.PollingInterval <= 0 || c.ResultTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("start delay can't be negative, polling interval and result timeout must be positive"))
+	}
+
+	if c.EncryptionWorkers < 0 || c.MaxQueuedBatches < 0 {
+		errs = append(errs, fmt.Errorf("encryption workers and max queued batches can't be negative"))
+	}
+
+	if c.Output == "" {
+		errs = append(errs, fmt.Errorf("output must be set"))
+	}
+
+	if c.Format != "csv" && c.Format != "json" && c.Format != "both" {
+		errs = append(errs, fmt.Errorf("format must be csv, json or both, got %q", c.Format))
+	}
+
+	logConfig := DefaultLogConfig(c.LogDir, "bench")
+	logConfig.LogLevel = c.LogLevel
+	errs = append(errs, logConfig.Validate()...)
+
+	return errs
+}
+
+// parseIntList parses comma separated positive ints
+func parseIntList(list string) ([]int, error) {
+	values := make([]int, 0)
+	for _, item := range strings.Split(list, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		if value < 1 {
+			return nil, fmt.Errorf("%d is not positive", value)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// isScheme reports whether name is one of the supported schemes
+func isScheme(name string) bool {
+	for _, scheme := range Schemes {
+		if scheme == name {
+			return true
+		}
+	}
+	return false
+}
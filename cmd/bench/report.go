@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strconv"
+)
+
+var csvHeader = []string{
+	"scheme", "sensorCnt", "batchSize", "batchCnt", "repetition", "taskId",
+	"expected", "result", "correct", "error",
+	"keyGenerationTime", "deriveKeyTime", "encryptionTime", "encryptedBatches",
+	"partialDecryptionTime", "decryptionTime", "ciphersSubmitted", "ciphersReceived", "resultDelay",
+}
+
+func (r *runResult) csvRecord() []string {
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 6, 64)
+	}
+
+	return []string{
+		r.Scheme, strconv.Itoa(r.SensorCnt), strconv.Itoa(r.BatchSize), strconv.Itoa(r.BatchCnt), strconv.Itoa(r.Repetition), string(r.TaskId),
+		strconv.FormatInt(r.Expected, 10), strconv.FormatInt(r.Result, 10), strconv.FormatBool(r.Correct), r.Error,
+		formatFloat(r.KeyGenerationTime), formatFloat(r.DeriveKeyTime), formatFloat(r.EncryptionTime), strconv.FormatUint(r.EncryptedBatches, 10),
+		formatFloat(r.PartialDecryptionTime), formatFloat(r.DecryptionTime), strconv.Itoa(r.CiphersSubmitted), strconv.Itoa(r.CiphersReceived), formatFloat(r.ResultDelay),
+	}
+}
+
+func writeCSVReport(path string, results []*runResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	_ = writer.Write(csvHeader)
+	for _, result := range results {
+		_ = writer.Write(result.csvRecord())
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeJSONReport(path string, results []*runResult) error {
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	. "fe/common"
+	"fe/server"
+	"fe/testkit"
+	"fmt"
+	"time"
+)
+
+// runParams is a single point of the sweep
+type runParams struct {
+	Scheme     string `json:"scheme"`
+	SensorCnt  int    `json:"sensorCnt"`
+	BatchSize  int    `json:"batchSize"`
+	BatchCnt   int    `json:"batchCnt"`
+	Repetition int    `json:"repetition"`
+}
+
+func (p runParams) String() string {
+	return fmt.Sprintf("%s, %d sensors, %d batches of %d samples, run %d", p.Scheme, p.SensorCnt, p.BatchCnt, p.BatchSize, p.Repetition)
+}
+
+// supported reports whether p.Scheme can be used for the task; single-input schemes support only one sensor that
+// submits one batch
+func (p runParams) supported() bool {
+	return CheckScheme(p.Scheme, p.Scheme != SchemeDummy, p.SensorCnt, p.BatchCnt) == nil
+}
+
+// runResult holds the outcome and the timings (in seconds) of a single run
+type runResult struct {
+	runParams
+	TaskId UUID `json:"taskId"`
+
+	Expected int64  `json:"expected"`
+	Result   int64  `json:"result"`
+	Correct  bool   `json:"correct"`
+	Error    string `json:"error,omitempty"`
+
+	KeyGenerationTime     float64 `json:"keyGenerationTime"`
+	DeriveKeyTime         float64 `json:"deriveKeyTime"`
+	EncryptionTime        float64 `json:"encryptionTime"` // summed over all batches of all sensors
+	EncryptedBatches      uint64  `json:"encryptedBatches"`
+	PartialDecryptionTime float64 `json:"partialDecryptionTime"` // summed over all ciphers
+	DecryptionTime        float64 `json:"decryptionTime"`
+	CiphersSubmitted      int     `json:"ciphersSubmitted"`
+	CiphersReceived       int     `json:"ciphersReceived"`
+	ResultDelay           float64 `json:"resultDelay"` // from the end of sampling until the result is observed
+}
+
+// run starts a new testkit.Cluster, runs one task on it, checks its result and collects the metrics of the hosts
+func run(config *BenchConfig, params runParams, logDir string) *runResult {
+	result := &runResult{runParams: params}
+	if err := result.run(config, logDir); err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (r *runResult) run(config *BenchConfig, logDir string) error {
+	c, err := testkit.StartCluster(testkit.Options{
+		SensorCnt:       r.SensorCnt,
+		PollingInterval: time.Duration(config.PollingInterval),
+		LogDir:          logDir,
+		LogLevel:        config.LogLevel,
+		DlogTableDir:    config.DlogTableDir,
+
+		EncryptionWorkers: config.EncryptionWorkers,
+		MaxQueuedBatches:  config.MaxQueuedBatches,
+	})
+	if err != nil {
+		return err
+	}
+	defer c.Shutdown()
+
+	//region task
+
+	tariffId, err := c.AddTariff(server.Tariff{
+		Description:    "bench",
+		SamplingPeriod: config.SamplingPeriod,
+		BatchSize:      r.BatchSize,
+		MinSampleValue: config.MinSampleValue,
+		MaxSampleValue: config.MaxSampleValue,
+		MinTariffValue: config.MinTariffValue,
+		MaxTariffValue: config.MaxTariffValue,
+		SampleScale:    config.SampleScale,
+		RateScale:      config.RateScale,
+	})
+	if err != nil {
+		return err
+	}
+
+	start := c.Now().Add(time.Duration(config.StartDelay)).Add(time.Second).Truncate(time.Second)
+	duration := config.SamplingPeriod * r.BatchSize * r.BatchCnt
+	if r.TaskId, err = c.AddTask(ServerTaskRequest{
+		Start:            int(start.Unix()),
+		Duration:         duration,
+		TariffId:         tariffId,
+		EnableEncryption: r.Scheme != SchemeDummy,
+		Scheme:           r.Scheme,
+	}); err != nil {
+		return err
+	}
+
+	//endregion
+
+	//region result
+
+	samplingEnd := start.Add(time.Duration(duration) * time.Second)
+	if r.Result, err = c.WaitForResult(r.TaskId, time.Until(samplingEnd)+time.Duration(config.ResultTimeout)); err != nil {
+		return err
+	}
+	r.ResultDelay = time.Since(samplingEnd).Seconds()
+
+	if r.Expected, err = c.ExpectedResult(r.TaskId); err != nil {
+		return err
+	}
+	r.Correct = r.Expected == r.Result
+
+	//endregion
+
+	//region metrics
+
+	r.KeyGenerationTime, _ = c.Authority.Metrics.HistogramTotals("fe_keygen_duration_seconds")
+	r.DeriveKeyTime, _ = c.Authority.Metrics.HistogramTotals("fe_derive_key_duration_seconds")
+	r.PartialDecryptionTime, _ = c.Server.Metrics.HistogramTotals("fe_partial_decryption_duration_seconds")
+	r.DecryptionTime, _ = c.Server.Metrics.HistogramTotals("fe_decryption_duration_seconds")
+	r.CiphersReceived = int(c.Server.Metrics.CounterTotal("fe_ciphers_received_total"))
+
+	for _, s := range c.Sensors {
+		encryptionTime, encryptedBatches := s.Metrics.HistogramTotals("fe_encryption_duration_seconds")
+		r.EncryptionTime += encryptionTime
+		r.EncryptedBatches += encryptedBatches
+		r.CiphersSubmitted += int(s.Metrics.CounterTotal("fe_ciphers_submitted_total"))
+
+		// with the decentralized scheme, the sensors generate the keys instead of the authority
+		keyGenerationTime, _ := s.Metrics.HistogramTotals("fe_keygen_duration_seconds")
+		r.KeyGenerationTime += keyGenerationTime
+		deriveKeyTime, _ := s.Metrics.HistogramTotals("fe_derive_key_duration_seconds")
+		r.DeriveKeyTime += deriveKeyTime
+	}
+
+	//endregion
+
+	return nil
+}
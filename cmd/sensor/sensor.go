@@ -4,45 +4,41 @@ import (
 	. "fe/common"
 	. "fe/sensor"
 	"fmt"
-	"net"
 	"os"
 )
 
-func SensorMain() {
-	// init server
-	args := os.Args[1:]
-	argsCnt := len(args)
-	defaultArgs := []string{GetIPv4().String(), "8081", "http"}
-
-	if argsCnt == 1 || argsCnt > 3 {
-		panic("arg error")
+// SensorMain runs the sensor until it's shut down; it exits with 1 if it can't start, or if its http server fails.
+func SensorMain() int {
+	config := DefaultSensorConfig()
+	printOnly, err := LoadConfig(config, "sensor", "FE_SENSOR", os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return 1
 	}
 
-	if len(args) != 3 {
-		args = append(args, defaultArgs[argsCnt:]...)
+	if printOnly {
+		return 0
 	}
 
-	ipv4 := net.ParseIP(args[0])
-	if ipv4 == nil {
-		fmt.Errorf("not a valid ipv4")
-		return
-	}
+	fmt.Printf("sensor started on %s \n", config.GetIP())
 
-	fmt.Printf("sensor started with args: %s \n", args)
+	GobInit()
 
-	ip := IP{
-		Scheme: args[2],
-		IPv4:   net.ParseIP(args[0]),
-		Port:   args[1],
+	sensor, err := InitSensor(config, RealClock{})
+	if err != nil {
+		fmt.Println(err)
+		return 1
 	}
 
-	GobInit()
-
-	sensor := InitSensor()
 	sensor.StartTaskDaemon(StartTaskWorker)
-	sensor.RunHttpServer(ip)
+	report := sensor.Run(config.GetIP())
+	fmt.Printf("shut down; %s\n", report)
+	if report.HttpServerErr != nil {
+		return 1
+	}
+	return 0
 }
 
 func main() {
-	SensorMain()
+	os.Exit(SensorMain())
 }
@@ -4,30 +4,39 @@ import (
 	. "fe/common"
 	. "fe/server"
 	"fmt"
+	"os"
 )
 
-func ServerMain() {
-	// todo add args
-
-	err := InitLogger("server")
+// ServerMain runs the server until it's shut down; it exits with 1 if it can't start, or if its http server fails.
+func ServerMain() int {
+	config := DefaultServerConfig()
+	printOnly, err := LoadConfig(config, "server", "FE_SERVER", os.Args[1:], os.Stdout)
 	if err != nil {
 		fmt.Println(err)
-		return
+		return 1
 	}
 
-	ip := IP{
-		Scheme: "http",
-		IPv4:   GetIPv4(),
-		Port:   "8080",
+	if printOnly {
+		return 0
 	}
 
 	GobInit()
 
-	server := InitServer()
+	server, err := InitServer(config, RealClock{})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
 	server.StartTaskDaemon(StartTaskWorker)
-	server.RunHttpServer(ip)
+	report := server.Run(config.GetIP())
+	fmt.Printf("shut down; %s\n", report)
+	if report.HttpServerErr != nil {
+		return 1
+	}
+	return 0
 }
 
 func main() {
-	ServerMain()
+	os.Exit(ServerMain())
 }
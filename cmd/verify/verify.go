@@ -0,0 +1,97 @@
+package main
+
+import (
+	. "fe/common"
+	. "fe/server"
+	"fmt"
+	"os"
+)
+
+// VerifyConfig names the bundle to check, and the keys the customer trusts; the keys that aren't pinned are taken
+// from the bundle.
+type VerifyConfig struct {
+	Bundle       string `yaml:"bundle" toml:"bundle" flag:"bundle" usage:"path of the bundle, as returned by GET /v1/tasks/:id/bundle"`
+	AuthorityKey string `yaml:"authorityKey" toml:"authorityKey" flag:"authority-key" usage:"hex encoded public key of the authority, as returned by its GET /v1/public-key"`
+	ServerKey    string `yaml:"serverKey" toml:"serverKey" flag:"server-key" usage:"hex encoded public key of the server"`
+	SensorKeys   string `yaml:"sensorKeys" toml:"sensorKeys" flag:"sensor-keys" usage:"comma separated sensorId=key pairs of the public keys of the sensors"`
+	DlogTableDir string `yaml:"dlogTableDir" toml:"dlogTableDir" flag:"dlog-table-dir" usage:"directory the discrete logarithm tables are cached in; if empty, they are cached only in memory"`
+}
+
+func DefaultVerifyConfig() *VerifyConfig {
+	return &VerifyConfig{}
+}
+
+func (c *VerifyConfig) Validate() []error {
+	errs := make([]error, 0)
+
+	if c.Bundle == "" {
+		errs = append(errs, fmt.Errorf("bundle must be set"))
+	}
+	if _, err := ParseSensorKeys(c.SensorKeys); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// VerifyMain checks the bundle of a billed task offline, and prints the outcome of every check; it exits with 1 if
+// any of them fails.
+func VerifyMain() int {
+	config := DefaultVerifyConfig()
+	printOnly, err := LoadConfig(config, "verify", "FE_VERIFY", os.Args[1:], os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	if printOnly {
+		return 0
+	}
+
+	GobInit()
+
+	data, err := os.ReadFile(config.Bundle)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	bundle := &Bundle{}
+	if err = UnmarshalData(data, bundle); err != nil {
+		fmt.Printf("invalid bundle: %s\n", err)
+		return 2
+	}
+
+	sensorKeys, _ := ParseSensorKeys(config.SensorKeys)
+	keys := PinnedKeys{
+		Authority: config.AuthorityKey,
+		Server:    config.ServerKey,
+		Sensors:   sensorKeys,
+	}
+	if keys.Authority == "" || keys.Server == "" || len(keys.Sensors) < len(bundle.Sensors) {
+		fmt.Println("warning: not all the keys are pinned, the keys of the bundle are trusted")
+	}
+
+	statement := bundle.Statement
+	fmt.Printf("task %s of customer %s: %s (%s)\n", statement.TaskId, statement.CustomerId, statement.Amount, bundle.Scheme)
+
+	failed := 0
+	for _, check := range VerifyBundle(bundle, keys, config.DlogTableDir) {
+		if check.Err == nil {
+			fmt.Printf("  ok:     %s\n", check.Name)
+		} else {
+			failed++
+			fmt.Printf("  failed: %s: %s\n", check.Name, check.Err)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d checks failed\n", failed)
+		return 1
+	}
+	fmt.Println("the statement is verified")
+	return 0
+}
+
+func main() {
+	os.Exit(VerifyMain())
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// The hosts serve their APIs under V1Prefix, with plural resource names (e.g. /v1/tasks/:id). The JSON and the text
+// responses of the /v1 endpoints are wrapped in a DataEnvelope, and their errors in an ErrorEnvelope, whose APIError
+// has a machine-readable ErrorCode; the gob encoded FE params, the files and the event streams are sent as they are.
+// The unversioned endpoints are kept for the older clients, but are deprecated; fe/client is the client of the /v1
+// APIs.
+
+// V1Prefix is the prefix of the paths of the /v1 APIs
+const V1Prefix = "/v1"
+
+// DeprecationHeader is set on the responses of the deprecated endpoints
+const DeprecationHeader = "Deprecation"
+
+type ErrorCode string
+
+const (
+	ErrorInvalidRequest  ErrorCode = "invalid_request"
+	ErrorUnauthenticated ErrorCode = "unauthenticated"
+	ErrorForbidden       ErrorCode = "forbidden"
+	ErrorNotFound        ErrorCode = "not_found"
+	ErrorConflict        ErrorCode = "conflict"
+	ErrorGone            ErrorCode = "gone"
+	ErrorInternal        ErrorCode = "internal"
+	ErrorNotImplemented  ErrorCode = "not_implemented"
+	ErrorBadGateway      ErrorCode = "bad_gateway"
+	ErrorUnavailable     ErrorCode = "unavailable"
+)
+
+var errorCodes = []ErrorCode{
+	ErrorInvalidRequest, ErrorUnauthenticated, ErrorForbidden, ErrorNotFound, ErrorConflict, ErrorGone, ErrorInternal,
+	ErrorNotImplemented, ErrorBadGateway, ErrorUnavailable,
+}
+
+// ErrorCodeForStatus returns the code of the errors with the status code
+func ErrorCodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrorUnauthenticated
+	case http.StatusForbidden:
+		return ErrorForbidden
+	case http.StatusNotFound:
+		return ErrorNotFound
+	case http.StatusConflict:
+		return ErrorConflict
+	case http.StatusGone:
+		return ErrorGone
+	case http.StatusNotImplemented:
+		return ErrorNotImplemented
+	case http.StatusBadGateway:
+		return ErrorBadGateway
+	case http.StatusServiceUnavailable:
+		return ErrorUnavailable
+	}
+	if status >= http.StatusInternalServerError {
+		return ErrorInternal
+	}
+	return ErrorInvalidRequest
+}
+
+// APIError is the error of a /v1 endpoint; Status is the status code of the response
+type APIError struct {
+	Status  int       `json:"-"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details []string  `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if len(e.Details) == 0 {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Code, e.Message, strings.Join(e.Details, "; "))
+}
+
+// NewAPIError returns the error of the status, with the code the status has by default
+func NewAPIError(status int, format string, args ...any) *APIError {
+	return &APIError{
+		Status:  status,
+		Code:    ErrorCodeForStatus(status),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// toAPIError converts the body of an ErrorResponse
+func toAPIError(status int, body any) *APIError {
+	var apiError *APIError
+	switch body := body.(type) {
+	case *APIError:
+		return body
+	case error:
+		if errors.As(body, &apiError) {
+			return apiError
+		}
+		return NewAPIError(status, "%s", body)
+	case string:
+		return NewAPIError(status, "%s", body)
+	case []error:
+		apiError = NewAPIError(status, "%d errors", len(body))
+		for _, err := range body {
+			apiError.Details = append(apiError.Details, err.Error())
+		}
+		return apiError
+	}
+	panic("unknown response type")
+}
+
+type DataEnvelope struct {
+	Data any `json:"data"`
+}
+
+type ErrorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+// UnmarshalData unmarshals the JSON response of an endpoint into v; the response of a /v1 endpoint is unwrapped from
+// its DataEnvelope, so that the offline tools read the files saved from either
+func UnmarshalData(data []byte, v any) error {
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &envelope); err == nil && len(envelope.Data) > 0 {
+		data = envelope.Data
+	}
+	return json.Unmarshal(data, v)
+}
+
+// envelope wraps the responses of the handler in a DataEnvelope, and its errors in an ErrorEnvelope
+func envelope(next EndpointHandler) EndpointHandler {
+	return func(c *gin.Context) (ResponseType, int, any) {
+		responseType, code, body := next(c)
+		switch responseType {
+		case JSONResponse, StringResponse:
+			return JSONResponse, code, DataEnvelope{Data: body}
+		case ErrorResponse:
+			return ErrorResponse, code, toAPIError(code, body)
+		}
+		return responseType, code, body
+	}
+}
+
+// noRoute answers the requests no endpoint is routed for
+func noRoute(c *gin.Context) {
+	c.JSON(http.StatusNotFound, ErrorEnvelope{Error: NewAPIError(http.StatusNotFound, "no endpoint %s %s", c.Request.Method, c.Request.URL.Path)})
+}
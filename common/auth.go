@@ -0,0 +1,320 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An HttpServer with an Authenticator requires the callers of the endpoints that declare roles (see Endpoint.Roles)
+// to authenticate with a bearer token in AuthorizationHeader: an API key, or a JWT signed with HS256. The Principal
+// of the token must have one of the roles of the endpoint; the handlers then scope the customers and the sensors to
+// their own resources with AuthorizeSubject. The operators may access everything.
+//
+// The hosts authenticate to each other the same way: the server to the authority and the share holders with
+// ServerConfig.AuthorityCredentialFile, the dealer to the share holders with AuthorityConfig.ShareHolderCredentialFile,
+// and the sensors to the authority with their credential for the server, which the authority must accept too (a JWT
+// signed with the secret both share, or an API key listed in both).
+
+// AuthorizationHeader carries the caller's credential, as "Bearer <token>"
+const AuthorizationHeader = "Authorization"
+
+type Role string
+
+const (
+	RoleOperator  Role = "operator"
+	RoleCustomer  Role = "customer"
+	RoleSensor    Role = "sensor"
+	RoleAuthority Role = "authority"
+	RoleServer    Role = "server"
+)
+
+func (r Role) Verify() bool {
+	switch r {
+	case RoleOperator, RoleCustomer, RoleSensor, RoleAuthority, RoleServer:
+		return true
+	}
+	return false
+}
+
+// Principal is the authenticated caller; Subject is the id of the customer or the sensor the credential is
+// scoped to, and is empty for the operators, the authority and the server
+type Principal struct {
+	Role    Role `json:"role"`
+	Subject UUID `json:"subject,omitempty"`
+}
+
+func (p *Principal) String() string {
+	if p.Subject.IsNil() {
+		return string(p.Role)
+	}
+	return string(p.Role) + " " + string(p.Subject)
+}
+
+//region config
+
+type AuthConfig struct {
+	APIKeysFile   string `yaml:"apiKeysFile" toml:"apiKeysFile" flag:"api-keys-file" usage:"JSON file of the API keys, a list of {key, role, subject}; if neither it nor jwtSecretFile is set, the endpoints are unauthenticated"`
+	JWTSecretFile string `yaml:"jwtSecretFile" toml:"jwtSecretFile" flag:"jwt-secret-file" usage:"file of the secret the HS256 JWTs are signed with; their role and sub claims are the caller's role and subject"`
+}
+
+// APIKey is an entry of AuthConfig.APIKeysFile
+type APIKey struct {
+	Key string `json:"key"`
+	Principal
+}
+
+func (c *AuthConfig) IsEnabled() bool {
+	return c.APIKeysFile != "" || c.JWTSecretFile != ""
+}
+
+// ReadCredentialFile returns the API key or the JWT in the file, which a host authenticates to another host with; it
+// returns an empty credential if there's no file
+func ReadCredentialFile(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	credential := strings.TrimSpace(string(data))
+	if credential == "" {
+		return "", fmt.Errorf("credential file %s is empty", file)
+	}
+	return credential, nil
+}
+
+//endregion
+
+//region Authenticator
+
+type Authenticator struct {
+	apiKeys   map[string]Principal // by the hash of the key
+	keysMutex sync.RWMutex
+	jwtSecret []byte // nil if the JWTs aren't accepted
+	clock     Clock
+}
+
+// NewAuthenticator loads the API keys and the JWT secret of the config; it returns nil if the config has neither
+func NewAuthenticator(config *AuthConfig, clock Clock) (*Authenticator, error) {
+	if !config.IsEnabled() {
+		return nil, nil
+	}
+
+	a := &Authenticator{
+		apiKeys: make(map[string]Principal),
+		clock:   clock,
+	}
+
+	if config.APIKeysFile != "" {
+		data, err := os.ReadFile(config.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		var keys []APIKey
+		if err = json.Unmarshal(data, &keys); err != nil {
+			return nil, fmt.Errorf("invalid API keys file %s: %s", config.APIKeysFile, err)
+		}
+		for idx, key := range keys {
+			if key.Key == "" || !key.Role.Verify() {
+				return nil, fmt.Errorf("API key no %d of %s has no key, or an invalid role %q", idx, config.APIKeysFile, key.Role)
+			}
+			a.AddAPIKey(key.Key, key.Principal)
+		}
+	}
+
+	if config.JWTSecretFile != "" {
+		secret, err := os.ReadFile(config.JWTSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		if a.jwtSecret = []byte(strings.TrimSpace(string(secret))); len(a.jwtSecret) == 0 {
+			return nil, fmt.Errorf("JWT secret file %s is empty", config.JWTSecretFile)
+		}
+	}
+
+	return a, nil
+}
+
+// AddAPIKey accepts the key as the credential of the principal; only its hash is kept
+func (a *Authenticator) AddAPIKey(key string, principal Principal) {
+	a.keysMutex.Lock()
+	defer a.keysMutex.Unlock()
+	a.apiKeys[hashAPIKey(key)] = principal
+}
+
+// IssueAPIKey returns a new random API key of the principal
+func (a *Authenticator) IssueAPIKey(principal Principal) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(data)
+	a.AddAPIKey(key, principal)
+	return key, nil
+}
+
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+var errUnauthenticated = errors.New("invalid credentials")
+
+// Authenticate returns the principal of the token, an API key or a JWT
+func (a *Authenticator) Authenticate(token string) (*Principal, error) {
+	if strings.Count(token, ".") == 2 {
+		return a.authenticateJWT(token)
+	}
+
+	a.keysMutex.RLock()
+	defer a.keysMutex.RUnlock()
+	if principal, ok := a.apiKeys[hashAPIKey(token)]; ok {
+		return &principal, nil
+	}
+	return nil, errUnauthenticated
+}
+
+//endregion
+
+//region JWT
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type jwtClaims struct {
+	Subject   UUID  `json:"sub,omitempty"`
+	Role      Role  `json:"role"`
+	ExpiresAt int64 `json:"exp,omitempty"` // unix timestamp; the token doesn't expire if it's 0
+}
+
+var jwtEncoding = base64.RawURLEncoding
+
+// SignJWT returns a JWT of the principal signed with HS256, which expires after ttl; a zero ttl never expires
+func SignJWT(secret []byte, principal Principal, ttl time.Duration, clock Clock) (string, error) {
+	claims := jwtClaims{Subject: principal.Subject, Role: principal.Role}
+	if ttl != 0 {
+		claims.ExpiresAt = clock.Now().Add(ttl).Unix()
+	}
+
+	header, err := json.Marshal(jwtHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := jwtEncoding.EncodeToString(header) + "." + jwtEncoding.EncodeToString(payload)
+	return signed + "." + jwtEncoding.EncodeToString(signJWT(secret, signed)), nil
+}
+
+func signJWT(secret []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func (a *Authenticator) authenticateJWT(token string) (*Principal, error) {
+	if a.jwtSecret == nil {
+		return nil, errUnauthenticated
+	}
+
+	parts := strings.Split(token, ".")
+	signature, err := jwtEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, signJWT(a.jwtSecret, parts[0]+"."+parts[1])) {
+		return nil, errUnauthenticated
+	}
+
+	// the header is checked only after the signature, so that the algorithm can't be chosen by the caller
+	var header jwtHeader
+	if data, err := jwtEncoding.DecodeString(parts[0]); err != nil || json.Unmarshal(data, &header) != nil || header.Alg != "HS256" {
+		return nil, errUnauthenticated
+	}
+	var claims jwtClaims
+	if data, err := jwtEncoding.DecodeString(parts[1]); err != nil || json.Unmarshal(data, &claims) != nil {
+		return nil, errUnauthenticated
+	}
+	if !claims.Role.Verify() || (claims.ExpiresAt != 0 && a.clock.Now().Unix() >= claims.ExpiresAt) {
+		return nil, errUnauthenticated
+	}
+
+	return &Principal{Role: claims.Role, Subject: claims.Subject}, nil
+}
+
+//endregion
+
+//region request authorization
+
+const principalKey = "principal"
+
+// authorize authenticates the request, and checks that its principal has one of the roles; if it doesn't, it
+// returns the status code of the refusal
+func (a *Authenticator) authorize(c *gin.Context, roles []Role) (int, error) {
+	token, ok := strings.CutPrefix(c.GetHeader(AuthorizationHeader), "Bearer ")
+	if !ok || token == "" {
+		c.Header("WWW-Authenticate", "Bearer")
+		return http.StatusUnauthorized, fmt.Errorf("authentication required")
+	}
+	principal, err := a.Authenticate(token)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return http.StatusUnauthorized, err
+	}
+
+	for _, role := range roles {
+		if principal.Role == role {
+			c.Set(principalKey, principal)
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusForbidden, fmt.Errorf("%s may not %s %s", principal, c.Request.Method, c.FullPath())
+}
+
+// Authorize is the Middleware that lets through only the callers with one of the roles
+func (a *Authenticator) Authorize(roles []Role) Middleware {
+	return func(next EndpointHandler) EndpointHandler {
+		return func(c *gin.Context) (ResponseType, int, any) {
+			if code, err := a.authorize(c, roles); err != nil {
+				return ErrorResponse, code, err.Error()
+			}
+			return next(c)
+		}
+	}
+}
+
+// GetPrincipal returns the authenticated caller of the request, or nil if the request isn't authenticated
+func GetPrincipal(c *gin.Context) *Principal {
+	principal, ok := c.Get(principalKey)
+	if !ok {
+		return nil
+	}
+	return principal.(*Principal)
+}
+
+// AuthorizeSubject reports whether the caller of the request may access the resources of subject, which has the
+// role; the requests that aren't authenticated have been let through by the HttpServer, and are authorized
+func AuthorizeSubject(c *gin.Context, role Role, subject UUID) bool {
+	principal := GetPrincipal(c)
+	if principal == nil || principal.Role == RoleOperator {
+		return true
+	}
+	return principal.Role == role && principal.Subject == subject
+}
+
+//endregion
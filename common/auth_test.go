@@ -0,0 +1,231 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes data to a new file of the test's temp dir, and returns its path
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// newTestAuthenticator returns an Authenticator of an operator and a customer API key, which accepts the JWTs
+// signed with secret
+func newTestAuthenticator(t *testing.T, secret []byte) *Authenticator {
+	t.Helper()
+
+	keys, err := json.Marshal([]APIKey{
+		{Key: "operator-key", Principal: Principal{Role: RoleOperator}},
+		{Key: "customer-key", Principal: Principal{Role: RoleCustomer, Subject: "customer-0"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := NewAuthenticator(&AuthConfig{
+		APIKeysFile:   writeFile(t, "api-keys.json", keys),
+		JWTSecretFile: writeFile(t, "jwt-secret", append(secret, '\n')),
+	}, RealClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticator
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	if authenticator, err := NewAuthenticator(&AuthConfig{}, RealClock{}); authenticator != nil || err != nil {
+		t.Errorf("authenticator without API keys or JWT secret: %v, %v", authenticator, err)
+	}
+
+	tests := []struct {
+		name string
+		keys string
+	}{
+		{"invalid role", `[{"key": "key", "role": "admin"}]`},
+		{"no key", `[{"role": "operator"}]`},
+		{"not a list", `{"key": "key", "role": "operator"}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &AuthConfig{APIKeysFile: writeFile(t, "api-keys.json", []byte(test.keys))}
+			if _, err := NewAuthenticator(config, RealClock{}); err == nil {
+				t.Error("invalid API keys file accepted")
+			}
+		})
+	}
+
+	t.Run("empty JWT secret", func(t *testing.T) {
+		config := &AuthConfig{JWTSecretFile: writeFile(t, "jwt-secret", []byte(" \n"))}
+		if _, err := NewAuthenticator(config, RealClock{}); err == nil {
+			t.Error("empty JWT secret accepted")
+		}
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	secret := []byte("secret")
+	authenticator := newTestAuthenticator(t, secret)
+	issued, err := authenticator.IssueAPIKey(Principal{Role: RoleSensor, Subject: "sensor-0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(secret []byte, principal Principal, ttl time.Duration) string {
+		token, err := SignJWT(secret, principal, ttl, RealClock{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	customerJWT := sign(secret, Principal{Role: RoleCustomer, Subject: "customer-1"}, time.Hour)
+	payload := strings.Split(customerJWT, ".")[1]
+	unsigned := jwtEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + payload + "."
+
+	tests := []struct {
+		name      string
+		token     string
+		principal Principal
+		valid     bool
+	}{
+		{"API key", "operator-key", Principal{Role: RoleOperator}, true},
+		{"scoped API key", "customer-key", Principal{Role: RoleCustomer, Subject: "customer-0"}, true},
+		{"issued API key", issued, Principal{Role: RoleSensor, Subject: "sensor-0"}, true},
+		{"unknown API key", "unknown-key", Principal{}, false},
+		{"JWT", customerJWT, Principal{Role: RoleCustomer, Subject: "customer-1"}, true},
+		{"JWT without expiry", sign(secret, Principal{Role: RoleOperator}, 0), Principal{Role: RoleOperator}, true},
+		{"expired JWT", sign(secret, Principal{Role: RoleOperator}, -time.Minute), Principal{}, false},
+		{"JWT of another secret", sign([]byte("other"), Principal{Role: RoleOperator}, time.Hour), Principal{}, false},
+		{"unsigned JWT", unsigned, Principal{}, false},
+		{"JWT of an invalid role", sign(secret, Principal{Role: "admin"}, time.Hour), Principal{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			principal, err := authenticator.Authenticate(test.token)
+			if test.valid && err != nil {
+				t.Errorf("valid token rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid token accepted")
+			} else if test.valid && *principal != test.principal {
+				t.Errorf("principal %s, expected %s", principal, &test.principal)
+			}
+		})
+	}
+
+	t.Run("JWT without a secret", func(t *testing.T) {
+		keysFile := writeFile(t, "api-keys.json", []byte(`[{"key": "operator-key", "role": "operator"}]`))
+		keysOnly, err := NewAuthenticator(&AuthConfig{APIKeysFile: keysFile}, RealClock{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = keysOnly.Authenticate(customerJWT); err == nil {
+			t.Error("JWT accepted without a secret")
+		}
+	})
+}
+
+// newTestContext returns the context of a request with the credential
+func newTestContext(credential string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	if credential != "" {
+		c.Request.Header.Set(AuthorizationHeader, "Bearer "+credential)
+	}
+	return c
+}
+
+func TestAuthorize(t *testing.T) {
+	authenticator := newTestAuthenticator(t, []byte("secret"))
+	handler := authenticator.Authorize([]Role{RoleOperator, RoleCustomer})(func(c *gin.Context) (ResponseType, int, any) {
+		return NoResponse, http.StatusOK, GetPrincipal(c)
+	})
+
+	tests := []struct {
+		name       string
+		credential string
+		code       int
+	}{
+		{"operator", "operator-key", http.StatusOK},
+		{"customer", "customer-key", http.StatusOK},
+		{"no credential", "", http.StatusUnauthorized},
+		{"invalid credential", "unknown-key", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestContext(test.credential)
+			if _, code, _ := handler(c); code != test.code {
+				t.Errorf("status %d, expected %d", code, test.code)
+			}
+		})
+	}
+
+	t.Run("other role", func(t *testing.T) {
+		sensorKey, err := authenticator.IssueAPIKey(Principal{Role: RoleSensor, Subject: "sensor-0"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, code, _ := handler(newTestContext(sensorKey)); code != http.StatusForbidden {
+			t.Errorf("status %d, expected %d", code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("principal", func(t *testing.T) {
+		_, _, principal := handler(newTestContext("customer-key"))
+		if p, ok := principal.(*Principal); !ok || p.Subject != "customer-0" {
+			t.Errorf("principal of the request %v, expected customer customer-0", principal)
+		}
+	})
+}
+
+func TestAuthorizeSubject(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		valid     bool
+	}{
+		{"unauthenticated", nil, true},
+		{"operator", &Principal{Role: RoleOperator}, true},
+		{"own subject", &Principal{Role: RoleCustomer, Subject: "customer-0"}, true},
+		{"other subject", &Principal{Role: RoleCustomer, Subject: "customer-1"}, false},
+		{"other role", &Principal{Role: RoleSensor, Subject: "customer-0"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestContext("")
+			if test.principal != nil {
+				c.Set(principalKey, test.principal)
+			}
+			authorized := AuthorizeSubject(c, RoleCustomer, "customer-0")
+			if test.valid && !authorized {
+				t.Error("valid principal refused")
+			} else if !test.valid && authorized {
+				t.Error("invalid principal authorized")
+			}
+		})
+	}
+}
+
+func TestReadCredentialFile(t *testing.T) {
+	if credential, err := ReadCredentialFile(""); credential != "" || err != nil {
+		t.Errorf("credential without a file: %q, %v", credential, err)
+	}
+	credential, err := ReadCredentialFile(writeFile(t, "credential", []byte("key\n")))
+	if err != nil || credential != "key" {
+		t.Errorf("credential %q, %v, expected key", credential, err)
+	}
+	if _, err = ReadCredentialFile(writeFile(t, "empty", []byte("\n"))); err == nil {
+		t.Error("empty credential file accepted")
+	}
+}
@@ -0,0 +1,32 @@
+package common
+
+import (
+	"time"
+)
+
+// ClockSyncResponse is the remote host's part of an NTP-style exchange: the times on its Clock (in unix ns)
+// when the request was received and when the response was sent.
+type ClockSyncResponse struct {
+	ReceiveTime  int64 `json:"receive_time"`
+	TransmitTime int64 `json:"transmit_time"`
+}
+
+// ClockSync is the result of measuring the offset of a remote host's clock.
+type ClockSync struct {
+	Offset     time.Duration `json:"offset"`      // remote clock - local clock
+	Delay      time.Duration `json:"delay"`       // round trip, without the time spent in the remote host
+	MeasuredAt time.Time     `json:"measured_at"` // on the local clock
+}
+
+// NewClockSync computes the offset and the delay of an exchange that was sent at sent and received at received
+// on the local clock
+func NewClockSync(sent time.Time, response ClockSyncResponse, received time.Time) ClockSync {
+	receiveTime := time.Unix(0, response.ReceiveTime)
+	transmitTime := time.Unix(0, response.TransmitTime)
+
+	return ClockSync{
+		Offset:     (receiveTime.Sub(sent) + transmitTime.Sub(received)) / 2,
+		Delay:      received.Sub(sent) - transmitTime.Sub(receiveTime),
+		MeasuredAt: received,
+	}
+}
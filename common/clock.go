@@ -0,0 +1,54 @@
+package common
+
+import "time"
+
+// Clock is the time used for scheduling: when sampling starts, how often sensors are sampled, and how often
+// params are polled. Every Host has its own Clock, which is passed to its Runnables and tasks; durations of the work
+// itself (encryption, decryption...) are always measured on the wall clock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker sends the time on C every period, until it's stopped; like time.Ticker, it drops ticks for slow receivers.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the wall clock.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// clockOrDefault returns clock, or RealClock if clock is nil
+func clockOrDefault(clock Clock) Clock {
+	if clock == nil {
+		return RealClock{}
+	}
+	return clock
+}
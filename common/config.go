@@ -1,21 +1,552 @@
 package common
 
-import "time"
-
-const (
-	FHMultiIPESecLevel              = 1
-	MaxParallelSubmissionsPerSensor = 3 //
-	ServerLogDir                    = "server-logs"
-	SensorLogDir                    = "sensor-logs"
-	ServerLogFilename               = "server"
-	SensorLogFilename               = "sensor"
-	ServerTaskDaemonChanSize        = 15
-	SensorTaskChanSize              = 15
-	SensorSamplingChanSizeCoeff     = 2
-	SensorEncryptionChanSizeCoeff   = 1
-	DecryptionParamsPollingInterval = 5 * time.Second
-	SchemaParamsPollingInterval     = 10 * time.Second
-	EncryptionParamsPollingInterval = 10 * time.Second
-	AuthorityLogDir                 = "authority-logs"
-	AuthorityLogFilename            = "authority"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
+
+// Config is implemented by all host configurations; Validate returns every violation found, not just the first one.
+type Config interface {
+	Validate() []error
+}
+
+// Duration is a time.Duration that is written as "5s", "1m30s", ... in config files, env variables and flags.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+//region HostConfig
+
+// HostConfig holds the settings shared by all hosts: where the HttpServer listens, where the logs go, and how many
+// tasks can be queued to the TaskDaemon.
+type HostConfig struct {
+	Scheme       string `yaml:"scheme" toml:"scheme" flag:"scheme" usage:"scheme used by the http server (http or https)"`
+	IPv4         string `yaml:"ipv4" toml:"ipv4" flag:"ip" usage:"ipv4 address of the http server; 'auto' uses the address of the outbound interface"`
+	Port         string `yaml:"port" toml:"port" flag:"port" usage:"port of the http server"`
+	TaskChanSize int    `yaml:"taskChanSize" toml:"taskChanSize" flag:"task-chan-size" usage:"number of tasks that can be queued to the task daemon"`
+
+	LogConfig `yaml:",inline"`
+
+	ShutdownTimeout Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout" flag:"shutdown-timeout" usage:"time given to the task workers to stop after SIGINT or SIGTERM"`
+
+	SigningKeyFile string `yaml:"signingKeyFile" toml:"signingKeyFile" flag:"signing-key-file" usage:"PEM file of the ed25519 key the host signs its records with, created if it doesn't exist; if empty, a new key is generated on every start"`
+}
+
+// GetIP returns the IP the HttpServer should listen on.
+func (c *HostConfig) GetIP() IP {
+	ipv4 := GetIPv4()
+	if c.IPv4 != "auto" {
+		ipv4 = net.ParseIP(c.IPv4)
+	}
+
+	return IP{
+		Scheme: c.Scheme,
+		IPv4:   ipv4,
+		Port:   c.Port,
+	}
+}
+
+func (c *HostConfig) Validate() []error {
+	errs := make([]error, 0)
+
+	if c.Scheme != "http" && c.Scheme != "https" {
+		errs = append(errs, fmt.Errorf("scheme must be http or https, got %q", c.Scheme))
+	}
+
+	if c.IPv4 != "auto" && (net.ParseIP(c.IPv4) == nil || net.ParseIP(c.IPv4).To4() == nil) {
+		errs = append(errs, fmt.Errorf("ip must be a valid ipv4 address or 'auto', got %q", c.IPv4))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be a number in [0, 65535], got %q", c.Port))
+	}
+
+	if c.TaskChanSize <= 0 {
+		errs = append(errs, fmt.Errorf("task chan size must be positive, got %d", c.TaskChanSize))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown timeout must be positive"))
+	}
+
+	errs = append(errs, c.LogConfig.Validate()...)
+	return errs
+}
+
+//endregion
+
+//region LogConfig
+
+// LogConfig defines the format and the level of the logs, and how log files are rotated and retained.
+type LogConfig struct {
+	LogDir        string   `yaml:"logDir" toml:"logDir" flag:"log-dir" usage:"directory for log files"`
+	LogFilename   string   `yaml:"logFilename" toml:"logFilename" flag:"log-filename" usage:"name of the host log file, without extension"`
+	LogFormat     string   `yaml:"logFormat" toml:"logFormat" flag:"log-format" usage:"format of log lines (text or json)"`
+	LogLevel      string   `yaml:"logLevel" toml:"logLevel" flag:"log-level" usage:"minimal level of logged messages (debug, info, warning or error); can be changed at runtime"`
+	LogMaxSize    int      `yaml:"logMaxSize" toml:"logMaxSize" flag:"log-max-size" usage:"size in MB after which a log file is rotated; 0 disables rotation"`
+	LogMaxBackups int      `yaml:"logMaxBackups" toml:"logMaxBackups" flag:"log-max-backups" usage:"number of rotated files kept per log file"`
+	LogRetention  Duration `yaml:"logRetention" toml:"logRetention" flag:"log-retention" usage:"log files not written to for this long are deleted; 0 keeps them forever"`
+}
+
+func DefaultLogConfig(logDir string, logFilename string) LogConfig {
+	return LogConfig{
+		LogDir:        logDir,
+		LogFilename:   logFilename,
+		LogFormat:     "text",
+		LogLevel:      "debug",
+		LogMaxSize:    0,
+		LogMaxBackups: 3,
+		LogRetention:  0,
+	}
+}
+
+func (c *LogConfig) Validate() []error {
+	errs := make([]error, 0)
+
+	if c.LogDir == "" {
+		errs = append(errs, fmt.Errorf("log dir must be set"))
+	}
+
+	if c.LogFilename == "" {
+		errs = append(errs, fmt.Errorf("log filename must be set"))
+	}
+
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("log format must be text or json, got %q", c.LogFormat))
+	}
+
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %q", c.LogLevel))
+	}
+
+	if c.LogMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("log max size can't be negative, got %d", c.LogMaxSize))
+	}
+
+	if c.LogMaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("log max backups can't be negative, got %d", c.LogMaxBackups))
+	}
+
+	if c.LogRetention < 0 {
+		errs = append(errs, fmt.Errorf("log retention can't be negative"))
+	}
+
+	return errs
+}
+
+//endregion
+
+//region ServerConfig
+
+type ServerConfig struct {
+	HostConfig `yaml:",inline"`
+	AuthConfig `yaml:",inline"`
+
+	SchemaParamsPollingInterval     Duration `yaml:"schemaParamsPollingInterval" toml:"schemaParamsPollingInterval" flag:"schema-params-polling-interval" usage:"interval between polling the authority for schema params"`
+	DecryptionParamsPollingInterval Duration `yaml:"decryptionParamsPollingInterval" toml:"decryptionParamsPollingInterval" flag:"decryption-params-polling-interval" usage:"interval between polling the authority for decryption params"`
+
+	ClockSyncSamples     int      `yaml:"clockSyncSamples" toml:"clockSyncSamples" flag:"clock-sync-samples" usage:"number of round trips used to measure the clock offset of a sensor"`
+	ClockOffsetTolerance Duration `yaml:"clockOffsetTolerance" toml:"clockOffsetTolerance" flag:"clock-offset-tolerance" usage:"largest clock offset of a sensor that is accepted without a warning"`
+	RefuseClockOffset    bool     `yaml:"refuseClockOffset" toml:"refuseClockOffset" flag:"refuse-clock-offset" usage:"refuse tasks with sensors whose clock offset exceeds the tolerance, instead of only warning"`
+
+	CipherGracePeriod Duration `yaml:"cipherGracePeriod" toml:"cipherGracePeriod" flag:"cipher-grace-period" usage:"time after the end of a task in which late ciphers are still accepted, unless the task sets its own"`
+
+	AuthorityThreshold      int    `yaml:"authorityThreshold" toml:"authorityThreshold" flag:"authority-threshold" usage:"number of share holders needed to derive a decryption key; 0 disables the threshold mode"`
+	AuthorityCredentialFile string `yaml:"authorityCredentialFile" toml:"authorityCredentialFile" flag:"authority-credential-file" usage:"file of the API key or JWT of the server role, which the server authenticates to the authority and the share holders with"`
+
+	MaxDecryptionSteps  int `yaml:"maxDecryptionSteps" toml:"maxDecryptionSteps" flag:"max-decryption-steps" usage:"largest number of discrete logarithm steps per search of a task's decryption; tasks above it are refused"`
+	WarnDecryptionSteps int `yaml:"warnDecryptionSteps" toml:"warnDecryptionSteps" flag:"warn-decryption-steps" usage:"number of discrete logarithm steps per search of a task's decryption above which a warning is issued"`
+
+	DlogTableDir        string `yaml:"dlogTableDir" toml:"dlogTableDir" flag:"dlog-table-dir" usage:"directory the discrete logarithm tables are cached in; if empty, they are cached only in memory"`
+	DlogTableMaxEntries int    `yaml:"dlogTableMaxEntries" toml:"dlogTableMaxEntries" flag:"dlog-table-max-entries" usage:"largest number of baby steps in a discrete logarithm table; larger bounds are searched with more giant steps"`
+	DlogTableCacheSize  int    `yaml:"dlogTableCacheSize" toml:"dlogTableCacheSize" flag:"dlog-table-cache-size" usage:"number of discrete logarithm tables kept in memory"`
+}
+
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		HostConfig: HostConfig{
+			Scheme:       "http",
+			IPv4:         "127.0.0.1",
+			Port:         "8080",
+			TaskChanSize: 15,
+			LogConfig:    DefaultLogConfig("logs/server-logs", "server"),
+
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		SchemaParamsPollingInterval:     Duration(10 * time.Second),
+		DecryptionParamsPollingInterval: Duration(5 * time.Second),
+
+		ClockSyncSamples:     4,
+		ClockOffsetTolerance: Duration(2 * time.Second),
+		RefuseClockOffset:    false,
+
+		CipherGracePeriod: Duration(15 * time.Minute),
+
+		AuthorityThreshold: 0,
+
+		MaxDecryptionSteps:  1 << 22,
+		WarnDecryptionSteps: 1 << 18,
+
+		DlogTableDir:        "cache/dlog-tables",
+		DlogTableMaxEntries: 1 << 22,
+		DlogTableCacheSize:  4,
+	}
+}
+
+func (c *ServerConfig) Validate() []error {
+	errs := c.HostConfig.Validate()
+
+	if c.SchemaParamsPollingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("schema params polling interval must be positive"))
+	}
+
+	if c.DecryptionParamsPollingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("decryption params polling interval must be positive"))
+	}
+
+	if c.ClockSyncSamples <= 0 {
+		errs = append(errs, fmt.Errorf("clock sync samples must be positive, got %d", c.ClockSyncSamples))
+	}
+
+	if c.ClockOffsetTolerance < 0 {
+		errs = append(errs, fmt.Errorf("clock offset tolerance can't be negative"))
+	}
+
+	if c.CipherGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("cipher grace period can't be negative"))
+	}
+
+	if c.AuthorityThreshold < 0 {
+		errs = append(errs, fmt.Errorf("authority threshold can't be negative, got %d", c.AuthorityThreshold))
+	}
+
+	if c.MaxDecryptionSteps <= 0 || c.WarnDecryptionSteps <= 0 {
+		errs = append(errs, fmt.Errorf("max and warn decryption steps must be positive"))
+	} else if c.WarnDecryptionSteps > c.MaxDecryptionSteps {
+		errs = append(errs, fmt.Errorf("warn decryption steps (%d) can't be greater than max decryption steps (%d)", c.WarnDecryptionSteps, c.MaxDecryptionSteps))
+	}
+
+	if c.DlogTableMaxEntries <= 0 || c.DlogTableCacheSize <= 0 {
+		errs = append(errs, fmt.Errorf("dlog table max entries and cache size must be positive"))
+	}
+
+	return errs
+}
+
+//endregion
+
+//region AuthorityConfig
+
+type AuthorityConfig struct {
+	HostConfig `yaml:",inline"`
+	AuthConfig `yaml:",inline"`
+
+	ShareHolderCredentialFile string `yaml:"shareHolderCredentialFile" toml:"shareHolderCredentialFile" flag:"share-holder-credential-file" usage:"file of the API key or JWT of the authority role, which the dealer authenticates to the share holders with"`
+
+	FHMultiIPESecLevel   int `yaml:"fhMultiIPESecLevel" toml:"fhMultiIPESecLevel" flag:"fh-multi-ipe-sec-level" usage:"security level of the FHMultiIPE schema"`
+	DamgardModulusLength int `yaml:"damgardModulusLength" toml:"damgardModulusLength" flag:"damgard-modulus-length" usage:"bit length of the modulus of the Damgard schema (1024, 1536, 2048, 2560, 3072 or 4096)"`
+	PaillierLambda       int `yaml:"paillierLambda" toml:"paillierLambda" flag:"paillier-lambda" usage:"security parameter of the Paillier schema"`
+	PaillierBitLength    int `yaml:"paillierBitLength" toml:"paillierBitLength" flag:"paillier-bit-length" usage:"bit length of the primes of the Paillier schema"`
+	LWESecLevel          int `yaml:"lweSecLevel" toml:"lweSecLevel" flag:"lwe-sec-level" usage:"security parameter n of the LWE schema"`
+
+	AllowPartialKeys   bool    `yaml:"allowPartialKeys" toml:"allowPartialKeys" flag:"allow-partial-keys" usage:"derive keys restricted to the received ciphers, so that tasks with missing batches can be billed"`
+	MinPartialCoverage float64 `yaml:"minPartialCoverage" toml:"minPartialCoverage" flag:"min-partial-coverage" usage:"minimum fraction of the ciphers of a task that must be received to derive a restricted key"`
+	MinProgressWindow  int     `yaml:"minProgressWindow" toml:"minProgressWindow" flag:"min-progress-window" usage:"minimum number of batches between the prefix keys of running totals, so that the consumption of fewer batches isn't revealed"`
+}
+
+func DefaultAuthorityConfig() *AuthorityConfig {
+	return &AuthorityConfig{
+		HostConfig: HostConfig{
+			Scheme:       "http",
+			IPv4:         "127.0.0.1",
+			Port:         "8082",
+			TaskChanSize: 15,
+			LogConfig:    DefaultLogConfig("logs/authority-logs", "authority"),
+
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		FHMultiIPESecLevel:   1,
+		DamgardModulusLength: 1024,
+		PaillierLambda:       128,
+		PaillierBitLength:    512,
+		LWESecLevel:          128,
+
+		AllowPartialKeys:   true,
+		MinPartialCoverage: 0.5,
+		MinProgressWindow:  1,
+	}
+}
+
+func (c *AuthorityConfig) Validate() []error {
+	errs := c.HostConfig.Validate()
+
+	if c.FHMultiIPESecLevel <= 0 {
+		errs = append(errs, fmt.Errorf("FHMultiIPE security level must be positive, got %d", c.FHMultiIPESecLevel))
+	}
+
+	switch c.DamgardModulusLength {
+	case 1024, 1536, 2048, 2560, 3072, 4096:
+	default:
+		errs = append(errs, fmt.Errorf("Damgard modulus length must be 1024, 1536, 2048, 2560, 3072 or 4096, got %d", c.DamgardModulusLength))
+	}
+
+	if c.PaillierLambda <= 0 {
+		errs = append(errs, fmt.Errorf("Paillier lambda must be positive, got %d", c.PaillierLambda))
+	}
+
+	if c.PaillierBitLength <= 0 {
+		errs = append(errs, fmt.Errorf("Paillier bit length must be positive, got %d", c.PaillierBitLength))
+	}
+
+	if c.LWESecLevel <= 0 {
+		errs = append(errs, fmt.Errorf("LWE security level must be positive, got %d", c.LWESecLevel))
+	}
+
+	if c.MinPartialCoverage <= 0 || c.MinPartialCoverage > 1 {
+		errs = append(errs, fmt.Errorf("min partial coverage must be in (0, 1], got %g", c.MinPartialCoverage))
+	}
+
+	if c.MinProgressWindow <= 0 {
+		errs = append(errs, fmt.Errorf("min progress window must be positive, got %d", c.MinProgressWindow))
+	}
+
+	return errs
+}
+
+//endregion
+
+//region SensorConfig
+
+type SensorConfig struct {
+	HostConfig `yaml:",inline"`
+	AuthConfig `yaml:",inline"`
+
+	MaxParallelSubmissions          int      `yaml:"maxParallelSubmissions" toml:"maxParallelSubmissions" flag:"max-parallel-submissions" usage:"maximum number of ciphers submitted to the server at once, per task"`
+	SamplingChanSizeCoeff           int      `yaml:"samplingChanSizeCoeff" toml:"samplingChanSizeCoeff" flag:"sampling-chan-size-coeff" usage:"size of the sampling chan, in batches"`
+	EncryptionChanSizeCoeff         int      `yaml:"encryptionChanSizeCoeff" toml:"encryptionChanSizeCoeff" flag:"encryption-chan-size-coeff" usage:"size of the encryption chan, in batch counts"`
+	EncryptionParamsPollingInterval Duration `yaml:"encryptionParamsPollingInterval" toml:"encryptionParamsPollingInterval" flag:"encryption-params-polling-interval" usage:"interval between polling the authority for encryption params"`
+	CompensateClockOffset           bool     `yaml:"compensateClockOffset" toml:"compensateClockOffset" flag:"compensate-clock-offset" usage:"shift the sampling schedule by the clock offset measured by the server"`
+
+	EncryptionWorkers int `yaml:"encryptionWorkers" toml:"encryptionWorkers" flag:"encryption-workers" usage:"maximum number of batches encrypted at once, for all tasks; 0 uses the number of CPUs"`
+	MaxQueuedBatches  int `yaml:"maxQueuedBatches" toml:"maxQueuedBatches" flag:"max-queued-batches" usage:"maximum number of batches of a task waiting for encryption, before samples are buffered by the sampler; 0 disables the limit"`
+
+	OutboxDir           string   `yaml:"outboxDir" toml:"outboxDir" flag:"outbox-dir" usage:"directory where the ciphers waiting for upload are kept, must not be shared with another sensor; empty keeps them only in memory"`
+	OutboxSize          int      `yaml:"outboxSize" toml:"outboxSize" flag:"outbox-size" usage:"maximum number of ciphers waiting for upload; when exceeded, the oldest one is dropped"`
+	OutboxRetryInterval Duration `yaml:"outboxRetryInterval" toml:"outboxRetryInterval" flag:"outbox-retry-interval" usage:"interval between attempts to upload the ciphers while the server is unreachable"`
+}
+
+func DefaultSensorConfig() *SensorConfig {
+	return &SensorConfig{
+		HostConfig: HostConfig{
+			Scheme:       "http",
+			IPv4:         "127.0.0.1",
+			Port:         "8081",
+			TaskChanSize: 15,
+			LogConfig:    DefaultLogConfig("logs/sensor-logs", "sensor"),
+
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		MaxParallelSubmissions:          3,
+		SamplingChanSizeCoeff:           2,
+		EncryptionChanSizeCoeff:         1,
+		EncryptionParamsPollingInterval: Duration(10 * time.Second),
+		CompensateClockOffset:           false,
+
+		EncryptionWorkers: 0,
+		MaxQueuedBatches:  8,
+
+		OutboxDir:           "outbox",
+		OutboxSize:          1024,
+		OutboxRetryInterval: Duration(10 * time.Second),
+	}
+}
+
+func (c *SensorConfig) Validate() []error {
+	errs := c.HostConfig.Validate()
+
+	if c.MaxParallelSubmissions <= 0 {
+		errs = append(errs, fmt.Errorf("max parallel submissions must be positive, got %d", c.MaxParallelSubmissions))
+	}
+
+	if c.SamplingChanSizeCoeff <= 0 {
+		errs = append(errs, fmt.Errorf("sampling chan size coeff must be positive, got %d", c.SamplingChanSizeCoeff))
+	}
+
+	if c.EncryptionChanSizeCoeff <= 0 {
+		errs = append(errs, fmt.Errorf("encryption chan size coeff must be positive, got %d", c.EncryptionChanSizeCoeff))
+	}
+
+	if c.EncryptionParamsPollingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("encryption params polling interval must be positive"))
+	}
+
+	if c.EncryptionWorkers < 0 {
+		errs = append(errs, fmt.Errorf("encryption workers can't be negative, got %d", c.EncryptionWorkers))
+	}
+
+	if c.MaxQueuedBatches < 0 {
+		errs = append(errs, fmt.Errorf("max queued batches can't be negative, got %d", c.MaxQueuedBatches))
+	}
+
+	if c.OutboxSize <= 0 {
+		errs = append(errs, fmt.Errorf("outbox size must be positive, got %d", c.OutboxSize))
+	}
+
+	if c.OutboxRetryInterval <= 0 {
+		errs = append(errs, fmt.Errorf("outbox retry interval must be positive"))
+	}
+
+	return errs
+}
+
+//endregion
+
+//region loading
+
+// LoadConfig populates cfg, which must already hold the defaults, from (in order of increasing precedence)
+// a YAML or TOML config file, environment variables and command line args.
+//
+// Every field tagged with `flag:"some-name"` can be set with the -some-name flag, or with the ENVPREFIX_SOME_NAME
+// env variable. The config file is set with -config or ENVPREFIX_CONFIG. If -print-config is passed, the resulting
+// config is written to out, and printOnly is true.
+func LoadConfig(cfg Config, name string, envPrefix string, args []string, out io.Writer) (printOnly bool, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+
+	configPath := fs.String("config", os.Getenv(envPrefix+"_CONFIG"), "path to a YAML (.yaml, .yml) or TOML (.toml) config file")
+	printConfig := fs.Bool("print-config", false, "print the resulting config and exit")
+	registerConfigFlags(fs, reflect.ValueOf(cfg).Elem())
+
+	if err = fs.Parse(args); err != nil {
+		return false, err
+	}
+
+	if fs.NArg() > 0 {
+		return false, fmt.Errorf("unexpected args: %v", fs.Args())
+	}
+
+	// flags are re-applied at the end, so they take precedence over the config file and env variables
+	setFlags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "print-config" {
+			setFlags[f.Name] = f.Value.String()
+		}
+	})
+
+	if *configPath != "" {
+		if err = loadConfigFile(cfg, *configPath); err != nil {
+			return false, err
+		}
+	}
+
+	errs := make([]error, 0)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		envName := envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, exists := os.LookupEnv(envName); exists {
+			if err := f.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q for %s: %s", value, envName, err))
+			}
+		}
+	})
+
+	for flagName, value := range setFlags {
+		_ = fs.Set(flagName, value)
+	}
+
+	errs = append(errs, cfg.Validate()...)
+	if len(errs) > 0 {
+		return false, errors.Join(errs...)
+	}
+
+	if *printConfig {
+		encoder := yaml.NewEncoder(out)
+		defer encoder.Close()
+		return true, encoder.Encode(cfg)
+	}
+
+	return false, nil
+}
+
+// registerConfigFlags registers a flag for every field of v tagged with `flag`, including fields of embedded structs.
+func registerConfigFlags(fs *flag.FlagSet, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		fieldValue := v.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			registerConfigFlags(fs, fieldValue)
+			continue
+		}
+
+		flagName, ok := field.Tag.Lookup("flag")
+		if !ok {
+			continue
+		}
+		usage := field.Tag.Get("usage")
+
+		switch ptr := fieldValue.Addr().Interface().(type) {
+		case *Duration:
+			fs.TextVar(ptr, flagName, *ptr, usage)
+		case *string:
+			fs.StringVar(ptr, flagName, *ptr, usage)
+		case *int:
+			fs.IntVar(ptr, flagName, *ptr, usage)
+		case *float64:
+			fs.Float64Var(ptr, flagName, *ptr, usage)
+		case *bool:
+			fs.BoolVar(ptr, flagName, *ptr, usage)
+		default:
+			panic("unsupported config field type " + field.Type.String())
+		}
+	}
+}
+
+func loadConfigFile(cfg Config, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error during reading config file: %s", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, cfg)
+	case ".toml":
+		err = toml.Unmarshal(content, cfg)
+	default:
+		return fmt.Errorf("unsupported config file extension %s, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return fmt.Errorf("error during parsing config file %s: %s", path, err)
+	}
+	return nil
+}
+
+//endregion
@@ -0,0 +1,148 @@
+package common
+
+import (
+	"bytes"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testEnvPrefix = "FE_TEST"
+
+// loadServerConfig loads a ServerConfig from its defaults and the args
+func loadServerConfig(t *testing.T, args ...string) (*ServerConfig, error) {
+	t.Helper()
+
+	config := DefaultServerConfig()
+	_, err := LoadConfig(config, "server", testEnvPrefix, args, &bytes.Buffer{})
+	return config, err
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"config.yaml", "port: \"9000\"\nlogLevel: warning\ncipherGracePeriod: 1m30s\napiKeysFile: keys.json\n"},
+		{"config.yml", "port: \"9000\"\nlogLevel: warning\ncipherGracePeriod: 1m30s\napiKeysFile: keys.json\n"},
+		{"config.toml", "port = \"9000\"\nlogLevel = \"warning\"\ncipherGracePeriod = \"1m30s\"\napiKeysFile = \"keys.json\"\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := loadServerConfig(t, "-config", writeFile(t, test.name, []byte(test.content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the fields of the embedded configs are set too
+			if config.Port != "9000" || config.LogLevel != "warning" || config.APIKeysFile != "keys.json" {
+				t.Errorf("port %s, log level %s, API keys file %s", config.Port, config.LogLevel, config.APIKeysFile)
+			}
+			if config.CipherGracePeriod != Duration(90*time.Second) {
+				t.Errorf("cipher grace period %s, expected 1m30s", time.Duration(config.CipherGracePeriod))
+			}
+			// the fields that aren't in the file keep their defaults
+			if config.IPv4 != DefaultServerConfig().IPv4 {
+				t.Errorf("ip %s, expected the default", config.IPv4)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", []byte("port: \"9000\"\nlogLevel: warning\ntaskChanSize: 7\n"))
+
+	t.Run("env over file", func(t *testing.T) {
+		t.Setenv(testEnvPrefix+"_PORT", "9001")
+		t.Setenv(testEnvPrefix+"_LOG_LEVEL", "error")
+		config, err := loadServerConfig(t, "-config", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Port != "9001" || config.LogLevel != "error" || config.TaskChanSize != 7 {
+			t.Errorf("port %s, log level %s, task chan size %d", config.Port, config.LogLevel, config.TaskChanSize)
+		}
+	})
+
+	t.Run("flags over env", func(t *testing.T) {
+		t.Setenv(testEnvPrefix+"_PORT", "9001")
+		config, err := loadServerConfig(t, "-config", file, "-port", "9002")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Port != "9002" || config.LogLevel != "warning" {
+			t.Errorf("port %s, log level %s", config.Port, config.LogLevel)
+		}
+	})
+
+	t.Run("config file from env", func(t *testing.T) {
+		t.Setenv(testEnvPrefix+"_CONFIG", file)
+		config, err := loadServerConfig(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Port != "9000" {
+			t.Errorf("port %s, expected the one of the file", config.Port)
+		}
+	})
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+	}{
+		{"missing file", nil, []string{"-config", "missing.yaml"}},
+		{"unsupported extension", nil, []string{"-config", "config.json"}},
+		{"invalid flag value", nil, []string{"-task-chan-size", "many"}},
+		{"unknown flag", nil, []string{"-unknown", "1"}},
+		{"unexpected args", nil, []string{"extra"}},
+		{"invalid env value", map[string]string{testEnvPrefix + "_TASK_CHAN_SIZE": "many"}, nil},
+		{"invalid config", nil, []string{"-scheme", "ftp", "-task-chan-size", "0"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			if _, err := loadServerConfig(t, test.args...); err == nil {
+				t.Error("invalid config accepted")
+			}
+		})
+	}
+
+	t.Run("all violations", func(t *testing.T) {
+		_, err := loadServerConfig(t, "-scheme", "ftp", "-task-chan-size", "0")
+		if err == nil || !strings.Contains(err.Error(), "scheme") || !strings.Contains(err.Error(), "task chan size") {
+			t.Errorf("got %v, expected the errors of the scheme and the task chan size", err)
+		}
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		file := writeFile(t, "config.toml", []byte("port = \n"))
+		if _, err := loadServerConfig(t, "-config", file); err == nil {
+			t.Error("invalid config file accepted")
+		}
+	})
+}
+
+func TestPrintConfig(t *testing.T) {
+	out := &bytes.Buffer{}
+	config := DefaultServerConfig()
+	printOnly, err := LoadConfig(config, "server", testEnvPrefix, []string{"-print-config", "-port", "9003"}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !printOnly {
+		t.Error("print only not reported")
+	}
+
+	printed := DefaultServerConfig()
+	if err = yaml.Unmarshal(out.Bytes(), printed); err != nil {
+		t.Fatal(err)
+	}
+	if printed.Port != "9003" || printed.CipherGracePeriod != config.CipherGracePeriod {
+		t.Errorf("printed config differs from the loaded one:\n%s", out)
+	}
+}
@@ -21,4 +21,19 @@ const (
 	ErrorResponse  ResponseType = "error"
 	DataResponse   ResponseType = "application/octet-stream"
 	NoResponse     ResponseType = "no response"
+	StreamResponse ResponseType = "text/event-stream" // the body is an *EventStream
+	FileResponse   ResponseType = "file"              // the body is a File, sent as an attachment
+)
+
+// FE schemes, as chosen in task requests and reported in metrics
+const (
+	SchemeFHIPE         = "fhipe"
+	SchemeFHMultiIPE    = "fh-multi-ipe"
+	SchemeDamgardMulti  = "damgard-multi"  // DDH-based multi-input IPE
+	SchemePaillierMulti = "paillier-multi" // Paillier-based multi-input IPE
+	SchemeLWE           = "lwe"            // LWE-based fully secure IPE
+	SchemeDMCFE         = "dmcfe"          // decentralized multi-client FE
+	// SchemeDecentralizedDMCFE is SchemeDMCFE without the authority; the sensors set up the keys themselves
+	SchemeDecentralizedDMCFE = "decentralized-dmcfe"
+	SchemeDummy              = "dummy"
 )
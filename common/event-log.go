@@ -0,0 +1,106 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// The tasks publish their events (e.g. a cipher received, or the result decrypted) to an EventLog, which is streamed
+// to the clients as server-sent events, see HttpServer. The log keeps all the events of the task, so a client that
+// subscribes late, or reconnects with the Last-Event-ID header, gets the events it has missed first. The log is
+// closed after the last event of the task, and the streams end once they have sent it.
+
+// Event is a server-sent event; Id is its index in the EventLog
+type Event struct {
+	Id   int
+	Type string
+	Time time.Time
+	Data any // marshalled to JSON
+}
+
+type EventLog struct {
+	events  []Event
+	closed  bool
+	changed chan struct{} // closed, and replaced, when an event is published or the log is closed
+	mutex   sync.Mutex
+
+	clock Clock
+}
+
+func NewEventLog(clock Clock) *EventLog {
+	return &EventLog{
+		events:  make([]Event, 0),
+		changed: make(chan struct{}),
+		clock:   clockOrDefault(clock),
+	}
+}
+
+// Publish appends an event to the log; events published after Close are discarded
+func (l *EventLog) Publish(eventType string, data any) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.events = append(l.events, Event{
+		Id:   len(l.events),
+		Type: eventType,
+		Time: l.clock.Now(),
+		Data: data,
+	})
+	l.notify()
+}
+
+// Close marks that no more events will be published
+func (l *EventLog) Close() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return
+	}
+	l.closed = true
+	l.notify()
+}
+
+// Closed returns true if the log is closed
+func (l *EventLog) Closed() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.closed
+}
+
+// notify wakes up the streams; the mutex must be held
+func (l *EventLog) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Subscribe returns a stream of the events after the event with id lastEventId; -1 streams all the events
+func (l *EventLog) Subscribe(lastEventId int) *EventStream {
+	return &EventStream{
+		log:    l,
+		cursor: lastEventId + 1,
+	}
+}
+
+// EventStream is a subscription to an EventLog, see EventLog.Subscribe
+type EventStream struct {
+	log    *EventLog
+	cursor int
+}
+
+// Next returns the events that haven't been returned yet, a channel that is closed when there are new ones, and
+// whether the log is closed, in which case no events will follow the returned ones
+func (s *EventStream) Next() (events []Event, changed <-chan struct{}, closed bool) {
+	s.log.mutex.Lock()
+	defer s.log.mutex.Unlock()
+
+	if s.cursor < len(s.log.events) {
+		events = make([]Event, len(s.log.events)-s.cursor)
+		copy(events, s.log.events[s.cursor:])
+		s.cursor = len(s.log.events)
+	}
+	return events, s.log.changed, s.log.closed
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Samples and rates are decimal values, that are encoded as fixed-point integers before they are sampled, encrypted
+// or used in a functional key: a value with scale s is multiplied by 10^s and rounded. The result of a task is a sum
+// of products of samples and rates, so its scale is the sum of the scales of the samples and the rates.
+
+const (
+	MaxFixedPointScale = 9
+
+	// MaxFixedPointValue is the largest absolute value of an encoded value; larger values aren't exact in float64
+	MaxFixedPointValue = 1 << 53
+)
+
+// EncodeFixedPoint encodes value with scale decimal digits
+func EncodeFixedPoint(value float64, scale int) (int, error) {
+	if scale < 0 || scale > MaxFixedPointScale {
+		return 0, fmt.Errorf("scale must be in [0, %d], got %d", MaxFixedPointScale, scale)
+	}
+
+	encoded := math.Round(value * math.Pow10(scale))
+	if math.IsNaN(encoded) || math.Abs(encoded) > MaxFixedPointValue {
+		return 0, fmt.Errorf("%g with scale %d is out of range", value, scale)
+	}
+	return int(encoded), nil
+}
+
+// DecodeFixedPoint decodes value with scale decimal digits
+func DecodeFixedPoint(value int, scale int) float64 {
+	return float64(value) / math.Pow10(scale)
+}
+
+// FormatFixedPoint formats value with scale decimal digits as a decimal number; unlike DecodeFixedPoint, it is
+// exact for any value, so it is used for the results
+func FormatFixedPoint(value *big.Int, scale int) string {
+	digits := new(big.Int).Abs(value).String()
+	sign := ""
+	if value.Sign() < 0 {
+		sign = "-"
+	}
+	if scale <= 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// ValueBound returns the bound of the absolute values in [minValue, maxValue], as used by the FE schemes
+func ValueBound(minValue, maxValue int) int {
+	if minValue < 0 && -minValue > maxValue {
+		return -minValue
+	}
+	return maxValue
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestEncodeFixedPoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    float64
+		scale    int
+		expected int
+		valid    bool
+	}{
+		{"integer", 42, 0, 42, true},
+		{"decimal", 1.25, 2, 125, true},
+		{"negative", -0.5, 3, -500, true},
+		{"rounded", 0.125, 2, 13, true},
+		{"rounded negative", -0.125, 2, -13, true},
+		{"max scale", 1, MaxFixedPointScale, 1_000_000_000, true},
+		{"max value", MaxFixedPointValue, 0, MaxFixedPointValue, true},
+		{"negative scale", 1, -1, 0, false},
+		{"scale too large", 1, MaxFixedPointScale + 1, 0, false},
+		{"out of range", MaxFixedPointValue / 10, 2, 0, false},
+		{"infinite", math.Inf(-1), 0, 0, false},
+		{"not a number", math.NaN(), 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := EncodeFixedPoint(test.value, test.scale)
+			if test.valid && err != nil {
+				t.Errorf("valid value rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid value accepted")
+			} else if test.valid && encoded != test.expected {
+				t.Errorf("encoded %d, expected %d", encoded, test.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeFixedPoint(t *testing.T) {
+	for _, value := range []float64{0, 1.5, -2.25, 1234.567} {
+		encoded, err := EncodeFixedPoint(value, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded := DecodeFixedPoint(encoded, 3); decoded != value {
+			t.Errorf("%g decoded as %g", value, decoded)
+		}
+	}
+}
+
+func TestFormatFixedPoint(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+
+	tests := []struct {
+		value    *big.Int
+		scale    int
+		expected string
+	}{
+		{big.NewInt(12345), 2, "123.45"},
+		{big.NewInt(-12345), 2, "-123.45"},
+		{big.NewInt(5), 3, "0.005"},
+		{big.NewInt(-5), 3, "-0.005"},
+		{big.NewInt(100), 2, "1.00"},
+		{big.NewInt(0), 2, "0.00"},
+		{big.NewInt(42), 0, "42"},
+		{huge, 10, "-12345678901234567890.1234567890"},
+	}
+
+	for _, test := range tests {
+		if formatted := FormatFixedPoint(test.value, test.scale); formatted != test.expected {
+			t.Errorf("%s with scale %d formatted as %s, expected %s", test.value, test.scale, formatted, test.expected)
+		}
+	}
+}
+
+func TestValueBound(t *testing.T) {
+	tests := []struct {
+		minValue, maxValue, expected int
+	}{
+		{0, 10, 10},
+		{-5, 10, 10},
+		{-20, 10, 20},
+		{-20, -10, 20},
+	}
+
+	for _, test := range tests {
+		if bound := ValueBound(test.minValue, test.maxValue); bound != test.expected {
+			t.Errorf("bound of [%d, %d] is %d, expected %d", test.minValue, test.maxValue, bound, test.expected)
+		}
+	}
+}
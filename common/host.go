@@ -1,50 +1,300 @@
 package common
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
 
 // Host has a HttpServer for accepting requests and a taskDaemon for executing tasks.
 type Host[TaskT any] struct {
 	// TaskDaemon
-	taskChan          chan *TaskT // todo close
-	taskDaemonStateFn func() RunnableState
-	taskDaemonStopFn  func()
+	taskChan       chan *TaskT
+	taskChanMutex  sync.RWMutex // guards taskChan from being closed while a task is sent to it
+	taskChanClosed bool
+	taskDaemon     *Runnable
+
+	// task workers started by TaskDaemon
+	taskWorkers      []*Runnable
+	taskWorkersMutex sync.Mutex
 
 	// HttpServer
 	*HttpServer
 
+	Metrics *MetricsRegistry
+
+	// Signer signs the records the Host vouches for, see signing.go
+	Signer *Signer
+
+	// Clock schedules the Host's tasks; it is passed to every Runnable and task of the Host
+	Clock Clock
+
 	Logger *Logger
+	config *HostConfig
+}
+
+// ShutdownReport lists the names of task workers by the state they were in when the Host was shut down.
+type ShutdownReport struct {
+	Completed   []string `json:"completed"`
+	Failed      []string `json:"failed"`
+	Interrupted []string `json:"interrupted"`
+	TimedOut    []string `json:"timed_out"` // workers that haven't stopped before the shutdown deadline
+
+	// HttpServerErr is the error the HttpServer failed with, if the Host was shut down because of it
+	HttpServerErr error `json:"-"`
+}
+
+func (r *ShutdownReport) String() string {
+	return fmt.Sprintf("completed: [%s], failed: [%s], interrupted: [%s], timed out: [%s]",
+		strings.Join(r.Completed, ", "), strings.Join(r.Failed, ", "),
+		strings.Join(r.Interrupted, ", "), strings.Join(r.TimedOut, ", "))
 }
 
 // InitHost initializes a new host by creating log file, setting up Task Daemon and registering endpoints
-// to the HttpServer.
-func InitHost[TaskT any](logDir string, logFilename string, taskDaemonChanSize int, endpoints []Endpoint) *Host[TaskT] {
-	err := InitLogger(logDir)
+// to the HttpServer; if clock is nil, the Host uses RealClock.
+func InitHost[TaskT any](config *HostConfig, clock Clock, endpoints []Endpoint) (*Host[TaskT], error) {
+	err := InitLogger(&config.LogConfig)
 	if err != nil {
-		fmt.Println("host not started")
-		return nil
+		return nil, fmt.Errorf("host not started: %s", err)
+	}
+
+	signer, err := NewSigner(config.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("host not started: loading signing key failed: %s", err)
 	}
 
 	host := &Host[TaskT]{
-		taskChan: make(chan *TaskT, taskDaemonChanSize),
-		Logger:   GetLoggerForFile("", logFilename),
+		taskChan: make(chan *TaskT, config.TaskChanSize),
+		Metrics:  NewMetricsRegistry(),
+		Signer:   signer,
+		Clock:    clockOrDefault(clock),
+		Logger:   GetLoggerForFile("", config.LogFilename),
+		config:   config,
+	}
+	host.HttpServer, err = InitHttpServer("fe "+config.LogFilename, host.Logger, host.Metrics, append(endpoints, host.getHostEndpoints()...))
+	if err != nil {
+		return nil, fmt.Errorf("host not started: %s", err)
+	}
+
+	host.Metrics.NewGaugeFunc("fe_task_daemon_queue_depth", "Number of tasks waiting for the task daemon.",
+		func() float64 { return float64(len(host.taskChan)) })
+	host.Metrics.NewGaugeFunc("fe_runnables_active", "Number of running Runnables (task daemon, task workers, samplers).",
+		func() float64 { return float64(ActiveRunnables()) })
+
+	return host, nil
+}
+
+// getHostEndpoints returns the endpoints every Host has, regardless of its role.
+func (h *Host[TaskT]) getHostEndpoints() []Endpoint {
+	v1 := RouteGroup{Prefix: V1Prefix, Envelope: true}
+	deprecated := RouteGroup{Deprecated: true}
+
+	endpoints := v1.Endpoints([]Endpoint{
+		{Method: "GET", Path: "/log-level", Handler: h.getLogLevelEndpoint, Roles: []Role{RoleOperator},
+			Summary: "the log level", Response: LogLevel{}},
+		{Method: "PUT", Path: "/log-level", Handler: h.setLogLevelEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the log level", Request: LogLevel{}, Response: LogLevel{}},
+		{Method: "GET", Path: "/clock", Handler: h.getClockEndpoint,
+			Summary: "the clock, for measuring its offset", Response: ClockSyncResponse{}},
+		{Method: "GET", Path: "/public-key", Handler: h.getPublicKeyEndpoint,
+			Summary: "the key the host's signatures are verified with", Response: PublicKeyResponse{}},
+	})
+
+	endpoints = append(endpoints, deprecated.Endpoints([]Endpoint{
+		{Method: "GET", Path: "/log-level", Handler: h.getLogLevelEndpoint, Roles: []Role{RoleOperator},
+			Summary: "the log level", Response: LogLevel{}},
+		{Method: "POST", Path: "/log-level", Handler: h.setLogLevelEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the log level", Request: LogLevel{}, Response: LogLevel{}},
+		{Method: "GET", Path: "/clock", Handler: h.getClockEndpoint,
+			Summary: "the clock, for measuring its offset", Response: ClockSyncResponse{}},
+		{Method: "GET", Path: "/public-key", Handler: h.getPublicKeyEndpoint,
+			Summary: "the key the host's signatures are verified with", Response: PublicKeyResponse{}},
+	})...)
+
+	// the metrics and the OpenAPI document aren't versioned, as their formats are standard
+	return append(endpoints, []Endpoint{
+		{Method: "GET", Path: "/metrics", Handler: h.getMetricsEndpoint,
+			Summary: "the metrics, in the Prometheus text format", Response: BodyText},
+		{Method: "GET", Path: "/openapi.json", Handler: h.getOpenAPIEndpoint,
+			Summary: "the OpenAPI document of the endpoints", Response: map[string]any{}},
+	}...)
+}
+
+// getOpenAPIEndpoint returns the OpenAPI document of the Host's endpoints, see openapi.go
+//
+// endpoint: [GET] /openapi.json
+func (h *Host[TaskT]) getOpenAPIEndpoint(c *gin.Context) (ResponseType, int, any) {
+	return JSONResponse, http.StatusOK, h.OpenAPI()
+}
+
+// getClockEndpoint answers an NTP-style exchange, see client.HostClient.MeasureClockOffset
+//
+// endpoint: [GET] /clock
+func (h *Host[TaskT]) getClockEndpoint(c *gin.Context) (ResponseType, int, any) {
+	receiveTime := h.Clock.Now()
+	return JSONResponse, http.StatusOK, ClockSyncResponse{
+		ReceiveTime:  receiveTime.UnixNano(),
+		TransmitTime: h.Clock.Now().UnixNano(),
+	}
+}
+
+// getPublicKeyEndpoint returns the hex encoded key the Host's signatures are verified with
+//
+// endpoint: [GET] /public-key
+func (h *Host[TaskT]) getPublicKeyEndpoint(c *gin.Context) (ResponseType, int, any) {
+	return JSONResponse, http.StatusOK, PublicKeyResponse{PublicKey: h.Signer.PublicKey()}
+}
+
+// endpoint: [GET] /metrics
+func (h *Host[TaskT]) getMetricsEndpoint(c *gin.Context) (ResponseType, int, any) {
+	return StringResponse, http.StatusOK, h.Metrics.String()
+}
+
+// endpoint: [GET] /log-level
+func (h *Host[TaskT]) getLogLevelEndpoint(c *gin.Context) (ResponseType, int, any) {
+	return JSONResponse, http.StatusOK, LogLevel{Level: GetLogLevel()}
+}
+
+// endpoint: [PUT] /log-level
+func (h *Host[TaskT]) setLogLevelEndpoint(c *gin.Context) (ResponseType, int, any) {
+	var body LogLevel
+	if err := c.BindJSON(&body); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	if err := SetLogLevel(body.Level); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
 	}
-	host.HttpServer = InitHttpServer(host.Logger, endpoints)
 
-	return host
+	h.Logger.Info("log level set to %s", body.Level)
+	return JSONResponse, http.StatusOK, LogLevel{Level: GetLogLevel()}
 }
 
-func (h *Host[TaskT]) StartTaskDaemon(startTaskWorkerFn func(*TaskT)) {
-	taskDaemonHandle := NewRunnable("task daemon", h.Logger)
-	h.taskDaemonStopFn = taskDaemonHandle.Stop
-	h.taskDaemonStateFn = taskDaemonHandle.GetState
-	go TaskDaemon(taskDaemonHandle, &h.taskChan, startTaskWorkerFn)
+// StartTaskDaemon starts the TaskDaemon; startTaskWorkerFn must return the Runnable of the started task worker,
+// so that it can be stopped when the Host is shut down.
+func (h *Host[TaskT]) StartTaskDaemon(startTaskWorkerFn func(*TaskT) *Runnable) {
+	h.taskDaemon = NewRunnable("task daemon", h.Clock, h.Logger)
+	go TaskDaemon(h.taskDaemon, &h.taskChan, func(task *TaskT) {
+		taskWorker := startTaskWorkerFn(task)
+
+		h.taskWorkersMutex.Lock()
+		defer h.taskWorkersMutex.Unlock()
+		h.taskWorkers = append(h.taskWorkers, taskWorker)
+	})
 }
 
-func (h *Host[TaskT]) StopTaskDaemon() {
-	// todo
-	// todo where to close taskChan?
+// StopTaskDaemon closes taskChan, and waits for the TaskDaemon to start the remaining tasks and exit.
+func (h *Host[TaskT]) StopTaskDaemon(ctx context.Context) {
+	h.taskChanMutex.Lock()
+	if !h.taskChanClosed {
+		h.taskChanClosed = true
+		close(h.taskChan)
+	}
+	h.taskChanMutex.Unlock()
+
+	if h.taskDaemon == nil {
+		return
+	}
+
+	select {
+	case <-h.taskDaemon.Closed():
+	case <-ctx.Done():
+		h.taskDaemon.Stop()
+		h.Logger.Error("task daemon has not been drained before the deadline")
+	}
 }
 
-func (h *Host[TaskT]) SendTaskToDaemon(t *TaskT) {
-	h.taskChan <- t
+// SendTaskToDaemon queues the task for execution; it fails if the Host is shutting down or if the queue is full.
+// The send never blocks, as StopTaskDaemon couldn't close taskChan while a sender holds taskChanMutex.
+func (h *Host[TaskT]) SendTaskToDaemon(t *TaskT) error {
+	h.taskChanMutex.RLock()
+	defer h.taskChanMutex.RUnlock()
+
+	if h.taskChanClosed {
+		return fmt.Errorf("host is shutting down, no new tasks are accepted")
+	}
+
+	select {
+	case h.taskChan <- t:
+		return nil
+	default:
+		return fmt.Errorf("task queue is full (%d tasks), try again later", cap(h.taskChan))
+	}
+}
+
+// Run serves the HttpServer on ip until SIGINT or SIGTERM is received (or until the HttpServer fails),
+// and then shuts the Host down within the configured shutdown timeout.
+func (h *Host[TaskT]) Run(ip IP) *ShutdownReport {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	httpServerErr := make(chan error, 1)
+	go func() {
+		httpServerErr <- h.RunHttpServer(ip)
+	}()
+
+	var serverErr error
+	select {
+	case sig := <-signals:
+		h.Logger.Info("received %s, shutting down", sig)
+	case serverErr = <-httpServerErr:
+		h.Logger.Error("http server exited (%v), shutting down", serverErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.config.ShutdownTimeout))
+	defer cancel()
+	report := h.Shutdown(ctx)
+	report.HttpServerErr = serverErr
+	return report
+}
+
+// Shutdown stops the Host: the HttpServer stops accepting requests, the TaskDaemon is drained, task workers are
+// stopped one by one, and log files are closed. Workers that don't stop before ctx expires are reported as timed out.
+func (h *Host[TaskT]) Shutdown(ctx context.Context) *ShutdownReport {
+	report := &ShutdownReport{
+		Completed:   make([]string, 0),
+		Failed:      make([]string, 0),
+		Interrupted: make([]string, 0),
+		TimedOut:    make([]string, 0),
+	}
+
+	if err := h.StopHttpServer(ctx); err != nil {
+		h.Logger.Err(err)
+	}
+
+	h.StopTaskDaemon(ctx)
+
+	h.taskWorkersMutex.Lock()
+	taskWorkers := h.taskWorkers
+	h.taskWorkersMutex.Unlock()
+
+	for _, taskWorker := range taskWorkers {
+		taskWorker.Stop()
+
+		select {
+		case <-taskWorker.Closed():
+			switch taskWorker.GetState() {
+			case RunnableDone:
+				report.Completed = append(report.Completed, taskWorker.Name())
+			case RunnableFailed:
+				report.Failed = append(report.Failed, taskWorker.Name())
+			default:
+				report.Interrupted = append(report.Interrupted, taskWorker.Name())
+			}
+		case <-ctx.Done():
+			report.TimedOut = append(report.TimedOut, taskWorker.Name())
+		}
+	}
+
+	h.Logger.Info("shutdown report: %s", report)
+	CloseLoggers()
+	return report
 }
@@ -1,29 +1,99 @@
 package common
 
 type RegisterSensorRequest struct {
-	SensorId UUID `json:"sensorId"`
+	SensorId UUID `json:"sensor_id"`
 	IP
+
+	// PublicKey verifies the signatures of the sensor's batch commitments, see BatchCommitment
+	PublicKey string `json:"public_key,omitempty"`
 }
 
 type ServerTaskRequest struct {
-	CustomerId       UUID `json:"customerId"`
+	CustomerId       UUID `json:"customer_id"`
 	Start            int  `json:"start"` // timestamp when server resets for the first time and starts measuring
 	Duration         int  `json:"duration"`
-	TariffId         UUID `json:"tariffId"`
-	EnableEncryption bool `json:"enableEncryption"`
+	TariffId         UUID `json:"tariff_id"`
+	EnableEncryption bool `json:"enable_encryption"`
+
+	// Scheme is the FE scheme of the task; if empty, DefaultScheme is used
+	Scheme string `json:"scheme"`
+
+	// GracePeriod is the time after the end of the task in which late ciphers are accepted, in seconds;
+	// if 0, ServerConfig.CipherGracePeriod is used
+	GracePeriod int `json:"grace_period,omitempty"`
+
+	// ProgressWindow enables the running total of the task, updated every ProgressWindow batches; 0 disables it
+	ProgressWindow int `json:"progress_window,omitempty"`
 }
 
 type AuthorityTaskRequest struct {
-	Id        UUID
-	SensorIds []UUID
+	Id        UUID   `json:"id"`
+	SensorIds []UUID `json:"sensor_ids"`
 	BatchParams
-	MaxTariffValue   int  `json:"maxRateValue"`
-	MaxSampleValue   int  `json:"maxSampleValue"`
-	EnableEncryption bool `json:"enableEncryption"`
+
+	// the bounds are fixed-point encoded, see EncodeFixedPoint
+	MinTariffValue   int    `json:"min_rate_value"`
+	MaxTariffValue   int    `json:"max_rate_value"`
+	MinSampleValue   int    `json:"min_sample_value"`
+	MaxSampleValue   int    `json:"max_sample_value"`
+	EnableEncryption bool   `json:"enable_encryption"`
+	Scheme           string `json:"scheme"`
+
+	// ShareHolders are set only in the threshold mode; the master secret is split among them, so that any
+	// Threshold of them can derive the decryption key
+	ShareHolders []IP `json:"share_holders,omitempty"`
+	Threshold    int  `json:"threshold,omitempty"`
+
+	// ProgressWindow is the number of batches between the prefix keys of the running total; 0 if it's disabled
+	ProgressWindow int `json:"progress_window,omitempty"`
+}
+
+// PartialRatesRequest asks the authority for a decryption key restricted to the ciphers that have been received;
+// the rates must be the ones the task's key has been derived for, and the missing ciphers get zero rates
+type PartialRatesRequest struct {
+	Rates          []int `json:"rates"`
+	MissingCiphers []int `json:"missing_ciphers"` // indices of the missing ciphers, sensorIdx*BatchCnt + batchIdx
+}
+
+// PrefixRatesRequest asks the authority for a decryption key restricted to the first Batches batches of every sensor,
+// for the running total of the task; Batches must be a multiple of the task's progress window
+type PrefixRatesRequest struct {
+	Rates   []int `json:"rates"`
+	Batches int   `json:"batches"`
 }
 
 type SensorTaskRequest struct {
 	TaskId UUID `json:"id"`
 	SamplingParams
-	AuthorityIP IP `json:"authorityIP"`
+	AuthorityIP IP `json:"authority_ip"`
+
+	// ClockOffset is the offset of the sensor's clock from the server's clock, as measured by the server
+	ClockOffset Duration `json:"clock_offset"`
+
+	Scheme string `json:"scheme"`
+	// DMCFE is set only for SchemeDecentralizedDMCFE, as the sensor sets up its keys itself
+	DMCFE *DMCFETaskParams `json:"dmcfe,omitempty"`
+}
+
+// DMCFETaskParams describe the sensor's part of a SchemeDecentralizedDMCFE task; the sensor has a client for every
+// sample of a batch, and the clients of sensor no SensorIdx have indices from SensorIdx*BatchSize on
+type DMCFETaskParams struct {
+	SensorIdx    int `json:"sensor_idx"`
+	SensorCnt    int `json:"sensor_cnt"`
+	MinRateValue int `json:"min_rate_value"` // rates out of [MinRateValue, MaxRateValue] aren't approved
+	MaxRateValue int `json:"max_rate_value"`
+}
+
+type RemoveSensorRequest struct {
+	SensorId string `json:"sensor_id"`
+}
+
+// SetCustomerRequest sets the customer of a sensor
+type SetCustomerRequest struct {
+	CustomerId UUID `json:"id"`
+}
+
+// CredentialRequest sets the credential a sensor authenticates to the server with, see RemoteHttpServer.Credential
+type CredentialRequest struct {
+	Credential string `json:"credential"`
 }
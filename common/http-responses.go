@@ -0,0 +1,105 @@
+package common
+
+// LogLevel is both the request and the response of the log level endpoints of a Host
+type LogLevel struct {
+	Level string `json:"level"`
+}
+
+type PublicKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+//region server
+
+// CreatedCustomer is the new customer; APIKey is set only if the endpoints are authenticated
+type CreatedCustomer struct {
+	Id     UUID   `json:"id"`
+	APIKey string `json:"api_key,omitempty"`
+}
+
+// CustomerDetails is the customer and its sensors
+type CustomerDetails struct {
+	Id      UUID             `json:"id"`
+	Sensors []CustomerSensor `json:"sensors"`
+}
+
+type CustomerSensor struct {
+	Id        UUID   `json:"id"`
+	IP        string `json:"ip"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// IssuedAPIKey is the API key of a new sensor, which is returned only once
+type IssuedAPIKey struct {
+	APIKey string `json:"api_key"`
+}
+
+type TaskDetails struct {
+	TaskId     UUID                `json:"task_id"`
+	CustomerId UUID                `json:"customer_id"`
+	Sensors    []TaskSensorDetails `json:"sensors"`
+	Scheme     string              `json:"scheme"`
+	Threshold  int                 `json:"threshold,omitempty"`
+	Status     string              `json:"status"`
+	SamplingParams
+
+	// ciphers are accepted until Deadline (a timestamp); MissingBatches are set after it, by sensor id
+	Deadline       int64          `json:"deadline"`
+	MissingBatches map[UUID][]int `json:"missing_batches,omitempty"`
+
+	DecryptorStats any   `json:"decryptor_stats"`
+	Result         int64 `json:"result"` // fixed-point encoded
+
+	// Amount is the decimal value of the result, with the scale of the tariff's samples and rates summed
+	Amount string `json:"amount,omitempty"`
+}
+
+type TaskSensorDetails struct {
+	Id            UUID       `json:"id"`
+	SubmittedTask bool       `json:"task_submitted"`
+	ClockSync     *ClockSync `json:"clock_sync"`
+}
+
+type TaskProgress struct {
+	TaskId         UUID                `json:"task_id"`
+	Status         string              `json:"status"`
+	ProgressWindow int                 `json:"progress_window"`
+	BatchCnt       int                 `json:"batch_cnt"`
+	Points         []TaskProgressPoint `json:"points"`
+}
+
+type TaskProgressPoint struct {
+	Batches    int    `json:"batches"` // of every sensor
+	End        int64  `json:"end"`     // timestamp of the end of the last batch
+	ComputedAt int64  `json:"computed_at,omitempty"`
+	Result     int64  `json:"result"` // fixed-point encoded
+	Amount     string `json:"amount"`
+	Final      bool   `json:"final,omitempty"`
+}
+
+// ShareHolders reports the health of the share holders of the threshold mode
+type ShareHolders struct {
+	Threshold    int               `json:"threshold"`
+	Healthy      int               `json:"healthy"`
+	ShareHolders []ShareHolderInfo `json:"share_holders"`
+}
+
+type ShareHolderInfo struct {
+	IP      string             `json:"ip"`
+	Healthy bool               `json:"healthy"`
+	Status  *ShareHolderStatus `json:"status,omitempty"`
+	Error   string             `json:"error,omitempty"`
+}
+
+//endregion
+
+//region sensor
+
+// SensorCustomer is the customer of a sensor; AuditToken is set only when the customer is set the first time, see
+// SampleDisclosure
+type SensorCustomer struct {
+	Id         UUID   `json:"id"`
+	AuditToken string `json:"audit_token,omitempty"`
+}
+
+//endregion
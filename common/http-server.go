@@ -1,89 +1,345 @@
 package common
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
+// CorrelationIdHeader carries the id that correlates the logs of a request across hosts
+const CorrelationIdHeader = "X-Correlation-Id"
+
+// RequestLogger returns logger with the correlation id of the request being handled
+func RequestLogger(c *gin.Context, logger *Logger) *Logger {
+	return logger.WithField(CorrelationIdField, c.GetString(CorrelationIdField))
+}
+
+// eventStreamHeartbeat is how often an idle event stream sends a comment
+const eventStreamHeartbeat = 15 * time.Second
+
+// File is the body of a FileResponse
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Endpoint is routed by the HttpServer, see routing.go; Summary, Query, Request, Status and Response only document it,
+// see openapi.go
 type Endpoint struct {
-	Method  string
-	Path    string
-	Handler func(c *gin.Context) (ResponseType, int, any)
+	Method     string
+	Path       string
+	Handler    EndpointHandler
+	Middleware []Middleware
+
+	// Roles may call the endpoint, if the HttpServer has an Authenticator; the endpoint is public if it's empty
+	Roles []Role
+
+	// Envelope wraps the responses and the errors of the endpoint, as the ones of the /v1 APIs, see api.go;
+	// Deprecated endpoints set DeprecationHeader
+	Envelope   bool
+	Deprecated bool
+
+	Summary string
+	Query   map[string]string // descriptions of the query parameters, by name
+
+	// Request and Response are values of the types of the JSON bodies, or the content types of the other bodies
+	// (e.g. BodyOctetStream); Response is the body of the Status response, which is 200 if it's 0
+	Request  any
+	Status   int
+	Response any
 }
 
 type HttpServer struct {
 	*IP
-	HttpLogger *Logger
-	endpoints  []Endpoint
+	HttpLogger    *Logger
+	Title         string // of the OpenAPI document
+	endpoints     []Endpoint
+	router        *gin.Engine
+	middleware    []Middleware
+	authenticator *Authenticator // nil if the endpoints are unauthenticated, see auth.go
+
+	requestDuration *Histogram
+
+	server         *http.Server
+	serverMutex    sync.Mutex
+	stopped        bool
+	streamsStopped chan struct{} // closed when the server is stopped, as the event streams would never end
+}
+
+// InitHttpServer routes the endpoints; it fails if any of them can't be routed, see ValidateEndpoints
+func InitHttpServer(title string, logger *Logger, metrics *MetricsRegistry, endpoints []Endpoint) (*HttpServer, error) {
+	if endpoints == nil {
+		return nil, fmt.Errorf("endpoints not set")
+	}
+	if err := ValidateEndpoints(endpoints); err != nil {
+		return nil, fmt.Errorf("invalid endpoints: %w", err)
+	}
+
+	host := &HttpServer{
+		IP:             nil,
+		HttpLogger:     GetLogger("http server", logger),
+		Title:          title,
+		endpoints:      endpoints,
+		router:         gin.Default(),
+		streamsStopped: make(chan struct{}),
+		requestDuration: metrics.NewHistogram("fe_http_request_duration_seconds", "Time spent handling HTTP requests, per endpoint.",
+			DurationBuckets, "method", "path", "code"),
+	}
+	host.router.NoRoute(noRoute)
+
+	errs := make([]error, 0)
+	for _, endpoint := range endpoints {
+		if err := addRoute(host.router, endpoint, host.serve(endpoint)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid endpoints: %w", errors.Join(errs...))
+	}
+
+	return host, nil
+}
+
+// Use wraps the handlers of all the endpoints by the middleware, the first one outermost; it must be called before
+// the server is started
+func (host *HttpServer) Use(middleware ...Middleware) {
+	host.middleware = append(host.middleware, middleware...)
+}
+
+// Endpoints returns the endpoints the HttpServer routes
+func (host *HttpServer) Endpoints() []Endpoint {
+	return host.endpoints
+}
+
+// SetAuthenticator makes the endpoints with roles require authentication; it must be called before the server is
+// started
+func (host *HttpServer) SetAuthenticator(authenticator *Authenticator) {
+	host.authenticator = authenticator
 }
 
-func InitHttpServer(logger *Logger, endpoints []Endpoint) *HttpServer {
-	return &HttpServer{
-		IP:         nil,
-		HttpLogger: GetLogger("http server", logger),
-		endpoints:  endpoints,
+// RunHttpServer serves the endpoints on ip until StopHttpServer is called; it returns nil if the server is stopped
+// by StopHttpServer, and an error if the server could not be started.
+func (host *HttpServer) RunHttpServer(ip IP) error {
+	listener, err := net.Listen("tcp", ip.IPv4.String()+":"+ip.Port)
+	if err != nil {
+		host.HttpLogger.Err(err)
+		return err
 	}
+
+	return host.ServeHttpServer(listener, ip)
 }
 
-// todo what if machine is not online ????
-func (host *HttpServer) RunHttpServer(ip IP) {
-	if host.endpoints == nil {
-		host.HttpLogger.Error("endpoints not set")
-		return
+// ServeHttpServer is RunHttpServer on an already bound listener (e.g. on an ephemeral port);
+// ip is the address that the listener is reachable on.
+func (host *HttpServer) ServeHttpServer(listener net.Listener, ip IP) error {
+	handler, err := host.Handler(ip)
+	if err != nil {
+		return err
+	}
+
+	host.serverMutex.Lock()
+	if host.stopped {
+		host.serverMutex.Unlock()
+		_ = listener.Close()
+		return nil
+	}
+	host.server = &http.Server{
+		Handler: handler,
+	}
+	host.serverMutex.Unlock()
+
+	err = host.server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		host.HttpLogger.Err(err)
+		return err
 	}
 
+	return nil
+}
+
+// Handler returns the http.Handler that serves the endpoints, for serving them with another http.Server
+// (e.g. httptest.Server); ip is the address that the handler is reachable on.
+func (host *HttpServer) Handler(ip IP) (http.Handler, error) {
 	host.IP = &ip
-	router := gin.Default()
-
-	addLogging := func(fnToCall func(c *gin.Context) (ResponseType, int, any)) func(c *gin.Context) {
-		return func(c *gin.Context) {
-			host.HttpLogger.Info("%s -->   %-6s   %s", c.RemoteIP(), c.Request.Method, c.Request.URL.String())
-			responseType, code, body := fnToCall(c)
-			switch responseType {
-			case StringResponse:
-				c.String(code, body.(string))
-			case JSONResponse:
+	return host.router, nil
+}
+
+// serve returns the gin handler of the endpoint; the middleware of the HttpServer and the authorization are added
+// on every request, as they may be set after the endpoint is routed. The envelope wraps the authorization, so that
+// its errors are enveloped too.
+func (host *HttpServer) serve(endpoint Endpoint) gin.HandlerFunc {
+	handler := chain(endpoint.Handler, endpoint.Middleware)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		// requests from other hosts carry their correlation id, others get a new one
+		correlationId := c.GetHeader(CorrelationIdHeader)
+		if correlationId == "" {
+			correlationId = string(NewUUID())
+		}
+		c.Set(CorrelationIdField, correlationId)
+		c.Header(CorrelationIdHeader, correlationId)
+		logger := host.HttpLogger.WithField(CorrelationIdField, correlationId)
+
+		fnToCall := handler
+		if host.authenticator != nil && len(endpoint.Roles) > 0 {
+			fnToCall = host.authenticator.Authorize(endpoint.Roles)(fnToCall)
+		}
+		if endpoint.Envelope {
+			fnToCall = envelope(fnToCall)
+		}
+		fnToCall = chain(fnToCall, host.middleware)
+		if endpoint.Deprecated {
+			c.Header(DeprecationHeader, "true")
+			fromLegacyRequest(c)
+		}
+
+		logger.Info("%s -->   %-6s   %s", c.RemoteIP(), c.Request.Method, c.Request.URL.String())
+		responseType, code, body := fnToCall(c)
+		logger.Info("%s <--   %-6s   %s   %d", c.RemoteIP(), c.Request.Method, c.Request.URL.String(), code)
+		defer func() {
+			// streams last as long as the tasks do, so they would only skew the durations
+			if responseType == StreamResponse {
+				return
+			}
+			// the route template is used, so that e.g. all tasks share one series
+			host.requestDuration.ObserveDuration(time.Since(start), c.Request.Method, c.FullPath(), strconv.Itoa(code))
+		}()
+
+		switch responseType {
+		case StringResponse:
+			c.String(code, body.(string))
+		case JSONResponse:
+			if endpoint.Deprecated {
+				writeLegacyJSON(c, code, body)
+			} else {
 				c.JSON(code, body)
-			case DataResponse:
-				c.Header("Content-Type", string(DataResponse))
-				c.Data(code, "application/octet-stream", body.([]byte))
-			case NoResponse:
-				c.Status(code)
-			case ErrorResponse:
-
-				switch body.(type) {
-				case error:
-					host.HttpLogger.Err(body.(error))
-					c.JSON(code, gin.H{"error": body})
-				case string:
-					host.HttpLogger.Error(body.(string))
-					c.JSON(code, gin.H{"error": body})
-
-				case []error:
-					for _, err := range body.([]error) {
-						host.HttpLogger.Err(err)
-					}
-					c.JSON(code, gin.H{"errors": body})
-				default:
-					panic("unknown response type")
-				}
+			}
+		case DataResponse:
+			c.Header("Content-Type", string(DataResponse))
+			c.Data(code, "application/octet-stream", body.([]byte))
+		case NoResponse:
+			c.Status(code)
+		case FileResponse:
+			file := body.(File)
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+			c.Data(code, file.ContentType, file.Data)
+		case StreamResponse:
+			host.streamEvents(c, code, body.(*EventStream))
+		case ErrorResponse:
 
+			switch body.(type) {
+			case *APIError:
+				logger.Err(body.(*APIError))
+				c.JSON(code, ErrorEnvelope{Error: body.(*APIError)})
+			case error:
+				logger.Err(body.(error))
+				c.JSON(code, gin.H{"error": body.(error).Error()})
+			case string:
+				logger.Error(body.(string))
+				c.JSON(code, gin.H{"error": body})
+
+			case []error:
+				messages := make([]string, 0, len(body.([]error)))
+				for _, err := range body.([]error) {
+					logger.Err(err)
+					messages = append(messages, err.Error())
+				}
+				c.JSON(code, gin.H{"errors": messages})
+			default:
+				panic("unknown response type")
 			}
 
 		}
 	}
+}
+
+// LastEventIdHeader is sent by the clients that reconnect to an event stream, with the id of the last event received
+const LastEventIdHeader = "Last-Event-ID"
+
+// ParseLastEventId returns the id in the Last-Event-ID header of the request, or -1 if there is none
+func ParseLastEventId(c *gin.Context) (int, error) {
+	header := c.GetHeader(LastEventIdHeader)
+	if header == "" {
+		return -1, nil
+	}
+	lastEventId, err := strconv.Atoi(header)
+	if err != nil || lastEventId < 0 {
+		return 0, fmt.Errorf("invalid %s %q", LastEventIdHeader, header)
+	}
+	return lastEventId, nil
+}
+
+// streamEvents sends the events of the stream as server-sent events, until the event log is closed, the client
+// disconnects, or the server is stopped
+func (host *HttpServer) streamEvents(c *gin.Context, code int, stream *EventStream) {
+	c.Header("Content-Type", string(StreamResponse))
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(code)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
 
-	for _, endpoint := range host.endpoints {
-		switch endpoint.Method {
-		case "POST":
-			router.POST(endpoint.Path, addLogging(endpoint.Handler))
-		case "GET":
-			router.GET(endpoint.Path, addLogging(endpoint.Handler))
+	for {
+		events, changed, closed := stream.Next()
+		for _, event := range events {
+			data, err := json.Marshal(struct {
+				Time time.Time `json:"time"`
+				Data any       `json:"data"`
+			}{event.Time, event.Data})
+			if err != nil {
+				host.HttpLogger.Err(err)
+				return
+			}
+			if _, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+		if closed {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			// keeps the idle connection from being closed by proxies
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		case <-host.streamsStopped:
+			return
 		}
 	}
+}
 
-	err := router.Run(host.IPv4.String() + ":" + host.Port)
-	if err != nil {
-		host.HttpLogger.Err(err)
+// StopHttpServer stops accepting new requests and waits for the active ones to finish, or for ctx to expire.
+func (host *HttpServer) StopHttpServer(ctx context.Context) error {
+	host.serverMutex.Lock()
+	defer host.serverMutex.Unlock()
+
+	if !host.stopped {
+		host.stopped = true
+		close(host.streamsStopped)
+	}
+	if host.server == nil {
+		return nil
 	}
 
+	host.HttpLogger.Info("stopping http server")
+	return host.server.Shutdown(ctx)
 }
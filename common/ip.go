@@ -5,7 +5,7 @@ import (
 )
 
 type IP struct {
-	Scheme string `json:"schema"`
+	Scheme string `json:"scheme"`
 	IPv4   net.IP `json:"ipv4"`
 	Port   string `json:"port"`
 }
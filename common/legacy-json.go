@@ -0,0 +1,159 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+)
+
+// The deprecated endpoints keep the JSON field names they had before the /v1 APIs, which are camelCase: the keys
+// of the JSON requests are renamed to the /v1 ones before the handlers bind them, and the keys of the JSON
+// responses back to the legacy ones. Only the fields that existed before /v1 are renamed; the ones added since have
+// their /v1 names on all routes.
+
+// legacyJSONKeys are the legacy names of the fields, by their /v1 names
+var legacyJSONKeys = map[string]string{
+	"authority_ip":         "authorityIP",
+	"batch_cnt":            "batchCnt",
+	"batch_idx":            "batchIdx",
+	"batch_size":           "batchSize",
+	"bound_x":              "boundX",
+	"bound_y":              "boundY",
+	"cipher_hash":          "cipherHash",
+	"client_keys":          "clientKeys",
+	"clock_offset":         "clockOffset",
+	"customer_id":          "customerId",
+	"decryption_params_id": "decryptionParamsId",
+	"enable_encryption":    "enableEncryption",
+	"grace_period":         "gracePeriod",
+	"idx_offset":           "idxOffset",
+	"key_hash":             "keyHash",
+	"max_rate_value":       "maxRateValue",
+	"max_sample_value":     "maxSampleValue",
+	"max_tariff_value":     "maxTariffValue",
+	"measured_at":          "measuredAt",
+	"min_rate_value":       "minRateValue",
+	"min_sample_value":     "minSampleValue",
+	"min_tariff_value":     "minTariffValue",
+	"missing_ciphers":      "missingCiphers",
+	"progress_window":      "progressWindow",
+	"pub_key":              "pubKey",
+	"pub_keys":             "pubKeys",
+	"public_key":           "publicKey",
+	"rate_scale":           "rateScale",
+	"rates_hash":           "ratesHash",
+	"receive_time":         "receiveTime",
+	"result_bound":         "resultBound",
+	"sample_scale":         "sampleScale",
+	"sampled_at":           "sampledAt",
+	"sampling_period":      "samplingPeriod",
+	"search_bound":         "searchBound",
+	"sec_key":              "secKey",
+	"sec_keys":             "secKeys",
+	"sensor_cnt":           "sensorCnt",
+	"sensor_id":            "sensorId",
+	"sensor_ids":           "sensorIds",
+	"sensor_idx":           "sensorIdx",
+	"share_holders":        "shareHolders",
+	"tariff_id":            "tariffId",
+	"task_id":              "taskId",
+	"task_ids":             "taskIds",
+	"timed_out":            "timedOut",
+	"transmit_time":        "transmitTime",
+}
+
+// v1JSONKeys are the /v1 names of the fields, by their legacy names
+var v1JSONKeys = make(map[string]string, len(legacyJSONKeys))
+
+func init() {
+	for v1, legacy := range legacyJSONKeys {
+		v1JSONKeys[legacy] = v1
+	}
+}
+
+// the scheme of an IP was named "schema"; as "scheme" is a field of other objects too, it's renamed only in the
+// objects with an ipv4
+const (
+	ipKey           = "ipv4"
+	ipSchemeKey     = "scheme"
+	legacySchemeKey = "schema"
+)
+
+// renameJSONKey returns the legacy name of the key of an object, or its /v1 name if toLegacy is false
+func renameJSONKey(key string, isIP bool, toLegacy bool) string {
+	if isIP && toLegacy && key == ipSchemeKey {
+		return legacySchemeKey
+	}
+	if isIP && !toLegacy && key == legacySchemeKey {
+		return ipSchemeKey
+	}
+
+	names := v1JSONKeys
+	if toLegacy {
+		names = legacyJSONKeys
+	}
+	if renamed, ok := names[key]; ok {
+		return renamed
+	}
+	return key
+}
+
+// renameJSONKeys renames the keys of all the objects in the decoded JSON value
+func renameJSONKeys(value any, toLegacy bool) any {
+	switch v := value.(type) {
+	case map[string]any:
+		_, isIP := v[ipKey]
+		renamed := make(map[string]any, len(v))
+		for key, field := range v {
+			renamed[renameJSONKey(key, isIP, toLegacy)] = renameJSONKeys(field, toLegacy)
+		}
+		return renamed
+	case []any:
+		for idx := range v {
+			v[idx] = renameJSONKeys(v[idx], toLegacy)
+		}
+	}
+	return value
+}
+
+// convertJSON renames the keys of the JSON data; the numbers are kept as they are, as they may be big.Ints
+func convertJSON(data []byte, toLegacy bool) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameJSONKeys(value, toLegacy))
+}
+
+// fromLegacyRequest renames the keys of the JSON body of a request to a deprecated endpoint; the other bodies (e.g.
+// gob encoded ones) are left as they are
+func fromLegacyRequest(c *gin.Context) {
+	if c.Request.Body == nil || c.ContentType() == BodyOctetStream {
+		return
+	}
+	data, err := io.ReadAll(c.Request.Body)
+	_ = c.Request.Body.Close()
+	if err == nil && json.Valid(data) {
+		if converted, err := convertJSON(data, false); err == nil {
+			data = converted
+		}
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	c.Request.ContentLength = int64(len(data))
+}
+
+// writeLegacyJSON writes the JSON response of a deprecated endpoint, with the legacy keys
+func writeLegacyJSON(c *gin.Context, code int, body any) {
+	data, err := json.Marshal(body)
+	if err == nil {
+		data, err = convertJSON(data, true)
+	}
+	if err != nil {
+		c.JSON(code, body)
+		return
+	}
+	c.Data(code, "application/json; charset=utf-8", data)
+}
@@ -0,0 +1,125 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type legacyTestBody struct {
+	SensorId    UUID     `json:"sensor_id"`
+	Authority   IP       `json:"authority_ip"`
+	Scheme      string   `json:"scheme"`
+	SearchBound *big.Int `json:"search_bound"`
+	Added       []int    `json:"added_since"` // a field that didn't exist before /v1
+}
+
+// newLegacyTestServer returns the handler of an HttpServer whose /v1 and deprecated endpoints echo legacyTestBody
+func newLegacyTestServer(t *testing.T) http.Handler {
+	t.Helper()
+
+	gin.SetMode(gin.ReleaseMode)
+	echo := func(c *gin.Context) (ResponseType, int, any) {
+		var body legacyTestBody
+		if err := c.BindJSON(&body); err != nil {
+			return ErrorResponse, http.StatusBadRequest, err
+		}
+		return JSONResponse, http.StatusOK, body
+	}
+	endpoints := append(
+		RouteGroup{Prefix: V1Prefix}.Endpoints([]Endpoint{{Method: "POST", Path: "/echo", Handler: echo}}),
+		RouteGroup{Deprecated: true}.Endpoints([]Endpoint{{Method: "POST", Path: "/echo", Handler: echo}})...,
+	)
+	host, err := InitHttpServer("test", GetDiscardLogger(), NewMetricsRegistry(), endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := host.Handler(IP{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+// post sends the JSON body to the path, and returns the decoded JSON response
+func post(t *testing.T, handler http.Handler, path string, body string) map[string]any {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("POST", path, strings.NewReader(body))
+	request.Header.Set("Content-Type", BodyJSON)
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var response map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// expectKeys checks that the object has exactly the keys
+func expectKeys(t *testing.T, object any, keys ...string) {
+	t.Helper()
+
+	fields, ok := object.(map[string]any)
+	if !ok || len(fields) != len(keys) {
+		t.Errorf("got %v, expected the keys %v", object, keys)
+		return
+	}
+	for _, key := range keys {
+		if _, ok = fields[key]; !ok {
+			t.Errorf("key %s missing from %v", key, object)
+		}
+	}
+}
+
+func TestLegacyJSON(t *testing.T) {
+	handler := newLegacyTestServer(t)
+	bound := "123456789012345678901234567890"
+
+	t.Run("v1", func(t *testing.T) {
+		response := post(t, handler, V1Prefix+"/echo", `{"sensor_id": "sensor-0", "scheme": "dummy",
+			"authority_ip": {"scheme": "http", "ipv4": "127.0.0.1", "port": "8082"}, "search_bound": `+bound+`, "added_since": [1]}`)
+		expectKeys(t, response, "sensor_id", "authority_ip", "scheme", "search_bound", "added_since")
+		expectKeys(t, response["authority_ip"], "scheme", "ipv4", "port")
+	})
+
+	t.Run("deprecated", func(t *testing.T) {
+		response := post(t, handler, "/echo", `{"sensorId": "sensor-0", "scheme": "dummy",
+			"authorityIP": {"schema": "http", "ipv4": "127.0.0.1", "port": "8082"}, "searchBound": `+bound+`, "added_since": [1]}`)
+		expectKeys(t, response, "sensorId", "authorityIP", "scheme", "searchBound", "added_since")
+		expectKeys(t, response["authorityIP"], "schema", "ipv4", "port")
+
+		if response["sensorId"] != "sensor-0" || response["authorityIP"].(map[string]any)["schema"] != "http" {
+			t.Errorf("legacy fields not bound: %v", response)
+		}
+	})
+}
+
+func TestConvertJSON(t *testing.T) {
+	// the numbers aren't rounded to float64, and the arrays of objects are renamed too
+	data := `{"task_ids":["task-0"],"items":[{"sensor_id":"sensor-0","bound_x":123456789012345678901234567890}]}`
+	legacy, err := convertJSON([]byte(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"items":[{"boundX":123456789012345678901234567890,"sensorId":"sensor-0"}],"taskIds":["task-0"]}`
+	if string(legacy) != expected {
+		t.Errorf("got %s, expected %s", legacy, expected)
+	}
+
+	v1, err := convertJSON(legacy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected = `{"items":[{"bound_x":123456789012345678901234567890,"sensor_id":"sensor-0"}],"task_ids":["task-0"]}`; string(v1) != expected {
+		t.Errorf("got %s, expected %s", v1, expected)
+	}
+}
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logFile is a log file that is rotated when it exceeds maxSize bytes: dir/name.log is renamed to dir/name.1.log,
+// dir/name.1.log to dir/name.2.log, and so on; only maxBackups rotated files are kept.
+type logFile struct {
+	dir        string
+	name       string
+	maxSize    int64
+	maxBackups int
+
+	file  *os.File
+	size  int64
+	mutex sync.Mutex
+}
+
+// openLogFile creates dir/name.log (truncating it if it exists); maxSizeMB of 0 disables rotation
+func openLogFile(dir string, name string, maxSizeMB int, maxBackups int) (*logFile, error) {
+	f := &logFile{
+		dir:        dir,
+		name:       name,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+
+	file, err := os.Create(f.path(0))
+	if err != nil {
+		return nil, err
+	}
+	f.file = file
+
+	return f, nil
+}
+
+// path returns the path of the log file, or of its idx-th rotated file
+func (f *logFile) path(idx int) string {
+	if idx == 0 {
+		return f.dir + f.name + ".log"
+	}
+	return fmt.Sprintf("%s%s.%d.log", f.dir, f.name, idx)
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, fmt.Errorf("log file %s is closed", f.path(0))
+	}
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *logFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	// the oldest rotated file is overwritten
+	for idx := f.maxBackups - 1; idx >= 1; idx-- {
+		_ = os.Rename(f.path(idx), f.path(idx+1))
+	}
+
+	if f.maxBackups > 0 {
+		_ = os.Rename(f.path(0), f.path(1))
+	}
+
+	file, err := os.Create(f.path(0))
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+func (f *logFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	_ = f.file.Sync()
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// initLogDir creates dir, and deletes expired log files in it
+func initLogDir(dir string, retention time.Duration) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error during creating log dir %s: %s", dir, err)
+	}
+
+	return removeExpiredLogFiles(dir, retention, nil)
+}
+
+// removeExpiredLogFiles deletes log files (and their rotated files) in dir that haven't been modified for longer than
+// retention, except the ones in openFiles; retention of 0 keeps all the files
+func removeExpiredLogFiles(dir string, retention time.Duration, openFiles map[string]*logFile) error {
+	if retention == 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error during reading log dir %s: %s", dir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+
+		// name.log and name.1.log both belong to name
+		name := strings.SplitN(entry.Name(), ".", 2)[0]
+		if _, isOpen := openFiles[name]; isOpen {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		if time.Since(info.ModTime()) > retention {
+			_ = os.Remove(dir + entry.Name())
+		}
+	}
+
+	return nil
+}
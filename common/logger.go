@@ -4,30 +4,87 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"io"
-	"os"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 var loggerMap map[string]*logrus.Logger
+var logFiles map[string]*logFile
 var loggerMapMutex sync.Mutex
 var loggingDir = ""
+var logConfig = DefaultLogConfig("logs", "")
+var logLevel = logrus.DebugLevel
 
-// InitLogger initializes the logger ; must be called before any logging
-func InitLogger(dir string) error {
-	loggerMap = make(map[string]*logrus.Logger)
+// InitLogger initializes the logger, creates the logging dir and deletes expired log files ; must be called before any logging.
+// Loggers of hosts that are already initialized in the same process are kept.
+func InitLogger(config *LogConfig) error {
+	loggerMapMutex.Lock()
+	defer loggerMapMutex.Unlock()
 
-	//err := os.Mkdir(dir, 0755)
-	//if err != nil {
-	//	return fmt.Errorf("error during creating log dir %s, using current working dir for logging...", dir)
-	//}
+	if loggerMap == nil {
+		loggerMap = make(map[string]*logrus.Logger)
+		logFiles = make(map[string]*logFile)
+	}
 
+	level, err := logrus.ParseLevel(config.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	dir := config.LogDir
 	if dir[len(dir)-1] != '/' {
 		dir += "/"
 	}
-	loggingDir = "logs/" + dir
+
+	if err = initLogDir(dir, time.Duration(config.LogRetention)); err != nil {
+		return err
+	}
+
+	loggingDir = dir
+	logConfig = *config
+	logLevel = level
+	return nil
+}
+
+// CloseLoggers closes all log files; anything logged afterward by the existing loggers is discarded
+func CloseLoggers() {
+	loggerMapMutex.Lock()
+	defer loggerMapMutex.Unlock()
+
+	for _, dumbLogger := range loggerMap {
+		dumbLogger.SetOutput(io.Discard)
+	}
+
+	for _, file := range logFiles {
+		_ = file.Close()
+	}
+	loggerMap = make(map[string]*logrus.Logger)
+	logFiles = make(map[string]*logFile)
+}
+
+// SetLogLevel changes the level of all existing and future loggers
+func SetLogLevel(levelString string) error {
+	level, err := logrus.ParseLevel(levelString)
+	if err != nil {
+		return err
+	}
+
+	loggerMapMutex.Lock()
+	defer loggerMapMutex.Unlock()
+
+	logLevel = level
+	for _, dumbLogger := range loggerMap {
+		dumbLogger.SetLevel(level)
+	}
 	return nil
-	// todo close files
+}
+
+func GetLogLevel() string {
+	loggerMapMutex.Lock()
+	defer loggerMapMutex.Unlock()
+	return logLevel.String()
 }
 
 // logs dir must exist
@@ -36,76 +93,130 @@ func GetLoggerForFile(prefix string, filename string) *Logger {
 	defer loggerMapMutex.Unlock()
 	if loggerMap == nil {
 		loggerMap = make(map[string]*logrus.Logger)
+		logFiles = make(map[string]*logFile)
 	}
 
 	dumbLogger, exists := loggerMap[filename]
 	if !exists {
-		logFile, err := os.Create(loggingDir + filename + ".log")
+		file, err := openLogFile(loggingDir, filename, logConfig.LogMaxSize, logConfig.LogMaxBackups)
 		if err != nil {
 			panic("error during creating log file")
 		}
+		logFiles[filename] = file
+
+		// per-task files are created during the whole lifetime of the host, so expired ones are deleted here as well
+		_ = removeExpiredLogFiles(loggingDir, time.Duration(logConfig.LogRetention), logFiles)
 
 		dumbLogger = logrus.New()
-		dumbLogger.SetLevel(logrus.DebugLevel)
-		dumbLogger.SetOutput(logFile)
+		dumbLogger.SetLevel(logLevel)
+		dumbLogger.SetOutput(file)
 		//httpLogger.SetReportCaller(true)
-		dumbLogger.SetFormatter(&LogFormatter{
-			logrus.TextFormatter{
-				FullTimestamp:          true,
-				TimestampFormat:        "2006-01-02 15:04:05",
-				ForceColors:            true,
-				DisableLevelTruncation: true,
-			},
-		})
+		if logConfig.LogFormat == "json" {
+			dumbLogger.SetFormatter(&logrus.JSONFormatter{
+				TimestampFormat: time.RFC3339Nano,
+			})
+		} else {
+			dumbLogger.SetFormatter(&LogFormatter{
+				logrus.TextFormatter{
+					FullTimestamp:          true,
+					TimestampFormat:        "2006-01-02 15:04:05",
+					ForceColors:            true,
+					DisableLevelTruncation: true,
+				},
+			})
+		}
 		loggerMap[filename] = dumbLogger
 	}
 
-	prefix = prefix + "$"
-
-	return &Logger{prefix, dumbLogger}
+	return &Logger{prefix, logrus.Fields{}, dumbLogger}
 }
 
+// GetLogger creates a Logger with the provided prefix, that logs to the same file and with the same fields as logger
 func GetLogger(prefix string, logger *Logger) *Logger {
-	prefix = prefix + "$"
-	return &Logger{prefix, logger.dumbLogger}
+	return &Logger{prefix, logger.fields, logger.dumbLogger}
 }
 
 func GetDiscardLogger() *Logger {
 	dumbLogger := logrus.New()
 	dumbLogger.SetOutput(io.Discard)
-	return &Logger{"", dumbLogger}
+	return &Logger{"", logrus.Fields{}, dumbLogger}
 }
 
+// field keys that are used across all hosts, so that the logs of one task can be correlated
+const (
+	ComponentField     = "component"
+	TaskIdField        = "task_id"
+	SensorIdField      = "sensor_id"
+	CorrelationIdField = "correlation_id"
+)
+
 type Logger struct {
 	prefix     string
+	fields     logrus.Fields
 	dumbLogger *logrus.Logger
 }
 
+// WithField returns a copy of the Logger which adds key=value to every logged message
+func (l *Logger) WithField(key string, value any) *Logger {
+	fields := make(logrus.Fields, len(l.fields)+1)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &Logger{l.prefix, fields, l.dumbLogger}
+}
+
+func (l *Logger) entry() *logrus.Entry {
+	entry := l.dumbLogger.WithFields(l.fields)
+	if l.prefix != "" {
+		entry = entry.WithField(ComponentField, l.prefix)
+	}
+	return entry
+}
+
 func (l *Logger) Info(format string, args ...interface{}) {
-	l.dumbLogger.Infof(l.prefix+format, args...)
+	l.entry().Infof(format, args...)
+}
+
+func (l *Logger) Warn(format string, args ...interface{}) {
+	l.entry().Warnf(format, args...)
 }
 
 func (l *Logger) Error(format string, args ...interface{}) {
-	l.dumbLogger.Errorf(l.prefix+format, args...)
+	l.entry().Errorf(format, args...)
 }
 
 func (l *Logger) Debug(format string, args ...interface{}) {
-	l.dumbLogger.Debugf(l.prefix+format, args...)
+	l.entry().Debugf(format, args...)
 }
 
 func (l *Logger) Err(err error) {
-	l.dumbLogger.Error(l.prefix + err.Error())
+	l.entry().Error(err.Error())
 }
 
+// LogFormatter formats entries as "[time] LEVEL [component] - message key=value ..."
 type LogFormatter struct {
 	logrus.TextFormatter
 }
 
 func (f *LogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
-	prefix := strings.Split(entry.Message, "$")[0]
-	message, _ := strings.CutPrefix(entry.Message, prefix+"$")
-	if len(prefix) > 0 {
-		prefix = "[" + prefix + "] "
+	prefix := ""
+	if component, exists := entry.Data[ComponentField]; exists {
+		prefix = fmt.Sprintf("[%s] ", component)
 	}
-	return []byte(fmt.Sprintf("[%s] %s %s- %s\n", entry.Time.Format(f.TimestampFormat), strings.ToUpper(entry.Level.String()), prefix, message)), nil
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		if key != ComponentField {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	fields := ""
+	for _, key := range keys {
+		fields += fmt.Sprintf(" %s=%v", key, entry.Data[key])
+	}
+
+	return []byte(fmt.Sprintf("[%s] %s %s- %s%s\n", entry.Time.Format(f.TimestampFormat), strings.ToUpper(entry.Level.String()), prefix, entry.Message, fields)), nil
 }
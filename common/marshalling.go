@@ -9,18 +9,38 @@ import (
 func GobInit() {
 	gob.Register(&MultiFESchemaParams{})
 	gob.Register(&SingleFESchemaParams{})
+	gob.Register(&DamgardSchemaParams{})
+	gob.Register(&PaillierSchemaParams{})
+	gob.Register(&LWESchemaParams{})
 
 	gob.Register(&SingleFECipher{})
 	gob.Register(&MultiFECipher{})
 	gob.Register(&DummyCipher{})
+	gob.Register(&MultiInputCipher{})
+	gob.Register(&LWECipher{})
+	gob.Register(&DMCFECipher{})
 
 	gob.Register(&MultiFEDecryptionParams{})
 	gob.Register(&SingleFEDecryptionParams{})
 	gob.Register(&DummyDecryptionParams{})
+	gob.Register(&DamgardMultiDecryptionParams{})
+	gob.Register(&PaillierMultiDecryptionParams{})
+	gob.Register(&LWEDecryptionParams{})
+	gob.Register(&DMCFEDecryptionParams{})
 
 	gob.Register(&MultiFEEncryptionParams{})
 	gob.Register(&SingleFEEncryptionParams{})
 	gob.Register(&DummyEncryptionParams{})
+	gob.Register(&DamgardMultiEncryptionParams{})
+	gob.Register(&PaillierMultiEncryptionParams{})
+	gob.Register(&LWEEncryptionParams{})
+	gob.Register(&DMCFEEncryptionParams{})
+
+	gob.Register(&DMCFEPubKeys{})
+	gob.Register(&DMCFEKeyShares{})
+
+	gob.Register(&ThresholdShare{})
+	gob.Register(&ThresholdPartialKey{})
 }
 
 func Encode(data any) ([]byte, error) {
@@ -0,0 +1,314 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are histogram buckets (in seconds) that cover everything from a single encryption to decrypting
+// a large result.
+var DurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 25, 50, 100}
+
+type metric interface {
+	metricName() string
+	write(w io.Writer)
+}
+
+// MetricsRegistry holds the metrics of a Host, and writes them in the Prometheus text format.
+type MetricsRegistry struct {
+	metrics []metric
+	mutex   sync.Mutex
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		metrics: make([]metric, 0),
+	}
+}
+
+func (r *MetricsRegistry) register(m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes all the registered metrics in the Prometheus text format.
+func (r *MetricsRegistry) Write(w io.Writer) {
+	r.mutex.Lock()
+	metrics := r.metrics
+	r.mutex.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// HistogramTotals returns the sum and the count of all observations of the histogram called name, across all its series
+func (r *MetricsRegistry) HistogramTotals(name string) (sum float64, count uint64) {
+	if h, ok := r.lookup(name).(*Histogram); ok {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		for _, series := range h.series {
+			sum += series.sum
+			count += series.count
+		}
+	}
+	return
+}
+
+// CounterTotal returns the value of the counter called name, summed across all its series
+func (r *MetricsRegistry) CounterTotal(name string) (total float64) {
+	if c, ok := r.lookup(name).(*Counter); ok {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for _, series := range c.series {
+			total += series.value
+		}
+	}
+	return
+}
+
+func (r *MetricsRegistry) lookup(name string) metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, m := range r.metrics {
+		if m.metricName() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+func (r *MetricsRegistry) String() string {
+	var builder strings.Builder
+	r.Write(&builder)
+	return builder.String()
+}
+
+//region Counter
+
+// Counter is a monotonically increasing value, with one series per combination of label values.
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	series map[string]*counterSeries
+	mutex  sync.Mutex
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func (r *MetricsRegistry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*counterSeries),
+	}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter for the provided label values, which must match the labels of the Counter.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	series, exists := c.series[key]
+	if !exists {
+		series = &counterSeries{labelValues: labelValues}
+		c.series[key] = series
+	}
+	series.value += value
+}
+
+func (c *Counter) metricName() string {
+	return c.name
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		series := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, series.labelValues), formatValue(series.value))
+	}
+}
+
+//endregion
+
+//region Histogram
+
+// Histogram counts observations in buckets, with one series per combination of label values.
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	series map[string]*histogramSeries
+	mutex  sync.Mutex
+}
+
+type histogramSeries struct {
+	labelValues  []string
+	bucketCounts []uint64 // bucketCounts[i] counts observations <= buckets[i]
+	count        uint64
+	sum          float64
+}
+
+func (r *MetricsRegistry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds value to the histogram for the provided label values, which must match the labels of the Histogram.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	series, exists := h.series[key]
+	if !exists {
+		series = &histogramSeries{
+			labelValues:  labelValues,
+			bucketCounts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = series
+	}
+
+	for idx, bound := range h.buckets {
+		if value <= bound {
+			series.bucketCounts[idx]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// ObserveDuration adds d, in seconds, to the histogram.
+func (h *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+func (h *Histogram) metricName() string {
+	return h.name
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		for idx, bound := range h.buckets {
+			labelValues := append(append([]string{}, series.labelValues...), formatValue(bound))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, labelValues), series.bucketCounts[idx])
+		}
+		labelValues := append(append([]string{}, series.labelValues...), "+Inf")
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(bucketLabels, labelValues), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, series.labelValues), formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, series.labelValues), series.count)
+	}
+}
+
+//endregion
+
+//region GaugeFunc
+
+// GaugeFunc is a value that can go up and down, read by calling valueFn at the time the metrics are collected.
+type GaugeFunc struct {
+	name    string
+	help    string
+	valueFn func() float64
+}
+
+func (r *MetricsRegistry) NewGaugeFunc(name string, help string, valueFn func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		name:    name,
+		help:    help,
+		valueFn: valueFn,
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) metricName() string {
+	return g.name
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.valueFn()))
+}
+
+//endregion
+
+//region formatting
+
+func writeHeader(w io.Writer, name string, help string, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func formatLabels(labels []string, labelValues []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, len(labels))
+	for idx, label := range labels {
+		value := ""
+		if idx < len(labelValues) {
+			value = labelValues[idx]
+		}
+		pairs[idx] = fmt.Sprintf(`%s="%s"`, label, escaper.Replace(value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//endregion
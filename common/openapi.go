@@ -0,0 +1,357 @@
+package common
+
+import (
+	"encoding"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The OpenAPI document of a host is generated from its endpoints: the schemas of the bodies are reflected from the
+// types of Endpoint.Request and Endpoint.Response, following the json tags. The named structs are components, so
+// that they're referenced instead of repeated, and so that the recursive types (e.g. the customers and their
+// sensors) end. The document is served by every host as GET /openapi.json.
+
+// BodyText and BodyEventStream are the content types of the bodies of a StringResponse and a StreamResponse
+const (
+	BodyText        = "text/plain"
+	BodyEventStream = string(StreamResponse)
+)
+
+const openAPIVersion = "3.0.3"
+
+// OpenAPI returns the OpenAPI document of the endpoints; authenticated documents the bearer authentication of the
+// endpoints with roles
+func OpenAPI(title string, endpoints []Endpoint, authenticated bool) map[string]any {
+	generator := &schemaGenerator{
+		schemas: make(map[string]any),
+		names:   make(map[reflect.Type]string),
+		taken:   make(map[string]reflect.Type),
+	}
+
+	paths := make(map[string]map[string]any)
+	operationIds := make(map[string]int)
+	for _, endpoint := range endpoints {
+		path, parameters := openAPIPath(endpoint.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		operation := generator.operation(endpoint, parameters, authenticated)
+
+		// the operations whose paths differ only in their params are numbered, as their ids must be unique
+		operationId := operation["operationId"].(string)
+		if operationIds[operationId]++; operationIds[operationId] > 1 {
+			operation["operationId"] = operationId + strconv.Itoa(operationIds[operationId])
+		}
+		paths[path][strings.ToLower(endpoint.Method)] = operation
+	}
+
+	document := map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   title,
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": generator.schemas,
+		},
+	}
+	if authenticated {
+		document["components"].(map[string]any)["securitySchemes"] = map[string]any{
+			"bearer": map[string]any{
+				"type":        "http",
+				"scheme":      "bearer",
+				"description": "an API key, or a JWT signed with HS256",
+			},
+		}
+	}
+	return document
+}
+
+// openAPIPath converts the gin path params (:id, *path) to the OpenAPI ones ({id}), and returns their names
+func openAPIPath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	parameters := make([]string, 0)
+	for idx, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			parameters = append(parameters, segment[1:])
+			segments[idx] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), parameters
+}
+
+// operationId is the method followed by the static segments of the path, e.g. getV1TasksBundle for
+// GET /v1/tasks/:id/bundle
+func operationId(method, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+func (g *schemaGenerator) operation(endpoint Endpoint, pathParameters []string, authenticated bool) map[string]any {
+	operation := map[string]any{
+		"operationId": operationId(endpoint.Method, endpoint.Path),
+	}
+	if endpoint.Summary != "" {
+		operation["summary"] = endpoint.Summary
+	}
+	if endpoint.Deprecated {
+		operation["deprecated"] = true
+		operation["description"] = "the JSON fields that predate /v1 have their legacy camelCase names"
+	}
+
+	parameters := make([]any, 0)
+	for _, name := range pathParameters {
+		parameters = append(parameters, map[string]any{
+			"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	queryNames := make([]string, 0, len(endpoint.Query))
+	for name := range endpoint.Query {
+		queryNames = append(queryNames, name)
+	}
+	sort.Strings(queryNames)
+	for _, name := range queryNames {
+		parameters = append(parameters, map[string]any{
+			"name": name, "in": "query", "description": endpoint.Query[name], "schema": map[string]any{"type": "string"},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if endpoint.Request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  g.content(endpoint.Request),
+		}
+	}
+
+	status := endpoint.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]any{"description": http.StatusText(status)}
+	if endpoint.Response != nil && endpoint.Envelope {
+		success["content"] = g.envelopedContent(endpoint.Response)
+	} else if endpoint.Response != nil {
+		success["content"] = g.content(endpoint.Response)
+	}
+	errorResponse := map[string]any{
+		"description": "error",
+		"content": g.content(struct {
+			Error  string   `json:"error,omitempty"`
+			Errors []string `json:"errors,omitempty"`
+		}{}),
+	}
+	if endpoint.Envelope {
+		errorResponse["content"] = g.content(ErrorEnvelope{})
+	}
+	responses := map[string]any{
+		strconv.Itoa(status): success,
+		"default":            errorResponse,
+	}
+
+	if len(endpoint.Roles) > 0 {
+		roles := make([]string, len(endpoint.Roles))
+		for idx, role := range endpoint.Roles {
+			roles[idx] = string(role)
+		}
+		operation["x-roles"] = roles
+		if authenticated {
+			operation["security"] = []any{map[string]any{"bearer": []string{}}}
+			responses[strconv.Itoa(http.StatusUnauthorized)] = errorResponse
+			responses[strconv.Itoa(http.StatusForbidden)] = errorResponse
+		}
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+// content returns the content of a body, whose type is the type of the value, or whose content type is the string
+func (g *schemaGenerator) content(body any) map[string]any {
+	if contentType, ok := body.(string); ok {
+		schema := map[string]any{"type": "string"}
+		if contentType == BodyOctetStream {
+			schema["format"] = "binary"
+		}
+		return map[string]any{contentType: map[string]any{"schema": schema}}
+	}
+	return map[string]any{BodyJSON: map[string]any{"schema": g.schema(reflect.TypeOf(body))}}
+}
+
+// envelopedContent returns the content of a body wrapped in a DataEnvelope; the bodies that are neither JSON nor text
+// aren't wrapped
+func (g *schemaGenerator) envelopedContent(body any) map[string]any {
+	contentType, ok := body.(string)
+	if ok && contentType != BodyText {
+		return g.content(body)
+	}
+
+	data := map[string]any{"type": "string"}
+	if !ok {
+		data = g.schema(reflect.TypeOf(body))
+	}
+	return map[string]any{BodyJSON: map[string]any{"schema": map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"data": data},
+	}}}
+}
+
+//region schemas
+
+type schemaGenerator struct {
+	schemas map[string]any
+	names   map[reflect.Type]string // names of the components, by type
+	taken   map[string]reflect.Type
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	bigIntType        = reflect.TypeOf(big.Int{})
+	uuidType          = reflect.TypeOf(UUID(""))
+	errorCodeType     = reflect.TypeOf(ErrorCode(""))
+	byteSliceType     = reflect.TypeOf([]byte(nil))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// implements reports whether the type, or the pointer to it, implements the interface
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || (t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(iface))
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == bigIntType:
+		return map[string]any{"type": "integer", "description": "arbitrary precision"}
+	case t == uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	case t == errorCodeType:
+		return map[string]any{"type": "string", "enum": errorCodes}
+	case t == byteSliceType:
+		return map[string]any{"type": "string", "format": "byte"}
+	case implements(t, jsonMarshalerType):
+		return map[string]any{}
+	case implements(t, textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + g.component(t)}
+	}
+	// interfaces, and whatever else isn't known until the response is sent
+	return map[string]any{}
+}
+
+// component returns the name of the component of the named struct, which is added on the first use
+func (g *schemaGenerator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	// the types of different packages may have the same name
+	name := t.Name()
+	if other, ok := g.taken[name]; ok && other != t {
+		name = strings.ReplaceAll(t.PkgPath(), "/", ".") + "." + name
+	}
+	g.names[t] = name
+	g.taken[name] = t
+
+	// the name is set before the schema is generated, so that the recursive references end
+	g.schemas[name] = g.structSchema(t)
+	return name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	g.addProperties(t, properties)
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// addProperties adds the fields of the struct, and the fields of its embedded structs, as encoding/json does: the
+// fields of the struct itself take precedence over the embedded ones
+func (g *schemaGenerator) addProperties(t reflect.Type, properties map[string]any) {
+	embedded := make([]reflect.Type, 0)
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct &&
+			!implements(fieldType, jsonMarshalerType) && !implements(fieldType, textMarshalerType) {
+			embedded = append(embedded, fieldType)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+	}
+
+	for _, embeddedType := range embedded {
+		embeddedProperties := make(map[string]any)
+		g.addProperties(embeddedType, embeddedProperties)
+		for name, schema := range embeddedProperties {
+			if _, ok := properties[name]; !ok {
+				properties[name] = schema
+			}
+		}
+	}
+}
+
+//endregion
+
+// OpenAPI returns the OpenAPI document of the HttpServer's endpoints
+func (host *HttpServer) OpenAPI() map[string]any {
+	return OpenAPI(host.Title, host.endpoints, host.authenticator != nil)
+}
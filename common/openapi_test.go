@@ -0,0 +1,218 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"math/big"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOpenAPIPath(t *testing.T) {
+	tests := []struct {
+		path       string
+		openAPI    string
+		parameters []string
+	}{
+		{"/", "/", []string{}},
+		{"/v1/tasks", "/v1/tasks", []string{}},
+		{"/v1/tasks/:id/bundle", "/v1/tasks/{id}/bundle", []string{"id"}},
+		{"/task/:taskId/:sensorId", "/task/{taskId}/{sensorId}", []string{"taskId", "sensorId"}},
+		{"/files/*path", "/files/{path}", []string{"path"}},
+	}
+	for _, test := range tests {
+		path, parameters := openAPIPath(test.path)
+		if path != test.openAPI || !slices.Equal(parameters, test.parameters) {
+			t.Errorf("%s converted to %s %v, expected %s %v", test.path, path, parameters, test.openAPI, test.parameters)
+		}
+	}
+}
+
+func TestOperationId(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		id     string
+	}{
+		{"GET", "/v1/tasks/:id/bundle", "getV1TasksBundle"},
+		{"PUT", "/v1/log-level", "putV1LogLevel"},
+		{"GET", "/openapi.json", "getOpenapiJson"},
+		{"POST", "/task/:taskId/:sensorId", "postTask"},
+		{"GET", "/", "get"},
+	}
+	for _, test := range tests {
+		if id := operationId(test.method, test.path); id != test.id {
+			t.Errorf("operation id of %s %s is %s, expected %s", test.method, test.path, id, test.id)
+		}
+	}
+}
+
+type openAPITestBase struct {
+	Id      UUID   `json:"id"`
+	Comment string `json:"comment"`
+}
+
+// openAPITestNode is recursive, and embeds openAPITestBase, whose comment it overrides
+type openAPITestNode struct {
+	openAPITestBase
+	Comment  int                `json:"comment"`
+	Children []*openAPITestNode `json:"children,omitempty"`
+	Bound    *big.Int           `json:"bound"`
+	Data     []byte             `json:"data"`
+	Created  time.Time          `json:"created"`
+	Labels   map[string]float64 `json:"labels"`
+	Internal string             `json:"-"`
+	Untagged bool
+	hidden   int
+}
+
+// openAPIDocument returns the OpenAPI document of the endpoints, as it's served
+func openAPIDocument(t *testing.T, endpoints []Endpoint, authenticated bool) map[string]any {
+	t.Helper()
+
+	data, err := json.Marshal(OpenAPI("test", endpoints, authenticated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document map[string]any
+	if err = json.Unmarshal(data, &document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+// lookup returns the value of the document at the keys, or fails the test
+func lookup(t *testing.T, document any, keys ...string) any {
+	t.Helper()
+
+	value := document
+	for idx, key := range keys {
+		object, ok := value.(map[string]any)
+		if !ok {
+			t.Fatalf("%v isn't an object", keys[:idx])
+		}
+		if value, ok = object[key]; !ok {
+			t.Fatalf("%v not found", keys[:idx+1])
+		}
+	}
+	return value
+}
+
+func TestOpenAPI(t *testing.T) {
+	handler := func(c *gin.Context) (ResponseType, int, any) {
+		return NoResponse, http.StatusOK, nil
+	}
+	endpoints := append(
+		RouteGroup{Prefix: V1Prefix, Envelope: true, Roles: []Role{RoleOperator}}.Endpoints([]Endpoint{
+			{Method: "GET", Path: "/nodes/:id", Handler: handler, Summary: "a node", Query: map[string]string{"depth": "of the children"},
+				Response: openAPITestNode{}},
+			{Method: "POST", Path: "/nodes", Handler: handler, Request: openAPITestNode{}, Status: http.StatusCreated,
+				Response: BodyOctetStream},
+		}),
+		RouteGroup{Deprecated: true}.Endpoints([]Endpoint{
+			{Method: "GET", Path: "/node/:id", Handler: handler, Response: []openAPITestNode{}},
+			{Method: "GET", Path: "/node/:id/:childId", Handler: handler, Response: BodyText},
+		})...,
+	)
+	document := openAPIDocument(t, endpoints, true)
+
+	t.Run("operations", func(t *testing.T) {
+		get := lookup(t, document, "paths", "/v1/nodes/{id}", "get")
+		if id := lookup(t, get, "operationId"); id != "getV1Nodes" {
+			t.Errorf("operation id %v", id)
+		}
+		parameters := lookup(t, get, "parameters").([]any)
+		if len(parameters) != 2 || lookup(t, parameters[0], "in") != "path" || lookup(t, parameters[1], "name") != "depth" {
+			t.Errorf("parameters %v, expected the id and the depth", parameters)
+		}
+		// the paths that differ only in their params are numbered
+		if id := lookup(t, document, "paths", "/node/{id}/{childId}", "get", "operationId"); id != "getNode2" {
+			t.Errorf("operation id %v, expected getNode2", id)
+		}
+
+		post := lookup(t, document, "paths", "/v1/nodes", "post")
+		if ref := lookup(t, post, "requestBody", "content", BodyJSON, "schema", "$ref"); ref != "#/components/schemas/openAPITestNode" {
+			t.Errorf("request body %v", ref)
+		}
+		if format := lookup(t, post, "responses", "201", "content", BodyOctetStream, "schema", "format"); format != "binary" {
+			t.Errorf("response format %v", format)
+		}
+	})
+
+	t.Run("envelope", func(t *testing.T) {
+		data := lookup(t, document, "paths", "/v1/nodes/{id}", "get", "responses", "200", "content", BodyJSON, "schema", "properties", "data")
+		if lookup(t, data, "$ref") != "#/components/schemas/openAPITestNode" {
+			t.Errorf("enveloped data %v", data)
+		}
+		lookup(t, document, "components", "schemas", "ErrorEnvelope")
+
+		// the deprecated endpoints have no envelope, and name the legacy fields
+		deprecated := lookup(t, document, "paths", "/node/{id}", "get")
+		if lookup(t, deprecated, "deprecated") != true {
+			t.Error("deprecated endpoint not marked")
+		}
+		lookup(t, deprecated, "description")
+		if lookup(t, deprecated, "responses", "200", "content", BodyJSON, "schema", "type") != "array" {
+			t.Error("response of the deprecated endpoint enveloped")
+		}
+	})
+
+	t.Run("security", func(t *testing.T) {
+		get := lookup(t, document, "paths", "/v1/nodes/{id}", "get")
+		lookup(t, get, "security")
+		lookup(t, get, "responses", "401")
+		if roles := lookup(t, get, "x-roles").([]any); len(roles) != 1 || roles[0] != "operator" {
+			t.Errorf("roles %v", roles)
+		}
+		lookup(t, document, "components", "securitySchemes", "bearer")
+
+		public := lookup(t, document, "paths", "/node/{id}", "get").(map[string]any)
+		if _, ok := public["security"]; ok {
+			t.Error("public endpoint requires authentication")
+		}
+
+		unauthenticated := openAPIDocument(t, endpoints, false)
+		if _, ok := lookup(t, unauthenticated, "paths", "/v1/nodes/{id}", "get").(map[string]any)["security"]; ok {
+			t.Error("authentication documented without an authenticator")
+		}
+	})
+
+	t.Run("schemas", func(t *testing.T) {
+		properties := lookup(t, document, "components", "schemas", "openAPITestNode", "properties").(map[string]any)
+		expected := []string{"id", "comment", "children", "bound", "data", "created", "labels", "Untagged"}
+		if len(properties) != len(expected) {
+			t.Errorf("properties %v, expected %v", properties, expected)
+		}
+		for _, name := range expected {
+			lookup(t, properties, name)
+		}
+
+		tests := []struct {
+			property string
+			key      string
+			value    any
+		}{
+			{"id", "format", "uuid"},
+			{"comment", "type", "integer"}, // the field of the struct itself, not the embedded one
+			{"bound", "type", "integer"},
+			{"data", "format", "byte"},
+			{"created", "format", "date-time"},
+			{"Untagged", "type", "boolean"},
+		}
+		for _, test := range tests {
+			if value := lookup(t, properties, test.property, test.key); value != test.value {
+				t.Errorf("%s of %s is %v, expected %v", test.key, test.property, value, test.value)
+			}
+		}
+
+		// the recursive reference ends at the component
+		if ref := lookup(t, properties, "children", "items", "$ref"); ref != "#/components/schemas/openAPITestNode" {
+			t.Errorf("children %v", ref)
+		}
+		if labels := lookup(t, properties, "labels", "additionalProperties", "type"); labels != "number" {
+			t.Errorf("labels %v", labels)
+		}
+	})
+}
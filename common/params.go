@@ -1,6 +1,7 @@
 package common
 
 import (
+	"fmt"
 	"github.com/fentec-project/bn256"
 	"github.com/fentec-project/gofe/data"
 	"github.com/fentec-project/gofe/innerprod/fullysec"
@@ -9,14 +10,17 @@ import (
 
 type SamplingParams struct {
 	Start          int `json:"start"` // timestamp when server resets for the first time and starts measuring
-	SamplingPeriod int `json:"samplingPeriod"`
+	SamplingPeriod int `json:"sampling_period"`
 	BatchParams
-	MaxSampleValue int `json:"maxSampleValue"`
+
+	// the bounds are fixed-point encoded, see EncodeFixedPoint
+	MinSampleValue int `json:"min_sample_value"`
+	MaxSampleValue int `json:"max_sample_value"`
 }
 
 type BatchParams struct {
-	BatchSize int `json:"batchSize"`
-	BatchCnt  int `json:"batchCnt"`
+	BatchSize int `json:"batch_size"`
+	BatchCnt  int `json:"batch_cnt"`
 }
 
 //region FE
@@ -26,6 +30,9 @@ type BatchParams struct {
 type FESchemaParams any
 type SingleFESchemaParams = fullysec.FHIPEParams
 type MultiFESchemaParams = fullysec.FHMultiIPEParams
+type DamgardSchemaParams = fullysec.DamgardParams
+type PaillierSchemaParams = fullysec.PaillierParams
+type LWESchemaParams = fullysec.LWEParams
 
 //endregion
 
@@ -43,6 +50,23 @@ type DummyCipher struct {
 	Samples []*big.Int
 }
 
+// MultiInputCipher is a cipher of SchemeDamgardMulti or SchemePaillierMulti
+type MultiInputCipher struct {
+	Idx     int
+	Payload data.Vector
+}
+
+type LWECipher struct {
+	Payload data.Vector
+}
+
+// DMCFECipher holds the ciphers of all the samples of a batch; every sample is encrypted by its own DMCFE client
+type DMCFECipher struct {
+	BatchIdx  int
+	SensorIdx int
+	Payload   []*bn256.G1
+}
+
 //endregion
 
 // region Encryption
@@ -50,18 +74,50 @@ type DummyCipher struct {
 type FEEncryptionParams any
 
 type SingleFEEncryptionParams struct {
-	SecKey       *fullysec.FHIPESecKey `json:"secKey"`
+	SecKey       *fullysec.FHIPESecKey `json:"sec_key"`
 	SchemaParams *SingleFESchemaParams `json:"params"`
 }
 
 type MultiFEEncryptionParams struct {
-	IdxOffset    int                  `json:"idxOffset"`
-	SecKeys      []data.Matrix        `json:"secKeys"`
+	IdxOffset    int                  `json:"idx_offset"`
+	SecKeys      []data.Matrix        `json:"sec_keys"`
 	SchemaParams *MultiFESchemaParams `json:"params"`
 }
 
 type DummyEncryptionParams struct {
-	IdxOffset int `json:"idxOffset"`
+	IdxOffset int `json:"idx_offset"`
+}
+
+// DamgardMultiEncryptionParams hold a public key and a one-time pad for every batch of the sensor
+type DamgardMultiEncryptionParams struct {
+	IdxOffset    int                  `json:"idx_offset"`
+	Bound        *big.Int             `json:"bound"`
+	PubKeys      data.Matrix          `json:"pub_keys"`
+	Otps         data.Matrix          `json:"otps"`
+	SchemaParams *DamgardSchemaParams `json:"params"`
+}
+
+// PaillierMultiEncryptionParams hold a public key and a one-time pad for every batch of the sensor
+type PaillierMultiEncryptionParams struct {
+	IdxOffset    int                   `json:"idx_offset"`
+	BoundX       *big.Int              `json:"bound_x"`
+	BoundY       *big.Int              `json:"bound_y"`
+	PubKeys      data.Matrix           `json:"pub_keys"`
+	Otps         data.Matrix           `json:"otps"`
+	SchemaParams *PaillierSchemaParams `json:"params"`
+}
+
+type LWEEncryptionParams struct {
+	PubKey       data.Matrix      `json:"pub_key"`
+	SchemaParams *LWESchemaParams `json:"params"`
+}
+
+// DMCFEEncryptionParams hold the secrets of the sensor's DMCFE clients, one for every sample of a batch;
+// batch no i is encrypted under the label DMCFELabel(Label, i)
+type DMCFEEncryptionParams struct {
+	SensorIdx  int         `json:"sensor_idx"`
+	ClientKeys data.Matrix `json:"client_keys"`
+	Label      string      `json:"label"`
 }
 
 //endregion
@@ -86,6 +142,107 @@ type DummyDecryptionParams struct {
 	Rates    [][]*big.Int
 }
 
+type DamgardMultiDecryptionParams struct {
+	NumClients    int
+	Bound         *big.Int
+	SchemaParams  DamgardSchemaParams
+	DecryptionKey *fullysec.DamgardMultiDerivedKey
+	Rates         data.Matrix
+}
+
+type PaillierMultiDecryptionParams struct {
+	NumClients    int
+	BoundX        *big.Int
+	BoundY        *big.Int
+	SchemaParams  PaillierSchemaParams
+	DecryptionKey *fullysec.PaillierMultiDerivedKey
+	Rates         data.Matrix
+}
+
+type LWEDecryptionParams struct {
+	SchemaParams  LWESchemaParams
+	DecryptionKey data.Vector
+	Rates         data.Vector
+}
+
+// DMCFEDecryptionParams hold a decryption key (the sum of the key shares of all the clients) and the rates of all the
+// clients, for every batch
+type DMCFEDecryptionParams struct {
+	SensorCnt      int
+	BatchCnt       int
+	BatchSize      int
+	Bound          *big.Int
+	Label          string
+	DecryptionKeys []data.VectorG2
+	Rates          data.Matrix
+}
+
+//endregion
+
+// DMCFELabel returns the label that batch no batchIdx of the task is encrypted under
+func DMCFELabel(label string, batchIdx int) string {
+	return fmt.Sprintf("%s/%d", label, batchIdx)
+}
+
+// DMCFERates returns the rates of all the clients for every batch; every sensor's batch is multiplied by the same
+// rates, so the client no i gets the rate of the sample no i%batchSize
+func DMCFERates(rates []int, sensorCnt, batchSize int) (data.Matrix, error) {
+	if len(rates)%batchSize != 0 {
+		return nil, fmt.Errorf("rates count %d is not a multiple of the batch size %d", len(rates), batchSize)
+	}
+
+	matrix := make(data.Matrix, len(rates)/batchSize)
+	for batchIdx := range matrix {
+		matrix[batchIdx] = make(data.Vector, sensorCnt*batchSize)
+		for clientIdx := range matrix[batchIdx] {
+			matrix[batchIdx][clientIdx] = big.NewInt(int64(rates[batchIdx*batchSize+clientIdx%batchSize]))
+		}
+	}
+	return matrix, nil
+}
+
+// DMCFEBound returns the bound of the absolute value of the result of a batch, from the bounds of the absolute values
+// of samples and rates
+func DMCFEBound(clientCnt, sampleBound, rateBound int) *big.Int {
+	bound := big.NewInt(int64(clientCnt))
+	bound.Mul(bound, big.NewInt(int64(sampleBound)))
+	return bound.Mul(bound, big.NewInt(int64(rateBound)))
+}
+
+// DeriveDMCFEKeyShares derives the key share of clients for the rates of every batch; the key shares of the clients
+// are summed, as the decryption needs only their sum. The sum over all the clients of the task is the decryption key.
+func DeriveDMCFEKeyShares(clients []*fullysec.DMCFEClient, rates data.Matrix) ([]data.VectorG2, error) {
+	keyShares := make([]data.VectorG2, len(rates))
+	for batchIdx, batchRates := range rates {
+		for _, client := range clients {
+			keyShare, err := client.DeriveKeyShare(batchRates)
+			if err != nil {
+				return nil, err
+			}
+
+			if keyShares[batchIdx] == nil {
+				keyShares[batchIdx] = keyShare
+			} else {
+				keyShares[batchIdx] = keyShares[batchIdx].Add(keyShare)
+			}
+		}
+	}
+	return keyShares, nil
+}
+
+//region decentralized DMCFE
+
+// DMCFEPubKeys hold the public keys of DMCFE clients, ordered by the client idx; a sensor sends the keys of its own
+// clients, and receives the keys of all the clients
+type DMCFEPubKeys struct {
+	PubKeys []*bn256.G1
+}
+
+// DMCFEKeyShares hold, for every batch, the sum of the key shares of a sensor's clients
+type DMCFEKeyShares struct {
+	KeyShares []data.VectorG2
+}
+
 //endregion
 
 //endregion
@@ -2,7 +2,6 @@ package common
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,62 +10,72 @@ import (
 type RemoteHttpServer struct {
 	IP
 	Logger *Logger
-}
 
-// POST sends a POST http request to a remote http server; url should not include schema, ip address and port
-func (httpClient *RemoteHttpServer) POST(path string, body any, contentType string) (int, []byte, error) {
-	if contentType == BodyJSON {
-		body, _ = json.Marshal(body)
-		httpClient.Logger.Info("POST %s body: %s", httpClient.IP.String()+path, body)
-	} else if contentType != BodyOctetStream {
-		panic("POST content type is neither json nor octet-stream.")
-	}
+	// CorrelationId is sent with every request in CorrelationIdHeader; if empty, every request gets a new one
+	CorrelationId string
 
-	// Create a request with the payload
-	req, err := http.NewRequest("POST", httpClient.IP.String()+path, bytes.NewBuffer(body.([]byte)))
-	if err != nil {
-		httpClient.Logger.Error("error during creating request: %s", err)
-		return 0, nil, fmt.Errorf("error during creating http request")
-	}
+	// Credential is sent with every request as a bearer token in AuthorizationHeader, if set; see auth.go
+	Credential string
+}
 
-	if contentType == "json" {
-		req.Header.Set("Content-Type", "application/json")
+// ForTask returns a copy of the RemoteHttpServer whose requests are correlated by the task id
+func (httpClient *RemoteHttpServer) ForTask(taskId UUID) *RemoteHttpServer {
+	return &RemoteHttpServer{
+		IP:            httpClient.IP,
+		Logger:        httpClient.Logger.WithField(TaskIdField, taskId).WithField(CorrelationIdField, taskId),
+		CorrelationId: string(taskId),
+		Credential:    httpClient.Credential,
 	}
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		httpClient.Logger.Error("error during sending request: %s", err)
-		return 0, nil, fmt.Errorf("error during sending http request")
+// setCorrelationId sets the correlation id header of req, and the credential, and returns the logger that logs with
+// the correlation id
+func (httpClient *RemoteHttpServer) setCorrelationId(req *http.Request) *Logger {
+	if httpClient.Credential != "" {
+		req.Header.Set(AuthorizationHeader, "Bearer "+httpClient.Credential)
 	}
-
-	// get status code & read response body
-	statusCode := resp.StatusCode
-	responseBody, err := getResponseBody(resp)
-	if err != nil {
-		httpClient.Logger.Error("error during reading response body: %s", err)
-		return statusCode, nil, fmt.Errorf("error during reading http response")
+	if httpClient.CorrelationId != "" {
+		req.Header.Set(CorrelationIdHeader, httpClient.CorrelationId)
+		return httpClient.Logger
 	}
 
-	httpClient.Logger.Info("POST %s -> %d %s ", httpClient.IP.String()+path, statusCode, string(responseBody))
-	return statusCode, responseBody, nil
+	correlationId := string(NewUUID())
+	req.Header.Set(CorrelationIdHeader, correlationId)
+	return httpClient.Logger.WithField(CorrelationIdField, correlationId)
 }
 
-// GET sends a GET http request to a remote http server; url should not include schema, ip address and port
-func (httpClient *RemoteHttpServer) GET(path string) (int, []byte, error) {
-	httpClient.Logger.Info("GET %s", httpClient.IP.String()+path)
+// Do sends an http request with the method to a remote http server; the path doesn't include the schema, the ip
+// address and the port, and the body, if any, has the content type. The requests of the hosts are sent by fe/client.
+func (httpClient *RemoteHttpServer) Do(method string, path string, contentType string, body []byte, headers map[string]string) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewBuffer(body)
+	}
 
-	// Create a request with the payload
-	req, err := http.NewRequest("GET", httpClient.IP.String()+path, nil)
+	req, err := http.NewRequest(method, httpClient.IP.String()+path, reader)
 	if err != nil {
 		httpClient.Logger.Error("error during creating request: %s", err)
 		return 0, nil, fmt.Errorf("error during creating http request")
 	}
 
+	logger := httpClient.setCorrelationId(req)
+	if contentType == BodyJSON {
+		logger.Info("%s %s body: %s", method, httpClient.IP.String()+path, body)
+	} else {
+		logger.Info("%s %s", method, httpClient.IP.String()+path)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		httpClient.Logger.Error("error during sending request: %s", err)
+		logger.Error("error during sending request: %s", err)
 		return 0, nil, fmt.Errorf("error during sending http request")
 	}
 
@@ -74,12 +83,12 @@ func (httpClient *RemoteHttpServer) GET(path string) (int, []byte, error) {
 	statusCode := resp.StatusCode
 	responseBody, err := getResponseBody(resp)
 	if err != nil {
-		httpClient.Logger.Error("error during reading response body: %s", err)
+		logger.Error("error during reading response body: %s", err)
 		return statusCode, nil, fmt.Errorf("error during reading http response")
 	}
 
 	if resp.Header.Get("Content-Type") != string(DataResponse) {
-		httpClient.Logger.Info("GET %s -> %d %s ", httpClient.IP.String()+path, statusCode, string(responseBody))
+		logger.Info("%s %s -> %d %s ", method, httpClient.IP.String()+path, statusCode, string(responseBody))
 	}
 
 	return statusCode, responseBody, nil
@@ -16,15 +16,15 @@ func NewRepeatedSequenceGenerator() *RepeatedSequenceGenerator {
 	}
 }
 
-// ReadSample mocks a hardware sensor, and returns random sample in [0, maxValue]
-func (s *RepeatedSequenceGenerator) ReadSample(maxValue int, idx *int) int {
+// ReadSample mocks a hardware sensor, and returns random sample in [minValue, maxValue]
+func (s *RepeatedSequenceGenerator) ReadSample(minValue, maxValue int, idx *int) int {
 	//todo ovo ne radi za paralelan pristup, mora eksterni kursor !!!
 	s.Mutex.Lock()
 	defer s.Mutex.Unlock()
 	*idx += 1
 	if *idx == len(s.SampledSequence)+1 {
 		// generate new sample
-		value := rand.Intn(maxValue)
+		value := minValue + rand.Intn(maxValue-minValue+1)
 		s.SampledSequence = append(s.SampledSequence, value)
 		return value
 	} else {
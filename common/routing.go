@@ -0,0 +1,147 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// An Endpoint is routed for any of the supportedMethods. Its handler is wrapped by the middleware of the HttpServer
+// (see Use), then by the envelope (see api.go), then by the authorization of its roles, then by its own Middleware,
+// the first one outermost. The endpoints are usually declared in a RouteGroup, which prefixes their paths and adds
+// its middleware and roles.
+// InitHttpServer validates the endpoints, so that a declaration that would never be routed fails the startup of
+// the host, instead of being ignored.
+
+// EndpointHandler handles a request, and returns the type, the status code and the body of the response
+type EndpointHandler func(c *gin.Context) (ResponseType, int, any)
+
+// Middleware wraps the handler of an endpoint; it may answer the request itself, without calling next
+type Middleware func(next EndpointHandler) EndpointHandler
+
+var supportedMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+func isSupportedMethod(method string) bool {
+	for _, supported := range supportedMethods {
+		if method == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// chain wraps handler by the middleware, the first one outermost
+func chain(handler EndpointHandler, middleware []Middleware) EndpointHandler {
+	for idx := len(middleware) - 1; idx >= 0; idx-- {
+		handler = middleware[idx](handler)
+	}
+	return handler
+}
+
+//region RouteGroup
+
+// RouteGroup declares endpoints that share a path prefix, middleware and roles; the endpoints of an Envelope or a
+// Deprecated group are too
+type RouteGroup struct {
+	Prefix     string
+	Middleware []Middleware
+	Roles      []Role // of the endpoints that don't declare their own
+	Envelope   bool
+	Deprecated bool
+}
+
+// Group returns the subgroup of the group with the prefix appended, and the middleware added after the group's
+func (g RouteGroup) Group(prefix string, middleware ...Middleware) RouteGroup {
+	return RouteGroup{
+		Prefix:     joinPaths(g.Prefix, prefix),
+		Middleware: append(append([]Middleware{}, g.Middleware...), middleware...),
+		Roles:      g.Roles,
+		Envelope:   g.Envelope,
+		Deprecated: g.Deprecated,
+	}
+}
+
+// Endpoints returns the endpoints with the group's prefix, middleware and roles
+func (g RouteGroup) Endpoints(endpoints []Endpoint) []Endpoint {
+	grouped := make([]Endpoint, len(endpoints))
+	for idx, endpoint := range endpoints {
+		endpoint.Path = joinPaths(g.Prefix, endpoint.Path)
+		endpoint.Middleware = append(append([]Middleware{}, g.Middleware...), endpoint.Middleware...)
+		if len(endpoint.Roles) == 0 {
+			endpoint.Roles = g.Roles
+		}
+		endpoint.Envelope = endpoint.Envelope || g.Envelope
+		endpoint.Deprecated = endpoint.Deprecated || g.Deprecated
+		grouped[idx] = endpoint
+	}
+	return grouped
+}
+
+// joinPaths appends path to prefix; an empty path, or "/", is the prefix itself
+func joinPaths(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if path == "" || path == "/" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	return prefix + path
+}
+
+//endregion
+
+//region validation
+
+// ValidateEndpoints checks that every endpoint can be routed, and that no two endpoints have the same method and path
+func ValidateEndpoints(endpoints []Endpoint) error {
+	errs := make([]error, 0)
+	routes := make(map[string]bool)
+
+	for _, endpoint := range endpoints {
+		route := endpoint.Method + " " + endpoint.Path
+		if !isSupportedMethod(endpoint.Method) {
+			errs = append(errs, fmt.Errorf("%s: unsupported method %q, supported are %s", route, endpoint.Method, strings.Join(supportedMethods, ", ")))
+		}
+		if !strings.HasPrefix(endpoint.Path, "/") {
+			errs = append(errs, fmt.Errorf("%s: the path must begin with /", route))
+		}
+		if endpoint.Handler == nil {
+			errs = append(errs, fmt.Errorf("%s: no handler", route))
+		}
+		for _, role := range endpoint.Roles {
+			if !role.Verify() {
+				errs = append(errs, fmt.Errorf("%s: invalid role %q", route, role))
+			}
+		}
+		for _, middleware := range endpoint.Middleware {
+			if middleware == nil {
+				errs = append(errs, fmt.Errorf("%s: nil middleware", route))
+			}
+		}
+		if routes[route] {
+			errs = append(errs, fmt.Errorf("%s: declared twice", route))
+		}
+		routes[route] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// addRoute adds the route of the endpoint to the router; gin panics on the routes that conflict with the ones
+// already added (e.g. /task/:id and /task/:taskId), which is returned as an error
+func addRoute(router *gin.Engine, endpoint Endpoint, handler gin.HandlerFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s %s: %v", endpoint.Method, endpoint.Path, r)
+		}
+	}()
+	router.Handle(endpoint.Method, endpoint.Path, handler)
+	return nil
+}
+
+//endregion
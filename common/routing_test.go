@@ -0,0 +1,163 @@
+package common
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJoinPaths(t *testing.T) {
+	tests := []struct {
+		prefix string
+		path   string
+		joined string
+	}{
+		{"", "", "/"},
+		{"", "/", "/"},
+		{"/", "/", "/"},
+		{"", "/tasks", "/tasks"},
+		{"/v1", "", "/v1"},
+		{"/v1", "/", "/v1"},
+		{"/v1/", "/tasks", "/v1/tasks"},
+		{"/v1", "/tasks/:id", "/v1/tasks/:id"},
+	}
+	for _, test := range tests {
+		if joined := joinPaths(test.prefix, test.path); joined != test.joined {
+			t.Errorf("%q joined to %q is %q, expected %q", test.path, test.prefix, joined, test.joined)
+		}
+	}
+}
+
+// tracing returns a middleware that appends name to the trace, and then calls the next handler
+func tracing(trace *[]string, name string) Middleware {
+	return func(next EndpointHandler) EndpointHandler {
+		return func(c *gin.Context) (ResponseType, int, any) {
+			*trace = append(*trace, name)
+			return next(c)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	trace := make([]string, 0)
+	handler := func(c *gin.Context) (ResponseType, int, any) {
+		trace = append(trace, "handler")
+		return NoResponse, http.StatusOK, nil
+	}
+	refuse := func(next EndpointHandler) EndpointHandler {
+		return func(c *gin.Context) (ResponseType, int, any) {
+			return ErrorResponse, http.StatusForbidden, nil
+		}
+	}
+
+	chain(handler, []Middleware{tracing(&trace, "outer"), tracing(&trace, "inner")})(nil)
+	if expected := []string{"outer", "inner", "handler"}; !slices.Equal(trace, expected) {
+		t.Errorf("trace %v, expected %v", trace, expected)
+	}
+
+	// a middleware may answer the request itself
+	trace = trace[:0]
+	if _, code, _ := chain(handler, []Middleware{tracing(&trace, "outer"), refuse})(nil); code != http.StatusForbidden {
+		t.Errorf("status %d, expected %d", code, http.StatusForbidden)
+	}
+	if expected := []string{"outer"}; !slices.Equal(trace, expected) {
+		t.Errorf("trace %v, expected %v", trace, expected)
+	}
+}
+
+func TestRouteGroup(t *testing.T) {
+	trace := make([]string, 0)
+	handler := func(c *gin.Context) (ResponseType, int, any) {
+		return NoResponse, http.StatusOK, nil
+	}
+
+	v1 := RouteGroup{Prefix: "/v1", Middleware: []Middleware{tracing(&trace, "v1")}, Roles: []Role{RoleOperator}}
+	tasks := v1.Group("/tasks", tracing(&trace, "tasks"))
+	tasks.Envelope = true
+	endpoints := tasks.Endpoints([]Endpoint{
+		{Method: "GET", Path: "/", Handler: handler},
+		{Method: "GET", Path: "/:id", Handler: handler, Roles: []Role{RoleCustomer}, Middleware: []Middleware{tracing(&trace, "task")}},
+	})
+
+	if endpoints[0].Path != "/v1/tasks" || endpoints[1].Path != "/v1/tasks/:id" {
+		t.Errorf("paths %s and %s", endpoints[0].Path, endpoints[1].Path)
+	}
+	if !slices.Equal(endpoints[0].Roles, []Role{RoleOperator}) || !slices.Equal(endpoints[1].Roles, []Role{RoleCustomer}) {
+		t.Errorf("roles %v and %v, expected the group's and the endpoint's own", endpoints[0].Roles, endpoints[1].Roles)
+	}
+	if !endpoints[0].Envelope || !endpoints[1].Envelope || endpoints[0].Deprecated {
+		t.Error("envelope or deprecation not inherited from the group")
+	}
+
+	chain(endpoints[1].Handler, endpoints[1].Middleware)(nil)
+	if expected := []string{"v1", "tasks", "task"}; !slices.Equal(trace, expected) {
+		t.Errorf("trace %v, expected %v", trace, expected)
+	}
+
+	// the subgroup doesn't change the middleware of its group
+	if len(v1.Middleware) != 1 || len(v1.Endpoints([]Endpoint{{Method: "GET", Path: "/", Handler: handler}})[0].Middleware) != 1 {
+		t.Error("middleware of the subgroup added to the group")
+	}
+}
+
+func TestValidateEndpoints(t *testing.T) {
+	handler := func(c *gin.Context) (ResponseType, int, any) {
+		return NoResponse, http.StatusOK, nil
+	}
+
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		valid    bool
+	}{
+		{"valid", Endpoint{Method: "PATCH", Path: "/tasks/:id", Handler: handler, Roles: []Role{RoleOperator}}, true},
+		{"other method", Endpoint{Method: "POST", Path: "/tasks", Handler: handler}, true},
+		{"unsupported method", Endpoint{Method: "CONNECT", Path: "/tasks/:id", Handler: handler}, false},
+		{"lowercase method", Endpoint{Method: "put", Path: "/tasks/:id", Handler: handler}, false},
+		{"relative path", Endpoint{Method: "PUT", Path: "tasks/:id", Handler: handler}, false},
+		{"no handler", Endpoint{Method: "PUT", Path: "/tasks/:id"}, false},
+		{"invalid role", Endpoint{Method: "PUT", Path: "/tasks/:id", Handler: handler, Roles: []Role{"admin"}}, false},
+		{"nil middleware", Endpoint{Method: "PUT", Path: "/tasks/:id", Handler: handler, Middleware: []Middleware{nil}}, false},
+		{"declared twice", Endpoint{Method: "GET", Path: "/tasks", Handler: handler}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateEndpoints([]Endpoint{{Method: "GET", Path: "/tasks", Handler: handler}, test.endpoint})
+			if test.valid && err != nil {
+				t.Errorf("valid endpoint rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid endpoint accepted")
+			}
+		})
+	}
+
+	t.Run("all violations", func(t *testing.T) {
+		err := ValidateEndpoints([]Endpoint{{Method: "CONNECT", Path: "tasks"}})
+		if err == nil || strings.Count(err.Error(), "\n") != 2 {
+			t.Errorf("got %v, expected the errors of the method, the path and the handler", err)
+		}
+	})
+}
+
+func TestInitHttpServerRoutes(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	handler := func(c *gin.Context) (ResponseType, int, any) {
+		return NoResponse, http.StatusOK, nil
+	}
+
+	// gin refuses wildcards of different names in the same segment of a method, which fails the startup instead of
+	// panicking
+	_, err := InitHttpServer("test", GetDiscardLogger(), NewMetricsRegistry(), []Endpoint{
+		{Method: "GET", Path: "/tasks/:id", Handler: handler},
+		{Method: "GET", Path: "/tasks/:taskId/bundle", Handler: handler},
+	})
+	if err == nil {
+		t.Error("conflicting routes accepted")
+	}
+
+	if _, err = InitHttpServer("test", GetDiscardLogger(), NewMetricsRegistry(), []Endpoint{{Method: "GET", Path: "tasks"}}); err == nil {
+		t.Error("invalid endpoints accepted")
+	}
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 /*
@@ -9,7 +10,11 @@ note: In order to execute a goroutine whole lifecycle is managed by Runnable, it
 
 func goroutine(r *Runnable, ...) {
 	...
-	r.Start()
+	if exiting := r.Start(); exiting {
+		// cancelled before it has been started
+		r.Close()
+		return
+	}
 	...
 
 loop:
@@ -41,25 +46,39 @@ const (
 	RunnableFailed    = "failed"
 )
 
+// activeRunnables counts Runnables in RunnableRunning state, across all hosts in the process
+var activeRunnables atomic.Int64
+
+// ActiveRunnables returns the number of Runnables that are currently running
+func ActiveRunnables() int64 {
+	return activeRunnables.Load()
+}
+
 type Runnable struct {
 	name  string
 	state RunnableState
 	mutex sync.Mutex
 
-	ExitChan chan bool
+	ExitChan   chan bool
+	closedChan chan struct{}
 
+	Clock  Clock
 	Logger *Logger
 }
 
+func (r *Runnable) Name() string {
+	return r.name
+}
+
 func (r *Runnable) GetState() RunnableState {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	return r.state
 }
 
-// NewRunnable creates Runnable, and assigns provided httpLogger to it;
-// if httpLogger is not provided, logged messages are discarded
-func NewRunnable(name string, logger *Logger) *Runnable {
+// NewRunnable creates Runnable, and assigns provided clock and httpLogger to it;
+// if clock is not provided, RealClock is used, and if httpLogger is not provided, logged messages are discarded
+func NewRunnable(name string, clock Clock, logger *Logger) *Runnable {
 	if logger == nil {
 		logger = GetDiscardLogger()
 	} else {
@@ -67,10 +86,12 @@ func NewRunnable(name string, logger *Logger) *Runnable {
 	}
 
 	return &Runnable{
-		name:     name,
-		ExitChan: make(chan bool, 1),
-		state:    RunnableCreated,
-		Logger:   logger,
+		name:       name,
+		ExitChan:   make(chan bool, 1),
+		closedChan: make(chan struct{}),
+		state:      RunnableCreated,
+		Clock:      clockOrDefault(clock),
+		Logger:     logger,
 	}
 }
 
@@ -82,6 +103,7 @@ func (r *Runnable) Start() (exiting bool) {
 	if r.state == RunnableCreated {
 		exiting = false
 		r.state = RunnableRunning
+		activeRunnables.Add(1)
 		r.Logger.Info("starting...")
 	} else {
 		// cancelled
@@ -97,6 +119,7 @@ func (r *Runnable) Stop() {
 
 	if r.state == RunnableRunning {
 		r.state = RunnableStopped
+		activeRunnables.Add(-1)
 		r.ExitChan <- true
 	} else if r.state == RunnableCreated {
 		r.state = RunnableCancelled
@@ -113,6 +136,7 @@ func (r *Runnable) Done() {
 
 	if r.state == RunnableRunning {
 		r.state = RunnableDone
+		activeRunnables.Add(-1)
 		r.ExitChan <- true
 	} else {
 		// already stopped
@@ -131,13 +155,21 @@ func (r *Runnable) Fail(err error) {
 	}
 
 	r.state = RunnableFailed
+	activeRunnables.Add(-1)
 	r.ExitChan <- true
 	r.Logger.Info(r.name+"failed", r.state)
 	r.Logger.Err(err)
 }
 
-// Close closes resources allocated by Runnable (only ExitChan - everything else must be closed manually)
+// Close closes resources allocated by Runnable (only ExitChan - everything else must be closed manually);
+// must be called from Runnable's goroutine right before it exits, even if it has been cancelled
 func (r *Runnable) Close() {
 	close(r.ExitChan)
-	r.Logger.Info(r.name+" is %s at %d", r.state, Now().Unix())
+	close(r.closedChan)
+	r.Logger.Info(r.name+" is %s at %d", r.GetState(), r.Clock.Now().Unix())
+}
+
+// Closed returns a chan that gets closed when Runnable's goroutine exits
+func (r *Runnable) Closed() <-chan struct{} {
+	return r.closedChan
 }
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Schemes lists all the FE schemes a task can use.
+//
+// With every scheme but SchemeDecentralizedDMCFE, the authority generates all the keys and can derive a key for any
+// rates. With SchemeDecentralizedDMCFE, the authority isn't used: every sensor generates the keys of its own clients,
+// and derives key shares only for the rates it approves, so the sensors jointly decide which rates can be decrypted.
+// Single-input schemes (SchemeFHIPE, SchemeLWE) support a single cipher per task. Both DMCFE schemes reveal the total
+// of every batch to the server, while the other schemes reveal only the total of the task.
+var Schemes = []string{SchemeFHIPE, SchemeFHMultiIPE, SchemeDamgardMulti, SchemePaillierMulti, SchemeLWE, SchemeDMCFE,
+	SchemeDecentralizedDMCFE, SchemeDummy}
+
+// DefaultScheme returns the scheme of a task that doesn't specify one
+func DefaultScheme(enableEncryption bool, sensorCnt, batchCnt int) string {
+	switch {
+	case !enableEncryption:
+		return SchemeDummy
+	case sensorCnt*batchCnt == 1:
+		return SchemeFHIPE
+	default:
+		return SchemeFHMultiIPE
+	}
+}
+
+// CheckScheme returns an error if the scheme can't be used by a task with sensorCnt sensors that submit batchCnt
+// batches each
+func CheckScheme(scheme string, enableEncryption bool, sensorCnt, batchCnt int) error {
+	switch scheme {
+	case SchemeDummy:
+		if enableEncryption {
+			return fmt.Errorf("scheme %s doesn't encrypt samples, but encryption is enabled", scheme)
+		}
+		return nil
+
+	case SchemeFHIPE, SchemeLWE:
+		if sensorCnt*batchCnt != 1 {
+			return fmt.Errorf("scheme %s is single-input, so it supports a single sensor that submits a single batch", scheme)
+		}
+
+	case SchemeFHMultiIPE, SchemeDamgardMulti, SchemePaillierMulti, SchemeDMCFE, SchemeDecentralizedDMCFE:
+
+	default:
+		return fmt.Errorf("unknown scheme %q, supported schemes are %s", scheme, strings.Join(Schemes, ", "))
+	}
+
+	if !enableEncryption {
+		return fmt.Errorf("scheme %s encrypts samples, but encryption is disabled", scheme)
+	}
+	return nil
+}
+
+// UsesAuthority reports whether the keys of a task that uses scheme are generated by the authority
+func UsesAuthority(scheme string) bool {
+	return scheme != SchemeDecentralizedDMCFE
+}
+
+// DecryptsBatches reports whether the batches of a task that uses scheme are decrypted with keys of their own, so that
+// the decrypted batches can be billed without a key restricted to them
+func DecryptsBatches(scheme string) bool {
+	return scheme == SchemeDMCFE || scheme == SchemeDecentralizedDMCFE
+}
+
+// SupportsProgress reports whether the running total of a task that uses scheme can be computed, that is whether
+// the authority can derive keys restricted to the first batches
+func SupportsProgress(scheme string) bool {
+	return scheme == SchemeFHMultiIPE || scheme == SchemeDummy
+}
@@ -0,0 +1,281 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Every host signs what it vouches for with its ed25519 key, so that a billing dispute can be settled offline,
+// from a bundle of signed records (see server/bundle.go and cmd/verify): the sensors sign a BatchCommitment to every
+// batch they submit, and the authority signs a RatesAttestation for every decryption key it derives. The records
+// are signed as JSON, without their signature; keys, signatures and hashes are hex encoded.
+
+//region Signer
+
+type Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+// NewSigner loads the key from keyFile, or generates one and writes it there if the file doesn't exist; if keyFile
+// is empty, the key is generated, and lost when the host stops
+func NewSigner(keyFile string) (*Signer, error) {
+	if keyFile == "" {
+		return generateSigner()
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		signer, err := generateSigner()
+		if err != nil {
+			return nil, err
+		}
+		return signer, signer.save(keyFile)
+	} else if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key file %s isn't PEM encoded", keyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key file %s doesn't hold an ed25519 key", keyFile)
+	}
+	return &Signer{privateKey: privateKey}, nil
+}
+
+func generateSigner() (*Signer, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{privateKey: privateKey}, nil
+}
+
+func (s *Signer) save(keyFile string) error {
+	data, err := x509.MarshalPKCS8PrivateKey(s.privateKey)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), 0600)
+}
+
+// PublicKey returns the hex encoded public key
+func (s *Signer) PublicKey() string {
+	return hex.EncodeToString(s.privateKey.Public().(ed25519.PublicKey))
+}
+
+// Sign returns the hex encoded signature of v, as JSON
+func (s *Signer) Sign(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(ed25519.Sign(s.privateKey, data)), nil
+}
+
+// VerifySignature returns an error unless signature is the signature of v, as JSON, by the key publicKey
+func VerifySignature(publicKey string, v any, signature string) error {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key %q", publicKey)
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return fmt.Errorf("signature doesn't match")
+	}
+	return nil
+}
+
+//endregion
+
+// Hash returns the hex encoded SHA-256 of data
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashRates returns the hex encoded SHA-256 of the rates, as a JSON array
+func HashRates(rates []int) string {
+	data, _ := json.Marshal(rates)
+	return Hash(data)
+}
+
+//region BatchCommitment
+
+// CommitmentOpening is what a BatchCommitment commits to; the random nonce keeps the samples from being guessed
+// from the commitment
+type CommitmentOpening struct {
+	TaskId   UUID    `json:"task_id"`
+	SensorId UUID    `json:"sensor_id"`
+	BatchIdx int     `json:"batch_idx"`
+	Samples  []int64 `json:"samples"` // fixed-point encoded
+	Nonce    []byte  `json:"nonce"`
+}
+
+// Commit returns the hex encoded SHA-256 of the opening, as JSON
+func (o *CommitmentOpening) Commit() string {
+	data, _ := json.Marshal(o)
+	return Hash(data)
+}
+
+// BatchCommitment is the sensor's signed record of a batch it has submitted: the commitment to its samples, and
+// the hash of the encoded cipher the server has received
+type BatchCommitment struct {
+	TaskId     UUID   `json:"task_id"`
+	SensorId   UUID   `json:"sensor_id"`
+	BatchIdx   int    `json:"batch_idx"`
+	Commitment string `json:"commitment"` // see CommitmentOpening.Commit
+	CipherHash string `json:"cipher_hash"`
+	SampledAt  int64  `json:"sampled_at"` // in unix ns
+	Signature  string `json:"signature,omitempty"`
+}
+
+func (c *BatchCommitment) Sign(signer *Signer) error {
+	unsigned := *c
+	unsigned.Signature = ""
+	signature, err := signer.Sign(unsigned)
+	c.Signature = signature
+	return err
+}
+
+func (c *BatchCommitment) Verify(publicKey string) error {
+	unsigned := *c
+	unsigned.Signature = ""
+	return VerifySignature(publicKey, unsigned, c.Signature)
+}
+
+// BatchCommitmentHeader carries the BatchCommitment of a submitted cipher, as base64 encoded JSON
+const BatchCommitmentHeader = "X-Batch-Commitment"
+
+// HeaderValue returns the commitment encoded for BatchCommitmentHeader
+func (c *BatchCommitment) HeaderValue() string {
+	data, _ := json.Marshal(c)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// ParseBatchCommitment decodes the value of BatchCommitmentHeader
+func ParseBatchCommitment(headerValue string) (*BatchCommitment, error) {
+	data, err := base64.StdEncoding.DecodeString(headerValue)
+	if err != nil {
+		return nil, fmt.Errorf("invalid batch commitment: %s", err)
+	}
+	commitment := &BatchCommitment{}
+	if err = json.Unmarshal(data, commitment); err != nil {
+		return nil, fmt.Errorf("invalid batch commitment: %s", err)
+	}
+	return commitment, nil
+}
+
+//endregion
+
+//region SampleDisclosure
+
+// SampleDisclosure is the sensor's disclosure of the samples of a task to its customer, see
+// sensor/disclosure.go; only the committed batches are disclosed, and every one of them opens its commitment
+type SampleDisclosure struct {
+	TaskId     UUID             `json:"task_id"`
+	SensorId   UUID             `json:"sensor_id"`
+	CustomerId UUID             `json:"customer_id"`
+	Batches    []DisclosedBatch `json:"batches"`
+}
+
+type DisclosedBatch struct {
+	BatchIdx   int              `json:"batch_idx"`
+	Samples    []int64          `json:"samples"` // fixed-point encoded
+	Nonce      []byte           `json:"nonce"`
+	SampledAt  int64            `json:"sampled_at"` // in unix ns
+	Commitment *BatchCommitment `json:"commitment"`
+}
+
+// Opening returns the opening of the commitment of the disclosed batch
+func (d *SampleDisclosure) Opening(batch *DisclosedBatch) CommitmentOpening {
+	return CommitmentOpening{
+		TaskId:   d.TaskId,
+		SensorId: d.SensorId,
+		BatchIdx: batch.BatchIdx,
+		Samples:  batch.Samples,
+		Nonce:    batch.Nonce,
+	}
+}
+
+// Verify returns an error unless every batch is opened by its commitment, which is signed by publicKey
+func (d *SampleDisclosure) Verify(publicKey string) error {
+	for idx := range d.Batches {
+		batch := &d.Batches[idx]
+		commitment := batch.Commitment
+		if commitment == nil {
+			return fmt.Errorf("batch no %d has no commitment", batch.BatchIdx)
+		}
+		if err := commitment.Verify(publicKey); err != nil {
+			return fmt.Errorf("the commitment of batch no %d: %s", batch.BatchIdx, err)
+		}
+		if commitment.TaskId != d.TaskId || commitment.SensorId != d.SensorId || commitment.BatchIdx != batch.BatchIdx {
+			return fmt.Errorf("the commitment of batch no %d is for another batch", batch.BatchIdx)
+		}
+		if commitment.SampledAt != batch.SampledAt {
+			return fmt.Errorf("batch no %d is committed as sampled at %d", batch.BatchIdx, commitment.SampledAt)
+		}
+		opening := d.Opening(batch)
+		if opening.Commit() != commitment.Commitment {
+			return fmt.Errorf("the samples of batch no %d don't open its commitment", batch.BatchIdx)
+		}
+	}
+	return nil
+}
+
+//endregion
+
+//region RatesAttestation
+
+// RatesAttestation is the authority's signed record of a decryption key it has derived: the rates it has been
+// derived for, the ciphers it is restricted to, and the hash of the encoded decryption params the authority serves
+type RatesAttestation struct {
+	TaskId             UUID   `json:"task_id"`
+	DecryptionParamsId UUID   `json:"decryption_params_id"`
+	Scheme             string `json:"scheme"`
+	RatesHash          string `json:"rates_hash"` // see HashRates
+	MissingCiphers     []int  `json:"missing_ciphers,omitempty"`
+	KeyHash            string `json:"key_hash"`
+	Signature          string `json:"signature,omitempty"`
+}
+
+func (a *RatesAttestation) Sign(signer *Signer) error {
+	unsigned := *a
+	unsigned.Signature = ""
+	signature, err := signer.Sign(unsigned)
+	a.Signature = signature
+	return err
+}
+
+func (a *RatesAttestation) Verify(publicKey string) error {
+	unsigned := *a
+	unsigned.Signature = ""
+	return VerifySignature(publicKey, unsigned, a.Signature)
+}
+
+//endregion
@@ -0,0 +1,204 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+
+	signer, err := NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestNewSigner(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys", "signing-key.pem")
+	signer, err := NewSigner(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(keyFile); err != nil {
+		t.Errorf("generated key not saved: %s", err)
+	}
+
+	// the saved key is loaded again
+	loaded, err := NewSigner(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.PublicKey() != signer.PublicKey() {
+		t.Errorf("loaded key %s, expected %s", loaded.PublicKey(), signer.PublicKey())
+	}
+
+	if ephemeral := newTestSigner(t); ephemeral.PublicKey() == signer.PublicKey() {
+		t.Error("ephemeral key is the saved one")
+	}
+	if _, err = NewSigner(writeFile(t, "signing-key.pem", []byte("key"))); err == nil {
+		t.Error("key file that isn't PEM encoded accepted")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	signer := newTestSigner(t)
+	value := map[string]int{"result": 42}
+	signature, err := signer.Sign(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		publicKey string
+		value     any
+		signature string
+		valid     bool
+	}{
+		{"valid", signer.PublicKey(), value, signature, true},
+		{"altered value", signer.PublicKey(), map[string]int{"result": 43}, signature, false},
+		{"other key", newTestSigner(t).PublicKey(), value, signature, false},
+		{"invalid key", "key", value, signature, false},
+		{"no key", "", value, signature, false},
+		{"invalid signature", signer.PublicKey(), value, "signature", false},
+		{"no signature", signer.PublicKey(), value, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifySignature(test.publicKey, test.value, test.signature)
+			if test.valid && err != nil {
+				t.Errorf("valid signature rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid signature accepted")
+			}
+		})
+	}
+}
+
+func TestBatchCommitment(t *testing.T) {
+	signer := newTestSigner(t)
+	opening := CommitmentOpening{TaskId: "task-0", SensorId: "sensor-0", BatchIdx: 1, Samples: []int64{1, -2}, Nonce: []byte{7}}
+	commitment := &BatchCommitment{TaskId: "task-0", SensorId: "sensor-0", BatchIdx: 1, Commitment: opening.Commit(),
+		CipherHash: Hash([]byte("cipher")), SampledAt: 1000}
+	if err := commitment.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := commitment.Verify(signer.PublicKey()); err != nil {
+		t.Errorf("valid commitment rejected: %s", err)
+	}
+
+	t.Run("altered", func(t *testing.T) {
+		altered := *commitment
+		altered.BatchIdx = 2
+		if err := altered.Verify(signer.PublicKey()); err == nil {
+			t.Error("altered commitment accepted")
+		}
+	})
+
+	t.Run("opening", func(t *testing.T) {
+		other := opening
+		other.Nonce = []byte{8}
+		if other.Commit() == commitment.Commitment {
+			t.Error("commitment doesn't depend on the nonce")
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		parsed, err := ParseBatchCommitment(commitment.HeaderValue())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *parsed != *commitment {
+			t.Errorf("parsed %+v, expected %+v", parsed, commitment)
+		}
+		for _, headerValue := range []string{"not base64!", "bm90IGpzb24="} {
+			if _, err = ParseBatchCommitment(headerValue); err == nil {
+				t.Errorf("invalid header value %q accepted", headerValue)
+			}
+		}
+	})
+}
+
+// newTestDisclosure returns the disclosure of 2 batches of a sensor, with their commitments signed by signer
+func newTestDisclosure(t *testing.T, signer *Signer) *SampleDisclosure {
+	t.Helper()
+
+	disclosure := &SampleDisclosure{TaskId: "task-0", SensorId: "sensor-0", CustomerId: "customer-0"}
+	for batchIdx := 0; batchIdx < 2; batchIdx++ {
+		batch := DisclosedBatch{BatchIdx: batchIdx, Samples: []int64{int64(batchIdx), 5}, Nonce: []byte{byte(batchIdx)},
+			SampledAt: int64(1000 + batchIdx)}
+		opening := disclosure.Opening(&batch)
+		batch.Commitment = &BatchCommitment{TaskId: "task-0", SensorId: "sensor-0", BatchIdx: batchIdx,
+			Commitment: opening.Commit(), SampledAt: batch.SampledAt}
+		if err := batch.Commitment.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+		disclosure.Batches = append(disclosure.Batches, batch)
+	}
+	return disclosure
+}
+
+func TestSampleDisclosure(t *testing.T) {
+	signer := newTestSigner(t)
+
+	tests := []struct {
+		name   string
+		modify func(disclosure *SampleDisclosure)
+		valid  bool
+	}{
+		{"valid", func(disclosure *SampleDisclosure) {}, true},
+		{"no batches", func(disclosure *SampleDisclosure) { disclosure.Batches = nil }, true},
+		{"altered samples", func(disclosure *SampleDisclosure) { disclosure.Batches[1].Samples[0]++ }, false},
+		{"altered nonce", func(disclosure *SampleDisclosure) { disclosure.Batches[0].Nonce = []byte{9} }, false},
+		{"altered sampling time", func(disclosure *SampleDisclosure) { disclosure.Batches[0].SampledAt++ }, false},
+		{"no commitment", func(disclosure *SampleDisclosure) { disclosure.Batches[0].Commitment = nil }, false},
+		{"commitment of another batch", func(disclosure *SampleDisclosure) {
+			disclosure.Batches[0].Commitment = disclosure.Batches[1].Commitment
+		}, false},
+		{"another sensor", func(disclosure *SampleDisclosure) { disclosure.SensorId = "sensor-1" }, false},
+		{"commitment by another key", func(disclosure *SampleDisclosure) {
+			if err := disclosure.Batches[0].Commitment.Sign(newTestSigner(t)); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			disclosure := newTestDisclosure(t, signer)
+			test.modify(disclosure)
+			err := disclosure.Verify(signer.PublicKey())
+			if test.valid && err != nil {
+				t.Errorf("valid disclosure rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid disclosure accepted")
+			}
+		})
+	}
+}
+
+func TestRatesAttestation(t *testing.T) {
+	signer := newTestSigner(t)
+	attestation := &RatesAttestation{TaskId: "task-0", DecryptionParamsId: "params-0", Scheme: SchemeFHMultiIPE,
+		RatesHash: HashRates([]int{1, 2}), MissingCiphers: []int{3}, KeyHash: Hash([]byte("key"))}
+	if err := attestation.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	if err := attestation.Verify(signer.PublicKey()); err != nil {
+		t.Errorf("valid attestation rejected: %s", err)
+	}
+
+	altered := *attestation
+	altered.MissingCiphers = nil
+	if err := altered.Verify(signer.PublicKey()); err == nil {
+		t.Error("attestation of an unrestricted key accepted")
+	}
+	if err := attestation.Verify(newTestSigner(t).PublicKey()); err == nil {
+		t.Error("attestation by another key accepted")
+	}
+	if HashRates([]int{1, 2}) == HashRates([]int{2, 1}) {
+		t.Error("rates hash doesn't depend on the order of the rates")
+	}
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SimulatedClock is a Clock whose time only moves when it is advanced; timers and tickers fire when the clock is
+// advanced past their deadline. It's meant for deterministic simulations and replays, e.g. of whole billing periods.
+type SimulatedClock struct {
+	now     time.Time
+	waiters []*waiter
+	changed chan struct{} // closed, and replaced, when a timer is set, fired or stopped
+	mutex   sync.Mutex
+}
+
+// waiter is a pending timer, or a ticker if period is set
+type waiter struct {
+	deadline time.Time
+	period   time.Duration
+	ch       chan time.Time
+}
+
+func NewSimulatedClock(now time.Time) *SimulatedClock {
+	return &SimulatedClock{
+		now:     now,
+		waiters: make([]*waiter, 0),
+		changed: make(chan struct{}),
+	}
+}
+
+func (c *SimulatedClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the clock is advanced by d
+func (c *SimulatedClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+func (c *SimulatedClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, &waiter{deadline: c.now.Add(d), ch: ch})
+	c.notify()
+	return ch
+}
+
+func (c *SimulatedClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for SimulatedClock.NewTicker")
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	w := &waiter{deadline: c.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	c.notify()
+	return &simulatedTicker{clock: c, waiter: w}
+}
+
+// Advance moves the clock forward by d, and fires all the timers whose deadline has passed
+func (c *SimulatedClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.advanceTo(c.now.Add(d))
+}
+
+// AdvanceToNext moves the clock to the earliest deadline of the pending timers, and fires them;
+// returns false if there are no pending timers
+func (c *SimulatedClock) AdvanceToNext() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.waiters) == 0 {
+		return false
+	}
+
+	next := c.waiters[0].deadline
+	for _, w := range c.waiters {
+		if w.deadline.Before(next) {
+			next = w.deadline
+		}
+	}
+	c.advanceTo(next)
+	return true
+}
+
+// PendingTimers returns the number of timers that haven't fired yet, and of the running tickers
+func (c *SimulatedClock) PendingTimers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
+
+// WatchTimers returns the number of pending timers, like PendingTimers, and a channel that is closed when a timer
+// is set, fired or stopped; it lets a simulation wait until the goroutines driven by the clock have set their next
+// timers, before the clock is advanced again
+func (c *SimulatedClock) WatchTimers() (pending int, changed <-chan struct{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters), c.changed
+}
+
+// notify wakes up the watchers of the timers; the mutex must be held
+func (c *SimulatedClock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// advanceTo must be called with the mutex held; timers are fired in the order of their deadlines
+func (c *SimulatedClock) advanceTo(now time.Time) {
+	if now.After(c.now) {
+		c.now = now
+	}
+
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+
+	pending := make([]*waiter, 0, len(c.waiters))
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+
+		if w.period == 0 {
+			w.ch <- c.now
+			continue
+		}
+
+		// ticker: the tick is dropped if the previous one hasn't been received yet, and the ticks that were skipped
+		// by advancing the clock are not sent
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+		for !w.deadline.After(c.now) {
+			w.deadline = w.deadline.Add(w.period)
+		}
+		pending = append(pending, w)
+	}
+	c.waiters = pending
+	c.notify()
+}
+
+func (c *SimulatedClock) removeWaiter(w *waiter) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for idx, pending := range c.waiters {
+		if pending == w {
+			c.waiters = append(c.waiters[:idx], c.waiters[idx+1:]...)
+			c.notify()
+			return
+		}
+	}
+}
+
+type simulatedTicker struct {
+	clock  *SimulatedClock
+	waiter *waiter
+}
+
+func (t *simulatedTicker) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *simulatedTicker) Stop() {
+	t.clock.removeWaiter(t.waiter)
+}
@@ -1,13 +1,19 @@
 package common
 
 // TaskDaemon accepts Tasks from taskChan and starts a taskWorker for that task
+// when taskChan gets closed, tasks remaining in it are started, and then the TaskDaemon is done
 func TaskDaemon[TaskT any](r *Runnable, taskChan *chan *TaskT, startTaskWorkerFn func(task *TaskT)) {
-	r.Start()
+	if exiting := r.Start(); exiting {
+		r.Close()
+		return
+	}
 
+	tasks := *taskChan
 	for {
 		select {
-		case task, notEnd := <-*taskChan:
+		case task, notEnd := <-tasks:
 			if !notEnd {
+				tasks = nil
 				r.Done()
 			} else {
 				startTaskWorkerFn(task)
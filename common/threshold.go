@@ -0,0 +1,218 @@
+package common
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"math/big"
+)
+
+// In the threshold mode, the authority splits the master secret of a task among n share holders (authority instances),
+// so that any k of them can derive the decryption key, and fewer than k learn nothing about it. The secret is split
+// with Shamir's scheme over Z_Q, where Q is the order of the scheme's group; this works for the schemes whose key
+// derivation is linear over Z_Q in the master secret, as a partial key derived from a share is then a share of the key.
+
+// SupportsThreshold reports whether the master secret of a task that uses scheme can be split among share holders
+func SupportsThreshold(scheme string) bool {
+	return scheme == SchemeDamgardMulti
+}
+
+//region Shamir
+
+// ShamirSplit splits secret into n shares, any k of which recover it; share no i is the value of a random polynomial
+// of degree k-1, with the secret as the constant term, at x = i+1. q must be a prime.
+func ShamirSplit(secret *big.Int, k, n int, q *big.Int) ([]*big.Int, error) {
+	if k < 1 || k > n {
+		return nil, fmt.Errorf("threshold must be in [1, %d], got %d", n, k)
+	}
+
+	coefficients := make([]*big.Int, k)
+	coefficients[0] = new(big.Int).Mod(secret, q)
+	for idx := 1; idx < k; idx++ {
+		coefficient, err := rand.Int(rand.Reader, q)
+		if err != nil {
+			return nil, err
+		}
+		coefficients[idx] = coefficient
+	}
+
+	shares := make([]*big.Int, n)
+	for idx := range shares {
+		// Horner's method
+		x := big.NewInt(int64(idx + 1))
+		share := big.NewInt(0)
+		for c := k - 1; c >= 0; c-- {
+			share.Mul(share, x)
+			share.Add(share, coefficients[c])
+			share.Mod(share, q)
+		}
+		shares[idx] = share
+	}
+	return shares, nil
+}
+
+// LagrangeCoefficients returns the coefficients that interpolate the value of a polynomial at 0 from its values
+// at xs, mod prime q
+func LagrangeCoefficients(xs []int, q *big.Int) ([]*big.Int, error) {
+	coefficients := make([]*big.Int, len(xs))
+	for i, xi := range xs {
+		num, den := big.NewInt(1), big.NewInt(1)
+		for j, xj := range xs {
+			if i == j {
+				continue
+			}
+			if xi == xj {
+				return nil, fmt.Errorf("duplicate share no %d", xi)
+			}
+			num.Mul(num, big.NewInt(int64(-xj)))
+			num.Mod(num, q)
+			den.Mul(den, big.NewInt(int64(xi-xj)))
+			den.Mod(den, q)
+		}
+
+		denInv := new(big.Int).ModInverse(den, q)
+		if denInv == nil {
+			return nil, fmt.Errorf("modulus is not a prime")
+		}
+		coefficients[i] = num.Mul(num, denInv).Mod(num, q)
+	}
+	return coefficients, nil
+}
+
+//endregion
+
+//region shares
+
+// ThresholdShare is a share holder's share of the master secret of a SchemeDamgardMulti task, with the public params
+// needed to derive partial keys
+type ThresholdShare struct {
+	Idx              int // x coordinate of the share, from 1 on
+	Threshold        int
+	SensorCnt        int
+	BatchesPerSensor int
+	BatchSize        int
+	MinRateValue     int // fixed-point encoded, as in AuthorityTaskRequest
+	MaxRateValue     int
+	Bound            *big.Int
+	SchemaParams     *DamgardSchemaParams
+	Msk              []*fullysec.DamgardSecKey
+	Otp              data.Matrix
+}
+
+// SplitDamgardMultiSecKeys splits the secret parts of secKeys (the master secret keys and the one-time pads of all
+// the clients) into n shares, any k of which recover them; the public keys aren't shared
+func SplitDamgardMultiSecKeys(secKeys *fullysec.DamgardMultiSecKeys, k, n int, q *big.Int) ([]*ThresholdShare, error) {
+	shares := make([]*ThresholdShare, n)
+	for idx := range shares {
+		shares[idx] = &ThresholdShare{
+			Idx:       idx + 1,
+			Threshold: k,
+			Msk:       make([]*fullysec.DamgardSecKey, len(secKeys.Msk)),
+			Otp:       make(data.Matrix, len(secKeys.Otp)),
+		}
+	}
+
+	split := func(vector data.Vector, set func(share *ThresholdShare, vector data.Vector)) error {
+		vectors := make([]data.Vector, n)
+		for idx := range vectors {
+			vectors[idx] = make(data.Vector, len(vector))
+		}
+		for coordinate, secret := range vector {
+			secretShares, err := ShamirSplit(secret, k, n, q)
+			if err != nil {
+				return err
+			}
+			for idx, secretShare := range secretShares {
+				vectors[idx][coordinate] = secretShare
+			}
+		}
+		for idx, share := range shares {
+			set(share, vectors[idx])
+		}
+		return nil
+	}
+
+	for client, msk := range secKeys.Msk {
+		for idx := range shares {
+			shares[idx].Msk[client] = &fullysec.DamgardSecKey{}
+		}
+		if err := split(msk.S, func(share *ThresholdShare, v data.Vector) { share.Msk[client].S = v }); err != nil {
+			return nil, err
+		}
+		if err := split(msk.T, func(share *ThresholdShare, v data.Vector) { share.Msk[client].T = v }); err != nil {
+			return nil, err
+		}
+		if err := split(secKeys.Otp[client], func(share *ThresholdShare, v data.Vector) { share.Otp[client] = v }); err != nil {
+			return nil, err
+		}
+	}
+	return shares, nil
+}
+
+// ShareHolderStatus is reported by a share holder
+type ShareHolderStatus struct {
+	Shares  int    `json:"shares"`
+	TaskIds []UUID `json:"task_ids"`
+}
+
+// ThresholdPartialKey is derived by a share holder from its ThresholdShare; its decryption key is a share of the
+// decryption key
+type ThresholdPartialKey struct {
+	Idx              int
+	DecryptionParams *DamgardMultiDecryptionParams
+}
+
+// CombinePartialKeys interpolates the decryption key from the partial keys, derived for the same rates by different
+// share holders; there must be at least as many partial keys as the threshold, but that can't be checked here
+func CombinePartialKeys(partialKeys []*ThresholdPartialKey) (*DamgardMultiDecryptionParams, error) {
+	if len(partialKeys) == 0 {
+		return nil, fmt.Errorf("no partial keys")
+	}
+
+	first := partialKeys[0].DecryptionParams
+	q := first.SchemaParams.Q
+	xs := make([]int, len(partialKeys))
+	for idx, partialKey := range partialKeys {
+		xs[idx] = partialKey.Idx
+	}
+	coefficients, err := LagrangeCoefficients(xs, q)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &fullysec.DamgardMultiDerivedKey{
+		Keys: make([]*fullysec.DamgardDerivedKey, first.NumClients),
+		Z:    big.NewInt(0),
+	}
+	for client := range key.Keys {
+		key.Keys[client] = &fullysec.DamgardDerivedKey{Key1: big.NewInt(0), Key2: big.NewInt(0)}
+	}
+
+	addScaled := func(sum, value, coefficient *big.Int) {
+		sum.Add(sum, new(big.Int).Mul(value, coefficient))
+		sum.Mod(sum, q)
+	}
+	for idx, partialKey := range partialKeys {
+		partial := partialKey.DecryptionParams.DecryptionKey
+		if len(partial.Keys) != first.NumClients {
+			return nil, fmt.Errorf("partial key no %d has %d client keys, expected %d", partialKey.Idx, len(partial.Keys), first.NumClients)
+		}
+
+		addScaled(key.Z, partial.Z, coefficients[idx])
+		for client, clientKey := range partial.Keys {
+			addScaled(key.Keys[client].Key1, clientKey.Key1, coefficients[idx])
+			addScaled(key.Keys[client].Key2, clientKey.Key2, coefficients[idx])
+		}
+	}
+
+	return &DamgardMultiDecryptionParams{
+		NumClients:    first.NumClients,
+		Bound:         first.Bound,
+		SchemaParams:  first.SchemaParams,
+		DecryptionKey: key,
+		Rates:         first.Rates,
+	}, nil
+}
+
+//endregion
@@ -0,0 +1,143 @@
+package common
+
+import (
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"math/big"
+	"testing"
+)
+
+// interpolate recovers the secret from the shares with the given x coordinates (from 1 on), mod q
+func interpolate(t *testing.T, shares []*big.Int, xs []int, q *big.Int) *big.Int {
+	t.Helper()
+
+	coefficients, err := LagrangeCoefficients(xs, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := big.NewInt(0)
+	for idx, x := range xs {
+		secret.Add(secret, new(big.Int).Mul(shares[x-1], coefficients[idx]))
+	}
+	return secret.Mod(secret, q)
+}
+
+func TestShamirSplit(t *testing.T) {
+	// 2^127 - 1 is a prime
+	q := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1))
+	secret := new(big.Int).Sub(q, big.NewInt(12345))
+
+	shares, err := ShamirSplit(secret, 3, 5, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("%d shares, expected 5", len(shares))
+	}
+
+	for _, xs := range [][]int{{1, 2, 3}, {5, 3, 1}, {2, 4, 5}, {1, 2, 3, 4, 5}} {
+		if recovered := interpolate(t, shares, xs, q); recovered.Cmp(secret) != 0 {
+			t.Errorf("shares %v recover %s, expected %s", xs, recovered, secret)
+		}
+	}
+	// fewer shares than the threshold interpolate another polynomial
+	if recovered := interpolate(t, shares, []int{1, 2}, q); recovered.Cmp(secret) == 0 {
+		t.Error("2 shares recover the secret of threshold 3")
+	}
+}
+
+func TestShamirSplitNegativeSecret(t *testing.T) {
+	q := big.NewInt(7919)
+	shares, err := ShamirSplit(big.NewInt(-5), 2, 3, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered := interpolate(t, shares, []int{1, 3}, q); recovered.Int64() != 7914 {
+		t.Errorf("recovered %s, expected -5 mod q", recovered)
+	}
+}
+
+func TestShamirSplitInvalidThreshold(t *testing.T) {
+	q := big.NewInt(7919)
+	for _, k := range []int{0, 4} {
+		if _, err := ShamirSplit(big.NewInt(1), k, 3, q); err == nil {
+			t.Errorf("threshold %d of 3 shares accepted", k)
+		}
+	}
+}
+
+func TestLagrangeCoefficients(t *testing.T) {
+	q := big.NewInt(7919)
+	if _, err := LagrangeCoefficients([]int{1, 2, 1}, q); err == nil {
+		t.Error("duplicate share accepted")
+	}
+	if _, err := LagrangeCoefficients([]int{1, 3}, big.NewInt(8)); err == nil {
+		t.Error("modulus that isn't a prime accepted")
+	}
+}
+
+// TestCombinePartialKeys checks that the key combined from the partial keys of any threshold of share holders is the
+// key derived from the master secret
+func TestCombinePartialKeys(t *testing.T) {
+	numClients, vecLen := 4, 2
+	schema, err := fullysec.NewDamgardMultiPrecomp(numClients, vecLen, 1024, big.NewInt(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secKeys, err := schema.GenerateMasterKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := NewMatrix(numClients, []int{1, -2, 3, 4, 5, 6, -7, 8}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := schema.DeriveKey(secKeys, y)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shares, err := SplitDamgardMultiSecKeys(secKeys, 2, 3, schema.Params.Q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partialKey := func(share *ThresholdShare) *ThresholdPartialKey {
+		fk, err := schema.DeriveKey(&fullysec.DamgardMultiSecKeys{Msk: share.Msk, Otp: share.Otp}, y)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ThresholdPartialKey{
+			Idx: share.Idx,
+			DecryptionParams: &DamgardMultiDecryptionParams{
+				NumClients:    numClients,
+				Bound:         schema.Bound,
+				SchemaParams:  *schema.Params,
+				DecryptionKey: fk,
+				Rates:         y,
+			},
+		}
+	}
+
+	for _, idxs := range [][]int{{0, 1}, {2, 0}, {0, 1, 2}} {
+		partialKeys := make([]*ThresholdPartialKey, len(idxs))
+		for i, idx := range idxs {
+			partialKeys[i] = partialKey(shares[idx])
+		}
+		combined, err := CombinePartialKeys(partialKeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the key is defined mod Q
+		key := combined.DecryptionKey
+		if new(big.Int).Mod(expected.Z, schema.Params.Q).Cmp(key.Z) != 0 {
+			t.Errorf("shares %v: combined key differs from the derived one", idxs)
+			continue
+		}
+		for client := range key.Keys {
+			if new(big.Int).Mod(expected.Keys[client].Key1, schema.Params.Q).Cmp(key.Keys[client].Key1) != 0 ||
+				new(big.Int).Mod(expected.Keys[client].Key2, schema.Params.Q).Cmp(key.Keys[client].Key2) != 0 {
+				t.Errorf("shares %v: key of client no %d differs from the derived one", idxs, client)
+			}
+		}
+	}
+}
@@ -8,21 +8,17 @@ import (
 	"time"
 )
 
+// GetIPv4 returns the IPv4 address of the interface used for outbound traffic; if the machine is not online,
+// the loopback address is returned.
 func GetIPv4() net.IP {
-	//conn, err := net.Dial("udp", "8.8.8.8:80")
-	//if err != nil {
-	//	log.Fatal(err)
-	//}
-	//defer conn.Close()
-
-	//localAddr := conn.LocalAddr().(*net.UDPAddr)
-
-	//return localAddr.IP
-	return net.IPv4(127, 0, 0, 1)
-}
+	// no packets are sent, dialing udp only picks the outbound interface
+	conn, err := net.Dial("udp", "8.8.8.8:80")
+	if err != nil {
+		return net.IPv4(127, 0, 0, 1)
+	}
+	defer conn.Close()
 
-func Now() time.Time {
-	return time.Now().Truncate(time.Second)
+	return conn.LocalAddr().(*net.UDPAddr).IP
 }
 
 func GetIntPtrFromDuration(d *time.Duration) *int64 {
@@ -0,0 +1,83 @@
+package common
+
+import (
+	"math/big"
+)
+
+// The result of a task is decrypted by solving discrete logarithms with the baby-step giant-step method, whose cost
+// grows with the square root of the searched bound, so a task is feasible only if the bounds of its samples and
+// rates, its batch size, its duration and its sensor count are small enough. The bounds are computed exactly, with
+// big.Int, as their products easily overflow int64.
+
+// ResultBound returns the bound of the absolute value of the result of a task, from the bounds of the absolute
+// values of its samples and rates
+func ResultBound(sensorCnt, batchCnt, batchSize, sampleBound, rateBound int) *big.Int {
+	bound := big.NewInt(int64(sensorCnt))
+	bound.Mul(bound, big.NewInt(int64(batchCnt)))
+	bound.Mul(bound, big.NewInt(int64(batchSize)))
+	bound.Mul(bound, big.NewInt(int64(sampleBound)))
+	return bound.Mul(bound, big.NewInt(int64(rateBound)))
+}
+
+// DecryptionCost describes the discrete logarithms that the server solves to decrypt the result of a task
+type DecryptionCost struct {
+	// Searches is the number of discrete logarithms; 0 if the scheme decrypts without them
+	Searches int `json:"searches"`
+
+	// SearchBound is the bound the scheme searches every discrete logarithm within; it can be greater than
+	// the result bound, as some schemes bound samples and rates with the same value
+	SearchBound *big.Int `json:"search_bound,omitempty"`
+
+	// Steps is the number of group operations of a single search (baby steps and giant steps), in the worst case;
+	// negative results are searched for in parallel, so they don't add to it
+	Steps *big.Int `json:"steps,omitempty"`
+}
+
+// EstimateDecryptionCost returns the DecryptionCost of a task that uses scheme; the search bounds are the ones
+// gofe uses in the scheme's decryption
+func EstimateDecryptionCost(scheme string, sensorCnt, batchCnt, batchSize, sampleBound, rateBound int) DecryptionCost {
+	boundXY := new(big.Int).Mul(big.NewInt(int64(sampleBound)), big.NewInt(int64(rateBound)))
+
+	var searches int
+	var searchBound *big.Int
+	switch scheme {
+	case SchemeFHIPE:
+		searches = 1
+		searchBound = new(big.Int).Mul(big.NewInt(int64(batchSize)), boundXY)
+	case SchemeFHMultiIPE:
+		searches = 1
+		searchBound = ResultBound(sensorCnt, batchCnt, batchSize, sampleBound, rateBound)
+	case SchemeDamgardMulti:
+		// samples and rates share a bound
+		bound := sampleBound
+		if rateBound > sampleBound {
+			bound = rateBound
+		}
+		searches = 1
+		searchBound = ResultBound(sensorCnt, batchCnt, batchSize, bound, bound)
+	case SchemeDMCFE, SchemeDecentralizedDMCFE:
+		// every batch is decrypted on its own
+		searches = batchCnt
+		searchBound = DMCFEBound(sensorCnt, sampleBound, rateBound)
+		searchBound.Mul(searchBound, big.NewInt(int64(batchSize)))
+	default:
+		// SchemePaillierMulti, SchemeLWE and SchemeDummy don't solve discrete logarithms
+		return DecryptionCost{}
+	}
+
+	return DecryptionCost{
+		Searches:    searches,
+		SearchBound: searchBound,
+		Steps:       DlogSteps(searchBound),
+	}
+}
+
+// DlogSteps returns the worst-case number of group operations of the baby-step giant-step search within bound:
+// ceil(sqrt(bound)) baby steps, and as many giant steps
+func DlogSteps(bound *big.Int) *big.Int {
+	m := new(big.Int).Sqrt(bound)
+	if new(big.Int).Mul(m, m).Cmp(bound) < 0 {
+		m.Add(m, big.NewInt(1))
+	}
+	return m.Mul(m, big.NewInt(2))
+}
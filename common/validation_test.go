@@ -0,0 +1,86 @@
+package common
+
+import (
+	"math/big"
+	"testing"
+)
+
+// pow2 returns 2^exp
+func pow2(exp uint) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), exp)
+}
+
+func TestResultBound(t *testing.T) {
+	if bound := ResultBound(3, 4, 5, 10, 100); bound.Cmp(big.NewInt(60000)) != 0 {
+		t.Errorf("result bound %s, expected 60000", bound)
+	}
+
+	// the product of the bounds of a large task doesn't fit in int64, and isn't wrapped around
+	bound := ResultBound(1<<20, 1<<20, 1<<20, 1<<20, 1<<20)
+	if bound.IsInt64() || bound.Cmp(pow2(100)) != 0 {
+		t.Errorf("result bound %s, expected 2^100", bound)
+	}
+}
+
+func TestDlogSteps(t *testing.T) {
+	tests := []struct {
+		bound *big.Int
+		steps *big.Int
+	}{
+		{big.NewInt(0), big.NewInt(0)},
+		{big.NewInt(1), big.NewInt(2)},
+		{big.NewInt(2), big.NewInt(4)},
+		{big.NewInt(16), big.NewInt(8)},
+		{big.NewInt(17), big.NewInt(10)},
+		{pow2(100), pow2(51)},
+	}
+	for _, test := range tests {
+		if steps := DlogSteps(test.bound); steps.Cmp(test.steps) != 0 {
+			t.Errorf("%s steps within %s, expected %s", steps, test.bound, test.steps)
+		}
+	}
+}
+
+func TestEstimateDecryptionCost(t *testing.T) {
+	tests := []struct {
+		scheme      string
+		searches    int
+		searchBound int64
+	}{
+		{SchemeFHIPE, 1, 5 * 10 * 100},
+		{SchemeFHMultiIPE, 1, 3 * 4 * 5 * 10 * 100},
+		{SchemeDamgardMulti, 1, 3 * 4 * 5 * 100 * 100},
+		{SchemeDMCFE, 4, 3 * 10 * 100 * 5},
+		{SchemeDecentralizedDMCFE, 4, 3 * 10 * 100 * 5},
+		{SchemePaillierMulti, 0, 0},
+		{SchemeLWE, 0, 0},
+		{SchemeDummy, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.scheme, func(t *testing.T) {
+			cost := EstimateDecryptionCost(test.scheme, 3, 4, 5, 10, 100)
+			if cost.Searches != test.searches {
+				t.Errorf("%d searches, expected %d", cost.Searches, test.searches)
+			}
+			if test.searches == 0 {
+				if cost.SearchBound != nil || cost.Steps != nil {
+					t.Errorf("search bound %s and %s steps without searches", cost.SearchBound, cost.Steps)
+				}
+				return
+			}
+			if cost.SearchBound.Cmp(big.NewInt(test.searchBound)) != 0 {
+				t.Errorf("search bound %s, expected %d", cost.SearchBound, test.searchBound)
+			}
+			if cost.Steps.Cmp(DlogSteps(cost.SearchBound)) != 0 {
+				t.Errorf("%s steps, expected %s", cost.Steps, DlogSteps(cost.SearchBound))
+			}
+		})
+	}
+
+	t.Run("large task", func(t *testing.T) {
+		cost := EstimateDecryptionCost(SchemeFHMultiIPE, 1<<20, 1<<20, 1<<20, 1<<20, 1<<20)
+		if cost.SearchBound.Cmp(pow2(100)) != 0 || cost.Steps.Cmp(pow2(51)) != 0 {
+			t.Errorf("search bound %s and %s steps, expected 2^100 and 2^51", cost.SearchBound, cost.Steps)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package sensor
 
 import (
+	"fe/client"
 	. "fe/common"
 )
 
@@ -9,14 +10,5 @@ type Authority struct {
 }
 
 func (a *Authority) GetEncryptionParams(taskId UUID, sensorId UUID) (FEEncryptionParams, error) {
-	//method := "GET"
-	url := "/encryption/" + string(taskId) + "/" + string(sensorId)
-
-	_, responseBody, err := a.GET(url)
-	if err != nil {
-		return nil, err
-	}
-
-	feEncryptionParams, err := Decode(responseBody)
-	return feEncryptionParams, nil
+	return client.NewAuthority(a.ForTask(taskId)).EncryptionParams(taskId, sensorId)
 }
@@ -1,6 +1,7 @@
 package sensor
 
 import (
+	"crypto/rand"
 	. "fe/common"
 	"math/big"
 	"sync/atomic"
@@ -15,16 +16,23 @@ type Batch struct {
 	totalSamplesCnt    int32
 
 	cipher         FECipher
+	sampledAt      time.Time     // when the last sample was taken
+	queueTime      time.Duration // time spent waiting for an encryption worker
 	encryptionTime time.Duration
 	isEncrypted    atomic.Bool
 
 	isSubmitted atomic.Bool
+
+	nonce      []byte                          // opens the commitment to the samples, with them
+	commitment atomic.Pointer[BatchCommitment] // set when the cipher is encoded for submission, see commitments.go
 }
 
 func (b *Batch) InitBatch(idx int, samplesCnt int) {
 	b.idx = idx
 	b.samples = make([]*big.Int, samplesCnt)
 	b.totalSamplesCnt = int32(samplesCnt)
+	b.nonce = make([]byte, 32)
+	_, _ = rand.Read(b.nonce)
 }
 
 // AddSample adds a sample to the non-full batch and returns true if the batch is full. Adding to the full batch
@@ -36,16 +44,17 @@ func (b *Batch) AddSample(sample int) bool {
 	return newSampleIdx == b.totalSamplesCnt-1
 }
 
-func (b *Batch) GetSamples() []int32 {
+// GetSamples returns the fixed-point encoded samples of the batch
+func (b *Batch) GetSamples() []int64 {
 	sampleCnt := b.receivedSamplesCnt.Load()
 	if sampleCnt == 0 {
 		return nil
 	}
 
-	samples := make([]int32, sampleCnt)
+	samples := make([]int64, sampleCnt)
 	var idx int32
 	for idx = 0; idx < sampleCnt; idx++ {
-		samples[idx] = int32(b.samples[idx].Int64())
+		samples[idx] = b.samples[idx].Int64()
 	}
 
 	return samples
@@ -0,0 +1,52 @@
+package sensor
+
+import (
+	. "fe/common"
+	"sort"
+)
+
+// Every cipher is submitted with a signed BatchCommitment (in BatchCommitmentHeader), which commits the sensor to
+// the samples of the batch, and to the cipher the server has received. The server keeps the commitments for the
+// task's bundle, so the customer can check that the server billed with the ciphers the sensor has submitted; the
+// samples stay with the sensor, which can open the commitments with the nonces of the batches.
+
+// commit returns the signed commitment of batch no batchIdx, whose encoded cipher is cipher
+func (t *Task) commit(batchIdx int, cipher []byte) (*BatchCommitment, error) {
+	batch := &t.batches[batchIdx]
+	opening := CommitmentOpening{
+		TaskId:   t.Id,
+		SensorId: t.SensorId,
+		BatchIdx: batchIdx,
+		Samples:  batch.GetSamples(),
+		Nonce:    batch.nonce,
+	}
+
+	commitment := &BatchCommitment{
+		TaskId:     t.Id,
+		SensorId:   t.SensorId,
+		BatchIdx:   batchIdx,
+		Commitment: opening.Commit(),
+		CipherHash: Hash(cipher),
+		SampledAt:  batch.sampledAt.UnixNano(),
+	}
+	if err := commitment.Sign(t.signer); err != nil {
+		return nil, err
+	}
+
+	batch.commitment.Store(commitment)
+	return commitment, nil
+}
+
+// GetCommitments returns the commitments of the batches that have been submitted, or queued, ordered by batch
+func (t *Task) GetCommitments() []*BatchCommitment {
+	commitments := make([]*BatchCommitment, 0)
+	for idx := range t.batches {
+		if commitment := t.batches[idx].commitment.Load(); commitment != nil {
+			commitments = append(commitments, commitment)
+		}
+	}
+	sort.Slice(commitments, func(i, j int) bool {
+		return commitments[i].BatchIdx < commitments[j].BatchIdx
+	})
+	return commitments
+}
@@ -0,0 +1,69 @@
+package sensor
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	. "fe/common"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The samples are disclosed only to the sensor's customer, who audits the bill with them offline (see cmd/audit):
+// when the customer is set, the sensor issues an audit token, which is returned only in that response, and keeps
+// only its hash. GET /v1/tasks/:id/samples requires the token as a bearer token, and discloses the committed batches
+// with their nonces, so that the customer can open the commitments the server has billed with.
+
+// AuditTokenHeader carries the customer's audit token, as "Bearer <token>"
+const AuditTokenHeader = AuthorizationHeader
+
+// issueAuditToken returns a new random audit token, whose hash replaces the one of the previous token; customerMutex
+// must be held
+func (sensor *Sensor) issueAuditToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(data)
+	sensor.auditTokenHash = Hash([]byte(token))
+	return token, nil
+}
+
+// authorizeCustomer reports whether the request carries the customer's audit token
+func (sensor *Sensor) authorizeCustomer(c *gin.Context) bool {
+	sensor.customerMutex.RLock()
+	auditTokenHash := sensor.auditTokenHash
+	sensor.customerMutex.RUnlock()
+
+	if auditTokenHash == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(c.GetHeader(AuditTokenHeader), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(Hash([]byte(token))), []byte(auditTokenHash)) == 1
+}
+
+// Disclose returns the samples of the committed batches of the task, with the nonces that open the commitments
+func (t *Task) Disclose(customerId UUID) *SampleDisclosure {
+	disclosure := &SampleDisclosure{
+		TaskId:     t.Id,
+		SensorId:   t.SensorId,
+		CustomerId: customerId,
+		Batches:    make([]DisclosedBatch, 0),
+	}
+
+	for _, commitment := range t.GetCommitments() {
+		batch := &t.batches[commitment.BatchIdx]
+		disclosure.Batches = append(disclosure.Batches, DisclosedBatch{
+			BatchIdx:   commitment.BatchIdx,
+			Samples:    batch.GetSamples(),
+			Nonce:      batch.nonce,
+			SampledAt:  commitment.SampledAt,
+			Commitment: commitment,
+		})
+	}
+	return disclosure
+}
@@ -0,0 +1,101 @@
+package sensor
+
+import (
+	. "fe/common"
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestContext returns the context of a request with the header AuditTokenHeader, if it isn't empty
+func newTestContext(header string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	if header != "" {
+		c.Request.Header.Set(AuditTokenHeader, header)
+	}
+	return c
+}
+
+func TestAuthorizeCustomer(t *testing.T) {
+	sensor := &Sensor{}
+	if sensor.authorizeCustomer(newTestContext("Bearer token")) {
+		t.Error("customer authorized before an audit token is issued")
+	}
+
+	token, err := sensor.issueAuditToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.auditTokenHash == token {
+		t.Error("audit token kept instead of its hash")
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		valid  bool
+	}{
+		{"token", "Bearer " + token, true},
+		{"no token", "", false},
+		{"empty token", "Bearer ", false},
+		{"not a bearer token", token, false},
+		{"other token", "Bearer " + token[1:] + "0", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorized := sensor.authorizeCustomer(newTestContext(test.header))
+			if test.valid && !authorized {
+				t.Error("valid audit token refused")
+			} else if !test.valid && authorized {
+				t.Error("invalid audit token authorized")
+			}
+		})
+	}
+
+	t.Run("reissued", func(t *testing.T) {
+		if _, err := sensor.issueAuditToken(); err != nil {
+			t.Fatal(err)
+		}
+		if sensor.authorizeCustomer(newTestContext("Bearer " + token)) {
+			t.Error("previous audit token authorized")
+		}
+	})
+}
+
+func TestDisclose(t *testing.T) {
+	signer, err := NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &Task{Id: "task-0", SensorId: "sensor-0", batches: make([]Batch, 3), signer: signer}
+	for idx := range task.batches {
+		batch := &task.batches[idx]
+		batch.InitBatch(idx, 2)
+		batch.AddSample(idx)
+		batch.AddSample(-5)
+		batch.sampledAt = time.Unix(int64(1000+idx), 0)
+	}
+
+	// batch no 1 hasn't been submitted
+	for _, batchIdx := range []int{2, 0} {
+		if _, err = task.commit(batchIdx, []byte("cipher")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	disclosure := task.Disclose("customer-0")
+	if len(disclosure.Batches) != 2 || disclosure.Batches[0].BatchIdx != 0 || disclosure.Batches[1].BatchIdx != 2 {
+		t.Fatalf("disclosed batches %+v, expected the committed ones, in order", disclosure.Batches)
+	}
+	if samples := disclosure.Batches[1].Samples; len(samples) != 2 || samples[0] != 2 || samples[1] != -5 {
+		t.Errorf("disclosed samples %v, expected [2 -5]", samples)
+	}
+	if disclosure.CustomerId != "customer-0" || disclosure.SensorId != "sensor-0" {
+		t.Errorf("disclosure of sensor %s to customer %s", disclosure.SensorId, disclosure.CustomerId)
+	}
+	if err = disclosure.Verify(signer.PublicKey()); err != nil {
+		t.Errorf("disclosure doesn't open the commitments: %s", err)
+	}
+}
@@ -0,0 +1,111 @@
+package sensor
+
+import (
+	"container/heap"
+	. "fe/common"
+	"sync"
+	"time"
+)
+
+// EncryptionPool encrypts the batches of all the Sensor's tasks with a bounded number of workers, so that batches
+// that arrive at once (e.g. when the encryption params are fetched late) don't start encrypting at once. The oldest
+// batch, by the time it was sampled, is encrypted first. Workers are started when batches are queued, and exit when
+// the queue is empty.
+type EncryptionPool struct {
+	maxWorkers int
+	workers    int
+	queue      encryptionQueue
+	seq        uint64
+	mutex      sync.Mutex
+
+	metrics *sensorMetrics
+	logger  *Logger
+}
+
+// encryptionJob is a batch waiting for encryption; run is called by a worker, with the time the batch was queued
+type encryptionJob struct {
+	sampledAt time.Time
+	queuedAt  time.Time
+	seq       uint64 // breaks the ties of sampledAt, in the order of queueing
+	run       func(queueTime time.Duration)
+}
+
+func NewEncryptionPool(maxWorkers int, metrics *sensorMetrics, logger *Logger) *EncryptionPool {
+	return &EncryptionPool{
+		maxWorkers: maxWorkers,
+		queue:      make(encryptionQueue, 0),
+		metrics:    metrics,
+		logger:     GetLogger("encryption pool", logger),
+	}
+}
+
+// Submit queues a batch sampled at sampledAt, and starts a worker if fewer than maxWorkers are running
+func (p *EncryptionPool) Submit(sampledAt time.Time, run func(queueTime time.Duration)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.seq++
+	heap.Push(&p.queue, &encryptionJob{
+		sampledAt: sampledAt,
+		queuedAt:  time.Now(),
+		seq:       p.seq,
+		run:       run,
+	})
+
+	if p.workers < p.maxWorkers {
+		p.workers++
+		go p.worker()
+	}
+}
+
+// QueueLen returns the number of batches waiting for a worker
+func (p *EncryptionPool) QueueLen() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.queue)
+}
+
+func (p *EncryptionPool) worker() {
+	for {
+		p.mutex.Lock()
+		if len(p.queue) == 0 {
+			p.workers--
+			p.mutex.Unlock()
+			return
+		}
+		job := heap.Pop(&p.queue).(*encryptionJob)
+		p.mutex.Unlock()
+
+		queueTime := time.Since(job.queuedAt)
+		p.metrics.encryptionQueueTime.ObserveDuration(queueTime)
+		job.run(queueTime)
+	}
+}
+
+//region encryptionQueue
+
+// encryptionQueue is a heap of encryptionJobs, ordered by sampledAt and seq
+type encryptionQueue []*encryptionJob
+
+func (q encryptionQueue) Len() int { return len(q) }
+
+func (q encryptionQueue) Less(i, j int) bool {
+	if !q[i].sampledAt.Equal(q[j].sampledAt) {
+		return q[i].sampledAt.Before(q[j].sampledAt)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q encryptionQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *encryptionQueue) Push(x any) { *q = append(*q, x.(*encryptionJob)) }
+
+func (q *encryptionQueue) Pop() any {
+	old := *q
+	job := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return job
+}
+
+//endregion
@@ -8,7 +8,7 @@ import (
 	"net/http"
 )
 
-// POST /task
+// POST /tasks
 // body: customerId, start, measuringPeriod, submittingPeriod
 func (sensor *Sensor) submitTaskEndpoint(c *gin.Context) (ResponseType, int, any) {
 	// get JSON from request body; can't use BindJSON as we're unmarshalling twice!
@@ -23,8 +23,15 @@ func (sensor *Sensor) submitTaskEndpoint(c *gin.Context) (ResponseType, int, any
 	}
 
 	task := sensor.NewTask(&taskRequest)
+	if !UsesAuthority(task.Scheme) {
+		if err = task.SetupDMCFEClients(); err != nil {
+			return ErrorResponse, http.StatusBadRequest, err.Error()
+		}
+	}
 
-	sensor.SendTaskToDaemon(task)
+	if err = sensor.SendTaskToDaemon(task); err != nil {
+		return ErrorResponse, http.StatusServiceUnavailable, err
+	}
 
 	msg := fmt.Sprintf("task %s added successfully", task.Id)
 	sensor.HttpLogger.Info(msg)
@@ -41,6 +48,9 @@ func (sensor *Sensor) setServerEndpoint(c *gin.Context) (ResponseType, int, any)
 
 	newServer := sensor.NewServer(ip)
 
+	sensor.serverMutex.Lock()
+	defer sensor.serverMutex.Unlock()
+
 	// assert that Sensor doesn't already have Server
 	if sensor.Server == nil {
 		sensor.Server = newServer
@@ -54,53 +64,130 @@ func (sensor *Sensor) setServerEndpoint(c *gin.Context) (ResponseType, int, any)
 		return StringResponse, http.StatusOK, msg
 
 	} else {
-		return ErrorResponse, http.StatusBadRequest, fmt.Sprintf("could not set server %s, as server %s is already set", newServer.IP.String(), sensor.Server.IP.String())
+		return ErrorResponse, http.StatusConflict, fmt.Sprintf("could not set server %s, as server %s is already set", newServer.IP.String(), sensor.Server.IP.String())
 	}
 
 }
 
-func (sensor *Sensor) setCustomerEndpoint(c *gin.Context) (ResponseType, int, any) {
-	var data struct {
-		CustomerId UUID `json:"id"`
+// setServerCredentialEndpoint sets the API key (or JWT) the sensor authenticates to the server with, as issued
+// when the sensor is added to the customer on the server; it must be set before the sensor's tasks start, and only
+// the operator may set it
+//
+// endpoint: [PUT] /server/credential
+func (sensor *Sensor) setServerCredentialEndpoint(c *gin.Context) (ResponseType, int, any) {
+	var data CredentialRequest
+	if err := c.BindJSON(&data); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
 	}
 
+	server := sensor.setServerCredential(data.Credential)
+	if server == nil {
+		return ErrorResponse, http.StatusBadRequest, "server must be set before its credential"
+	}
+	sensor.HttpLogger.Info("credential of server %s set", server.IP.String())
+	return NoResponse, http.StatusNoContent, nil
+}
+
+func (sensor *Sensor) setCustomerEndpoint(c *gin.Context) (ResponseType, int, any) {
+	var data SetCustomerRequest
 	if err := c.BindJSON(&data); err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
 
+	sensor.customerMutex.Lock()
+	defer sensor.customerMutex.Unlock()
+
 	// assert that Sensor doesn't already have CustomerId
 	if sensor.CustomerId.IsNil() {
+		// the audit token is returned only once, to the operator that sets the customer
+		token, err := sensor.issueAuditToken()
+		if err != nil {
+			return ErrorResponse, http.StatusInternalServerError, err.Error()
+		}
 		sensor.CustomerId = data.CustomerId
-		msg := fmt.Sprintf("customer %s set successfully", data.CustomerId)
-		sensor.HttpLogger.Info(msg)
-		return StringResponse, http.StatusOK, msg
+		sensor.HttpLogger.Info("customer %s set successfully", data.CustomerId)
+		return JSONResponse, http.StatusOK, SensorCustomer{Id: data.CustomerId, AuditToken: token}
 
 	} else if sensor.CustomerId == data.CustomerId {
-		msg := fmt.Sprintf("customer %s is already set", sensor.CustomerId)
-		sensor.HttpLogger.Info(msg)
-		return StringResponse, http.StatusOK, msg
+		sensor.HttpLogger.Info("customer %s is already set", sensor.CustomerId)
+		return JSONResponse, http.StatusOK, SensorCustomer{Id: sensor.CustomerId}
 
 	} else {
-		return ErrorResponse, http.StatusBadRequest, fmt.Sprintf("could not set customer %s, as customer %s is already set", data.CustomerId, sensor.CustomerId)
+		return ErrorResponse, http.StatusConflict, fmt.Sprintf("could not set customer %s, as customer %s is already set", data.CustomerId, sensor.CustomerId)
 	}
 }
 
+// registerSensorEndpoint adds the sensor to its customer on its server, see Server.Register
+//
+// endpoint: [POST] /registration
 func (sensor *Sensor) registerSensorEndpoint(c *gin.Context) (ResponseType, int, any) {
 	// assert that the Server is already set
-	if sensor.Server == nil {
+	server := sensor.GetServer()
+	if server == nil {
 		return ErrorResponse, http.StatusBadRequest, "server must be set before sensor registration"
 	}
 
 	// assert that the CustomerId is already set
-	if sensor.CustomerId.IsNil() {
+	if sensor.GetCustomerId().IsNil() {
 		return ErrorResponse, http.StatusBadRequest, "customer must be set before sensor registration"
 	}
 
-	sensor.Server.Register(sensor)
+	// the error of the server is reported as the message, as its code is the server's
+	if err := server.Register(sensor); err != nil {
+		sensor.HttpLogger.Err(err)
+		return ErrorResponse, http.StatusBadGateway, fmt.Sprintf("registration to server %s failed: %s", server.IP.String(), err)
+	}
+	sensor.HttpLogger.Info("registered to server %s", server.IP.String())
 	return NoResponse, http.StatusNoContent, nil
 }
 
+// getSamplesEndpoint discloses the samples of the task's committed batches to the customer, see disclosure.go
+//
+// endpoint: [GET] /tasks/:id/samples
 func (sensor *Sensor) getSamplesEndpoint(c *gin.Context) (ResponseType, int, any) {
+	if !sensor.authorizeCustomer(c) {
+		c.Header("WWW-Authenticate", "Bearer")
+		return ErrorResponse, http.StatusUnauthorized, "the customer's audit token is required"
+	}
+
+	// get task uuid
+	taskIdString := c.Param("id")
+	taskId, err := NewUUIDFromString(taskIdString)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	// get task
+	task, err := sensor.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err
+	}
+
+	return JSONResponse, http.StatusOK, task.Disclose(sensor.GetCustomerId())
+}
+
+// getCommitmentsEndpoint returns the signed commitments of the task's submitted batches
+//
+// endpoint: [GET] /tasks/:id/commitments
+func (sensor *Sensor) getCommitmentsEndpoint(c *gin.Context) (ResponseType, int, any) {
+	taskId, err := NewUUIDFromString(c.Param("id"))
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	task, err := sensor.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err.Error()
+	}
+
+	return JSONResponse, http.StatusOK, task.GetCommitments()
+}
+
+// getTaskEventsEndpoint streams the sampling, encryption and submission events of the task as server-sent events,
+// from the first one, or from the one after the Last-Event-ID header
+//
+// endpoint: [GET] /tasks/:id/events
+func (sensor *Sensor) getTaskEventsEndpoint(c *gin.Context) (ResponseType, int, any) {
 	// get task uuid
 	taskIdString := c.Param("id")
 	taskId, err := NewUUIDFromString(taskIdString)
@@ -110,19 +197,193 @@ func (sensor *Sensor) getSamplesEndpoint(c *gin.Context) (ResponseType, int, any
 
 	// get task
 	task, err := sensor.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err.Error()
+	}
+
+	lastEventId, err := ParseLastEventId(c)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	return StreamResponse, http.StatusOK, task.Events(lastEventId)
+}
+
+//region decentralized DMCFE endpoints
+
+// getTaskForDMCFE returns the task with the id from the path, if it uses SchemeDecentralizedDMCFE
+func (sensor *Sensor) getTaskForDMCFE(c *gin.Context) (*Task, error) {
+	taskId, err := NewUUIDFromString(c.Param("id"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid task uuid")
+	}
+
+	task, err := sensor.GetTask(taskId)
+	if err != nil {
+		return nil, err
+	}
+
+	if UsesAuthority(task.Scheme) {
+		return nil, fmt.Errorf("task %s doesn't use %s", taskId, SchemeDecentralizedDMCFE)
+	}
+	return task, nil
+}
+
+// endpoint: [GET] /tasks/:id/dmcfe/pub-keys
+func (sensor *Sensor) getDMCFEPubKeysEndpoint(c *gin.Context) (ResponseType, int, any) {
+	task, err := sensor.getTaskForDMCFE(c)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	data, err := Encode(task.GetDMCFEPubKeys())
+	if err != nil {
+		return ErrorResponse, http.StatusInternalServerError, err
+	}
+
+	return DataResponse, http.StatusOK, data
+}
+
+// endpoint: [PUT] /tasks/:id/dmcfe/pub-keys
+// body: DMCFEPubKeys of all the clients of the task
+func (sensor *Sensor) setDMCFEPubKeysEndpoint(c *gin.Context) (ResponseType, int, any) {
+	task, err := sensor.getTaskForDMCFE(c)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	pubKeysBytes, err := c.GetRawData()
 	if err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
 
-	return JSONResponse, http.StatusOK, task.GetSamples()
+	pubKeys, err := Decode(pubKeysBytes)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	dmcfePubKeys, ok := pubKeys.(*DMCFEPubKeys)
+	if !ok {
+		return ErrorResponse, http.StatusBadRequest, "invalid public keys"
+	}
+
+	if err = task.SetDMCFEPubKeys(dmcfePubKeys); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	return NoResponse, http.StatusNoContent, nil
 }
 
-func (sensor *Sensor) GetEndpoints() []Endpoint {
-	return []Endpoint{
-		{"POST", "/server", sensor.setServerEndpoint},
-		{"POST", "/customer", sensor.setCustomerEndpoint},
-		{"POST", "/task", sensor.submitTaskEndpoint},
-		{"GET", "/register", sensor.registerSensorEndpoint},
-		{"GET", "/task/:id/samples", sensor.getSamplesEndpoint},
+// endpoint: [POST] /tasks/:id/dmcfe/key-shares
+// body: rates, as with [POST] /tasks/:taskId/rates of the authority
+func (sensor *Sensor) getDMCFEKeySharesEndpoint(c *gin.Context) (ResponseType, int, any) {
+	task, err := sensor.getTaskForDMCFE(c)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
 	}
+
+	ratesBytes, err := c.GetRawData()
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	rates, err := Decode(ratesBytes)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	ratesSlice, ok := rates.([]int)
+	if !ok {
+		return ErrorResponse, http.StatusBadRequest, "invalid rates"
+	}
+
+	if err = task.ApproveRates(ratesSlice); err != nil {
+		sensor.HttpLogger.Warn("rates for task %s rejected: %s", task.Id, err)
+		return ErrorResponse, http.StatusForbidden, err.Error()
+	}
+
+	keyShares, err := task.DeriveDMCFEKeyShares()
+	if err != nil {
+		return ErrorResponse, http.StatusConflict, err.Error()
+	}
+
+	data, err := Encode(keyShares)
+	if err != nil {
+		return ErrorResponse, http.StatusInternalServerError, err
+	}
+
+	return DataResponse, http.StatusOK, data
+}
+
+//endregion
+
+func (sensor *Sensor) GetEndpoints() []Endpoint {
+	return append(sensor.getV1Endpoints(), sensor.getDeprecatedEndpoints()...)
+}
+
+func (sensor *Sensor) getV1Endpoints() []Endpoint {
+	v1 := RouteGroup{Prefix: V1Prefix, Envelope: true}
+	tasks := v1.Group("/tasks")
+
+	return append(v1.Endpoints([]Endpoint{
+		{Method: "PUT", Path: "/server", Handler: sensor.setServerEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the server", Request: IP{}, Response: BodyText},
+		{Method: "PUT", Path: "/server/credential", Handler: sensor.setServerCredentialEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the credential the sensor authenticates to the server with", Request: CredentialRequest{},
+			Status: http.StatusNoContent},
+		{Method: "PUT", Path: "/customer", Handler: sensor.setCustomerEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the customer; the first time, the customer's audit token is returned", Request: SetCustomerRequest{},
+			Response: SensorCustomer{}},
+		{Method: "POST", Path: "/registration", Handler: sensor.registerSensorEndpoint,
+			Summary: "add the sensor to its customer on the server", Status: http.StatusNoContent},
+	}), tasks.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: sensor.submitTaskEndpoint,
+			Summary: "submit a task of the server", Request: SensorTaskRequest{}, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "GET", Path: "/:id/samples", Handler: sensor.getSamplesEndpoint,
+			Summary: "disclose the samples to the customer, with its audit token as the bearer token", Response: SampleDisclosure{}},
+		{Method: "GET", Path: "/:id/events", Handler: sensor.getTaskEventsEndpoint,
+			Summary: "the events of the task, as server-sent events", Response: BodyEventStream},
+		{Method: "GET", Path: "/:id/commitments", Handler: sensor.getCommitmentsEndpoint,
+			Summary: "the signed commitments of the submitted batches", Response: []*BatchCommitment{}},
+		{Method: "GET", Path: "/:id/dmcfe/pub-keys", Handler: sensor.getDMCFEPubKeysEndpoint,
+			Summary: "the DMCFE public keys of the sensor's clients, gob encoded", Response: BodyOctetStream},
+		{Method: "PUT", Path: "/:id/dmcfe/pub-keys", Handler: sensor.setDMCFEPubKeysEndpoint,
+			Summary: "set the DMCFE public keys of all the clients, gob encoded", Request: BodyOctetStream, Status: http.StatusNoContent},
+		{Method: "POST", Path: "/:id/dmcfe/key-shares", Handler: sensor.getDMCFEKeySharesEndpoint,
+			Summary: "derive the DMCFE key shares for the gob encoded rates", Request: BodyOctetStream, Response: BodyOctetStream},
+	})...)
+}
+
+// getDeprecatedEndpoints returns the unversioned endpoints, which the /v1 ones replace
+func (sensor *Sensor) getDeprecatedEndpoints() []Endpoint {
+	deprecated := RouteGroup{Deprecated: true}
+	tasks := deprecated.Group("/task")
+
+	return append(deprecated.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/server", Handler: sensor.setServerEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the server", Request: IP{}, Response: BodyText},
+		{Method: "POST", Path: "/server/credential", Handler: sensor.setServerCredentialEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the credential the sensor authenticates to the server with", Request: CredentialRequest{},
+			Status: http.StatusNoContent},
+		{Method: "POST", Path: "/customer", Handler: sensor.setCustomerEndpoint, Roles: []Role{RoleOperator},
+			Summary: "set the customer; the first time, the customer's audit token is returned", Request: SetCustomerRequest{},
+			Response: SensorCustomer{}},
+		{Method: "GET", Path: "/register", Handler: sensor.registerSensorEndpoint,
+			Summary: "register the sensor to the server", Status: http.StatusNoContent},
+	}), tasks.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: sensor.submitTaskEndpoint,
+			Summary: "submit a task of the server", Request: SensorTaskRequest{}, Status: http.StatusAccepted, Response: BodyText},
+		{Method: "GET", Path: "/:id/samples", Handler: sensor.getSamplesEndpoint,
+			Summary: "disclose the samples to the customer, with its audit token as the bearer token", Response: SampleDisclosure{}},
+		{Method: "GET", Path: "/:id/events", Handler: sensor.getTaskEventsEndpoint,
+			Summary: "the events of the task, as server-sent events", Response: BodyEventStream},
+		{Method: "GET", Path: "/:id/commitments", Handler: sensor.getCommitmentsEndpoint,
+			Summary: "the signed commitments of the submitted batches", Response: []*BatchCommitment{}},
+		{Method: "GET", Path: "/:id/dmcfe/pub-keys", Handler: sensor.getDMCFEPubKeysEndpoint,
+			Summary: "the DMCFE public keys of the sensor's clients, gob encoded", Response: BodyOctetStream},
+		{Method: "POST", Path: "/:id/dmcfe/pub-keys", Handler: sensor.setDMCFEPubKeysEndpoint,
+			Summary: "set the DMCFE public keys of all the clients, gob encoded", Request: BodyOctetStream, Status: http.StatusNoContent},
+		{Method: "POST", Path: "/:id/dmcfe/key-shares", Handler: sensor.getDMCFEKeySharesEndpoint,
+			Summary: "derive the DMCFE key shares for the gob encoded rates", Request: BodyOctetStream, Response: BodyOctetStream},
+	})...)
 }
@@ -0,0 +1,50 @@
+package sensor
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"time"
+)
+
+// DMCFEEncryptor encrypts every sample of a batch with its own DMCFE client, under the label of the batch
+type DMCFEEncryptor struct {
+	SensorIdx int
+	Clients   []*fullysec.DMCFEClient
+	Label     string
+
+	logger *Logger
+}
+
+func (e *DMCFEEncryptor) Scheme() string {
+	return SchemeDMCFE
+}
+
+func (e *DMCFEEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error) {
+	if len(batch.samples) != len(e.Clients) {
+		return nil, 0, fmt.Errorf("batch no %d has %d samples, expected %d", batch.idx, len(batch.samples), len(e.Clients))
+	}
+	label := DMCFELabel(e.Label, batch.idx)
+
+	// encrypt + measure time
+	start := time.Now()
+	payload := make([]*bn256.G1, len(e.Clients))
+	var err error
+	for idx, client := range e.Clients {
+		if payload[idx], err = client.Encrypt(batch.samples[idx], label); err != nil {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+	e.logger.Info("batch no %d encryption time: %d ns", batch.idx, elapsed.Nanoseconds())
+	if err != nil {
+		return nil, elapsed, err
+	}
+
+	return &DMCFECipher{
+		BatchIdx:  batch.idx,
+		SensorIdx: e.SensorIdx,
+		Payload:   payload,
+	}, elapsed, nil
+}
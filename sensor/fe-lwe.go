@@ -0,0 +1,34 @@
+package sensor
+
+import (
+	. "fe/common"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"time"
+)
+
+type LWEEncryptor struct {
+	Schema        *fullysec.LWE
+	EncryptionKey data.Matrix
+
+	logger *Logger
+}
+
+func (e *LWEEncryptor) Scheme() string {
+	return SchemeLWE
+}
+
+func (e *LWEEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error) {
+	// batchIdx is ignored
+
+	// encrypt + measure time
+	start := time.Now()
+	cipher, err := e.Schema.Encrypt(batch.samples, e.EncryptionKey)
+	elapsed := time.Since(start)
+	e.logger.Info("batch no %d encryption time: %d ns", batch.idx, elapsed.Nanoseconds())
+	if err != nil {
+		return nil, elapsed, err
+	}
+
+	return &LWECipher{Payload: cipher}, elapsed, nil
+}
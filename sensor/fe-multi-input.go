@@ -0,0 +1,83 @@
+package sensor
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/gofe/data"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"time"
+)
+
+//region DamgardMultiEncryptor
+
+type DamgardMultiEncryptor struct {
+	Client    *fullysec.DamgardMultiClient
+	IdxOffset int
+	PubKeys   data.Matrix
+	Otps      data.Matrix
+
+	logger *Logger
+}
+
+func (e *DamgardMultiEncryptor) Scheme() string {
+	return SchemeDamgardMulti
+}
+
+func (e *DamgardMultiEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error) {
+	if batch.idx >= len(e.PubKeys) {
+		return nil, 0, fmt.Errorf("batch no %d out of range (%d batches)", batch.idx, len(e.PubKeys))
+	}
+
+	// encrypt + measure time
+	start := time.Now()
+	cipher, err := e.Client.Encrypt(batch.samples, e.PubKeys[batch.idx], e.Otps[batch.idx])
+	elapsed := time.Since(start)
+	e.logger.Info("batch no %d encryption time: %d ns", batch.idx, elapsed.Nanoseconds())
+	if err != nil {
+		return nil, elapsed, err
+	}
+
+	return &MultiInputCipher{
+		Idx:     batch.idx + e.IdxOffset,
+		Payload: cipher,
+	}, elapsed, nil
+}
+
+//endregion
+
+//region PaillierMultiEncryptor
+
+type PaillierMultiEncryptor struct {
+	Client    *fullysec.PaillierMultiClient
+	IdxOffset int
+	PubKeys   data.Matrix
+	Otps      data.Matrix
+
+	logger *Logger
+}
+
+func (e *PaillierMultiEncryptor) Scheme() string {
+	return SchemePaillierMulti
+}
+
+func (e *PaillierMultiEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error) {
+	if batch.idx >= len(e.PubKeys) {
+		return nil, 0, fmt.Errorf("batch no %d out of range (%d batches)", batch.idx, len(e.PubKeys))
+	}
+
+	// encrypt + measure time
+	start := time.Now()
+	cipher, err := e.Client.Encrypt(batch.samples, e.PubKeys[batch.idx], e.Otps[batch.idx])
+	elapsed := time.Since(start)
+	e.logger.Info("batch no %d encryption time: %d ns", batch.idx, elapsed.Nanoseconds())
+	if err != nil {
+		return nil, elapsed, err
+	}
+
+	return &MultiInputCipher{
+		Idx:     batch.idx + e.IdxOffset,
+		Payload: cipher,
+	}, elapsed, nil
+}
+
+//endregion
@@ -9,6 +9,7 @@ import (
 
 type FEEncryptor interface {
 	Encrypt(batch *Batch) (FECipher, time.Duration, error)
+	Scheme() string
 }
 
 type SingleFEEncryptor struct {
@@ -58,12 +59,60 @@ func NewFEEncryptor(feParams FEEncryptionParams, logger *Logger) FEEncryptor {
 			logger:    GetLogger("fe encryptor", logger),
 		}
 
+	case *DamgardMultiEncryptionParams:
+		params := feParams.(*DamgardMultiEncryptionParams)
+		return &DamgardMultiEncryptor{
+			Client:    fullysec.NewDamgardMultiClientFromParams(params.Bound, params.SchemaParams),
+			IdxOffset: params.IdxOffset,
+			PubKeys:   params.PubKeys,
+			Otps:      params.Otps,
+			logger:    GetLogger("fe encryptor", logger),
+		}
+
+	case *PaillierMultiEncryptionParams:
+		params := feParams.(*PaillierMultiEncryptionParams)
+		return &PaillierMultiEncryptor{
+			Client:    fullysec.NewPaillierMultiClientFromParams(params.SchemaParams, params.BoundX, params.BoundY),
+			IdxOffset: params.IdxOffset,
+			PubKeys:   params.PubKeys,
+			Otps:      params.Otps,
+			logger:    GetLogger("fe encryptor", logger),
+		}
+
+	case *LWEEncryptionParams:
+		params := feParams.(*LWEEncryptionParams)
+		return &LWEEncryptor{
+			Schema:        &fullysec.LWE{Params: params.SchemaParams},
+			EncryptionKey: params.PubKey,
+			logger:        GetLogger("fe encryptor", logger),
+		}
+
+	case *DMCFEEncryptionParams:
+		params := feParams.(*DMCFEEncryptionParams)
+		clients := make([]*fullysec.DMCFEClient, len(params.ClientKeys))
+		for idx, s := range params.ClientKeys {
+			clients[idx] = &fullysec.DMCFEClient{
+				Idx: params.SensorIdx*len(params.ClientKeys) + idx,
+				S:   s,
+			}
+		}
+		return &DMCFEEncryptor{
+			SensorIdx: params.SensorIdx,
+			Clients:   clients,
+			Label:     params.Label,
+			logger:    GetLogger("fe encryptor", logger),
+		}
+
 	default:
 		//todo !!!
 		return nil
 	}
 }
 
+func (e *SingleFEEncryptor) Scheme() string {
+	return SchemeFHIPE
+}
+
 func (e *SingleFEEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error) {
 	// batchIdx is ignored
 
@@ -79,6 +128,10 @@ func (e *SingleFEEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, erro
 	return cipher, elapsed, nil
 }
 
+func (e *MultiFEEncryptor) Scheme() string {
+	return SchemeFHMultiIPE
+}
+
 func (e *MultiFEEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error) {
 	// todo check batchIdx bound!
 
@@ -97,11 +150,15 @@ func (e *MultiFEEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error
 	}, elapsed, nil
 }
 
+func (e *DummyEncryptor) Scheme() string {
+	return SchemeDummy
+}
+
 func (e *DummyEncryptor) Encrypt(batch *Batch) (FECipher, time.Duration, error) {
 
 	// encrypt + measure time
 	start := time.Now()
-	cipher := DummyCipher{
+	cipher := &DummyCipher{
 		Idx:     batch.idx + e.IdxOffset,
 		Samples: batch.samples,
 	}
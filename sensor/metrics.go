@@ -0,0 +1,38 @@
+package sensor
+
+import (
+	. "fe/common"
+)
+
+// sensorMetrics are the metrics of the Sensor, labeled by FE scheme
+type sensorMetrics struct {
+	encryptionTime           *Histogram
+	encryptionQueueTime      *Histogram
+	ciphersSubmitted         *Counter
+	cipherSubmissionFailures *Counter
+	outboxQueued             *Counter
+	outboxDropped            *Counter
+
+	// only for SchemeDecentralizedDMCFE, where the sensor sets up its keys itself
+	keyGenerationTime *Histogram
+	deriveKeyTime     *Histogram
+}
+
+func newSensorMetrics(registry *MetricsRegistry) *sensorMetrics {
+	return &sensorMetrics{
+		encryptionTime: registry.NewHistogram("fe_encryption_duration_seconds", "Time spent encrypting a batch of samples.",
+			DurationBuckets, "scheme"),
+		encryptionQueueTime: registry.NewHistogram("fe_encryption_queue_duration_seconds", "Time a batch waits for an encryption worker.",
+			DurationBuckets),
+		ciphersSubmitted: registry.NewCounter("fe_ciphers_submitted_total", "Ciphers successfully submitted to the server.",
+			"scheme"),
+		cipherSubmissionFailures: registry.NewCounter("fe_cipher_submission_failures_total", "Ciphers that could not be submitted to the server.",
+			"scheme"),
+		outboxQueued:  registry.NewCounter("fe_outbox_queued_total", "Ciphers queued in the outbox because the server was unreachable."),
+		outboxDropped: registry.NewCounter("fe_outbox_dropped_total", "Ciphers dropped from the outbox, because it was full or the server rejected them."),
+		keyGenerationTime: registry.NewHistogram("fe_keygen_duration_seconds", "Time spent generating FE client keys.",
+			DurationBuckets, "scheme"),
+		deriveKeyTime: registry.NewHistogram("fe_derive_key_duration_seconds", "Time spent deriving FE key shares.",
+			DurationBuckets, "scheme"),
+	}
+}
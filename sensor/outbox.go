@@ -0,0 +1,263 @@
+package sensor
+
+import (
+	"encoding/gob"
+	. "fe/common"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outbox keeps the ciphers that couldn't be submitted because the server is unreachable, and uploads them in order
+// when it's reachable again; while the Outbox isn't empty, new ciphers are queued behind the ones in it. The Outbox
+// is bounded, so when it's full, the oldest cipher is dropped. If dir is set, the ciphers are also written to disk,
+// so they survive a restart of the sensor; the dir must not be shared with another sensor.
+type Outbox struct {
+	dir           string
+	maxSize       int
+	retryInterval time.Duration
+
+	entries   []*OutboxEntry // ordered by Seq
+	seq       uint64
+	uploading bool
+	mutex     sync.Mutex
+
+	sensor  *Sensor
+	metrics *sensorMetrics
+	logger  *Logger
+}
+
+// OutboxEntry is an encoded cipher waiting for upload
+type OutboxEntry struct {
+	Seq      uint64
+	TaskId   UUID
+	SensorId UUID
+	BatchIdx int
+	Cipher   []byte
+	QueuedAt time.Time
+
+	Commitment *BatchCommitment
+}
+
+// NewOutbox creates the Outbox of the sensor, and loads the ciphers left in dir; uploading them starts as soon as
+// the server is set
+func NewOutbox(sensor *Sensor, config *SensorConfig) (*Outbox, error) {
+	outbox := &Outbox{
+		dir:           config.OutboxDir,
+		maxSize:       config.OutboxSize,
+		retryInterval: time.Duration(config.OutboxRetryInterval),
+		entries:       make([]*OutboxEntry, 0),
+		sensor:        sensor,
+		metrics:       sensor.metrics,
+		logger:        GetLogger("outbox", sensor.Logger),
+	}
+
+	if err := outbox.load(); err != nil {
+		return nil, fmt.Errorf("loading outbox failed: %s", err)
+	}
+	if len(outbox.entries) > 0 {
+		outbox.logger.Info("loaded %d ciphers", len(outbox.entries))
+		outbox.startUploading()
+	}
+	return outbox, nil
+}
+
+// Len returns the number of ciphers waiting for upload
+func (o *Outbox) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return len(o.entries)
+}
+
+// Add queues the cipher of batch no batchIdx, with its commitment, for upload
+func (o *Outbox) Add(taskId UUID, sensorId UUID, batchIdx int, cipher []byte, commitment *BatchCommitment) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.seq++
+	entry := &OutboxEntry{
+		Seq:      o.seq,
+		TaskId:   taskId,
+		SensorId: sensorId,
+		BatchIdx: batchIdx,
+		Cipher:   cipher,
+		QueuedAt: o.sensor.Clock.Now(),
+
+		Commitment: commitment,
+	}
+	if err := o.save(entry); err != nil {
+		o.logger.Err(err)
+		o.logger.Warn("cipher no %d of task %s is kept only in memory", batchIdx, taskId)
+	}
+	o.entries = append(o.entries, entry)
+
+	for len(o.entries) > o.maxSize {
+		dropped := o.entries[0]
+		o.logger.Error("outbox is full; dropping cipher no %d of task %s", dropped.BatchIdx, dropped.TaskId)
+		o.metrics.outboxDropped.Inc()
+		o.remove(dropped)
+		if task, err := o.sensor.GetTask(dropped.TaskId); err == nil {
+			task.failBatch(dropped.BatchIdx, "dropped from the full outbox")
+		}
+	}
+
+	o.startUploading()
+}
+
+// startUploading starts the uploader, unless it's already running; the mutex must be held
+func (o *Outbox) startUploading() {
+	if o.uploading {
+		return
+	}
+	o.uploading = true
+	go o.uploader()
+}
+
+// uploader uploads the ciphers from the oldest one, and waits for retryInterval whenever the server is unreachable;
+// it exits when the Outbox is empty
+func (o *Outbox) uploader() {
+	for {
+		o.mutex.Lock()
+		if len(o.entries) == 0 {
+			o.uploading = false
+			o.mutex.Unlock()
+			return
+		}
+		entry := o.entries[0]
+		o.mutex.Unlock()
+
+		server := o.sensor.GetServer()
+		if server == nil {
+			<-o.sensor.Clock.After(o.retryInterval)
+			continue
+		}
+
+		err := server.SubmitCipher(entry.TaskId, entry.SensorId, entry.BatchIdx, entry.Cipher, entry.Commitment)
+		if err != nil && isRetryable(err) {
+			o.logger.Info("server is unreachable, %d ciphers waiting; retrying in %s", o.Len(), o.retryInterval)
+			<-o.sensor.Clock.After(o.retryInterval)
+			continue
+		}
+
+		if err != nil {
+			o.logger.Err(err)
+			o.logger.Error("cipher no %d of task %s has been rejected by the server; dropping it", entry.BatchIdx, entry.TaskId)
+			o.metrics.outboxDropped.Inc()
+			if task, taskErr := o.sensor.GetTask(entry.TaskId); taskErr == nil {
+				task.failBatch(entry.BatchIdx, err.Error())
+			}
+		} else {
+			o.logger.Info("cipher no %d of task %s uploaded %s after it was queued", entry.BatchIdx, entry.TaskId,
+				o.sensor.Clock.Now().Sub(entry.QueuedAt).Round(time.Millisecond))
+			if task, err := o.sensor.GetTask(entry.TaskId); err == nil {
+				task.markSubmitted(entry.BatchIdx)
+			}
+		}
+
+		o.mutex.Lock()
+		o.remove(entry)
+		o.mutex.Unlock()
+	}
+}
+
+// remove removes the entry from memory and disk, if it's still there; the mutex must be held
+func (o *Outbox) remove(entry *OutboxEntry) {
+	for idx, e := range o.entries {
+		if e == entry {
+			o.entries = append(o.entries[:idx], o.entries[idx+1:]...)
+			break
+		}
+	}
+
+	if o.dir != "" {
+		if err := os.Remove(o.entryPath(entry.Seq)); err != nil && !os.IsNotExist(err) {
+			o.logger.Err(err)
+		}
+	}
+}
+
+//region persistence
+
+func (o *Outbox) entryPath(seq uint64) string {
+	return filepath.Join(o.dir, fmt.Sprintf("%020d.gob", seq))
+}
+
+// save writes the entry to dir, through a temporary file, so that an entry is never read half-written
+func (o *Outbox) save(entry *OutboxEntry) error {
+	if o.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(o.dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(o.dir, "entry.*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err = gob.NewEncoder(file).Encode(entry); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), o.entryPath(entry.Seq))
+}
+
+// load reads the entries from dir; the entries that can't be read are skipped
+func (o *Outbox) load() error {
+	if o.dir == "" {
+		return nil
+	}
+
+	files, err := os.ReadDir(o.dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".gob") {
+			continue
+		}
+
+		entry, err := readOutboxEntry(filepath.Join(o.dir, f.Name()))
+		if err != nil {
+			o.logger.Warn("skipping outbox entry %s: %s", f.Name(), err)
+			continue
+		}
+		o.entries = append(o.entries, entry)
+		if entry.Seq > o.seq {
+			o.seq = entry.Seq
+		}
+	}
+
+	sort.Slice(o.entries, func(i, j int) bool {
+		return o.entries[i].Seq < o.entries[j].Seq
+	})
+	return nil
+}
+
+func readOutboxEntry(path string) (*OutboxEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entry := &OutboxEntry{}
+	if err = gob.NewDecoder(file).Decode(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+//endregion
@@ -6,24 +6,33 @@ import (
 	"time"
 )
 
-// StartSampler starts sampler as Runnable goroutine, with samplingDetails, and returns function that stops the sampler.
-// The caller is responsible for closing sampleChan
-func StartSampler(samplingDetails *SamplingParams, sampleChan *chan int, closeChannelFn func(), logger *Logger) (stopFn func()) {
-	samplerHandle := NewRunnable("sampler", logger)
-	stopFn = samplerHandle.Stop
-	go sampler(samplerHandle, samplingDetails, sampleChan, closeChannelFn)
-	return
+// Sample is a reading of the sensor, with the time it was taken at
+type Sample struct {
+	Value     int
+	SampledAt time.Time
+}
+
+// StartSampler starts sampler as Runnable goroutine, with samplingDetails, and returns its Runnable handle;
+// sampling is scheduled on clock, shifted by clockOffset. The sampler closes sampleChan with closeChannelFn when it exits
+func StartSampler(samplingDetails *SamplingParams, clockOffset time.Duration, sampleChan *chan Sample, closeChannelFn func(), clock Clock, logger *Logger) *Runnable {
+	samplerHandle := NewRunnable("sampler", clock, logger)
+	go sampler(samplerHandle, samplingDetails, clockOffset, sampleChan, closeChannelFn)
+	return samplerHandle
 }
 
 // sampler reads the sensor with readSample and writes samples to sampleChan;
-// it reads sampling details (start, period, sampleCount, maxSampleValue) from samplingDetails;
-// it first resets the sensor at *start* time, then it samples the sensor every *period* seconds, *sampleCount* times
-func sampler(r *Runnable, samplingDetails *SamplingParams, sampleChan *chan int, closeChannelFn func()) {
+// it reads sampling details (start, period, sampleCount, sample bounds) from samplingDetails;
+// it first resets the sensor at *start* time, then it samples the sensor every *period* seconds, *sampleCount* times;
+// start is on the server's clock, so it's shifted by clockOffset (the offset of the sensor's clock from the server's).
+// Sample no i is taken at start + (i+1)*period, regardless of when the previous samples were taken, as every sample
+// is billed at the rate of its slot; if the task worker holds sampling back, the samples are buffered until it
+// catches up, so that backpressure never delays a measurement.
+func sampler(r *Runnable, samplingDetails *SamplingParams, clockOffset time.Duration, sampleChan *chan Sample, closeChannelFn func()) {
 
-	start := time.Unix(int64(samplingDetails.Start), 0)
+	start := time.Unix(int64(samplingDetails.Start), 0).Add(clockOffset)
 	period := time.Duration(samplingDetails.SamplingPeriod) * time.Second
 	sampleCount := samplingDetails.BatchCnt * samplingDetails.BatchSize
-	maxSampleValue := samplingDetails.MaxSampleValue
+	minSampleValue, maxSampleValue := samplingDetails.MinSampleValue, samplingDetails.MaxSampleValue
 
 	hwSensor := NewRepeatedSequenceGenerator()
 	if !hardwareSensor.CompareAndSwap(nil, hwSensor) {
@@ -32,43 +41,95 @@ func sampler(r *Runnable, samplingDetails *SamplingParams, sampleChan *chan int,
 
 	var idx int
 
-	r.Start()
+	if exiting := r.Start(); exiting {
+		r.Close()
+		closeChannelFn()
+		return
+	}
 
 	// wait for Start time
-	timeToSleep := start.Sub(Now())
+	timeToSleep := start.Sub(r.Clock.Now())
 	r.Logger.Info("waiting for reset time %d (sleeping %ds)", start.Unix(), int(timeToSleep.Seconds()))
-	time.Sleep(timeToSleep)
+	select {
+	case <-r.Clock.After(timeToSleep):
+	case <-r.ExitChan:
+		r.Close()
+		closeChannelFn()
+		return
+	}
 	// todo if late?
 
-	r.Logger.Info("resetting sampler at %d", Now().Unix())
+	r.Logger.Info("resetting sampler at %d", r.Clock.Now().Unix())
 	hwSensor.Reset(&idx)
 
+	sampledCnt := 0
+	buffered := make([]Sample, 0) // samples the task worker isn't ready for, from the oldest
+	nextSample := r.Clock.After(start.Add(period).Sub(r.Clock.Now()))
+
 	for {
+		// the sampler is done once all the samples are taken and sent
+		if sampledCnt == sampleCount && len(buffered) == 0 && r.GetState() == RunnableRunning {
+			r.Done()
+		}
+
+		// the oldest buffered sample is sent once the task worker is ready for it
+		var out chan Sample
+		var oldest Sample
+		if len(buffered) > 0 {
+			out = *sampleChan
+			oldest = buffered[0]
+		}
+
 		select {
-		case <-time.After(period):
+		case <-nextSample:
 			// if more than one case is possible, case choice is random
 			// when the work is done, sampler is no longer in RunnableRunning, but timer will fire anyway,
 			// and sampler will push new samples instead of exiting
 			// -> check if sampler's still running
 			if r.GetState() != RunnableRunning {
+				nextSample = nil
 				continue
 			}
 
-			// if server reading takes too long, time will be off -> time.After should be used in a separate goroutine
-			// it's ok here
-			*sampleChan <- hwSensor.ReadSample(maxSampleValue, &idx)
-			r.Logger.Info("sampled at %d", Now().Unix())
+			sample := Sample{
+				Value:     hwSensor.ReadSample(minSampleValue, maxSampleValue, &idx),
+				SampledAt: r.Clock.Now(),
+			}
+			r.Logger.Info("sampled at %d", sample.SampledAt.Unix())
+			sampledCnt++
+
+			nextSample = nil
+			if sampledCnt < sampleCount {
+				deadline := start.Add(time.Duration(sampledCnt+1) * period)
+				nextSample = r.Clock.After(deadline.Sub(r.Clock.Now()))
+			}
+
+			// samples are sent in order, so a sample waits behind the buffered ones
+			if len(buffered) == 0 {
+				select {
+				case *sampleChan <- sample:
+					continue
+				default:
+					r.Logger.Warn("sample chan is full; samples are buffered")
+				}
+			}
+			buffered = append(buffered, sample)
 
-			sampleCount--
-			if sampleCount == 0 {
-				r.Done()
+		case out <- oldest:
+			buffered = buffered[1:]
+			if len(buffered) == 0 {
+				r.Logger.Info("buffered samples sent")
 			}
 
 		case <-r.ExitChan:
+			if len(buffered) > 0 {
+				r.Logger.Warn("%d buffered samples dropped", len(buffered))
+			}
 			r.Close()
 			closeChannelFn()
 			return
 		}
+
 	}
 
 }
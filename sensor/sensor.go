@@ -3,24 +3,81 @@ package sensor
 import (
 	. "fe/common"
 	"fmt"
+	"runtime"
 	"sync"
 )
 
 type Sensor struct {
-	Id         UUID `json:"id"`
-	CustomerId UUID // todo can this be nil on the server?
-	Server     *Server
-	tasks      sync.Map
+	Id             UUID         `json:"id"`
+	CustomerId     UUID         // todo can this be nil on the server?
+	auditTokenHash string       // of the customer's audit token, see disclosure.go
+	customerMutex  sync.RWMutex // guards CustomerId and auditTokenHash, which are set by a request
+	Server         *Server      // never modified once set, as a new credential replaces it (see setServerCredential)
+	serverMutex    sync.RWMutex // guards Server, which is set by a request
+	tasks          sync.Map
 
 	*Host[Task]
+
+	config         *SensorConfig
+	metrics        *sensorMetrics
+	encryptionPool *EncryptionPool
+	outbox         *Outbox
 }
 
-func InitSensor() *Sensor {
+func InitSensor(config *SensorConfig, clock Clock) (*Sensor, error) {
+	var err error
 	sensor := &Sensor{
-		Id: NewUUID(),
+		Id:     NewUUID(),
+		config: config,
+	}
+	sensor.Host, err = InitHost[Task](&config.HostConfig, clock, sensor.GetEndpoints())
+	if err != nil {
+		return nil, err
+	}
+	sensor.metrics = newSensorMetrics(sensor.Metrics)
+
+	// only the operator may configure the sensor; the endpoints the server calls are public
+	authenticator, err := NewAuthenticator(&config.AuthConfig, sensor.Clock)
+	if err != nil {
+		return nil, err
+	}
+	if authenticator == nil {
+		sensor.Logger.Warn("no API keys or JWT secret are configured, the endpoints are unauthenticated")
+	}
+	sensor.HttpServer.SetAuthenticator(authenticator)
+
+	encryptionWorkers := config.EncryptionWorkers
+	if encryptionWorkers == 0 {
+		encryptionWorkers = runtime.NumCPU()
 	}
-	sensor.Host = InitHost[Task](SensorLogDir, SensorLogFilename, SensorTaskChanSize, sensor.GetEndpoints())
-	return sensor
+	sensor.encryptionPool = NewEncryptionPool(encryptionWorkers, sensor.metrics, sensor.Logger)
+	sensor.Metrics.NewGaugeFunc("fe_encryption_queue_depth", "Number of batches waiting for an encryption worker.",
+		func() float64 { return float64(sensor.encryptionPool.QueueLen()) })
+
+	sensor.Logger = sensor.Logger.WithField(SensorIdField, sensor.Id)
+	sensor.HttpLogger = sensor.HttpLogger.WithField(SensorIdField, sensor.Id)
+
+	sensor.outbox, err = NewOutbox(sensor, config)
+	if err != nil {
+		return nil, err
+	}
+	sensor.Metrics.NewGaugeFunc("fe_outbox_size", "Number of ciphers waiting for upload.",
+		func() float64 { return float64(sensor.outbox.Len()) })
+	return sensor, nil
+}
+
+// GetCustomerId returns the id of the sensor's customer, which is nil until the customer is set
+func (sensor *Sensor) GetCustomerId() UUID {
+	sensor.customerMutex.RLock()
+	defer sensor.customerMutex.RUnlock()
+	return sensor.CustomerId
+}
+
+// GetServer returns the sensor's server, which is nil until the server is set
+func (sensor *Sensor) GetServer() *Server {
+	sensor.serverMutex.RLock()
+	defer sensor.serverMutex.RUnlock()
+	return sensor.Server
 }
 
 func (sensor *Sensor) AddTask(task *Task) {
@@ -1,8 +1,9 @@
 package sensor
 
 import (
+	"errors"
+	"fe/client"
 	. "fe/common"
-	"fmt"
 	"net/http"
 )
 
@@ -20,42 +21,60 @@ func (sensor *Sensor) NewServer(ip IP) *Server {
 	}
 }
 
-// Register registers the sensor to the server.
-func (s *Server) Register(sensor *Sensor) {
-	//method := "POST"
-	url := "/customer/" + string(sensor.CustomerId) + "/sensor"
-	body := RegisterSensorRequest{
-		SensorId: sensor.Id,
-		IP:       *sensor.IP,
-	}
-
-	statusCode, responseBody, err := s.POST(url, body, BodyJSON)
-	if err != nil {
-		return
+// serverCredential returns the sensor's credential for the server, which it authenticates to the authority with too
+func (sensor *Sensor) serverCredential() string {
+	server := sensor.GetServer()
+	if server == nil {
+		return ""
 	}
+	return server.Credential
+}
 
-	fmt.Printf("status code: %d\n", statusCode)
-	fmt.Printf("response body: %s\n", responseBody)
+// setServerCredential replaces the sensor's Server by a copy with the credential, so that the Servers in use by the
+// uploads aren't modified; it returns nil if the server isn't set
+func (sensor *Sensor) setServerCredential(credential string) *Server {
+	sensor.serverMutex.Lock()
+	defer sensor.serverMutex.Unlock()
 
+	if sensor.Server == nil {
+		return nil
+	}
+	remote := *sensor.Server.RemoteHttpServer
+	remote.Credential = credential
+	sensor.Server = &Server{RemoteHttpServer: &remote}
+	return sensor.Server
 }
 
-// SubmitCipher sends encrypted data to the server.
-func (s *Server) SubmitCipher(taskId UUID, sensorId UUID, cipher FECipher) error {
-	//method := "POST"
-	url := "/task/" + string(taskId) + "/" + string(sensorId)
-	data, err := Encode(cipher)
+// Register adds the sensor to its customer on the server, with the server's credential; if the server issues the
+// sensor its API key, the key replaces the credential.
+func (s *Server) Register(sensor *Sensor) error {
+	apiKey, err := client.NewServer(s.RemoteHttpServer).AddSensor(sensor.GetCustomerId(), RegisterSensorRequest{
+		SensorId:  sensor.Id,
+		IP:        *sensor.IP,
+		PublicKey: sensor.Signer.PublicKey(),
+	})
 	if err != nil {
 		return err
 	}
 
-	statusCode, _, err := s.POST(url, data, BodyOctetStream)
-	if err != nil {
-		return err
+	if apiKey != "" {
+		sensor.setServerCredential(apiKey)
 	}
+	return nil
+}
 
-	// successful submission returns status code http.StatusAccepted
-	if statusCode != http.StatusAccepted {
-		return fmt.Errorf("wrong status code, expected %d, got %d", http.StatusAccepted, statusCode)
+// isRetryable reports whether submitting a cipher that failed with err can succeed later: the server is unreachable
+// or fails, as opposed to rejecting the cipher
+func isRetryable(err error) bool {
+	var rejected *APIError
+	if errors.As(err, &rejected) {
+		return rejected.Status >= http.StatusInternalServerError
 	}
-	return err
+	return true
+}
+
+// SubmitCipher sends the encoded cipher of batch no batchIdx, with its commitment, to the server; the ciphers queued
+// in the outbox by an older sensor have no commitment.
+func (s *Server) SubmitCipher(taskId UUID, sensorId UUID, batchIdx int, cipher []byte, commitment *BatchCommitment) error {
+	return client.NewServer(s.ForTask(taskId)).SubmitCipher(taskId, sensorId, batchIdx, cipher, commitment)
 }
@@ -0,0 +1,151 @@
+package sensor
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"slices"
+	"time"
+)
+
+// With SchemeDecentralizedDMCFE, the authority isn't used; the sensor generates the keys of its own clients,
+// sets their shares when the server sends the public keys of all the clients, and derives key shares only for
+// the rates it approves.
+
+// SetupDMCFEClients generates the DMCFE clients of the sensor, one for every sample of a batch
+func (t *Task) SetupDMCFEClients() error {
+	if t.dmcfe == nil {
+		return fmt.Errorf("task %s has no DMCFE params", t.Id)
+	}
+
+	start := time.Now()
+	clients := make([]*fullysec.DMCFEClient, t.BatchSize)
+	for idx := range clients {
+		client, err := fullysec.NewDMCFEClient(t.dmcfe.SensorIdx*t.BatchSize + idx)
+		if err != nil {
+			return err
+		}
+		clients[idx] = client
+	}
+	elapsed := time.Since(start)
+	t.metrics.keyGenerationTime.ObserveDuration(elapsed, t.Scheme)
+	t.logger.Info("DMCFE clients generated in %d ns", elapsed.Nanoseconds())
+
+	t.dmcfeClients = clients
+	return nil
+}
+
+// GetDMCFEPubKeys returns the public keys of the sensor's clients
+func (t *Task) GetDMCFEPubKeys() *DMCFEPubKeys {
+	pubKeys := make([]*bn256.G1, len(t.dmcfeClients))
+	for idx, client := range t.dmcfeClients {
+		pubKeys[idx] = client.ClientPubKey
+	}
+	return &DMCFEPubKeys{PubKeys: pubKeys}
+}
+
+// SetDMCFEPubKeys sets the shares of the sensor's clients from the public keys of all the clients, and sets
+// the encryptor; it can be called only once
+func (t *Task) SetDMCFEPubKeys(pubKeys *DMCFEPubKeys) error {
+	t.dmcfeMutex.Lock()
+	defer t.dmcfeMutex.Unlock()
+
+	if t.encryptionParamsFetched.Load() {
+		return fmt.Errorf("public keys of task %s are already set", t.Id)
+	}
+
+	clientCnt := t.dmcfe.SensorCnt * t.BatchSize
+	if len(pubKeys.PubKeys) != clientCnt {
+		return fmt.Errorf("expected %d public keys, got %d", clientCnt, len(pubKeys.PubKeys))
+	}
+
+	for idx, pubKey := range pubKeys.PubKeys {
+		if pubKey == nil {
+			return fmt.Errorf("public key of client no %d is missing", idx)
+		}
+	}
+
+	// the server must not replace the keys of the sensor's own clients
+	for _, client := range t.dmcfeClients {
+		if pubKeys.PubKeys[client.Idx].String() != client.ClientPubKey.String() {
+			return fmt.Errorf("public key of client no %d doesn't match", client.Idx)
+		}
+	}
+
+	for _, client := range t.dmcfeClients {
+		if err := client.SetShare(pubKeys.PubKeys); err != nil {
+			return err
+		}
+	}
+
+	t.encryptor = &DMCFEEncryptor{
+		SensorIdx: t.dmcfe.SensorIdx,
+		Clients:   t.dmcfeClients,
+		Label:     string(t.Id),
+		logger:    GetLogger("fe encryptor", t.logger),
+	}
+	t.encryptionParamsFetched.Store(true)
+	close(t.dmcfeShares)
+	t.events.Publish(eventEncryptionParams, nil)
+	t.logger.Info("DMCFE shares set")
+	return nil
+}
+
+// ApproveRates approves the rates if they are within the bounds of the task, and if no other rates have been
+// approved; as key shares are derived only for the approved rates, the server can't decrypt any other function
+// of the samples
+func (t *Task) ApproveRates(rates []int) error {
+	t.dmcfeMutex.Lock()
+	defer t.dmcfeMutex.Unlock()
+
+	if t.approvedRates != nil {
+		if !slices.Equal(t.approvedRates, rates) {
+			return fmt.Errorf("other rates have already been approved for task %s", t.Id)
+		}
+		return nil
+	}
+
+	if len(rates) != t.BatchCnt*t.BatchSize {
+		return fmt.Errorf("expected %d rates, got %d", t.BatchCnt*t.BatchSize, len(rates))
+	}
+	for idx, rate := range rates {
+		if rate < t.dmcfe.MinRateValue || rate > t.dmcfe.MaxRateValue {
+			return fmt.Errorf("rate no %d (%d) is out of range [%d, %d]", idx, rate, t.dmcfe.MinRateValue, t.dmcfe.MaxRateValue)
+		}
+	}
+
+	t.approvedRates = rates
+	t.logger.Info("rates approved")
+	return nil
+}
+
+// DeriveDMCFEKeyShares derives the key shares of the sensor's clients for the approved rates
+func (t *Task) DeriveDMCFEKeyShares() (*DMCFEKeyShares, error) {
+	if !t.encryptionParamsFetched.Load() {
+		return nil, fmt.Errorf("public keys of task %s are not set", t.Id)
+	}
+
+	t.dmcfeMutex.Lock()
+	rates := t.approvedRates
+	t.dmcfeMutex.Unlock()
+	if rates == nil {
+		return nil, fmt.Errorf("no rates have been approved for task %s", t.Id)
+	}
+
+	matrix, err := DMCFERates(rates, t.dmcfe.SensorCnt, t.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	keyShares, err := DeriveDMCFEKeyShares(t.dmcfeClients, matrix)
+	elapsed := time.Since(start)
+	t.metrics.deriveKeyTime.ObserveDuration(elapsed, t.Scheme)
+	t.logger.Info("DMCFE key shares derived in %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	return &DMCFEKeyShares{KeyShares: keyShares}, nil
+}
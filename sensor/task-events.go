@@ -0,0 +1,85 @@
+package sensor
+
+import (
+	. "fe/common"
+	"time"
+)
+
+// The task publishes its events to its EventLog, which is streamed at GET /v1/tasks/:id/events. Every batch ends up
+// either submitted or failed (as its encryption or submission failed, or its cipher has been dropped from the
+// outbox); the stream ends when all the batches have, or when the task worker is stopped.
+
+const (
+	eventCreated          = "created"           // the task has been created
+	eventEncryptionParams = "encryption_params" // the encryption params have been fetched, or set up
+	eventSampled          = "sampled"           // a batch has been sampled; batchEvent
+	eventEncrypted        = "encrypted"         // a batch has been encrypted; encryptedEvent
+	eventQueued           = "queued"            // a cipher has been queued in the outbox; batchEvent
+	eventSubmitted        = "submitted"         // a cipher has been accepted by the server; batchEvent
+	eventFailed           = "failed"            // a batch won't be submitted; failedEvent
+	eventDone             = "done"              // all the batches have been submitted or have failed; doneEvent
+	eventStopped          = "stopped"           // the task worker has been stopped; doneEvent
+)
+
+type batchEvent struct {
+	Batch int `json:"batch"`
+}
+
+type encryptedEvent struct {
+	Batch          int   `json:"batch"`
+	QueueTime      int64 `json:"queue_time"`      // in nanoseconds
+	EncryptionTime int64 `json:"encryption_time"` // in nanoseconds
+}
+
+type failedEvent struct {
+	Batch  int    `json:"batch"`
+	Reason string `json:"reason"`
+}
+
+type doneEvent struct {
+	Sampled   int `json:"sampled"`
+	Encrypted int `json:"encrypted"`
+	Submitted int `json:"submitted"`
+}
+
+// publishEncrypted publishes that batch no batchIdx has been encrypted
+func (t *Task) publishEncrypted(batchIdx int, queueTime, encryptionTime time.Duration) {
+	t.events.Publish(eventEncrypted, encryptedEvent{
+		Batch:          batchIdx,
+		QueueTime:      queueTime.Nanoseconds(),
+		EncryptionTime: encryptionTime.Nanoseconds(),
+	})
+}
+
+// failBatch publishes that batch no batchIdx won't be submitted
+func (t *Task) failBatch(batchIdx int, reason string) {
+	t.events.Publish(eventFailed, failedEvent{Batch: batchIdx, Reason: reason})
+	t.settleBatch()
+}
+
+// settleBatch records that a batch has been submitted or has failed, and ends the stream after the last one
+func (t *Task) settleBatch() {
+	if int(t.settledBatchesCnt.Add(1)) == t.BatchCnt {
+		t.events.Publish(eventDone, t.doneEvent())
+		t.events.Close()
+	}
+}
+
+// stopEvents ends the stream when the task worker is stopped
+func (t *Task) stopEvents() {
+	t.events.Publish(eventStopped, t.doneEvent())
+	t.events.Close()
+}
+
+func (t *Task) doneEvent() doneEvent {
+	return doneEvent{
+		Sampled:   int(t.sampledBatchesCnt.Load()),
+		Encrypted: int(t.encryptedBatchesCnt.Load()),
+		Submitted: int(t.submittedBatchesCnt.Load()),
+	}
+}
+
+// Events returns a stream of the task's events after the event with id lastEventId
+func (t *Task) Events(lastEventId int) *EventStream {
+	return t.events.Subscribe(lastEventId)
+}
@@ -2,56 +2,139 @@ package sensor
 
 import (
 	. "fe/common"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
 // StartTaskWorker starts taskWorker as a Runnable goroutine, for provided task,
 // and it populates Task.stopFn with function that stops the taskWorker
-func StartTaskWorker(task *Task) {
-	taskWorkerHandle := NewRunnable("task worker", task.logger)
+func StartTaskWorker(task *Task) *Runnable {
+	taskWorkerHandle := NewRunnable("task worker "+string(task.Id), task.clock, task.logger)
 	task.stopFn = taskWorkerHandle.Stop
 	go taskWorker(taskWorkerHandle, task)
-	return
+	return taskWorkerHandle
 }
 
 // taskWorker collects the sampled data, groups it into batches, encrypts batches and submits cyphers to the server.
 func taskWorker(r *Runnable, task *Task) {
-	r.Start()
+	if exiting := r.Start(); exiting {
+		r.Close()
+		return
+	}
+
+	// closed when the task worker is stopped, in order to cancel encryption and submission that haven't started yet
+	stopEncryption := make(chan bool)
+	stopSubmission := make(chan bool)
 
 	encryptionParamsFetched := make(chan bool, 1)
-	// fetch encryption params
+	// fetch encryption params; with the decentralized scheme, they are set by the server, so there's nothing to poll
 	go func() {
 		for {
 			if ok := task.FetchEncryptionParams(); ok {
 				encryptionParamsFetched <- true
 				return
 			}
-			time.Sleep(EncryptionParamsPollingInterval)
+
+			var polling <-chan time.Time
+			if UsesAuthority(task.Scheme) {
+				polling = task.clock.After(time.Duration(task.config.EncryptionParamsPollingInterval))
+			}
+			select {
+			case <-polling:
+			case <-task.dmcfeShares:
+			case <-stopEncryption:
+				return
+			}
 		}
 	}()
 
 	// start sampling
-	stopSampler := StartSampler(&task.SamplingParams, &task.samplingChan, task.CloseSamplingChan, task.logger)
+	sampler := StartSampler(&task.SamplingParams, task.clockOffset, &task.samplingChan, task.CloseSamplingChan, task.clock, task.logger)
 
 	// do not close these channels, close them through task
 	samplingChan := task.samplingChan     // chan to wait on for new samples
 	encryptionChan := task.encryptionChan // chan to wait on for encrypted batches
 
-	// http request rate limiting and cancelling
-	rateLimiter := make(chan bool, MaxParallelSubmissionsPerSensor)
-	for i := 0; i < MaxParallelSubmissionsPerSensor; i++ {
+	// http request rate limiting
+	maxParallelSubmissions := task.config.MaxParallelSubmissions
+	rateLimiter := make(chan bool, maxParallelSubmissions)
+	for i := 0; i < maxParallelSubmissions; i++ {
 		rateLimiter <- true
 	}
 
-	// http request cancelling in case the task daemon has been stopped
-	cancelSubmission := make(chan bool, MaxParallelSubmissionsPerSensor)
-	var submissionCancelled atomic.Bool
-	submissionCancelled.Store(false)
+	// batches that are waiting for encryption (or being encrypted), and ciphers waiting for submission (or being submitted)
+	var encryptionWg, submissionWg sync.WaitGroup
+	allSubmitted := make(chan bool, 1)
+
+	// batches are queued for the encryption pool once the encryption params are fetched; until then, they are pending.
+	// When maxQueuedBatches batches are pending or queued, samples aren't read any more, so the sampler buffers them
+	// until the pool catches up; the samples are still taken on schedule
+	pending := make([]int, 0)
+	queuedCnt := 0
+	maxQueuedBatches := task.config.MaxQueuedBatches
+	encryptionStarted := make(chan bool, task.BatchCnt) // a batch is taken from the queue by a worker
+	backpressure := false
+	paramsFetchedChan := encryptionParamsFetched // nil once the params are fetched
+
+	queueBatch := func(batchIdx int) {
+		task.encryptionPool.Submit(task.batches[batchIdx].sampledAt, func(queueTime time.Duration) {
+			encryptionStarted <- true
+
+			// cancelled while in the queue
+			select {
+			case <-stopEncryption:
+				encryptionWg.Done()
+				return
+			default:
+			}
+
+			task.batches[batchIdx].queueTime = queueTime
+			ok := task.EncryptBatch(batchIdx)
+
+			// added before encryptionWg.Done(), so that submissionWg.Wait() doesn't miss this cipher
+			submissionWg.Add(1)
+			encryptionWg.Done()
+
+			if !ok {
+				r.Logger.Info("could not encrypt batch no %d of task %s; aborting...", batchIdx, task.Id)
+				submissionWg.Done()
+				return
+			}
+
+			// submission doesn't hold up the encryption worker
+			go func() {
+				defer submissionWg.Done()
+
+				// either gets a token for submitting a cipher, or gets cancelled
+				select {
+				case <-rateLimiter:
+					// send the cipher to the server
+					if ok := task.SubmitCipher(batchIdx); !ok {
+						r.Logger.Info("could not submit cipher no %d of task %s; aborting...", batchIdx, task.Id)
+					}
+					rateLimiter <- true
+				case <-stopSubmission:
+				}
+			}()
+		})
+	}
 
 	for {
+		// backpressure
+		samples := samplingChan
+		if maxQueuedBatches > 0 && queuedCnt >= maxQueuedBatches {
+			samples = nil
+			if !backpressure {
+				r.Logger.Warn("%d batches are waiting for encryption; samples are buffered by the sampler", queuedCnt)
+			}
+			backpressure = true
+		} else if backpressure {
+			r.Logger.Info("reading samples is resumed")
+			backpressure = false
+		}
+
 		select {
-		case sample, notEnd := <-samplingChan:
+		case sample, notEnd := <-samples:
 
 			if !notEnd {
 				// done, all samples received
@@ -64,64 +147,68 @@ func taskWorker(r *Runnable, task *Task) {
 			// no need to do this in goroutine, TaskWorker will be able to keep up with all the incoming samples
 			task.AddSample(sample)
 
+		case <-paramsFetchedChan:
+			paramsFetchedChan = nil
+			r.Logger.Info("encryption params fetched; queueing %d pending batches", len(pending))
+			for _, batchIdx := range pending {
+				queueBatch(batchIdx)
+			}
+			pending = nil
+
+		case <-encryptionStarted:
+			queuedCnt--
+
 		case idx, notEnd := <-encryptionChan:
 			if !notEnd {
 				// done, all batches collected
 				encryptionChan = nil
-				r.Logger.Info("all batches collected & encrypted")
-				r.Done()
+				r.Logger.Info("all batches collected")
+
+				// the worker is done when all the collected batches are encrypted and submitted
+				go func() {
+					encryptionWg.Wait()
+					submissionWg.Wait()
+					allSubmitted <- true
+				}()
 				continue
 			}
 
-			// do this in goroutine, as it could take up much time
-			// in logger, it will still be displayed as TaskWorker
-			// no need for Runnable as it will not be waiting on channels in a loop
-			go func(batchIdx int) {
-				// wait until encryption params are fetched
-				<-encryptionParamsFetched
-				encryptionParamsFetched <- true
-
-				// encrypt the batch
-				ok := task.EncryptBatch(batchIdx)
-				if !ok {
-					r.Logger.Info("could not encrypt batch no %d of task %s; aborting...", batchIdx, task.Id)
-				}
-
-				// either gets a token for submitting a cipher, or gets cancelled
-				select {
-				case <-rateLimiter:
-					// send the cipher to the server
-					task.SubmitCipher(batchIdx)
-					if !ok {
-						r.Logger.Info("could not submit cipher no %d of task %s; aborting...", batchIdx, task.Id)
-					}
-
-					// if the submission is not cancelled, return the token
-					// if it is, do not return it, so that other goroutines don't start submitting (using this token)
-					if !submissionCancelled.Load() {
-						rateLimiter <- true
-					}
-				case <-cancelSubmission:
-					cancelSubmission <- true
-				}
+			encryptionWg.Add(1)
+			queuedCnt++
+			if pending != nil {
+				pending = append(pending, idx)
+			} else {
+				queueBatch(idx)
+			}
 
-			}(idx)
+		case <-allSubmitted:
+			r.Logger.Info("all batches encrypted & submitted")
+			r.Done()
 
 		case <-r.ExitChan:
 			// CRITICAL -> setting encryptionChan to nil so as fewer batches as possible start encryption
 			encryptionChan = nil
 
-			stopSampler()              // if sampler isn't done, this will stop it, and make it close its chan
+			// if the worker has been stopped, pending work is stopped in order: sampler -> encryption -> submission;
+			// batches that are already being encrypted or submitted are waited for
+
+			sampler.Stop() // if sampler isn't done, this will stop it, and make it close its chan
+			<-sampler.Closed()
 			task.CloseEncryptionChan() // already closed if task.AddSample() is called for all task.sampleCnt samples
 
-			submissionCancelled.Store(true)
-			for i := 0; i < MaxParallelSubmissionsPerSensor; i++ {
-				cancelSubmission <- true
+			// pending batches never get to the pool, while the queued ones are cancelled by the workers
+			close(stopEncryption)
+			for range pending {
+				encryptionWg.Done()
 			}
+			encryptionWg.Wait()
+
+			close(stopSubmission)
+			submissionWg.Wait()
 
-			// task may be completed, stopped(cancelled), or failed
-			// todo set task status
 			task.cleanup()
+			task.stopEvents()
+			r.Logger.Info("%d batches sampled, %d encrypted, %d submitted", task.sampledBatchesCnt.Load(), task.encryptedBatchesCnt.Load(), task.submittedBatchesCnt.Load())
 			r.Close()
 			return
 		}
@@ -3,13 +3,15 @@ package sensor
 import (
 	"encoding/json"
 	. "fe/common"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type Task struct {
 	Id       UUID   `json:"id"`
-	SensorId UUID   `json:"sensorId"`
+	SensorId UUID   `json:"sensor_id"`
 	stopFn   func() // stops TaskWorker execution when called
 
 	batches []Batch
@@ -17,22 +19,40 @@ type Task struct {
 	// sampling
 	SamplingParams
 	sampledBatchesCnt atomic.Int32 // atomic, if queried by another goroutine for task status
-	samplingChan      chan int
-	addingSampleMutex sync.Mutex // only in case of multiple goroutines calling AddSample
+	samplingChan      chan Sample
+	addingSampleMutex sync.Mutex    // only in case of multiple goroutines calling AddSample
+	clockOffset       time.Duration // the sampling schedule is shifted by clockOffset, if compensation is enabled
 
 	// encryption
+	Scheme                  string `json:"scheme"`
 	encryptor               FEEncryptor
 	encryptionParamsFetched atomic.Bool
 	encryptedBatchesCnt     atomic.Int32 // atomic, if queried by another goroutine for task status
 	encryptionChan          chan int
 	encryptionChanClosed    atomic.Bool
+	encryptionPool          *EncryptionPool
+
+	// decentralized DMCFE, set only for SchemeDecentralizedDMCFE
+	dmcfe         *DMCFETaskParams
+	dmcfeClients  []*fullysec.DMCFEClient
+	approvedRates []int
+	dmcfeMutex    sync.Mutex // guards setting the shares and approving the rates
+	dmcfeShares   chan bool  // closed when the shares are set, so the task worker doesn't have to poll for them
 
 	// submission
 	server              *Server
 	authority           *Authority
 	submittedBatchesCnt atomic.Int32
+	outbox              *Outbox
+
+	events            *EventLog    // see task-events.go
+	settledBatchesCnt atomic.Int32 // batches that have been submitted or have failed
 
-	logger *Logger
+	config  *SensorConfig
+	signer  *Signer
+	clock   Clock
+	metrics *sensorMetrics
+	logger  *Logger
 }
 
 // NewTask creates a new Task from common.SensorTaskRequest
@@ -44,16 +64,27 @@ func (sensor *Sensor) NewTask(taskRequest *SensorTaskRequest) *Task {
 		batches: make([]Batch, taskRequest.BatchCnt),
 
 		SamplingParams: taskRequest.SamplingParams,
-		samplingChan:   make(chan int, taskRequest.BatchSize*SensorSamplingChanSizeCoeff),
+		Scheme:         taskRequest.Scheme,
+		dmcfe:          taskRequest.DMCFE,
+		dmcfeShares:    make(chan bool),
+		samplingChan:   make(chan Sample, taskRequest.BatchSize*sensor.config.SamplingChanSizeCoeff),
 
-		encryptionChan: make(chan int, taskRequest.BatchCnt*SensorEncryptionChanSizeCoeff),
-		logger:         GetLoggerForFile("", string(taskRequest.TaskId)),
+		encryptionChan: make(chan int, taskRequest.BatchCnt*sensor.config.EncryptionChanSizeCoeff),
+		config:         sensor.config,
+		signer:         sensor.Signer,
+		clock:          sensor.Clock,
+		metrics:        sensor.metrics,
+		encryptionPool: sensor.encryptionPool,
+		logger:         GetLoggerForFile("", string(taskRequest.TaskId)).WithField(TaskIdField, taskRequest.TaskId).WithField(SensorIdField, sensor.Id),
 
-		server: sensor.Server,
+		server: sensor.GetServer(),
+		outbox: sensor.outbox,
+		events: NewEventLog(sensor.Clock),
 		authority: &Authority{
 			RemoteHttpServer: &RemoteHttpServer{
-				IP:     taskRequest.AuthorityIP,
-				Logger: GetLogger("authority", sensor.Logger),
+				IP:         taskRequest.AuthorityIP,
+				Logger:     GetLogger("authority", sensor.Logger),
+				Credential: sensor.serverCredential(),
 			},
 		},
 	}
@@ -62,7 +93,13 @@ func (sensor *Sensor) NewTask(taskRequest *SensorTaskRequest) *Task {
 		task.batches[idx].InitBatch(idx, taskRequest.BatchSize)
 	}
 
+	if sensor.config.CompensateClockOffset {
+		task.clockOffset = time.Duration(taskRequest.ClockOffset)
+		task.logger.Info("compensating clock offset of %s", task.clockOffset)
+	}
+
 	task.logger.Info("task created")
+	task.events.Publish(eventCreated, nil)
 	taskRequestJson, _ := json.MarshalIndent(taskRequest, "", "  ")
 	task.logger.Info("Task params: %s", string(taskRequestJson))
 	sensor.AddTask(task)
@@ -70,16 +107,18 @@ func (sensor *Sensor) NewTask(taskRequest *SensorTaskRequest) *Task {
 }
 
 // AddSample adds a new sample to the next incomplete batch. If the batch is full, submits it for encryption.
-func (t *Task) AddSample(sample int) {
+func (t *Task) AddSample(sample Sample) {
 	t.addingSampleMutex.Lock()
 	defer t.addingSampleMutex.Unlock()
 
 	currentBatchIdx := int(t.sampledBatchesCnt.Load())
 	currentBatch := &t.batches[currentBatchIdx]
-	currentBatchFull := currentBatch.AddSample(sample)
+	currentBatchFull := currentBatch.AddSample(sample.Value)
 
 	if currentBatchFull {
+		currentBatch.sampledAt = sample.SampledAt
 		sampledBatchesCnt := int(t.sampledBatchesCnt.Add(1))
+		t.events.Publish(eventSampled, batchEvent{Batch: currentBatchIdx})
 		t.encryptionChan <- currentBatchIdx
 		if sampledBatchesCnt == t.BatchCnt {
 			t.CloseEncryptionChan() // this is the signal that there won't be any more batches
@@ -95,33 +134,87 @@ func (t *Task) EncryptBatch(batchIdx int) bool {
 	if err != nil {
 		t.logger.Err(err)
 		t.logger.Info("encryption of batch no %d failed", batchIdx)
+		t.failBatch(batchIdx, "encryption failed")
 		return false
 	}
 	batch.cipher = cipher
 	batch.encryptionTime = elapsedTime
+	t.logger.Info("batch no %d: queue time: %d ns, encryption time: %d ns", batchIdx, batch.queueTime.Nanoseconds(), elapsedTime.Nanoseconds())
+	t.metrics.encryptionTime.ObserveDuration(elapsedTime, t.encryptor.Scheme())
 	t.encryptedBatchesCnt.Add(1)
+	t.publishEncrypted(batchIdx, batch.queueTime, elapsedTime)
 
 	//t.logger.Info("encryption of batch no %d successful", batchIdx)
 	return true
 }
 
+// SubmitCipher sends the cipher of batch no batchIdx to the server; if the server is unreachable, or other ciphers
+// are already waiting for it, the cipher is queued in the outbox, to keep the order of submissions
 func (t *Task) SubmitCipher(batchIdx int) bool {
 
 	t.logger.Info("submitting cipher no %d", batchIdx)
 
 	batch := &t.batches[batchIdx]
-	err := t.server.SubmitCipher(t.Id, t.SensorId, batch.cipher)
+	data, err := Encode(batch.cipher)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Info("encoding of cipher no %d failed", batchIdx)
+		t.failBatch(batchIdx, "encoding failed")
+		return false
+	}
+
+	commitment, err := t.commit(batchIdx, data)
 	if err != nil {
+		t.logger.Err(err)
+		t.logger.Info("committing to batch no %d failed", batchIdx)
+		t.failBatch(batchIdx, "committing failed")
+		return false
+	}
+
+	if t.outbox.Len() > 0 {
+		t.queueCipher(batchIdx, data, commitment)
+		return true
+	}
+
+	err = t.server.SubmitCipher(t.Id, t.SensorId, batchIdx, data, commitment)
+	if err != nil && isRetryable(err) {
+		t.logger.Warn("submission of cipher no %d failed: %s", batchIdx, err)
+		t.metrics.cipherSubmissionFailures.Inc(t.encryptor.Scheme())
+		t.queueCipher(batchIdx, data, commitment)
+		return true
+	} else if err != nil {
 		t.logger.Err(err)
 		t.logger.Info("submission of cipher no %d failed", batchIdx)
+		t.metrics.cipherSubmissionFailures.Inc(t.encryptor.Scheme())
+		t.failBatch(batchIdx, err.Error())
 		return false
 	}
-	t.submittedBatchesCnt.Add(1)
 
+	t.markSubmitted(batchIdx)
 	t.logger.Info("submission of cipher no %d successful", batchIdx)
 	return true
 }
 
+// queueCipher queues the encoded cipher of batch no batchIdx, with its commitment, in the outbox, which uploads
+// it later
+func (t *Task) queueCipher(batchIdx int, data []byte, commitment *BatchCommitment) {
+	t.logger.Info("cipher no %d queued in the outbox", batchIdx)
+	t.metrics.outboxQueued.Inc()
+	t.events.Publish(eventQueued, batchEvent{Batch: batchIdx})
+	t.outbox.Add(t.Id, t.SensorId, batchIdx, data, commitment)
+}
+
+// markSubmitted records that the cipher of batch no batchIdx has been accepted by the server
+func (t *Task) markSubmitted(batchIdx int) {
+	if t.batches[batchIdx].isSubmitted.Swap(true) {
+		return
+	}
+	t.submittedBatchesCnt.Add(1)
+	t.metrics.ciphersSubmitted.Inc(t.encryptor.Scheme())
+	t.events.Publish(eventSubmitted, batchEvent{Batch: batchIdx})
+	t.settleBatch()
+}
+
 // CloseSamplingChan closes the samplingChan
 func (t *Task) CloseSamplingChan() {
 	close(t.samplingChan)
@@ -142,8 +235,8 @@ func (t *Task) cleanup() {
 	// todo add cleanup
 }
 
-func (t *Task) GetSamples() [][]int32 {
-	samples := make([][]int32, 0)
+func (t *Task) GetSamples() [][]int64 {
+	samples := make([][]int64, 0)
 	for idx := 0; idx < t.BatchCnt; idx++ {
 		samplesFromBatch := t.batches[idx].GetSamples()
 		if samplesFromBatch == nil {
@@ -155,6 +248,11 @@ func (t *Task) GetSamples() [][]int32 {
 }
 
 func (t *Task) FetchEncryptionParams() bool {
+	if !UsesAuthority(t.Scheme) {
+		// the encryptor is set when the server sends the public keys of all the clients
+		return t.encryptionParamsFetched.Load()
+	}
+
 	feEncryptionParams, err := t.authority.GetEncryptionParams(t.Id, t.SensorId)
 	if err != nil {
 		t.logger.Err(err)
@@ -163,5 +261,6 @@ func (t *Task) FetchEncryptionParams() bool {
 
 	t.encryptor = NewFEEncryptor(feEncryptionParams, t.logger)
 	t.encryptionParamsFetched.Store(true)
+	t.events.Publish(eventEncryptionParams, nil)
 	return true
 }
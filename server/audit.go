@@ -0,0 +1,179 @@
+package server
+
+import (
+	. "fe/common"
+	"fmt"
+	"math/big"
+)
+
+// VerifyBundle shows that the result is the decryption of the committed ciphers, without revealing the samples;
+// the customer, who is disclosed the samples by the sensors (see sensor/disclosure.go), can also recompute the
+// result from them. AuditSamples opens the commitments of the bundle's ciphers with the disclosed samples, and
+// multiplies them by the bundle's rates, which must be the ones generated from the tariff the server has signed with
+// the bundle.
+
+// AuditSamples checks the bundle against the sensors' disclosures of the samples; the keys that aren't pinned are
+// taken from the bundle. Of the bundle itself, only the signature, the tariff and the rates are checked, see
+// VerifyBundle.
+func AuditSamples(bundle *Bundle, disclosures []*SampleDisclosure, keys PinnedKeys) []Check {
+	checks := make([]Check, 0)
+	check := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	check("server signature", verifyServerSignature(bundle, keys.Server))
+	check("statement rates", verifyStatementRates(bundle))
+	check("tariff", auditTariff(bundle))
+
+	disclosed, err := auditDisclosures(bundle, disclosures, keys.Sensors)
+	check("sample disclosures", err)
+	check("sample openings", auditOpenings(bundle, disclosed))
+
+	// result
+	result, err := recomputeFromSamples(bundle, disclosed)
+	if err == nil && result.Cmp(big.NewInt(bundle.Statement.Result)) != 0 {
+		err = fmt.Errorf("the samples are billed for %s, the statement for %d", result, bundle.Statement.Result)
+	} else if err == nil && FormatFixedPoint(result, bundle.Tariff.ResultScale()) != bundle.Statement.Amount {
+		err = fmt.Errorf("the samples are billed for %s, the statement for %s", FormatFixedPoint(result, bundle.Tariff.ResultScale()), bundle.Statement.Amount)
+	}
+	check("recomputed result", err)
+
+	return checks
+}
+
+// auditTariff checks that the statement is billed with the tariff, and that the rates are the ones it generates
+func auditTariff(bundle *Bundle) error {
+	tariff := &bundle.Tariff
+	statement := &bundle.Statement
+	if tariff.Description != statement.TariffDescription {
+		return fmt.Errorf("the statement is billed with tariff %q, the bundle has %q", statement.TariffDescription, tariff.Description)
+	}
+	if tariff.ResultScale() != statement.Scale {
+		return fmt.Errorf("the statement has scale %d, the tariff %d", statement.Scale, tariff.ResultScale())
+	}
+	if tariff.BatchSize < 1 || len(bundle.Rates) != bundle.BatchCnt*tariff.BatchSize {
+		return fmt.Errorf("%d rates don't fit %d batches of %d samples", len(bundle.Rates), bundle.BatchCnt, tariff.BatchSize)
+	}
+
+	// the authority attests whatever rates the server asks a key for, so the rates are checked against the tariff
+	rates, err := tariff.GenerateRates(bundle.BatchCnt)
+	if err != nil {
+		return err
+	}
+	for idx := range rates {
+		if rates[idx] != bundle.Rates[idx] {
+			return fmt.Errorf("rate no %d isn't the rate the tariff generates", idx)
+		}
+	}
+	return nil
+}
+
+// auditDisclosures verifies the disclosures, and returns them by sensor id
+func auditDisclosures(bundle *Bundle, disclosures []*SampleDisclosure, pinnedKeys map[UUID]string) (map[UUID]*SampleDisclosure, error) {
+	sensorKeys := make(map[UUID]string)
+	for _, sensor := range bundle.Sensors {
+		sensorKeys[sensor.Id] = sensor.PublicKey
+	}
+	for sensorId, key := range pinnedKeys {
+		sensorKeys[sensorId] = key
+	}
+
+	// the valid disclosures are kept, so that the other checks fail only for the invalid ones
+	disclosed := make(map[UUID]*SampleDisclosure)
+	var firstErr error
+	for _, disclosure := range disclosures {
+		if err := auditDisclosure(bundle, disclosure, sensorKeys, disclosed); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		disclosed[disclosure.SensorId] = disclosure
+	}
+	if firstErr != nil {
+		return disclosed, firstErr
+	}
+
+	for _, sensorId := range bundle.Statement.Sensors {
+		if _, ok := disclosed[sensorId]; !ok {
+			return disclosed, fmt.Errorf("the samples of sensor %s aren't disclosed", sensorId)
+		}
+	}
+	return disclosed, nil
+}
+
+func auditDisclosure(bundle *Bundle, disclosure *SampleDisclosure, sensorKeys map[UUID]string, disclosed map[UUID]*SampleDisclosure) error {
+	if disclosure.TaskId != bundle.Statement.TaskId {
+		return fmt.Errorf("the samples of sensor %s are of task %s", disclosure.SensorId, disclosure.TaskId)
+	}
+	if disclosure.CustomerId != bundle.Statement.CustomerId {
+		return fmt.Errorf("the samples of sensor %s are disclosed to customer %s", disclosure.SensorId, disclosure.CustomerId)
+	}
+	key, ok := sensorKeys[disclosure.SensorId]
+	if !ok {
+		return fmt.Errorf("sensor %s isn't a sensor of the task", disclosure.SensorId)
+	}
+	if _, ok = disclosed[disclosure.SensorId]; ok {
+		return fmt.Errorf("the samples of sensor %s are disclosed twice", disclosure.SensorId)
+	}
+	if err := disclosure.Verify(key); err != nil {
+		return fmt.Errorf("sensor %s: %s", disclosure.SensorId, err)
+	}
+	return nil
+}
+
+// auditOpenings checks that the disclosed samples open the commitments of the bundle's ciphers
+func auditOpenings(bundle *Bundle, disclosed map[UUID]*SampleDisclosure) error {
+	for _, cipher := range bundle.Ciphers {
+		batch, err := disclosedBatch(disclosed, cipher)
+		if err != nil {
+			return err
+		}
+		if cipher.Commitment == nil {
+			return fmt.Errorf("batch no %d of sensor %s has no commitment", cipher.Batch, cipher.SensorId)
+		}
+		if batch.Commitment.Commitment != cipher.Commitment.Commitment {
+			return fmt.Errorf("the samples of batch no %d of sensor %s don't open the billed commitment", cipher.Batch, cipher.SensorId)
+		}
+		if len(batch.Samples) != bundle.Tariff.BatchSize {
+			return fmt.Errorf("batch no %d of sensor %s has %d samples", cipher.Batch, cipher.SensorId, len(batch.Samples))
+		}
+	}
+	return nil
+}
+
+// recomputeFromSamples multiplies the disclosed samples of the billed batches by the rates; every sensor's batch is
+// multiplied by the same rates
+func recomputeFromSamples(bundle *Bundle, disclosed map[UUID]*SampleDisclosure) (*big.Int, error) {
+	result := new(big.Int)
+	product := new(big.Int)
+	for _, cipher := range bundle.Ciphers {
+		batch, err := disclosedBatch(disclosed, cipher)
+		if err != nil {
+			return nil, err
+		}
+		for sampleIdx, sample := range batch.Samples {
+			rateIdx := cipher.Batch*bundle.Tariff.BatchSize + sampleIdx
+			if rateIdx >= len(bundle.Rates) {
+				return nil, fmt.Errorf("batch no %d of sensor %s has no rate for sample no %d", cipher.Batch, cipher.SensorId, sampleIdx)
+			}
+			product.Mul(big.NewInt(sample), big.NewInt(int64(bundle.Rates[rateIdx])))
+			result.Add(result, product)
+		}
+	}
+	return result, nil
+}
+
+// disclosedBatch returns the disclosed batch of the cipher
+func disclosedBatch(disclosed map[UUID]*SampleDisclosure, cipher BundleCipher) (*DisclosedBatch, error) {
+	disclosure, ok := disclosed[cipher.SensorId]
+	if !ok {
+		return nil, fmt.Errorf("the samples of sensor %s aren't disclosed", cipher.SensorId)
+	}
+	for idx := range disclosure.Batches {
+		if disclosure.Batches[idx].BatchIdx == cipher.Batch {
+			return &disclosure.Batches[idx], nil
+		}
+	}
+	return nil, fmt.Errorf("batch no %d of sensor %s isn't disclosed", cipher.Batch, cipher.SensorId)
+}
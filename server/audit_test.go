@@ -0,0 +1,83 @@
+package server
+
+import (
+	. "fe/common"
+	"slices"
+	"testing"
+)
+
+func TestAuditSamples(t *testing.T) {
+	otherSigner, err := NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := map[UUID][]int{"sensor-0": {0}}
+	invalidDisclosure := []string{"sample disclosures", "sample openings", "recomputed result"}
+
+	tests := []struct {
+		name    string
+		missing map[UUID][]int
+		modify  func(tb *testBundle, keys *PinnedKeys)
+		failed  []string
+	}{
+		{"valid", nil, func(tb *testBundle, keys *PinnedKeys) {}, nil},
+		{"partial", partial, func(tb *testBundle, keys *PinnedKeys) {}, nil},
+		{"keys of the bundle", nil, func(tb *testBundle, keys *PinnedKeys) { *keys = PinnedKeys{} }, nil},
+		{"server key", nil, func(tb *testBundle, keys *PinnedKeys) {
+			keys.Server = otherSigner.PublicKey()
+		}, []string{"server signature"}},
+		{"billed for another result", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Statement.Result++
+		}, []string{"recomputed result"}},
+		{"billed for another amount", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Statement.Amount = "0.0"
+		}, []string{"recomputed result"}},
+		{"rates of another tariff", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Rates = slices.Clone(tb.bundle.Rates)
+			tb.bundle.Rates[0]++
+			tb.bundle.Statement.Rates.Hash = HashRates(tb.bundle.Rates)
+		}, []string{"tariff", "recomputed result"}},
+		{"sensor key", nil, func(tb *testBundle, keys *PinnedKeys) {
+			keys.Sensors["sensor-1"] = otherSigner.PublicKey()
+		}, invalidDisclosure},
+		{"undisclosed sensor", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.disclosures = tb.disclosures[:1]
+		}, invalidDisclosure},
+		{"unknown sensor", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.disclosures[1].SensorId = "sensor-2"
+		}, invalidDisclosure},
+		{"disclosed to another customer", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.disclosures[0].CustomerId = "customer-1"
+		}, invalidDisclosure},
+		{"samples of another task", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.disclosures[0].TaskId = "task-1"
+		}, invalidDisclosure},
+		{"altered samples", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.disclosures[0].Batches[1].Samples[0]++
+		}, invalidDisclosure},
+		{"disclosed twice", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.disclosures = append(tb.disclosures, tb.disclosures[0])
+		}, []string{"sample disclosures"}},
+		{"undisclosed batch", nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.disclosures[1].Batches = tb.disclosures[1].Batches[:1]
+		}, []string{"sample openings", "recomputed result"}},
+		{"billed with another commitment", nil, func(tb *testBundle, keys *PinnedKeys) {
+			commitment := *tb.bundle.Ciphers[0].Commitment
+			commitment.Commitment = Hash([]byte("other samples"))
+			tb.bundle.Ciphers[0].Commitment = &commitment
+		}, []string{"sample openings"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tb := newTestBundle(t, SchemeFHMultiIPE, test.missing)
+			keys := tb.pinnedKeys()
+			test.modify(tb, &keys)
+			tb.sign()
+
+			if failed := failedChecks(AuditSamples(tb.bundle, tb.disclosures, keys)); !slices.Equal(failed, test.failed) {
+				t.Errorf("failed checks %v, expected %v", failed, test.failed)
+			}
+		})
+	}
+}
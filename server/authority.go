@@ -1,10 +1,8 @@
 package server
 
 import (
-	"encoding/json"
+	"fe/client"
 	. "fe/common"
-	"fmt"
-	"net/http"
 )
 
 type Authority struct {
@@ -14,102 +12,76 @@ type Authority struct {
 func (server *Server) NewAuthority(ip IP) *Authority {
 	return &Authority{
 		RemoteHttpServer: &RemoteHttpServer{
-			IP:     ip,
-			Logger: GetLogger("http client", server.HttpLogger),
+			IP:         ip,
+			Logger:     GetLogger("http client", server.HttpLogger),
+			Credential: server.authorityCredential,
 		},
 	}
 }
 
-func (a *Authority) SubmitTask(taskId UUID, sensorIds []UUID, batchParams BatchParams, MaxTariffValue int, MaxSampleValue int, EnableEncryption bool) error {
-	url := "/task"
-	body := AuthorityTaskRequest{
+// forTask returns the client of the authority, whose requests carry the correlation id of the task
+func (a *Authority) forTask(taskId UUID) *client.Authority {
+	return client.NewAuthority(a.ForTask(taskId))
+}
+
+func (a *Authority) SubmitTask(taskId UUID, sensorIds []UUID, batchParams BatchParams, MinTariffValue, MaxTariffValue, MinSampleValue, MaxSampleValue int, EnableEncryption bool, scheme string,
+	shareHolders []IP, threshold int, progressWindow int) error {
+	return a.forTask(taskId).AddTask(AuthorityTaskRequest{
 		Id:               taskId,
 		SensorIds:        sensorIds,
 		BatchParams:      batchParams,
+		MinTariffValue:   MinTariffValue,
 		MaxTariffValue:   MaxTariffValue,
+		MinSampleValue:   MinSampleValue,
 		MaxSampleValue:   MaxSampleValue,
 		EnableEncryption: EnableEncryption,
-	}
-
-	statusCode, responseBody, _ := a.POST(url, body, BodyJSON)
-	if statusCode == http.StatusBadRequest {
-		var kvMap map[string]string
-		_ = json.Unmarshal(responseBody, &kvMap)
-
-		return fmt.Errorf(kvMap["error"])
-	}
-
-	return nil
+		Scheme:           scheme,
+		ShareHolders:     shareHolders,
+		Threshold:        threshold,
+		ProgressWindow:   progressWindow,
+	})
 }
 
 func (a *Authority) SendRates(taskId UUID, rates []int) (UUID, error) {
-	url := "/rates/" + string(taskId)
-	data, err := Encode(rates)
-	if err != nil {
-		return "", err
-	}
-
-	_, responseBody, err := a.POST(url, data, BodyOctetStream)
-	decryptionParamsId, err := NewUUIDFromString(string(responseBody))
-	if err != nil {
-		a.Logger.Err(err)
-		return "", nil
-	}
-
-	return decryptionParamsId, nil
+	return a.forTask(taskId).AddRates(taskId, rates)
 }
 
-func (a *Authority) FetchSchemaParamsStatus(taskId UUID) (*string, error) {
-	url := "/schema-status/" + string(taskId)
-	statusCode, responseBody, err := a.GET(url)
-	if err != nil {
-		return nil, err
-	}
-
-	if statusCode != http.StatusOK {
-		a.Logger.Err(fmt.Errorf("status code: %d, expected %d", statusCode, http.StatusOK))
-		return nil, fmt.Errorf("status code: %d", statusCode)
-	}
-
-	status := string(responseBody)
-
-	return &status, nil
+// SendPartialRates asks for a decryption key restricted to the received ciphers; the authority may refuse it,
+// according to its policy
+func (a *Authority) SendPartialRates(taskId UUID, rates []int, missingCiphers []int) (UUID, error) {
+	return a.forTask(taskId).AddPartialRates(taskId, PartialRatesRequest{
+		Rates:          rates,
+		MissingCiphers: missingCiphers,
+	})
 }
 
-func (a *Authority) FetchDecryptionParamsStatus(taskId UUID, decryptionParamsId UUID) (*string, error) {
-	url := "/decryption-status/" + string(taskId) + "/" + string(decryptionParamsId)
-	statusCode, responseBody, err := a.GET(url)
-	if err != nil {
-		return nil, err
-	}
-
-	if statusCode != http.StatusOK {
-		a.Logger.Err(fmt.Errorf("status code: %d, expected %d", statusCode, http.StatusOK))
-		return nil, fmt.Errorf("status code: %d", statusCode)
-	}
-
-	status := string(responseBody)
-
-	return &status, nil
+// SendPrefixRates asks for a decryption key restricted to the first batches of every sensor, for the running total
+func (a *Authority) SendPrefixRates(taskId UUID, rates []int, batches int) (UUID, error) {
+	return a.forTask(taskId).AddPrefixRates(taskId, PrefixRatesRequest{
+		Rates:   rates,
+		Batches: batches,
+	})
+}
 
+func (a *Authority) FetchSchemaParamsStatus(taskId UUID) (string, error) {
+	return a.forTask(taskId).SchemaParamsStatus(taskId)
 }
 
-func (a *Authority) FetchDecryptionParams(taskId UUID, decryptionParamsId UUID) (FEDecryptionParams, error) {
-	url := "/decryption/" + string(taskId) + "/" + string(decryptionParamsId)
-	statusCode, responseBody, err := a.GET(url)
-	if err != nil {
-		return nil, err
-	}
+func (a *Authority) FetchDecryptionParamsStatus(taskId UUID, decryptionParamsId UUID) (string, error) {
+	return a.forTask(taskId).DecryptionParamsStatus(taskId, decryptionParamsId)
+}
 
-	if statusCode != http.StatusOK {
-		a.Logger.Err(fmt.Errorf("status code: %d, expected %d", statusCode, http.StatusOK))
-		return nil, fmt.Errorf("status code: %d", statusCode)
-	}
+// FetchDecryptionParams returns the decryption params, and their encoding, which is attested by the authority
+func (a *Authority) FetchDecryptionParams(taskId UUID, decryptionParamsId UUID) (FEDecryptionParams, []byte, error) {
+	return a.forTask(taskId).DecryptionParams(taskId, decryptionParamsId)
+}
 
-	data, err := Decode(responseBody)
-	if err != nil {
-		return nil, err
-	}
+// FetchAttestation returns the authority's signed attestation of the decryption params
+func (a *Authority) FetchAttestation(taskId UUID, decryptionParamsId UUID) (*RatesAttestation, error) {
+	return a.forTask(taskId).Attestation(taskId, decryptionParamsId)
+}
 
-	return data, nil
+// FetchPublicKey returns the hex encoded key the authority's attestations are verified with
+func (a *Authority) FetchPublicKey() (string, error) {
+	return client.NewAuthority(a.RemoteHttpServer).PublicKey()
 }
@@ -0,0 +1,414 @@
+package server
+
+import (
+	"errors"
+	. "fe/common"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// The customer has to trust the server that Result is computed with the rates of the tariff and with the ciphers the
+// sensors have submitted, so every billed task has a Bundle, which cmd/verify checks offline: the sensors' signed
+// commitments to the ciphers (see sensor/commitments.go), the ciphers, the authority's attestation of the rates of
+// the decryption key (see authority/attestation.go), and the decryption params themselves. The result is checked by
+// decrypting the ciphers again with the attested key, which reveals only the result, as the key is functional; the
+// samples stay with the sensors, which commit to them. The keys combined by the server, in the threshold and the
+// decentralized modes, aren't attested by the authority, so such tasks have no bundle.
+
+// submittedCipher is an encoded cipher, as the server has received it
+type submittedCipher struct {
+	data       []byte
+	commitment *BatchCommitment // nil if the sensor hasn't sent one
+}
+
+// keyRecord is a decryption key the task is billed with
+type keyRecord struct {
+	data         []byte            // the encoded decryption params
+	attestation  *RatesAttestation // nil if the key isn't attested
+	authorityKey string
+}
+
+type Bundle struct {
+	Statement Statement `json:"statement"`
+	Tariff    Tariff    `json:"tariff"` // the tariff of Statement.TariffId, which the rates are generated from
+	Scheme    string    `json:"scheme"`
+	BatchCnt  int       `json:"batch_cnt"`
+	Rates     []int     `json:"rates"`
+
+	Sensors []BundleSensor `json:"sensors"`
+	Ciphers []BundleCipher `json:"ciphers"` // the ciphers the result is computed from
+
+	DecryptionParams []byte            `json:"decryption_params"` // gob encoded, as served by the authority
+	Attestation      *RatesAttestation `json:"attestation,omitempty"`
+	AuthorityKey     string            `json:"authority_key,omitempty"`
+
+	ServerKey string `json:"server_key"`
+	Signature string `json:"signature"` // of the bundle without the signature, by ServerKey
+}
+
+type BundleSensor struct {
+	Id        UUID   `json:"id"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+type BundleCipher struct {
+	SensorId   UUID             `json:"sensor_id"`
+	Batch      int              `json:"batch"`
+	Cipher     []byte           `json:"cipher"` // gob encoded
+	Commitment *BatchCommitment `json:"commitment,omitempty"`
+}
+
+//region recording
+
+// VerifyCommitment returns an error unless the commitment is signed by the sensor, and commits to the cipher of
+// batch no batchIdx of the sensor; the commitment is optional, but the sensors that have sent their key must sign
+func (t *Task) VerifyCommitment(sensorId UUID, batchIdx int, cipher []byte, commitment *BatchCommitment) error {
+	sensorIdx, err := t.getSensorIdx(sensorId)
+	if err != nil {
+		return err
+	}
+	publicKey := t.Sensors[sensorIdx].PublicKey
+
+	if commitment == nil {
+		if publicKey != "" {
+			return fmt.Errorf("the cipher has no commitment")
+		}
+		return nil
+	}
+	if commitment.TaskId != t.Id || commitment.SensorId != sensorId || commitment.BatchIdx != batchIdx {
+		return fmt.Errorf("the commitment is for batch no %d of sensor %s of task %s", commitment.BatchIdx, commitment.SensorId, commitment.TaskId)
+	}
+	if commitment.CipherHash != Hash(cipher) {
+		return fmt.Errorf("the commitment is for another cipher")
+	}
+	if publicKey != "" {
+		if err = commitment.Verify(publicKey); err != nil {
+			return fmt.Errorf("invalid commitment signature: %s", err)
+		}
+	}
+	return nil
+}
+
+// recordKey records the key the task is billed with in slot, with the authority's attestation of it; a missing or
+// mismatched attestation is logged, and is left to cmd/verify to reject
+func (t *Task) recordKey(slot *atomic.Pointer[keyRecord], decryptionParamsId UUID, data []byte) {
+	record := &keyRecord{data: data}
+	defer slot.Store(record)
+
+	attestation, err := t.Authority.FetchAttestation(t.Id, decryptionParamsId)
+	if err != nil {
+		t.logger.Warn("fetching the attestation of the decryption key failed: %s", err)
+		return
+	}
+	if attestation.KeyHash != Hash(data) {
+		t.logger.Warn("the attestation is for other decryption params")
+	}
+	if attestation.RatesHash != HashRates(t.Rates) {
+		t.logger.Warn("the attestation is for other rates")
+	}
+	record.attestation = attestation
+
+	if record.authorityKey, err = t.Authority.FetchPublicKey(); err != nil {
+		t.logger.Warn("fetching the public key of the authority failed: %s", err)
+	}
+}
+
+//endregion
+
+// ErrUnattestedKey is returned by Bundle for the tasks whose key is combined by the server
+var ErrUnattestedKey = errors.New("the decryption key is combined by the server, so it isn't attested by the authority")
+
+// Bundle returns the bundle of the task, signed by signer; it fails if the task has no result yet, or if its key
+// isn't derived by the authority
+func (t *Task) Bundle(signer *Signer) (*Bundle, error) {
+	if t.Threshold > 0 || !UsesAuthority(t.Scheme) {
+		return nil, fmt.Errorf("task %s has no bundle: %w", t.Id, ErrUnattestedKey)
+	}
+
+	statement, err := t.Statement()
+	if err != nil {
+		return nil, err
+	}
+
+	// the decrypted batches of the DMCFE schemes are billed with the task's key
+	key := t.billingKey.Load()
+	if statement.Partial && !DecryptsBatches(t.Scheme) {
+		key = t.partialKey.Load()
+	}
+	if key == nil {
+		return nil, fmt.Errorf("the decryption key of task %s hasn't been recorded", t.Id)
+	}
+
+	bundle := &Bundle{
+		Statement:        *statement,
+		Tariff:           *t.Tariff,
+		Scheme:           t.Scheme,
+		BatchCnt:         t.BatchCnt,
+		Rates:            t.Rates,
+		Sensors:          make([]BundleSensor, len(t.Sensors)),
+		Ciphers:          make([]BundleCipher, 0),
+		DecryptionParams: key.data,
+		Attestation:      key.attestation,
+		AuthorityKey:     key.authorityKey,
+		ServerKey:        signer.PublicKey(),
+	}
+
+	for sensorIdx, sensor := range t.Sensors {
+		bundle.Sensors[sensorIdx] = BundleSensor{Id: sensor.Id, PublicKey: sensor.PublicKey}
+
+		missing := make(map[int]bool)
+		for _, batchIdx := range statement.MissingBatches[sensor.Id] {
+			missing[batchIdx] = true
+		}
+		for batchIdx := range t.submittedCiphers[sensorIdx] {
+			cipher := t.submittedCiphers[sensorIdx][batchIdx].Load()
+			if cipher == nil || missing[batchIdx] {
+				continue
+			}
+			bundle.Ciphers = append(bundle.Ciphers, BundleCipher{
+				SensorId:   sensor.Id,
+				Batch:      batchIdx,
+				Cipher:     cipher.data,
+				Commitment: cipher.commitment,
+			})
+		}
+	}
+
+	if bundle.Signature, err = signer.Sign(bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+//region verification
+
+// PinnedKeys are the keys the verifier trusts; the keys that aren't pinned are taken from the bundle, in which case
+// the checks only show that the bundle is consistent
+type PinnedKeys struct {
+	Authority string
+	Server    string
+	Sensors   map[UUID]string
+}
+
+// ParseSensorKeys parses the comma separated sensorId=key pairs of the pinned keys of the sensors
+func ParseSensorKeys(list string) (map[UUID]string, error) {
+	keys := make(map[UUID]string)
+	if list == "" {
+		return keys, nil
+	}
+
+	for _, pair := range strings.Split(list, ",") {
+		sensorId, key, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !UUID(sensorId).Verify() {
+			return nil, fmt.Errorf("invalid sensor key %q, expected sensorId=key", pair)
+		}
+		keys[UUID(sensorId)] = key
+	}
+	return keys, nil
+}
+
+// Check is the outcome of one of the checks of VerifyBundle; Err is nil if the check has passed
+type Check struct {
+	Name string
+	Err  error
+}
+
+// VerifyBundle checks the bundle against the pinned keys: the signatures, that the statement is billed with
+// the rates the tariff generates and with the attested key, that the ciphers are the ones the sensors have committed
+// to, and that the ciphers decrypt to the billed result. The discrete logarithm tables are cached in dlogTableDir,
+// if it's set.
+func VerifyBundle(bundle *Bundle, keys PinnedKeys, dlogTableDir string) []Check {
+	checks := make([]Check, 0)
+	check := func(name string, err error) {
+		checks = append(checks, Check{Name: name, Err: err})
+	}
+
+	check("server signature", verifyServerSignature(bundle, keys.Server))
+
+	// statement
+	statement := bundle.Statement
+	if statement.ComputeHash() != statement.Hash {
+		check("statement hash", fmt.Errorf("the statement has been altered"))
+	} else {
+		check("statement hash", nil)
+	}
+	check("statement rates", verifyStatementRates(bundle))
+	check("tariff", auditTariff(bundle))
+
+	// attestation
+	check("rates attestation", verifyAttestation(bundle, keys.Authority))
+
+	// commitments
+	sensorKeys := make(map[UUID]string)
+	for _, sensor := range bundle.Sensors {
+		sensorKeys[sensor.Id] = sensor.PublicKey
+	}
+	for sensorId, key := range keys.Sensors {
+		sensorKeys[sensorId] = key
+	}
+	check("cipher commitments", verifyCommitments(bundle, sensorKeys))
+	check("batch coverage", verifyCoverage(bundle))
+
+	// result
+	result, err := Recompute(bundle.DecryptionParams, bundle.Ciphers, statement.Partial, dlogTableDir)
+	if err == nil && result.Cmp(big.NewInt(statement.Result)) != 0 {
+		err = fmt.Errorf("the ciphers decrypt to %s, the statement is billed for %d", result, statement.Result)
+	}
+	check("result", err)
+
+	return checks
+}
+
+func verifyServerSignature(bundle *Bundle, serverKey string) error {
+	if serverKey == "" {
+		serverKey = bundle.ServerKey
+	}
+	unsigned := *bundle
+	unsigned.Signature = ""
+	return VerifySignature(serverKey, unsigned, bundle.Signature)
+}
+
+func verifyStatementRates(bundle *Bundle) error {
+	if ratesHash := HashRates(bundle.Rates); ratesHash != bundle.Statement.Rates.Hash {
+		return fmt.Errorf("the statement is billed with rates %s, the bundle has %s", bundle.Statement.Rates.Hash, ratesHash)
+	}
+	return nil
+}
+
+func verifyAttestation(bundle *Bundle, authorityKey string) error {
+	attestation := bundle.Attestation
+	if attestation == nil {
+		return fmt.Errorf("the decryption key isn't attested by the authority")
+	}
+	if authorityKey == "" {
+		authorityKey = bundle.AuthorityKey
+	}
+	if err := attestation.Verify(authorityKey); err != nil {
+		return err
+	}
+
+	if attestation.TaskId != bundle.Statement.TaskId {
+		return fmt.Errorf("the attestation is for task %s", attestation.TaskId)
+	}
+	if attestation.RatesHash != HashRates(bundle.Rates) {
+		return fmt.Errorf("the key is attested for other rates")
+	}
+	if attestation.KeyHash != Hash(bundle.DecryptionParams) {
+		return fmt.Errorf("the attestation is for another key")
+	}
+	restricted := bundle.Statement.Partial && !DecryptsBatches(bundle.Scheme)
+	if len(attestation.MissingCiphers) > 0 != restricted {
+		return fmt.Errorf("the key restriction doesn't match the statement")
+	}
+	return nil
+}
+
+func verifyCommitments(bundle *Bundle, sensorKeys map[UUID]string) error {
+	for _, cipher := range bundle.Ciphers {
+		commitment := cipher.Commitment
+		if commitment == nil {
+			return fmt.Errorf("batch no %d of sensor %s has no commitment", cipher.Batch, cipher.SensorId)
+		}
+		if commitment.TaskId != bundle.Statement.TaskId || commitment.SensorId != cipher.SensorId || commitment.BatchIdx != cipher.Batch {
+			return fmt.Errorf("the commitment of batch no %d of sensor %s is for another batch", cipher.Batch, cipher.SensorId)
+		}
+		if commitment.CipherHash != Hash(cipher.Cipher) {
+			return fmt.Errorf("batch no %d of sensor %s isn't the committed cipher", cipher.Batch, cipher.SensorId)
+		}
+		if err := commitment.Verify(sensorKeys[cipher.SensorId]); err != nil {
+			return fmt.Errorf("the commitment of batch no %d of sensor %s: %s", cipher.Batch, cipher.SensorId, err)
+		}
+	}
+	return nil
+}
+
+// verifyCoverage checks that the bundle has a cipher of every batch of the statement's sensors, except the missing
+// ones, which must be the ones the key is restricted from
+func verifyCoverage(bundle *Bundle) error {
+	statement := bundle.Statement
+	received := make(map[UUID]map[int]bool)
+	for _, cipher := range bundle.Ciphers {
+		if received[cipher.SensorId] == nil {
+			received[cipher.SensorId] = make(map[int]bool)
+		}
+		if received[cipher.SensorId][cipher.Batch] {
+			return fmt.Errorf("batch no %d of sensor %s is in the bundle twice", cipher.Batch, cipher.SensorId)
+		}
+		received[cipher.SensorId][cipher.Batch] = true
+	}
+
+	missingCiphers := make([]int, 0)
+	for sensorIdx, sensorId := range statement.Sensors {
+		missing := make(map[int]bool)
+		for _, batchIdx := range statement.MissingBatches[sensorId] {
+			missing[batchIdx] = true
+		}
+		for batchIdx := 0; batchIdx < bundle.BatchCnt; batchIdx++ {
+			if missing[batchIdx] {
+				missingCiphers = append(missingCiphers, sensorIdx*bundle.BatchCnt+batchIdx)
+			} else if !received[sensorId][batchIdx] {
+				return fmt.Errorf("batch no %d of sensor %s is missing from the bundle", batchIdx, sensorId)
+			}
+		}
+	}
+
+	// the batches of the DMCFE schemes are decrypted with the ciphers of all the sensors, with the task's key
+	if DecryptsBatches(bundle.Scheme) {
+		for _, idx := range missingCiphers {
+			for _, sensorId := range statement.Sensors {
+				if !slices.Contains(statement.MissingBatches[sensorId], idx%bundle.BatchCnt) {
+					return fmt.Errorf("batch no %d of sensor %s is billed without the other sensors' batches", idx%bundle.BatchCnt, sensorId)
+				}
+			}
+		}
+	} else if bundle.Attestation != nil && !slices.Equal(missingCiphers, bundle.Attestation.MissingCiphers) {
+		return fmt.Errorf("the missing batches differ from the ciphers the key is restricted from")
+	}
+	return nil
+}
+
+// Recompute decrypts the ciphers with the decryption params; if partial, the params are restricted to the ciphers,
+// except with the DMCFE schemes, whose decrypted batches are summed
+func Recompute(decryptionParams []byte, ciphers []BundleCipher, partial bool, dlogTableDir string) (*big.Int, error) {
+	params, err := Decode(decryptionParams)
+	if err != nil {
+		return nil, fmt.Errorf("decoding decryption params failed: %s", err)
+	}
+
+	config := DefaultServerConfig()
+	config.DlogTableDir = dlogTableDir
+	logger := GetDiscardLogger()
+	metrics := newServerMetrics(NewMetricsRegistry())
+	decryptor, err := NewFEDecryptor(params, newDlogTables(config, metrics, logger), metrics, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var result *big.Int
+	for _, cipher := range ciphers {
+		feCipher, err := Decode(cipher.Cipher)
+		if err != nil {
+			return nil, fmt.Errorf("decoding batch no %d of sensor %s failed: %s", cipher.Batch, cipher.SensorId, err)
+		}
+		if result, err = decryptor.AddCipher(feCipher); err != nil {
+			return nil, fmt.Errorf("decrypting batch no %d of sensor %s failed: %s", cipher.Batch, cipher.SensorId, err)
+		}
+	}
+
+	if partial {
+		partialDecryptor, ok := decryptor.(PartialDecryptor)
+		if !ok {
+			return nil, fmt.Errorf("scheme %s can't bill the received batches only", decryptor.Scheme())
+		}
+		return partialDecryptor.DecryptPartial(params)
+	}
+	if result == nil {
+		return nil, fmt.Errorf("the ciphers don't decrypt to a result")
+	}
+	return result, nil
+}
+
+//endregion
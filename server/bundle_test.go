@@ -0,0 +1,350 @@
+package server
+
+import (
+	"errors"
+	. "fe/common"
+	"fmt"
+	"math/big"
+	"slices"
+	"testing"
+)
+
+// testBundle is a consistent bundle of a task of 2 sensors that submit 2 batches each, with the keys it's signed with
+// and the sensors' disclosures of the samples; its decryption params are made up, so its result can't be recomputed
+type testBundle struct {
+	bundle      *Bundle
+	server      *Signer
+	authority   *Signer
+	sensors     map[UUID]*Signer
+	disclosures []*SampleDisclosure
+}
+
+// newTestBundle returns the testBundle of a task of scheme, that misses the batches missingBatches
+func newTestBundle(t *testing.T, scheme string, missingBatches map[UUID][]int) *testBundle {
+	t.Helper()
+
+	newSigner := func() *Signer {
+		signer, err := NewSigner("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+	tb := &testBundle{server: newSigner(), authority: newSigner(), sensors: make(map[UUID]*Signer)}
+
+	tariff := Tariff{id: "tariff-0", Description: "flat", SamplingPeriod: 60, BatchSize: 2, MaxSampleValue: 10,
+		MinTariffValue: 0.1, MaxTariffValue: 0.9, RateScale: 1}
+	const batchCnt = 2
+	rates, err := tariff.GenerateRates(batchCnt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement := Statement{
+		TaskId:            "task-0",
+		CustomerId:        "customer-0",
+		Sensors:           []UUID{"sensor-0", "sensor-1"},
+		TariffId:          tariff.id,
+		TariffDescription: tariff.Description,
+		PeriodStart:       1000,
+		PeriodEnd:         1000 + batchCnt*2*60,
+		Rates:             summarizeRates(rates, &tariff),
+		Scale:             tariff.ResultScale(),
+		Partial:           len(missingBatches) > 0,
+		MissingBatches:    missingBatches,
+	}
+
+	// the samples of batch b of sensor s are s+b+1 and 2
+	result := new(big.Int)
+	ciphers := make([]BundleCipher, 0)
+	for sensorIdx, sensorId := range statement.Sensors {
+		signer := newSigner()
+		tb.sensors[sensorId] = signer
+		disclosure := &SampleDisclosure{TaskId: statement.TaskId, SensorId: sensorId, CustomerId: statement.CustomerId}
+
+		for batchIdx := 0; batchIdx < batchCnt; batchIdx++ {
+			if slices.Contains(missingBatches[sensorId], batchIdx) {
+				continue
+			}
+			batch := DisclosedBatch{BatchIdx: batchIdx, Samples: []int64{int64(sensorIdx + batchIdx + 1), 2},
+				Nonce: []byte{byte(sensorIdx), byte(batchIdx)}, SampledAt: int64(batchIdx)}
+			for sampleIdx, sample := range batch.Samples {
+				result.Add(result, big.NewInt(sample*int64(rates[batchIdx*tariff.BatchSize+sampleIdx])))
+			}
+
+			cipher := []byte(fmt.Sprintf("cipher of batch no %d of sensor %s", batchIdx, sensorId))
+			opening := disclosure.Opening(&batch)
+			batch.Commitment = &BatchCommitment{TaskId: statement.TaskId, SensorId: sensorId, BatchIdx: batchIdx,
+				Commitment: opening.Commit(), CipherHash: Hash(cipher), SampledAt: batch.SampledAt}
+			if err = batch.Commitment.Sign(signer); err != nil {
+				t.Fatal(err)
+			}
+
+			disclosure.Batches = append(disclosure.Batches, batch)
+			ciphers = append(ciphers, BundleCipher{SensorId: sensorId, Batch: batchIdx, Cipher: cipher, Commitment: batch.Commitment})
+		}
+		tb.disclosures = append(tb.disclosures, disclosure)
+	}
+	statement.Result = result.Int64()
+	statement.Amount = FormatFixedPoint(result, statement.Scale)
+	statement.Hash = statement.ComputeHash()
+
+	tb.bundle = &Bundle{
+		Statement:        statement,
+		Tariff:           tariff,
+		Scheme:           scheme,
+		BatchCnt:         batchCnt,
+		Rates:            rates,
+		Sensors:          []BundleSensor{{Id: "sensor-0"}, {Id: "sensor-1"}},
+		Ciphers:          ciphers,
+		DecryptionParams: []byte("decryption params"),
+		AuthorityKey:     tb.authority.PublicKey(),
+		ServerKey:        tb.server.PublicKey(),
+	}
+	for idx := range tb.bundle.Sensors {
+		tb.bundle.Sensors[idx].PublicKey = tb.sensors[tb.bundle.Sensors[idx].Id].PublicKey()
+	}
+
+	// the key of a partial task is restricted from the missing ciphers, unless its batches are decrypted on their own
+	tb.bundle.Attestation = &RatesAttestation{TaskId: statement.TaskId, DecryptionParamsId: "params-0", Scheme: scheme,
+		RatesHash: HashRates(rates), KeyHash: Hash(tb.bundle.DecryptionParams)}
+	if !DecryptsBatches(scheme) {
+		for sensorIdx, sensorId := range statement.Sensors {
+			for _, batchIdx := range missingBatches[sensorId] {
+				tb.bundle.Attestation.MissingCiphers = append(tb.bundle.Attestation.MissingCiphers, sensorIdx*batchCnt+batchIdx)
+			}
+		}
+	}
+	tb.attest()
+	tb.sign()
+	return tb
+}
+
+// attest signs the attestation again, by the authority
+func (tb *testBundle) attest() {
+	if err := tb.bundle.Attestation.Sign(tb.authority); err != nil {
+		panic(err)
+	}
+}
+
+// sign signs the bundle again, by the server
+func (tb *testBundle) sign() {
+	tb.bundle.Signature = ""
+	signature, err := tb.server.Sign(tb.bundle)
+	if err != nil {
+		panic(err)
+	}
+	tb.bundle.Signature = signature
+}
+
+// pinnedKeys returns the keys the bundle is signed with
+func (tb *testBundle) pinnedKeys() PinnedKeys {
+	keys := PinnedKeys{Authority: tb.authority.PublicKey(), Server: tb.server.PublicKey(), Sensors: make(map[UUID]string)}
+	for sensorId, signer := range tb.sensors {
+		keys.Sensors[sensorId] = signer.PublicKey()
+	}
+	return keys
+}
+
+// failedChecks returns the names of the checks that have failed
+func failedChecks(checks []Check) []string {
+	failed := make([]string, 0)
+	for _, check := range checks {
+		if check.Err != nil {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+func TestVerifyBundle(t *testing.T) {
+	otherSigner, err := NewSigner("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := map[UUID][]int{"sensor-1": {1}}
+
+	tests := []struct {
+		name    string
+		scheme  string
+		missing map[UUID][]int
+		modify  func(tb *testBundle, keys *PinnedKeys)
+		failed  []string // the checks that fail, besides the result's
+	}{
+		{"valid", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {}, nil},
+		{"partial", SchemeFHMultiIPE, partial, func(tb *testBundle, keys *PinnedKeys) {}, nil},
+		{"keys of the bundle", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) { *keys = PinnedKeys{} }, nil},
+		{"server key", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			keys.Server = otherSigner.PublicKey()
+		}, []string{"server signature"}},
+		{"altered statement", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Statement.Amount = "0"
+		}, []string{"statement hash"}},
+		{"rates of another statement", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Rates = slices.Clone(tb.bundle.Rates)
+			tb.bundle.Rates[0]++
+		}, []string{"statement rates", "tariff", "rates attestation"}},
+		{"rates of another tariff", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Rates = slices.Clone(tb.bundle.Rates)
+			tb.bundle.Rates[0]++
+			tb.bundle.Statement.Rates.Hash = HashRates(tb.bundle.Rates)
+			tb.bundle.Statement.Hash = tb.bundle.Statement.ComputeHash()
+			tb.bundle.Attestation.RatesHash = HashRates(tb.bundle.Rates)
+			tb.attest()
+		}, []string{"tariff"}},
+		{"another tariff", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Tariff.Description = "peak"
+		}, []string{"tariff"}},
+		{"unattested key", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Attestation = nil
+		}, []string{"rates attestation"}},
+		{"authority key", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			keys.Authority = otherSigner.PublicKey()
+		}, []string{"rates attestation"}},
+		{"attestation of another key", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.DecryptionParams = []byte("other decryption params")
+		}, []string{"rates attestation"}},
+		{"attestation of another task", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Attestation.TaskId = "task-1"
+			tb.attest()
+		}, []string{"rates attestation"}},
+		{"unrestricted key", SchemeFHMultiIPE, partial, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Attestation.MissingCiphers = nil
+			tb.attest()
+		}, []string{"rates attestation", "batch coverage"}},
+		{"key restricted from other ciphers", SchemeFHMultiIPE, partial, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Attestation.MissingCiphers = []int{2}
+			tb.attest()
+		}, []string{"batch coverage"}},
+		{"sensor key", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			keys.Sensors["sensor-0"] = otherSigner.PublicKey()
+		}, []string{"cipher commitments"}},
+		{"uncommitted cipher", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Ciphers[0].Cipher = []byte("other cipher")
+		}, []string{"cipher commitments"}},
+		{"commitment of another batch", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Ciphers[0].Commitment = tb.bundle.Ciphers[1].Commitment
+		}, []string{"cipher commitments"}},
+		{"missing batch", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Ciphers = tb.bundle.Ciphers[1:]
+		}, []string{"batch coverage"}},
+		{"duplicate batch", SchemeFHMultiIPE, nil, func(tb *testBundle, keys *PinnedKeys) {
+			tb.bundle.Ciphers = append(tb.bundle.Ciphers, tb.bundle.Ciphers[0])
+		}, []string{"batch coverage"}},
+		{"dmcfe", SchemeDMCFE, nil, func(tb *testBundle, keys *PinnedKeys) {}, nil},
+		{"dmcfe without a batch", SchemeDMCFE, map[UUID][]int{"sensor-0": {1}, "sensor-1": {1}},
+			func(tb *testBundle, keys *PinnedKeys) {}, nil},
+		{"dmcfe without a sensor's batch", SchemeDMCFE, partial,
+			func(tb *testBundle, keys *PinnedKeys) {}, []string{"batch coverage"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tb := newTestBundle(t, test.scheme, test.missing)
+			keys := tb.pinnedKeys()
+			test.modify(tb, &keys)
+			tb.sign()
+
+			checks := VerifyBundle(tb.bundle, keys, t.TempDir())
+			if last := checks[len(checks)-1]; last.Name != "result" || last.Err == nil {
+				t.Errorf("result of made up decryption params checked: %v", last.Err)
+			}
+			if failed := failedChecks(checks[:len(checks)-1]); !slices.Equal(failed, test.failed) {
+				t.Errorf("failed checks %v, expected %v", failed, test.failed)
+			}
+		})
+	}
+
+	t.Run("altered bundle", func(t *testing.T) {
+		tb := newTestBundle(t, SchemeFHMultiIPE, nil)
+		tb.bundle.Scheme = SchemeDamgardMulti
+		if failed := failedChecks(VerifyBundle(tb.bundle, tb.pinnedKeys(), t.TempDir())); !slices.Contains(failed, "server signature") {
+			t.Errorf("failed checks %v, expected the server signature", failed)
+		}
+	})
+}
+
+func TestBundleUnattested(t *testing.T) {
+	tests := []struct {
+		name string
+		task *Task
+	}{
+		{"threshold", &Task{Id: "task-0", Scheme: SchemeDamgardMulti, Threshold: 2}},
+		{"decentralized", &Task{Id: "task-0", Scheme: SchemeDecentralizedDMCFE}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			signer, err := NewSigner("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = test.task.Bundle(signer); !errors.Is(err, ErrUnattestedKey) {
+				t.Errorf("got %v, expected %v", err, ErrUnattestedKey)
+			}
+		})
+	}
+}
+
+func TestVerifyCommitment(t *testing.T) {
+	tb := newTestBundle(t, SchemeFHMultiIPE, nil)
+	cipher := tb.bundle.Ciphers[0]
+	task := &Task{Id: "task-0", Sensors: []*Sensor{
+		{Id: "sensor-0", PublicKey: tb.sensors["sensor-0"].PublicKey()},
+		{Id: "sensor-1"}, // hasn't sent its key
+	}}
+
+	tests := []struct {
+		name       string
+		sensorId   UUID
+		batchIdx   int
+		cipher     []byte
+		commitment *BatchCommitment
+		valid      bool
+	}{
+		{"valid", "sensor-0", 0, cipher.Cipher, cipher.Commitment, true},
+		{"without a key", "sensor-1", 0, []byte("cipher"), nil, true},
+		{"no commitment", "sensor-0", 0, cipher.Cipher, nil, false},
+		{"another batch", "sensor-0", 1, cipher.Cipher, cipher.Commitment, false},
+		{"another cipher", "sensor-0", 0, []byte("other cipher"), cipher.Commitment, false},
+		{"another sensor's commitment", "sensor-0", 0, tb.bundle.Ciphers[2].Cipher, tb.bundle.Ciphers[2].Commitment, false},
+		{"unknown sensor", "sensor-2", 0, cipher.Cipher, cipher.Commitment, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := task.VerifyCommitment(test.sensorId, test.batchIdx, test.cipher, test.commitment)
+			if test.valid && err != nil {
+				t.Errorf("valid commitment rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid commitment accepted")
+			}
+		})
+	}
+
+	t.Run("signed by another key", func(t *testing.T) {
+		forged := *cipher.Commitment
+		if err := forged.Sign(tb.sensors["sensor-1"]); err != nil {
+			t.Fatal(err)
+		}
+		if err := task.VerifyCommitment("sensor-0", 0, cipher.Cipher, &forged); err == nil {
+			t.Error("commitment signed by another key accepted")
+		}
+	})
+}
+
+func TestParseSensorKeys(t *testing.T) {
+	sensorId := NewUUID()
+	keys, err := ParseSensorKeys(" " + string(sensorId) + "=abc, " + string(NewUUID()) + "=def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[sensorId] != "abc" {
+		t.Errorf("keys %v", keys)
+	}
+	if keys, err = ParseSensorKeys(""); err != nil || len(keys) != 0 {
+		t.Errorf("keys %v (%v) of an empty list", keys, err)
+	}
+	for _, list := range []string{"sensor-0=abc", string(sensorId), string(sensorId) + "=abc,"} {
+		if _, err = ParseSensorKeys(list); err == nil {
+			t.Errorf("invalid list %q accepted", list)
+		}
+	}
+}
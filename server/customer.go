@@ -49,3 +49,15 @@ func (g *Customer) AddSensor(s *Sensor) {
 	g.Sensors = append(g.Sensors, s)
 	s.Customers = append(s.Customers, g)
 }
+
+// Details returns the customer and its sensors; Customer itself isn't marshalled, as its sensors refer back to it
+func (g *Customer) Details() CustomerDetails {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	details := CustomerDetails{Id: g.Uuid, Sensors: make([]CustomerSensor, len(g.Sensors))}
+	for idx, sensor := range g.Sensors {
+		details.Sensors[idx] = CustomerSensor{Id: sensor.Id, IP: sensor.IP.String(), PublicKey: sensor.PublicKey}
+	}
+	return details
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/bn256"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The results of the pairing-based schemes are decrypted by solving a discrete logarithm in GT with the baby-step
+// giant-step method. Its baby steps (the powers g^0, ..., g^(m-1) of the generator g) depend only on g and m, so
+// they are kept in a DlogTable, that is cached in memory and on disk, and reused by every search with the same
+// generator; a table built for a bound also serves every smaller bound. The searches then cost only the giant steps.
+//
+// The generator of DMCFE is fixed, so its tables are reused across all tasks, while the generator of FH-Multi-IPE is
+// the public key of the task. The generator of FH-IPE is randomized by every key and cipher, so its tables are never
+// cached.
+
+// DlogTable holds the baby steps of a generator, by the truncated hashes of the powers
+type DlogTable struct {
+	Generator []byte // marshalled generator
+	M         int64  // number of baby steps, the giant step is g^-M
+	Steps     map[string]int64
+
+	giantStep *bn256.GT
+}
+
+// DlogStats describe a single discrete logarithm search, for the decryptor stats
+type DlogStats struct {
+	TableSize   int64  `json:"table_size"`
+	TableSource string `json:"table_source"` // "memory", "disk", or "built"
+	BuildTime   *int64 `json:"build_time"`   // in nanoseconds; nil if the table was cached
+	SearchTime  *int64 `json:"search_time"`  // in nanoseconds
+}
+
+// DlogTables is the cache of the DlogTables of a Server
+type DlogTables struct {
+	dir        string // empty if the tables are cached only in memory
+	maxEntries int64
+	cacheSize  int
+
+	tables map[string]*DlogTable     // by the generator hash
+	order  []string                  // generator hashes, from the least recently used
+	builds map[string]*dlogTableLock // locks of the tables being loaded or built, by the generator hash
+	mutex  sync.Mutex                // guards tables, order and builds
+
+	metrics *serverMetrics
+	logger  *Logger
+}
+
+func newDlogTables(config *ServerConfig, metrics *serverMetrics, logger *Logger) *DlogTables {
+	return &DlogTables{
+		dir:        config.DlogTableDir,
+		maxEntries: int64(config.DlogTableMaxEntries),
+		cacheSize:  config.DlogTableCacheSize,
+		tables:     make(map[string]*DlogTable),
+		builds:     make(map[string]*dlogTableLock),
+		order:      make([]string, 0),
+		metrics:    metrics,
+		logger:     GetLogger("dlog tables", logger),
+	}
+}
+
+// Solve returns x such that h = g^x and |x| <= bound; negative values are searched for only if neg is set.
+// The table of g is cached only if cache is set.
+func (c *DlogTables) Solve(h, g *bn256.GT, bound *big.Int, neg bool, cache bool) (*big.Int, *DlogStats, error) {
+	stats := &DlogStats{}
+
+	table, err := c.getTable(g, c.tableSize(bound), cache, stats)
+	if err != nil {
+		return nil, stats, err
+	}
+	stats.TableSize = table.M
+
+	start := time.Now()
+	x, err := table.search(h, bound, neg)
+	elapsed := time.Since(start)
+	stats.SearchTime = GetIntPtrFromDuration(&elapsed)
+	return x, stats, err
+}
+
+// tableSize returns the number of baby steps that balances them with the giant steps, ceil(sqrt(bound + 1)),
+// capped at maxEntries
+func (c *DlogTables) tableSize(bound *big.Int) int64 {
+	m := new(big.Int).Sqrt(bound)
+	m.Add(m, big.NewInt(1))
+	if !m.IsInt64() || m.Int64() > c.maxEntries {
+		return c.maxEntries
+	}
+	return m.Int64()
+}
+
+// getTable returns a table of g with at least m baby steps, from memory, from disk, or newly built
+func (c *DlogTables) getTable(g *bn256.GT, m int64, cache bool, stats *DlogStats) (*DlogTable, error) {
+	generator := g.Marshal()
+	key := dlogTableKey(generator)
+
+	if !cache {
+		stats.TableSource = "built"
+		return c.buildTable(g, generator, m, stats), nil
+	}
+
+	if table := c.lookup(key, m, stats); table != nil {
+		return table, nil
+	}
+
+	// a table is loaded or built with the lock of its generator held, so that concurrent searches with the same
+	// generator build it only once, while the searches with other generators aren't blocked
+	lock := c.lockTable(key)
+	defer c.unlockTable(key, lock)
+
+	if table := c.lookup(key, m, stats); table != nil {
+		return table, nil
+	}
+
+	if table, err := c.load(key, generator, m); err != nil {
+		c.logger.Warn("loading dlog table %s failed: %s", key, err)
+	} else if table != nil {
+		c.mutex.Lock()
+		c.store(key, table)
+		c.mutex.Unlock()
+		c.metrics.dlogTableLookups.Inc("disk")
+		stats.TableSource = "disk"
+		return table, nil
+	}
+
+	table := c.buildTable(g, generator, m, stats)
+	c.mutex.Lock()
+	c.store(key, table)
+	c.mutex.Unlock()
+	c.metrics.dlogTableLookups.Inc("built")
+	stats.TableSource = "built"
+
+	if err := c.save(key, table); err != nil {
+		c.logger.Warn("saving dlog table %s failed: %s", key, err)
+	}
+	return table, nil
+}
+
+// lookup returns the table of the generator from memory, or nil if there's none with at least m baby steps
+func (c *DlogTables) lookup(key string, m int64, stats *DlogStats) *DlogTable {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	table, exists := c.tables[key]
+	if !exists || table.M < m {
+		return nil
+	}
+	c.touch(key)
+	c.metrics.dlogTableLookups.Inc("memory")
+	stats.TableSource = "memory"
+	return table
+}
+
+// dlogTableLock is held while a table is loaded or built; it is dropped once no search waits for it
+type dlogTableLock struct {
+	sync.Mutex
+	holders int // searches holding or waiting for the lock, guarded by the mutex of DlogTables
+}
+
+func (c *DlogTables) lockTable(key string) *dlogTableLock {
+	c.mutex.Lock()
+	lock, exists := c.builds[key]
+	if !exists {
+		lock = &dlogTableLock{}
+		c.builds[key] = lock
+	}
+	lock.holders++
+	c.mutex.Unlock()
+
+	lock.Lock()
+	return lock
+}
+
+func (c *DlogTables) unlockTable(key string, lock *dlogTableLock) {
+	lock.Unlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if lock.holders--; lock.holders == 0 {
+		delete(c.builds, key)
+	}
+}
+
+func (c *DlogTables) buildTable(g *bn256.GT, generator []byte, m int64, stats *DlogStats) *DlogTable {
+	start := time.Now()
+	table := &DlogTable{
+		Generator: generator,
+		M:         m,
+		Steps:     make(map[string]int64, m),
+	}
+
+	x := bn256.GetGTOne()
+	for i := int64(0); i < m; i++ {
+		table.Steps[dlogStepKey(x)] = i
+		x = new(bn256.GT).Add(x, g)
+	}
+	table.giantStep = new(bn256.GT).Neg(x)
+
+	elapsed := time.Since(start)
+	stats.BuildTime = GetIntPtrFromDuration(&elapsed)
+	c.logger.Info("built dlog table with %d entries in %d ns", m, elapsed.Nanoseconds())
+	return table
+}
+
+// search looks for x in [0, bound], and also in [-bound, 0) if neg is set, one giant step at a time
+func (t *DlogTable) search(h *bn256.GT, bound *big.Int, neg bool) (*big.Int, error) {
+	y := new(bn256.GT).Set(h)
+	var yNeg *bn256.GT
+	if neg {
+		yNeg = new(bn256.GT).Neg(h)
+	}
+
+	offset := new(big.Int)
+	step := big.NewInt(t.M)
+	for ; offset.Cmp(bound) <= 0; offset.Add(offset, step) {
+		if e, found := t.Steps[dlogStepKey(y)]; found {
+			return new(big.Int).Add(offset, big.NewInt(e)), nil
+		}
+		if neg {
+			if e, found := t.Steps[dlogStepKey(yNeg)]; found {
+				return new(big.Int).Neg(new(big.Int).Add(offset, big.NewInt(e))), nil
+			}
+			yNeg.Add(yNeg, t.giantStep)
+		}
+		y.Add(y, t.giantStep)
+	}
+	return nil, fmt.Errorf("failed to find the discrete logarithm within bound %s", bound)
+}
+
+//region cache
+
+// touch marks the table as the most recently used one; the mutex must be held
+func (c *DlogTables) touch(key string) {
+	for idx, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:idx], c.order[idx+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, key)
+}
+
+// store adds the table to the memory cache, and evicts the least recently used tables; the mutex must be held
+func (c *DlogTables) store(key string, table *DlogTable) {
+	c.tables[key] = table
+	c.touch(key)
+	for len(c.order) > c.cacheSize {
+		delete(c.tables, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// load reads the table of the generator from disk; nil is returned if there's none with at least m baby steps
+func (c *DlogTables) load(key string, generator []byte, m int64) (*DlogTable, error) {
+	if c.dir == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, key+".gob"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table := &DlogTable{}
+	if err = gob.NewDecoder(file).Decode(table); err != nil {
+		return nil, err
+	}
+	if string(table.Generator) != string(generator) {
+		return nil, fmt.Errorf("generator mismatch")
+	}
+	if table.M < m {
+		return nil, nil
+	}
+
+	g := new(bn256.GT)
+	if _, err = g.Unmarshal(table.Generator); err != nil {
+		return nil, err
+	}
+	table.giantStep = new(bn256.GT).Neg(new(bn256.GT).ScalarMult(g, big.NewInt(table.M)))
+	c.logger.Info("loaded dlog table %s with %d entries", key, table.M)
+	return table, nil
+}
+
+// save writes the table to disk; it is written to a temporary file first, so that a table is never read half-written
+func (c *DlogTables) save(key string, table *DlogTable) error {
+	if c.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err = gob.NewEncoder(file).Encode(table); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(c.dir, key+".gob"))
+}
+
+//endregion
+
+func dlogTableKey(generator []byte) string {
+	hash := sha1.Sum(generator)
+	return hex.EncodeToString(hash[:])
+}
+
+// dlogStepKey truncates the hash of x, as the tables hold millions of entries
+func dlogStepKey(x *bn256.GT) string {
+	hash := sha1.Sum(x.Marshal())
+	return string(hash[:10])
+}
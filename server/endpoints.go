@@ -1,15 +1,24 @@
 package server
 
 import (
+	"errors"
 	. "fe/common"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
 )
 
+// forbidden is the response to a caller that may not access the resources of subject, see AuthorizeSubject
+func forbidden(c *gin.Context, subject UUID) (ResponseType, int, any) {
+	return ErrorResponse, http.StatusForbidden, fmt.Sprintf("%s may not access %s", GetPrincipal(c), subject)
+}
+
 //region SENSOR endpoints
 
-// addSensorEndpoint creates new Sensor (or fetches existing) and adds it to the specified Customer.
+// addSensorEndpoint creates new Sensor (or fetches existing) and adds it to the specified Customer. If the endpoints
+// are authenticated, a new Sensor is issued the API key it submits its ciphers with, which is returned only once;
+// only the operators may add sensors, as whoever holds the key can submit ciphers as the sensor.
 //
 // endpoint: [POST] /customers/:id/sensors
 func (server *Server) addSensorEndpoint(c *gin.Context) (ResponseType, int, any) {
@@ -29,29 +38,40 @@ func (server *Server) addSensorEndpoint(c *gin.Context) (ResponseType, int, any)
 
 	customer, err := server.GetCustomer(customerId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
 	if !body.SensorId.Verify() {
 		return ErrorResponse, http.StatusBadRequest, fmt.Sprintf("invalid uuid %s", body.SensorId)
 	}
 
-	server.AddSensorToCustomer(body.SensorId, body.IP, customer)
+	// the key of an existing sensor isn't issued again
+	_, exists := server.sensors.Load(body.SensorId)
+	server.AddSensorToCustomer(body.SensorId, body.IP, body.PublicKey, customer)
+	if server.Authenticator == nil || exists {
+		return NoResponse, http.StatusNoContent, nil
+	}
 
-	return NoResponse, http.StatusNoContent, nil
+	apiKey, err := server.Authenticator.IssueAPIKey(Principal{Role: RoleSensor, Subject: body.SensorId})
+	if err != nil {
+		return ErrorResponse, http.StatusInternalServerError, err.Error()
+	}
+	return JSONResponse, http.StatusCreated, IssuedAPIKey{APIKey: apiKey}
 }
 
-// endpoint: [DELETE] /group/:id/sensor
+// endpoint: [DELETE] /customers/:id/sensors/:sensorId
 func (server *Server) removeSensorEndpoint(c *gin.Context) (ResponseType, int, any) {
 	//region param parsing
 	customerIdString := c.Param("id")
 
-	var body struct {
-		SensorId string `json:"sensorId"`
-	}
-
-	if err := c.BindJSON(&body); err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+	// the deprecated endpoint has the sensor id in the body
+	sensorIdString := c.Param("sensorId")
+	if sensorIdString == "" {
+		var body RemoveSensorRequest
+		if err := c.BindJSON(&body); err != nil {
+			return ErrorResponse, http.StatusBadRequest, err
+		}
+		sensorIdString = body.SensorId
 	}
 	//endregion
 
@@ -59,20 +79,23 @@ func (server *Server) removeSensorEndpoint(c *gin.Context) (ResponseType, int, a
 	if err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
+	if !AuthorizeSubject(c, RoleCustomer, customerId) {
+		return forbidden(c, customerId)
+	}
 
 	customer, err := server.GetCustomer(customerId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
-	sensorId, err := NewUUIDFromString(body.SensorId)
+	sensorId, err := NewUUIDFromString(sensorIdString)
 	if err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
 
 	sensor, exists := server.sensors.Load(sensorId)
 	if !exists {
-		return ErrorResponse, http.StatusBadRequest, "Sensor with the provided id does not exist."
+		return ErrorResponse, http.StatusNotFound, "Sensor with the provided id does not exist."
 	}
 
 	// ongoing tasks won't be affected!
@@ -81,32 +104,94 @@ func (server *Server) removeSensorEndpoint(c *gin.Context) (ResponseType, int, a
 	return NoResponse, http.StatusNoContent, nil
 }
 
-// endpoint: [POST] /task/:taskId/:sensorId
+// submitCipherEndpoint accepts a cipher of batch no batch of the sensor, with its commitment in BatchCommitmentHeader;
+// late ciphers are accepted until the deadline of the task
+//
+// endpoint: [POST] /tasks/:taskId/sensors/:sensorId/ciphers?batch=
 func (server *Server) submitCipherEndpoint(c *gin.Context) (ResponseType, int, any) {
 
 	// get task uuid
 	taskIdString := c.Param("taskId")
 	taskId, err := NewUUIDFromString(taskIdString)
 	if err != nil {
+		server.metrics.ciphersRejected.Inc(rejectedInvalidTask)
 		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
 	}
 
 	// get task
 	task, err := server.GetTask(taskId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		server.metrics.ciphersRejected.Inc(rejectedInvalidTask)
+		return ErrorResponse, http.StatusNotFound, err
+	}
+
+	sensorId, err := NewUUIDFromString(c.Param("sensorId"))
+	if err != nil {
+		server.metrics.ciphersRejected.Inc(rejectedInvalidCipher)
+		return ErrorResponse, http.StatusBadRequest, "invalid sensor uuid"
+	}
+	if !AuthorizeSubject(c, RoleSensor, sensorId) {
+		server.metrics.ciphersRejected.Inc(rejectedForbidden)
+		return forbidden(c, sensorId)
 	}
 
 	// get FECipher
 	bytes, err := c.GetRawData()
 	if err != nil {
+		server.metrics.ciphersRejected.Inc(rejectedInvalidCipher)
 		return ErrorResponse, http.StatusBadRequest, err
 	}
 
 	feCipher, err := Decode(bytes)
+	if err != nil {
+		server.metrics.ciphersRejected.Inc(rejectedInvalidCipher)
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+
+	batchIdx, err := strconv.Atoi(c.Query("batch"))
+	if err != nil {
+		server.metrics.ciphersRejected.Inc(rejectedInvalidCipher)
+		return ErrorResponse, http.StatusBadRequest, "invalid batch no"
+	}
+
+	var commitment *BatchCommitment
+	if header := c.GetHeader(BatchCommitmentHeader); header != "" {
+		if commitment, err = ParseBatchCommitment(header); err != nil {
+			server.metrics.ciphersRejected.Inc(rejectedCommitment)
+			return ErrorResponse, http.StatusBadRequest, err.Error()
+		}
+	}
+	if err = task.VerifyCommitment(sensorId, batchIdx, bytes, commitment); err != nil {
+		server.metrics.ciphersRejected.Inc(rejectedCommitment)
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	if err = task.CheckCipher(sensorId, batchIdx, feCipher); err != nil {
+		server.metrics.ciphersRejected.Inc(rejectedInvalidCipher)
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	switch err = task.AcceptCipher(sensorId, batchIdx, bytes, commitment); err {
+	case nil:
+	case errLateCipher:
+		server.metrics.ciphersRejected.Inc(rejectedLate)
+		return ErrorResponse, http.StatusGone, err
+	case errDuplicateCipher:
+		server.metrics.ciphersRejected.Inc(rejectedDuplicate)
+		return ErrorResponse, http.StatusConflict, err
+	default:
+		server.metrics.ciphersRejected.Inc(rejectedInvalidCipher)
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+	server.metrics.ciphersReceived.Inc()
+
+	RequestLogger(c, server.HttpLogger).
+		WithField(TaskIdField, taskId).
+		WithField(SensorIdField, c.Param("sensorId")).
+		Info("cipher received")
 
 	// won't return any errors, we'll need to check for errors
-	go task.AddCipher(feCipher)
+	go task.AddCipher(sensorId, batchIdx, feCipher)
 
 	return NoResponse, http.StatusAccepted, nil
 }
@@ -115,16 +200,27 @@ func (server *Server) submitCipherEndpoint(c *gin.Context) (ResponseType, int, a
 
 //region CUSTOMER endpoints
 
-// endpoint: [POST] /customer
+// createCustomerEndpoint creates a new Customer; if the endpoints are authenticated, the customer is issued the API
+// key it accesses its own resources with, which is returned only once
+//
+// endpoint: [POST] /customers
 func (server *Server) createCustomerEndpoint(c *gin.Context) (ResponseType, int, any) {
 	customer := server.AddCustomer()
 
 	// return customer uuid
-	server.HttpLogger.Info("created customer %s [%s]", customer.Uuid, customer)
-	return JSONResponse, http.StatusCreated, gin.H{"id": customer.Uuid}
+	server.HttpLogger.Info("created customer %s", customer.Uuid)
+	if server.Authenticator == nil {
+		return JSONResponse, http.StatusCreated, CreatedCustomer{Id: customer.Uuid}
+	}
+
+	apiKey, err := server.Authenticator.IssueAPIKey(Principal{Role: RoleCustomer, Subject: customer.Uuid})
+	if err != nil {
+		return ErrorResponse, http.StatusInternalServerError, err.Error()
+	}
+	return JSONResponse, http.StatusCreated, CreatedCustomer{Id: customer.Uuid, APIKey: apiKey}
 }
 
-// endpoint: [GET] /customer/:id
+// endpoint: [GET] /customers/:id
 func (server *Server) getCustomerDetailsEndpoint(c *gin.Context) (ResponseType, int, any) {
 	customerIdString := c.Param("id")
 
@@ -132,13 +228,76 @@ func (server *Server) getCustomerDetailsEndpoint(c *gin.Context) (ResponseType,
 	if err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
+	if !AuthorizeSubject(c, RoleCustomer, customerId) {
+		return forbidden(c, customerId)
+	}
 
 	customer, err := server.GetCustomer(customerId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
+	}
+
+	return JSONResponse, http.StatusOK, customer.Details()
+}
+
+// getStatementsEndpoint returns the billing statement of the customer's tasks that start in the period [from, to)
+// (timestamps; by default, all the tasks), or of the task only; without the format, the statement is returned as
+// JSON, otherwise it's downloaded as a JSON, CSV or HTML file
+//
+// endpoint: [GET] /customers/:id/statements?from=&to=&task=&format=
+func (server *Server) getStatementsEndpoint(c *gin.Context) (ResponseType, int, any) {
+	//region param parsing
+	customerId, err := NewUUIDFromString(c.Param("id"))
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid customer uuid"
+	}
+	if !AuthorizeSubject(c, RoleCustomer, customerId) {
+		return forbidden(c, customerId)
 	}
 
-	return JSONResponse, http.StatusOK, customer
+	var from, to int64
+	if fromString := c.Query("from"); fromString != "" {
+		if from, err = strconv.ParseInt(fromString, 10, 64); err != nil || from < 0 {
+			return ErrorResponse, http.StatusBadRequest, "invalid period start"
+		}
+	}
+	if toString := c.Query("to"); toString != "" {
+		if to, err = strconv.ParseInt(toString, 10, 64); err != nil || to <= from {
+			return ErrorResponse, http.StatusBadRequest, "invalid period end"
+		}
+	}
+	format := c.Query("format")
+	//endregion
+
+	if _, err = server.GetCustomer(customerId); err != nil {
+		return ErrorResponse, http.StatusNotFound, err.Error()
+	}
+
+	var statement *PeriodStatement
+	if taskIdString := c.Query("task"); taskIdString != "" {
+		taskId, err := NewUUIDFromString(taskIdString)
+		if err != nil {
+			return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+		}
+		task, err := server.GetTask(taskId)
+		if err != nil || task.CustomerId != customerId {
+			return ErrorResponse, http.StatusNotFound, fmt.Sprintf("task %s of customer %s does not exist", taskId, customerId)
+		}
+		if statement, err = server.TaskStatement(task); err != nil {
+			return ErrorResponse, http.StatusConflict, err.Error()
+		}
+	} else {
+		statement = server.PeriodStatement(customerId, from, to)
+	}
+
+	if format == "" {
+		return JSONResponse, http.StatusOK, statement
+	}
+	file, err := RenderStatement(statement, format)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+	return FileResponse, http.StatusOK, file
 }
 
 /*// endpoint: [GET] /customer/:id/lock
@@ -151,7 +310,7 @@ func (server *Server) lockCustomerEndpoint(c *gin.Context) (ResponseType, int, a
 
 	customer, err := server.GetCustomer(customerId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
 	customer.Lock()
@@ -168,7 +327,7 @@ func (server *Server) unlockCustomerEndpoint(c *gin.Context) (ResponseType, int,
 
 	customer, err := server.GetCustomer(customerId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
 	customer.Unlock()
@@ -182,49 +341,30 @@ func (server *Server) unlockCustomerEndpoint(c *gin.Context) (ResponseType, int,
 
 // addTaskEndpoint creates a new Task based on ServerTaskRequest and sends it to the TaskDaemon chan
 //
-// endpoint: [POST] /customer/:id/task
+// endpoint: [POST] /tasks
 func (server *Server) addTaskEndpoint(c *gin.Context) (ResponseType, int, any) {
 
-	if !server.IsAuthoritySet() {
-		return ErrorResponse, http.StatusBadRequest, "authority must be set before task creation"
-	}
-
 	// Parse the JSON data from the request body into the ServerTaskRequest struct
 	var taskRequest ServerTaskRequest
 	if err := c.BindJSON(&taskRequest); err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
-
-	//region asserts
-	errors := make([]error, 0)
-
-	// there should be exactly SampleCount rates
-	tariff, exists := GetTariff(taskRequest.TariffId)
-	if !exists {
-		return ErrorResponse, http.StatusBadRequest, fmt.Sprintf("tariff with id %s does not exist", taskRequest.TariffId)
+	if !AuthorizeSubject(c, RoleCustomer, taskRequest.CustomerId) {
+		return forbidden(c, taskRequest.CustomerId)
 	}
 
-	// submission frequency must be a divisor of sample count
-	if taskRequest.Duration%(tariff.BatchSize*tariff.SamplingPeriod) != 0 || taskRequest.Duration/(tariff.SamplingPeriod*tariff.BatchSize) == 0 {
-		return ErrorResponse, http.StatusBadRequest, "subscription duration must be a multiple of the time needed to generate one batch"
+	validation := server.ValidateTaskRequest(taskRequest)
+	if !validation.Valid {
+		return ErrorResponse, http.StatusBadRequest, validation.errors()
 	}
-
-	// todo assert that maxvalue fits in int64
-	// todo assert >=1 period
-	// todo assert SampleCount > 0
-	// todo assert t.BatchSize > 0
-	// todo assert start is in the future
-
-	if len(errors) > 0 {
-		return ErrorResponse, http.StatusBadRequest, errors
+	for _, warning := range validation.Warnings {
+		server.HttpLogger.Warn("task request: %s", warning)
 	}
 
-	//endregion
-
-	// get CustomerId
+	// the customer exists, as the request is valid
 	customer, err := server.GetCustomer(taskRequest.CustomerId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
 
 	// create new Task
@@ -232,21 +372,50 @@ func (server *Server) addTaskEndpoint(c *gin.Context) (ResponseType, int, any) {
 	if err = task.SetSensors(customer); err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
+	if err = task.SetScheme(); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+	if err = task.CheckSensorClocks(); err != nil {
+		return ErrorResponse, http.StatusConflict, err.Error()
+	}
 
-	// send task to TaskDaemon
+	task.events.Publish(eventCreated, taskCreatedEvent{
+		Scheme:    task.Scheme,
+		SensorCnt: len(task.Sensors),
+		BatchCnt:  task.BatchCnt,
+		Deadline:  task.Deadline().Unix(),
+	})
+
+	// send task to TaskDaemon; the task is added first, so that it's found by its worker, and removed if it isn't
+	// accepted, as it will never run
 	server.AddTask(task)
-	server.SendTaskToDaemon(task)
+	if err = server.SendTaskToDaemon(task); err != nil {
+		server.RemoveTask(task.Id)
+		task.fail(err.Error())
+		return ErrorResponse, http.StatusServiceUnavailable, err
+	}
 	server.HttpLogger.Info("task %s sent to task daemon", task.Id)
 
 	return StringResponse, http.StatusAccepted, string(task.Id)
 }
 
-// endpoint: [DELETE] /task/:id
-func (server *Server) removeTaskEndpoint(c *gin.Context) (ResponseType, int, any) {
-	return ErrorResponse, http.StatusInternalServerError, "not implemented"
+// validateTaskEndpoint validates ServerTaskRequest without creating a Task, and reports the errors, the warnings and
+// the limits (result bound and decryption cost) of the task
+//
+// endpoint: [POST] /tasks/validate
+func (server *Server) validateTaskEndpoint(c *gin.Context) (ResponseType, int, any) {
+	var taskRequest ServerTaskRequest
+	if err := c.BindJSON(&taskRequest); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
+	if !AuthorizeSubject(c, RoleCustomer, taskRequest.CustomerId) {
+		return forbidden(c, taskRequest.CustomerId)
+	}
+
+	return JSONResponse, http.StatusOK, server.ValidateTaskRequest(taskRequest)
 }
 
-// endpoint: [GET] /task/:id
+// endpoint: [GET] /tasks/:id
 func (server *Server) getTaskDetailsEndpoint(c *gin.Context) (ResponseType, int, any) {
 	// get task uuid
 	taskIdString := c.Param("id")
@@ -258,27 +427,22 @@ func (server *Server) getTaskDetailsEndpoint(c *gin.Context) (ResponseType, int,
 	// get task
 	task, err := server.GetTask(taskId)
 	if err != nil {
-		return ErrorResponse, http.StatusBadRequest, err
+		return ErrorResponse, http.StatusNotFound, err
 	}
-
-	type sensorInfo struct {
-		Id            UUID `json:"id"`
-		SubmittedTask bool `json:"task_submitted"`
+	if !AuthorizeSubject(c, RoleCustomer, task.CustomerId) {
+		return forbidden(c, task.Id)
 	}
 
-	response := struct {
-		TaskId     UUID         `json:"task_id"`
-		CustomerId UUID         `json:"customer_id"`
-		Sensors    []sensorInfo `json:"sensors"`
-		SamplingParams
-
-		DecryptorStats any   `json:"decryptor_stats"`
-		Result         int64 `json:"result"`
-	}{
+	response := TaskDetails{
 		TaskId:         task.Id,
 		CustomerId:     task.CustomerId,
-		Sensors:        make([]sensorInfo, len(task.Sensors)),
+		Sensors:        make([]TaskSensorDetails, len(task.Sensors)),
+		Scheme:         task.Scheme,
+		Threshold:      task.Threshold,
+		Status:         task.Status,
 		SamplingParams: task.SamplingParams,
+		Deadline:       task.Deadline().Unix(),
+		MissingBatches: task.GetMissingBatches(),
 	}
 
 	if task.feDecryptor != nil {
@@ -287,18 +451,131 @@ func (server *Server) getTaskDetailsEndpoint(c *gin.Context) (ResponseType, int,
 
 	if task.Result != nil {
 		response.Result = task.Result.Int64()
+		response.Amount = FormatFixedPoint(task.Result, task.Tariff.ResultScale())
 	}
 
 	for idx, sensor := range task.Sensors {
-		response.Sensors[idx] = sensorInfo{
+		response.Sensors[idx] = TaskSensorDetails{
 			Id:            sensor.Id,
 			SubmittedTask: task.submittedToSensors[idx].Load(),
+			ClockSync:     sensor.GetClockSync(),
 		}
 	}
 
 	return JSONResponse, http.StatusOK, response
 }
 
+// getTaskProgressEndpoint returns the running totals of the task, from the shortest prefix; the last point is
+// the result of the task, once it's decrypted
+//
+// endpoint: [GET] /tasks/:id/progress
+func (server *Server) getTaskProgressEndpoint(c *gin.Context) (ResponseType, int, any) {
+	// get task uuid
+	taskIdString := c.Param("id")
+	taskId, err := NewUUIDFromString(taskIdString)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	// get task
+	task, err := server.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err
+	}
+	if !AuthorizeSubject(c, RoleCustomer, task.CustomerId) {
+		return forbidden(c, task.Id)
+	}
+
+	response := TaskProgress{
+		TaskId:         task.Id,
+		Status:         task.Status,
+		ProgressWindow: task.ProgressWindow,
+		BatchCnt:       task.BatchCnt,
+		Points:         make([]TaskProgressPoint, 0),
+	}
+
+	resultScale := task.Tariff.ResultScale()
+	for _, point := range task.GetProgress() {
+		response.Points = append(response.Points, TaskProgressPoint{
+			Batches:    point.Batches,
+			End:        point.End.Unix(),
+			ComputedAt: point.ComputedAt.Unix(),
+			Result:     point.Result.Int64(),
+			Amount:     FormatFixedPoint(point.Result, resultScale),
+		})
+	}
+
+	// a partial result doesn't cover all the batches, but it's final too
+	if task.Result != nil {
+		response.Points = append(response.Points, TaskProgressPoint{
+			Batches: task.BatchCnt,
+			End:     task.End().Unix(),
+			Result:  task.Result.Int64(),
+			Amount:  FormatFixedPoint(task.Result, resultScale),
+			Final:   true,
+		})
+	}
+
+	return JSONResponse, http.StatusOK, response
+}
+
+// getTaskEventsEndpoint streams the events of the task as server-sent events, from the first one, or from the one
+// after the Last-Event-ID header; the stream ends after the result, or after the task fails
+//
+// endpoint: [GET] /tasks/:id/events
+func (server *Server) getTaskEventsEndpoint(c *gin.Context) (ResponseType, int, any) {
+	// get task uuid
+	taskIdString := c.Param("id")
+	taskId, err := NewUUIDFromString(taskIdString)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	// get task
+	task, err := server.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err.Error()
+	}
+	if !AuthorizeSubject(c, RoleCustomer, task.CustomerId) {
+		return forbidden(c, task.Id)
+	}
+
+	lastEventId, err := ParseLastEventId(c)
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
+
+	return StreamResponse, http.StatusOK, task.Events(lastEventId)
+}
+
+// getTaskBundleEndpoint returns the signed bundle of the billed task, which cmd/verify checks offline; the tasks whose
+// key is combined by the server (in the threshold and the decentralized modes) have no bundle
+//
+// endpoint: [GET] /tasks/:id/bundle
+func (server *Server) getTaskBundleEndpoint(c *gin.Context) (ResponseType, int, any) {
+	taskId, err := NewUUIDFromString(c.Param("id"))
+	if err != nil {
+		return ErrorResponse, http.StatusBadRequest, "invalid task uuid"
+	}
+
+	task, err := server.GetTask(taskId)
+	if err != nil {
+		return ErrorResponse, http.StatusNotFound, err.Error()
+	}
+	if !AuthorizeSubject(c, RoleCustomer, task.CustomerId) {
+		return forbidden(c, task.Id)
+	}
+
+	bundle, err := task.Bundle(server.Signer)
+	if errors.Is(err, ErrUnattestedKey) {
+		return ErrorResponse, http.StatusNotImplemented, err.Error()
+	} else if err != nil {
+		return ErrorResponse, http.StatusConflict, err.Error()
+	}
+
+	return JSONResponse, http.StatusOK, bundle
+}
+
 //endregion
 
 //region RATE endpoints
@@ -309,6 +586,9 @@ func (server *Server) addTariffEndpoint(c *gin.Context) (ResponseType, int, any)
 	if err := c.BindJSON(&tariff); err != nil {
 		return ErrorResponse, http.StatusBadRequest, err
 	}
+	if err := tariff.Validate(); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err.Error()
+	}
 
 	SaveTariff(tariff)
 
@@ -341,30 +621,196 @@ func (server *Server) setAuthorityEndpoint(c *gin.Context) (ResponseType, int, a
 		return StringResponse, http.StatusOK, msg
 
 	} else {
-		return ErrorResponse, http.StatusBadRequest, fmt.Errorf("could not set authority %s, as authority %s is already set", newAuthority.IP.String(), server.Authority.IP.String())
+		return ErrorResponse, http.StatusConflict, fmt.Errorf("could not set authority %s, as authority %s is already set", newAuthority.IP.String(), server.Authority.IP.String())
 	}
 
 }
 
-//endregion
+// addShareHolderEndpoint registers a share holder of the threshold mode; share holders are assigned to the tasks
+// that are created afterwards
+//
+// endpoint: [POST] /authority/share-holders
+func (server *Server) addShareHolderEndpoint(c *gin.Context) (ResponseType, int, any) {
+	var ip IP
+	if err := c.BindJSON(&ip); err != nil {
+		return ErrorResponse, http.StatusBadRequest, err
+	}
 
-func (server *Server) GetEndpoints() []Endpoint {
-	return []Endpoint{
-		{"POST", "/customer", server.createCustomerEndpoint},
-		{"GET", "/customer/:id", server.getCustomerDetailsEndpoint},
+	if !server.AddShareHolder(ip) {
+		msg := fmt.Sprintf("share holder %s is already set", ip.String())
+		server.HttpLogger.Info(msg)
+		return StringResponse, http.StatusOK, msg
+	}
+
+	msg := fmt.Sprintf("share holder %s set successfully", ip.String())
+	server.HttpLogger.Info(msg)
+	return StringResponse, http.StatusOK, msg
+}
+
+// getShareHoldersEndpoint reports the health of every share holder, and the shares it holds
+//
+// endpoint: [GET] /authority/share-holders
+func (server *Server) getShareHoldersEndpoint(c *gin.Context) (ResponseType, int, any) {
+	shareHolders := server.GetShareHolders()
+	response := ShareHolders{
+		Threshold:    server.config.AuthorityThreshold,
+		ShareHolders: make([]ShareHolderInfo, len(shareHolders)),
+	}
+
+	for idx, shareHolder := range shareHolders {
+		info := ShareHolderInfo{IP: shareHolder.IP.String()}
+		status, err := shareHolder.FetchStatus()
+		if err != nil {
+			info.Error = err.Error()
+		} else {
+			info.Healthy = true
+			info.Status = status
+			response.Healthy++
+		}
+		response.ShareHolders[idx] = info
+	}
 
-		//{"GET", "/group/:id/lock", server.lockGroupEndpoint},
-		//{"GET", "/group/:id/unlock", server.unlockGroupEndpoint},
+	return JSONResponse, http.StatusOK, response
+}
 
-		{"POST", "/group/:id/sensor", server.addSensorEndpoint},
-		{"DELETE", "/group/:id/sensor", server.removeSensorEndpoint},
+//endregion
 
-		{"POST", "/task", server.addTaskEndpoint},
-		{"DELETE", "/task/:id", server.removeTaskEndpoint},
-		{"GET", "/task/:id", server.getTaskDetailsEndpoint},
-		{"POST", "/task/:taskId/:sensorId", server.submitCipherEndpoint},
+// the roles of the endpoints, see Endpoint.Roles; the customers and the sensors are scoped to their own resources by
+// the handlers
+var (
+	operatorRoles  = []Role{RoleOperator}
+	customerRoles  = []Role{RoleOperator, RoleCustomer}
+	sensorRoles    = []Role{RoleSensor}
+	authorityRoles = []Role{RoleOperator, RoleAuthority}
+)
 
-		{"POST", "/authority", server.setAuthorityEndpoint},
-		{"POST", "/tariff", server.addTariffEndpoint},
-	}
+func (server *Server) GetEndpoints() []Endpoint {
+	return append(server.getV1Endpoints(), server.getDeprecatedEndpoints()...)
+}
+
+func (server *Server) getV1Endpoints() []Endpoint {
+	customers := RouteGroup{Prefix: V1Prefix + "/customers", Roles: customerRoles, Envelope: true}
+	tasks := RouteGroup{Prefix: V1Prefix + "/tasks", Roles: customerRoles, Envelope: true}
+	authorities := RouteGroup{Prefix: V1Prefix + "/authority", Roles: operatorRoles, Envelope: true}
+
+	endpoints := customers.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: server.createCustomerEndpoint, Roles: operatorRoles,
+			Summary: "create a customer", Status: http.StatusCreated, Response: CreatedCustomer{}},
+		{Method: "GET", Path: "/:id", Handler: server.getCustomerDetailsEndpoint,
+			Summary: "the customer and its sensors", Response: CustomerDetails{}},
+		{Method: "GET", Path: "/:id/statements", Handler: server.getStatementsEndpoint,
+			Summary: "the billing statement of the customer's tasks, or of one of them",
+			Query: map[string]string{
+				"from":   "timestamp; only the tasks that start at or after it",
+				"to":     "timestamp; only the tasks that start before it",
+				"task":   "id of the task, instead of the period",
+				"format": "json, csv or html; the statement is downloaded as a file",
+			},
+			Response: Statement{}},
+		{Method: "POST", Path: "/:id/sensors", Handler: server.addSensorEndpoint, Roles: operatorRoles,
+			Summary: "add a sensor to the customer; a new sensor is issued its API key", Request: RegisterSensorRequest{},
+			Status: http.StatusCreated, Response: IssuedAPIKey{}},
+		{Method: "DELETE", Path: "/:id/sensors/:sensorId", Handler: server.removeSensorEndpoint,
+			Summary: "remove a sensor from the customer", Status: http.StatusNoContent},
+	})
+
+	endpoints = append(endpoints, tasks.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: server.addTaskEndpoint,
+			Summary: "create a task; the response is its id", Request: ServerTaskRequest{},
+			Status: http.StatusAccepted, Response: BodyText},
+		{Method: "POST", Path: "/validate", Handler: server.validateTaskEndpoint,
+			Summary: "validate a task without creating it", Request: ServerTaskRequest{}, Response: TaskValidation{}},
+		{Method: "GET", Path: "/:id", Handler: server.getTaskDetailsEndpoint,
+			Summary: "the task and its result", Response: TaskDetails{}},
+		{Method: "GET", Path: "/:id/progress", Handler: server.getTaskProgressEndpoint,
+			Summary: "the running totals of the task", Response: TaskProgress{}},
+		{Method: "GET", Path: "/:id/events", Handler: server.getTaskEventsEndpoint,
+			Summary: "the events of the task, as server-sent events", Response: BodyEventStream},
+		{Method: "GET", Path: "/:id/bundle", Handler: server.getTaskBundleEndpoint,
+			Summary: "the signed bundle the result of the task is verified with", Response: Bundle{}},
+		{Method: "POST", Path: "/:taskId/sensors/:sensorId/ciphers", Handler: server.submitCipherEndpoint, Roles: sensorRoles,
+			Summary: "submit a cipher of the sensor, with its commitment in the X-Batch-Commitment header",
+			Query:   map[string]string{"batch": "index of the batch"},
+			Request: BodyOctetStream, Status: http.StatusAccepted},
+	})...)
+
+	endpoints = append(endpoints, authorities.Endpoints([]Endpoint{
+		{Method: "PUT", Path: "/", Handler: server.setAuthorityEndpoint,
+			Summary: "set the authority", Request: IP{}, Response: BodyText},
+		{Method: "POST", Path: "/share-holders", Handler: server.addShareHolderEndpoint,
+			Summary: "add a share holder of the threshold mode", Request: IP{}, Response: BodyText},
+		{Method: "GET", Path: "/share-holders", Handler: server.getShareHoldersEndpoint, Roles: authorityRoles,
+			Summary: "the health of the share holders", Response: ShareHolders{}},
+	})...)
+
+	return append(endpoints, Endpoint{Method: "POST", Path: V1Prefix + "/tariffs", Handler: server.addTariffEndpoint,
+		Roles: operatorRoles, Envelope: true,
+		Summary: "add a tariff; the response is its id", Request: Tariff{}, Status: http.StatusAccepted, Response: BodyText})
+}
+
+// getDeprecatedEndpoints returns the unversioned endpoints, which the /v1 ones replace
+func (server *Server) getDeprecatedEndpoints() []Endpoint {
+	customers := RouteGroup{Prefix: "/customer", Roles: customerRoles, Deprecated: true}
+	groups := RouteGroup{Prefix: "/group", Roles: customerRoles, Deprecated: true}
+	tasks := RouteGroup{Prefix: "/task", Roles: customerRoles, Deprecated: true}
+	authorities := RouteGroup{Prefix: "/authority", Roles: operatorRoles, Deprecated: true}
+
+	endpoints := customers.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: server.createCustomerEndpoint, Roles: operatorRoles,
+			Summary: "create a customer", Status: http.StatusCreated, Response: CreatedCustomer{}},
+		{Method: "GET", Path: "/:id", Handler: server.getCustomerDetailsEndpoint,
+			Summary: "the customer and its sensors", Response: CustomerDetails{}},
+		{Method: "GET", Path: "/:id/statements", Handler: server.getStatementsEndpoint,
+			Summary: "the billing statement of the customer's tasks, or of one of them",
+			Query: map[string]string{
+				"from":   "timestamp; only the tasks that start at or after it",
+				"to":     "timestamp; only the tasks that start before it",
+				"task":   "id of the task, instead of the period",
+				"format": "json, csv or html; the statement is downloaded as a file",
+			},
+			Response: Statement{}},
+	})
+
+	//{Method: "GET", Path: "/group/:id/lock", Handler: server.lockGroupEndpoint},
+	//{Method: "GET", Path: "/group/:id/unlock", Handler: server.unlockGroupEndpoint},
+	endpoints = append(endpoints, groups.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/:id/sensor", Handler: server.addSensorEndpoint, Roles: operatorRoles,
+			Summary: "add a sensor to the customer; a new sensor is issued its API key", Request: RegisterSensorRequest{},
+			Status: http.StatusCreated, Response: IssuedAPIKey{}},
+		{Method: "DELETE", Path: "/:id/sensor", Handler: server.removeSensorEndpoint,
+			Summary: "remove a sensor from the customer", Request: RemoveSensorRequest{}, Status: http.StatusNoContent},
+	})...)
+
+	endpoints = append(endpoints, tasks.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: server.addTaskEndpoint,
+			Summary: "create a task; the response is its id", Request: ServerTaskRequest{},
+			Status: http.StatusAccepted, Response: BodyText},
+		{Method: "POST", Path: "/validate", Handler: server.validateTaskEndpoint,
+			Summary: "validate a task without creating it", Request: ServerTaskRequest{}, Response: TaskValidation{}},
+		{Method: "GET", Path: "/:id", Handler: server.getTaskDetailsEndpoint,
+			Summary: "the task and its result", Response: TaskDetails{}},
+		{Method: "GET", Path: "/:id/progress", Handler: server.getTaskProgressEndpoint,
+			Summary: "the running totals of the task", Response: TaskProgress{}},
+		{Method: "GET", Path: "/:id/events", Handler: server.getTaskEventsEndpoint,
+			Summary: "the events of the task, as server-sent events", Response: BodyEventStream},
+		{Method: "GET", Path: "/:id/bundle", Handler: server.getTaskBundleEndpoint,
+			Summary: "the signed bundle the result of the task is verified with", Response: Bundle{}},
+		{Method: "POST", Path: "/:taskId/:sensorId", Handler: server.submitCipherEndpoint, Roles: sensorRoles,
+			Summary: "submit a cipher of the sensor, with its commitment in the X-Batch-Commitment header",
+			Query:   map[string]string{"batch": "index of the batch"},
+			Request: BodyOctetStream, Status: http.StatusAccepted},
+	})...)
+
+	endpoints = append(endpoints, authorities.Endpoints([]Endpoint{
+		{Method: "POST", Path: "/", Handler: server.setAuthorityEndpoint,
+			Summary: "set the authority", Request: IP{}, Response: BodyText},
+		{Method: "POST", Path: "/share-holder", Handler: server.addShareHolderEndpoint,
+			Summary: "add a share holder of the threshold mode", Request: IP{}, Response: BodyText},
+		{Method: "GET", Path: "/share-holders", Handler: server.getShareHoldersEndpoint, Roles: authorityRoles,
+			Summary: "the health of the share holders", Response: ShareHolders{}},
+	})...)
+
+	return append(endpoints, Endpoint{Method: "POST", Path: "/tariff", Handler: server.addTariffEndpoint,
+		Roles: operatorRoles, Deprecated: true,
+		Summary: "add a tariff; the response is its id", Request: Tariff{}, Status: http.StatusAccepted, Response: BodyText})
 }
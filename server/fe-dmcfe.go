@@ -0,0 +1,238 @@
+package server
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/bn256"
+	"math/big"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//region DMCFEDecryptor
+
+// DMCFEDecryptor decrypts a batch as soon as the ciphers of all the sensors for it arrive, and sums the results
+// of all the batches; as every batch has a key of its own, the decrypted batches can be billed when the others
+// are missing, without a restricted key (see PartialDecryptor)
+type DMCFEDecryptor struct {
+	*DMCFEDecryptionParams
+
+	Ciphers          [][]*bn256.G1 // for every batch, the ciphers of all the clients
+	RemainingCiphers []int         // for every batch
+	RemainingBatches int
+	cipherMutex      sync.Mutex // ciphers are added concurrently
+
+	DecryptionTime atomic.Int64 // in nanoseconds
+	DlogStats      []*DlogStats // for every batch
+
+	BatchResults []*big.Int // for every batch, nil until it's decrypted
+	Result       *big.Int   // the sum of the decrypted batches
+	ResultReady  atomic.Bool
+	Partial      bool // the Result is computed by DecryptPartial
+	resultMutex  sync.Mutex
+
+	dlogTables *DlogTables
+	metrics    *serverMetrics
+	logger     *Logger
+}
+
+func newDMCFEDecryptor(params *DMCFEDecryptionParams, dlogTables *DlogTables, metrics *serverMetrics, logger *Logger) *DMCFEDecryptor {
+	decryptor := &DMCFEDecryptor{
+		DMCFEDecryptionParams: params,
+		Ciphers:               make([][]*bn256.G1, params.BatchCnt),
+		RemainingCiphers:      make([]int, params.BatchCnt),
+		RemainingBatches:      params.BatchCnt,
+		DlogStats:             make([]*DlogStats, params.BatchCnt),
+		BatchResults:          make([]*big.Int, params.BatchCnt),
+		Result:                big.NewInt(0),
+		dlogTables:            dlogTables,
+		metrics:               metrics,
+		logger:                GetLogger("fe decryptor", logger),
+	}
+
+	for batchIdx := range decryptor.Ciphers {
+		decryptor.Ciphers[batchIdx] = make([]*bn256.G1, params.SensorCnt*params.BatchSize)
+		decryptor.RemainingCiphers[batchIdx] = params.SensorCnt
+	}
+	return decryptor
+}
+
+func (p *DMCFEDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
+	cipher := feCipher.(*DMCFECipher)
+	if cipher.BatchIdx < 0 || cipher.BatchIdx >= p.BatchCnt {
+		return nil, fmt.Errorf("batch no %d out of range (%d batches)", cipher.BatchIdx, p.BatchCnt)
+	}
+	if cipher.SensorIdx < 0 || cipher.SensorIdx >= p.SensorCnt {
+		return nil, fmt.Errorf("sensor no %d out of range (%d sensors)", cipher.SensorIdx, p.SensorCnt)
+	}
+	if len(cipher.Payload) != p.BatchSize {
+		return nil, fmt.Errorf("cipher has %d samples, expected %d", len(cipher.Payload), p.BatchSize)
+	}
+
+	// ciphers of a batch are ordered by the client idx
+	offset := cipher.SensorIdx * p.BatchSize
+	p.cipherMutex.Lock()
+	batchCiphers := p.Ciphers[cipher.BatchIdx]
+	if batchCiphers[offset] != nil {
+		p.cipherMutex.Unlock()
+		return nil, fmt.Errorf("batch no %d of sensor no %d already received", cipher.BatchIdx, cipher.SensorIdx)
+	}
+	copy(batchCiphers[offset:], cipher.Payload)
+	p.RemainingCiphers[cipher.BatchIdx]--
+	remainingCiphers := p.RemainingCiphers[cipher.BatchIdx]
+	p.cipherMutex.Unlock()
+
+	if remainingCiphers != 0 {
+		return nil, nil
+	}
+
+	start := time.Now()
+	batchResult, dlogStats, err := p.decryptBatch(cipher.BatchIdx, batchCiphers)
+	elapsed := time.Since(start)
+	p.DecryptionTime.Add(elapsed.Nanoseconds())
+	p.metrics.partialDecryptionTime.ObserveDuration(elapsed, p.Scheme())
+	p.logger.Info("batch no %d: decryption time: %d ns", cipher.BatchIdx, elapsed.Nanoseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+	p.DlogStats[cipher.BatchIdx] = dlogStats
+	p.BatchResults[cipher.BatchIdx] = batchResult
+	p.Result.Add(p.Result, batchResult)
+	p.RemainingBatches--
+	if p.RemainingBatches != 0 || p.Partial {
+		return nil, nil
+	}
+
+	p.logger.Info("total decryption time: %d ns", p.DecryptionTime.Load())
+	p.ResultReady.Store(true)
+	return p.Result, nil
+}
+
+// decryptBatch is fullysec.DMCFEDecrypt, with the discrete logarithm solved by the DlogTables; the generator is
+// the pairing of the generators of G1 and G2, so its table is shared by all the batches of all the tasks
+func (p *DMCFEDecryptor) decryptBatch(batchIdx int, ciphers []*bn256.G1) (*big.Int, *DlogStats, error) {
+	key := p.DecryptionKeys[batchIdx]
+	rates := p.Rates[batchIdx]
+	label := DMCFELabel(p.Label, batchIdx)
+
+	cipherSum := new(bn256.G1).ScalarBaseMult(big.NewInt(0))
+	for i, cipher := range ciphers {
+		rate := new(big.Int).Set(rates[i])
+		c := new(bn256.G1).Set(cipher)
+		if rate.Sign() < 0 {
+			c.Neg(c)
+			rate.Neg(rate)
+		}
+		cipherSum.Add(cipherSum, c.ScalarMult(c, rate))
+	}
+	s := bn256.Pair(cipherSum, new(bn256.G2).ScalarBaseMult(big.NewInt(1)))
+
+	for i := 0; i < 2; i++ {
+		hash, err := bn256.HashG1(strconv.Itoa(i) + " " + label)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.Add(s, new(bn256.GT).Neg(bn256.Pair(hash, key[i])))
+	}
+
+	g := bn256.Pair(new(bn256.G1).ScalarBaseMult(big.NewInt(1)), new(bn256.G2).ScalarBaseMult(big.NewInt(1)))
+	return p.dlogTables.Solve(s, g, p.Bound, true, true)
+}
+
+// ReceivedCipherIdxs returns the indices of the ciphers of the decrypted batches; the ciphers of a batch that some
+// sensors haven't submitted can't be decrypted, so they don't count as received
+func (p *DMCFEDecryptor) ReceivedCipherIdxs() []int {
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+
+	idxs := make([]int, 0)
+	for sensorIdx := 0; sensorIdx < p.SensorCnt; sensorIdx++ {
+		for batchIdx, batchResult := range p.BatchResults {
+			if batchResult != nil {
+				idxs = append(idxs, sensorIdx*p.BatchCnt+batchIdx)
+			}
+		}
+	}
+	return idxs
+}
+
+// DecryptPartial returns the sum of the decrypted batches; no params are needed, as the batches are decrypted with
+// their own keys
+func (p *DMCFEDecryptor) DecryptPartial(FEDecryptionParams) (*big.Int, error) {
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+
+	p.Partial = true
+	p.ResultReady.Store(true)
+	return new(big.Int).Set(p.Result), nil
+}
+
+// DecryptSubset sums the results of the batches whose ciphers are idxs; the ciphers of all the sensors must be
+// listed for every batch
+func (p *DMCFEDecryptor) DecryptSubset(_ FEDecryptionParams, idxs []int) (*big.Int, error) {
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+
+	listed := make([]bool, p.SensorCnt*p.BatchCnt)
+	sensorCnts := make(map[int]int)
+	for _, idx := range idxs {
+		if idx < 0 || idx >= len(listed) {
+			return nil, fmt.Errorf("cipher no %d out of range (%d ciphers)", idx, len(listed))
+		}
+		if !listed[idx] {
+			listed[idx] = true
+			sensorCnts[idx%p.BatchCnt]++
+		}
+	}
+
+	result := big.NewInt(0)
+	for batchIdx, sensorCnt := range sensorCnts {
+		if sensorCnt != p.SensorCnt {
+			return nil, fmt.Errorf("batch no %d is decrypted with the ciphers of all the sensors only", batchIdx)
+		}
+		if p.BatchResults[batchIdx] == nil {
+			return nil, fmt.Errorf("batch no %d hasn't been decrypted", batchIdx)
+		}
+		result.Add(result, p.BatchResults[batchIdx])
+	}
+	return result, nil
+}
+
+func (p *DMCFEDecryptor) Scheme() string {
+	return SchemeDMCFE
+}
+
+func (p *DMCFEDecryptor) GetStats() any {
+	stats := struct {
+		Finished         bool   `json:"finished"`
+		Partial          bool   `json:"partial,omitempty"`
+		DecryptionTime   *int64 `json:"decryption_time"`
+		TotalBatches     int    `json:"total_batches"`
+		DecryptedBatches int    `json:"decrypted_batches"`
+
+		Dlog map[int]*DlogStats `json:"dlog"`
+	}{}
+
+	stats.Finished = p.ResultReady.Load()
+	decryptionTime := p.DecryptionTime.Load()
+	stats.DecryptionTime = &decryptionTime
+	stats.TotalBatches = p.BatchCnt
+	p.resultMutex.Lock()
+	stats.Partial = p.Partial
+	stats.DecryptedBatches = p.BatchCnt - p.RemainingBatches
+	stats.Dlog = make(map[int]*DlogStats)
+	for batchIdx, dlogStats := range p.DlogStats {
+		if dlogStats != nil {
+			stats.Dlog[batchIdx] = dlogStats
+		}
+	}
+	p.resultMutex.Unlock()
+	return stats
+}
+
+//endregion
@@ -0,0 +1,64 @@
+package server
+
+import (
+	. "fe/common"
+	"github.com/fentec-project/gofe/innerprod/fullysec"
+	"math/big"
+	"sync/atomic"
+	"time"
+)
+
+//region LWEDecryptor
+
+type LWEDecryptor struct {
+	*fullysec.LWE
+	*LWEDecryptionParams
+
+	Result         *big.Int
+	ResultReady    atomic.Bool
+	DecryptionTime *time.Duration
+
+	metrics *serverMetrics
+	logger  *Logger
+}
+
+func (p *LWEDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
+	cipher := feCipher.(*LWECipher)
+
+	start := time.Now()
+	res, err := p.Decrypt(cipher.Payload, p.DecryptionKey, p.Rates)
+	elapsed := time.Since(start)
+	p.DecryptionTime = &elapsed
+	p.metrics.decryptionTime.ObserveDuration(elapsed, p.Scheme())
+	p.logger.Info("cipher no 0: decryption time: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	p.Result = res
+	p.ResultReady.Store(true)
+	return res, nil
+}
+
+func (p *LWEDecryptor) Scheme() string {
+	return SchemeLWE
+}
+
+func (p *LWEDecryptor) GetStats() any {
+	stats := struct {
+		Finished        bool   `json:"finished"`
+		DecryptionTime  *int64 `json:"decryption_time"`
+		TotalCiphers    int    `json:"total_ciphers"`
+		ReceivedCiphers int    `json:"received_ciphers"`
+	}{}
+
+	stats.Finished = p.ResultReady.Load()
+	stats.TotalCiphers = 1
+	stats.DecryptionTime = GetIntPtrFromDuration(p.DecryptionTime)
+	if stats.Finished {
+		stats.ReceivedCiphers = 1
+	}
+	return stats
+}
+
+//endregion
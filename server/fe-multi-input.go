@@ -0,0 +1,90 @@
+package server
+
+import (
+	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/gofe/data"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//region MultiInputDecryptor
+
+// MultiInputDecryptor decrypts the ciphers of SchemeDamgardMulti and SchemePaillierMulti; unlike MultiFEDecryptor,
+// the ciphers can't be processed as they arrive, so they are all decrypted at once, after the last one arrives
+type MultiInputDecryptor struct {
+	scheme  string
+	decrypt func(ciphers []data.Vector) (*big.Int, error)
+
+	Ciphers          []data.Vector
+	RemainingCiphers int
+	cipherMutex      sync.Mutex // ciphers are added concurrently
+
+	Result         *big.Int
+	ResultReady    atomic.Bool
+	DecryptionTime *time.Duration
+
+	metrics *serverMetrics
+	logger  *Logger
+}
+
+func (p *MultiInputDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
+	cipher := feCipher.(*MultiInputCipher)
+	if cipher.Idx < 0 || cipher.Idx >= len(p.Ciphers) {
+		return nil, fmt.Errorf("cipher no %d out of range (%d ciphers)", cipher.Idx, len(p.Ciphers))
+	}
+
+	p.cipherMutex.Lock()
+	if p.Ciphers[cipher.Idx] != nil {
+		p.cipherMutex.Unlock()
+		return nil, fmt.Errorf("cipher no %d already received", cipher.Idx)
+	}
+	p.Ciphers[cipher.Idx] = cipher.Payload
+	p.RemainingCiphers--
+	remainingCiphers := p.RemainingCiphers
+	p.cipherMutex.Unlock()
+	p.logger.Info("cipher no %d received", cipher.Idx)
+
+	if remainingCiphers != 0 {
+		return nil, nil
+	}
+
+	start := time.Now()
+	result, err := p.decrypt(p.Ciphers)
+	elapsed := time.Since(start)
+	p.DecryptionTime = &elapsed
+	p.metrics.decryptionTime.ObserveDuration(elapsed, p.Scheme())
+	p.logger.Info("decryption time: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	p.Result = result
+	p.ResultReady.Store(true)
+	return result, nil
+}
+
+func (p *MultiInputDecryptor) Scheme() string {
+	return p.scheme
+}
+
+func (p *MultiInputDecryptor) GetStats() any {
+	stats := struct {
+		Finished        bool   `json:"finished"`
+		DecryptionTime  *int64 `json:"decryption_time"`
+		TotalCiphers    int    `json:"total_ciphers"`
+		ReceivedCiphers int    `json:"received_ciphers"`
+	}{}
+
+	stats.Finished = p.ResultReady.Load()
+	stats.DecryptionTime = GetIntPtrFromDuration(p.DecryptionTime)
+	stats.TotalCiphers = len(p.Ciphers)
+	p.cipherMutex.Lock()
+	stats.ReceivedCiphers = len(p.Ciphers) - p.RemainingCiphers
+	p.cipherMutex.Unlock()
+	return stats
+}
+
+//endregion
@@ -2,8 +2,12 @@ package server
 
 import (
 	. "fe/common"
+	"fmt"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/data"
 	"github.com/fentec-project/gofe/innerprod/fullysec"
 	"math/big"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -13,6 +17,18 @@ import (
 type FEDecryptor interface {
 	AddCipher(feCipher FECipher) (*big.Int, error)
 	GetStats() any
+	Scheme() string
+}
+
+// PartialDecryptor is implemented by the FEDecryptors that can compute the result of the received ciphers only,
+// with decryption params restricted to them, when the rest of the ciphers are missing
+type PartialDecryptor interface {
+	// ReceivedCipherIdxs returns the indices of the ciphers that have been added
+	ReceivedCipherIdxs() []int
+	// DecryptPartial computes the result of the added ciphers; the ciphers added afterwards are ignored
+	DecryptPartial(params FEDecryptionParams) (*big.Int, error)
+	// DecryptSubset computes the total of the added ciphers idxs, without setting the result
+	DecryptSubset(params FEDecryptionParams, idxs []int) (*big.Int, error)
 }
 
 type SingleFEDecryptor struct {
@@ -22,23 +38,38 @@ type SingleFEDecryptor struct {
 	Result         *big.Int
 	ResultReady    atomic.Bool
 	DecryptionTime *time.Duration
+	DlogStats      atomic.Pointer[DlogStats] // read by GetStats while the result is decrypted
 
-	logger *Logger
+	dlogTables *DlogTables
+	metrics    *serverMetrics
+	logger     *Logger
 }
 
+// MultiFEDecryptor pairs every cipher with its part of the key as soon as it arrives, and solves the discrete
+// logarithm of the product of the pairings once all ciphers are processed
 type MultiFEDecryptor struct {
-	*fullysec.FHMultiIPEParallelDecryption
+	*fullysec.FHMultiIPE
 	*MultiFEDecryptionParams
 
 	ReceivedCiphers        []atomic.Bool
 	PartialProcessingTimes []*time.Duration
 
+	ciphers        []*MultiFECipher // kept for DecryptPartial
+	startedCiphers []atomic.Bool
+	sum            *bn256.GT // product of the pairings of the processed ciphers
+	pendingCnt     int
+	sumMutex       sync.Mutex
+
 	Result              *big.Int
 	ResultReady         atomic.Bool
 	DecryptionTime      *time.Duration
-	TotalDecryptionTime int64 //in nanoseconds
+	TotalDecryptionTime int64                     //in nanoseconds
+	DlogStats           atomic.Pointer[DlogStats] // read by GetStats while the result is decrypted
+	Partial             bool                      // the Result is computed by DecryptPartial
 
-	logger *Logger
+	dlogTables *DlogTables
+	metrics    *serverMetrics
+	logger     *Logger
 }
 
 type DummyDecryptor struct {
@@ -49,13 +80,17 @@ type DummyDecryptor struct {
 
 	Result      *big.Int
 	ResultReady atomic.Bool
+	Partial     bool           // the Result is computed by DecryptPartial
+	ciphers     []*DummyCipher // kept for DecryptPartial
+	resultMutex sync.Mutex     // ciphers are added concurrently
 
-	logger *Logger
+	metrics *serverMetrics
+	logger  *Logger
 }
 
 //endregion
 
-func NewFEDecryptor(params FEDecryptionParams, logger *Logger) (FEDecryptor, error) {
+func NewFEDecryptor(params FEDecryptionParams, dlogTables *DlogTables, metrics *serverMetrics, logger *Logger) (FEDecryptor, error) {
 	switch params.(type) {
 
 	case *SingleFEDecryptionParams:
@@ -63,6 +98,8 @@ func NewFEDecryptor(params FEDecryptionParams, logger *Logger) (FEDecryptor, err
 		return &SingleFEDecryptor{
 			SingleFEDecryptionParams: feParams,
 			FHIPE:                    fullysec.NewFHIPEFromParams(&feParams.SchemaParams),
+			dlogTables:               dlogTables,
+			metrics:                  metrics,
 			logger:                   GetLogger("fe decryptor", logger),
 		}, nil
 
@@ -72,11 +109,17 @@ func NewFEDecryptor(params FEDecryptionParams, logger *Logger) (FEDecryptor, err
 		vecCnt := feParams.SchemaParams.NumClients
 
 		return &MultiFEDecryptor{
-			FHMultiIPEParallelDecryption: schema.NewParallelDecryption(),
-			MultiFEDecryptionParams:      feParams,
-			ReceivedCiphers:              make([]atomic.Bool, vecCnt),
-			PartialProcessingTimes:       make([]*time.Duration, vecCnt),
-			logger:                       GetLogger("fe decryptor", logger),
+			FHMultiIPE:              schema,
+			MultiFEDecryptionParams: feParams,
+			ReceivedCiphers:         make([]atomic.Bool, vecCnt),
+			ciphers:                 make([]*MultiFECipher, vecCnt),
+			startedCiphers:          make([]atomic.Bool, vecCnt),
+			PartialProcessingTimes:  make([]*time.Duration, vecCnt),
+			sum:                     bn256.GetGTOne(),
+			pendingCnt:              vecCnt,
+			dlogTables:              dlogTables,
+			metrics:                 metrics,
+			logger:                  GetLogger("fe decryptor", logger),
 		}, nil
 
 	case *DummyDecryptionParams:
@@ -86,9 +129,53 @@ func NewFEDecryptor(params FEDecryptionParams, logger *Logger) (FEDecryptor, err
 			DummyDecryptionParams: feParams,
 			Result:                big.NewInt(0),
 			RemainingCiphers:      int64(feParams.BatchCnt),
+			ciphers:               make([]*DummyCipher, feParams.BatchCnt),
+			metrics:               metrics,
 			logger:                GetLogger("dummy decryptor", logger),
 		}, nil
 
+	case *DamgardMultiDecryptionParams:
+		feParams := params.(*DamgardMultiDecryptionParams)
+		schema := fullysec.NewDamgardMultiFromParams(feParams.NumClients, feParams.Bound, &feParams.SchemaParams)
+
+		return &MultiInputDecryptor{
+			scheme: SchemeDamgardMulti,
+			decrypt: func(ciphers []data.Vector) (*big.Int, error) {
+				return schema.Decrypt(ciphers, feParams.DecryptionKey, feParams.Rates)
+			},
+			Ciphers:          make([]data.Vector, feParams.NumClients),
+			RemainingCiphers: feParams.NumClients,
+			metrics:          metrics,
+			logger:           GetLogger("fe decryptor", logger),
+		}, nil
+
+	case *PaillierMultiDecryptionParams:
+		feParams := params.(*PaillierMultiDecryptionParams)
+		schema := fullysec.NewPaillierMultiFromParams(feParams.NumClients, feParams.BoundX, feParams.BoundY, &feParams.SchemaParams)
+
+		return &MultiInputDecryptor{
+			scheme: SchemePaillierMulti,
+			decrypt: func(ciphers []data.Vector) (*big.Int, error) {
+				return schema.Decrypt(ciphers, feParams.DecryptionKey, feParams.Rates)
+			},
+			Ciphers:          make([]data.Vector, feParams.NumClients),
+			RemainingCiphers: feParams.NumClients,
+			metrics:          metrics,
+			logger:           GetLogger("fe decryptor", logger),
+		}, nil
+
+	case *LWEDecryptionParams:
+		feParams := params.(*LWEDecryptionParams)
+		return &LWEDecryptor{
+			LWE:                 &fullysec.LWE{Params: &feParams.SchemaParams},
+			LWEDecryptionParams: feParams,
+			metrics:             metrics,
+			logger:              GetLogger("fe decryptor", logger),
+		}, nil
+
+	case *DMCFEDecryptionParams:
+		return newDMCFEDecryptor(params.(*DMCFEDecryptionParams), dlogTables, metrics, logger), nil
+
 	}
 
 	return nil, nil
@@ -101,9 +188,10 @@ func (p *SingleFEDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
 	cipher := feCipher.(*SingleFECipher)
 
 	start := time.Now()
-	res, err := p.Decrypt(cipher, &p.DecryptionKey)
+	res, err := p.decrypt(cipher)
 	elapsed := time.Since(start)
 	p.DecryptionTime = &elapsed
+	p.metrics.decryptionTime.ObserveDuration(elapsed, p.Scheme())
 	p.logger.Info("cipher no 0: decryption time: %d ns", time.Since(start).Nanoseconds())
 	if err != nil {
 		return nil, err
@@ -113,16 +201,45 @@ func (p *SingleFEDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
 	return res, nil
 }
 
+// decrypt is FHIPE.Decrypt, with the discrete logarithm solved by the DlogTables; the generator is randomized by
+// the key and the cipher, so its table isn't cached
+func (p *SingleFEDecryptor) decrypt(cipher *SingleFECipher) (*big.Int, error) {
+	key := &p.DecryptionKey
+	if len(cipher.C2) != p.Params.L || len(key.K2) != p.Params.L {
+		return nil, fmt.Errorf("key or cipher length error")
+	}
+
+	d1 := bn256.Pair(key.K1, cipher.C1)
+	d2 := bn256.GetGTOne()
+	for i := 0; i < p.Params.L; i++ {
+		d2.Add(d2, bn256.Pair(key.K2[i], cipher.C2[i]))
+	}
+
+	bound := new(big.Int).Mul(p.Params.BoundX, p.Params.BoundY)
+	bound.Mul(bound, big.NewInt(int64(p.Params.L)))
+
+	result, stats, err := p.dlogTables.Solve(d2, d1, bound, true, false)
+	p.DlogStats.Store(stats)
+	return result, err
+}
+
+func (p *SingleFEDecryptor) Scheme() string {
+	return SchemeFHIPE
+}
+
 func (p *SingleFEDecryptor) GetStats() any {
 	stats := struct {
 		Finished        bool   `json:"finished"`
 		DecryptionTime  *int64 `json:"decryption_time"`
 		TotalCiphers    int    `json:"total_ciphers"`
 		ReceivedCiphers int    `json:"received_ciphers"`
+
+		Dlog *DlogStats `json:"dlog,omitempty"`
 	}{}
 
 	stats.Finished = p.ResultReady.Load()
 	stats.TotalCiphers = 1
+	stats.Dlog = p.DlogStats.Load()
 	stats.DecryptionTime = GetIntPtrFromDuration(p.DecryptionTime)
 	if stats.Finished {
 		stats.ReceivedCiphers = 1
@@ -140,21 +257,25 @@ func (p *MultiFEDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
 	cipher := feCipher.(*MultiFECipher)
 
 	start := time.Now()
-	remainingBatches, err := p.ParallelDecryption(cipher.Idx, cipher.Payload, p.DecryptionKey)
+	remainingBatches, err := p.addPairing(cipher)
 	elapsed := time.Since(start)
-	p.PartialProcessingTimes[cipher.Idx] = &elapsed
-	p.logger.Info("cipher no %d: partial processing time: %d ns", cipher.Idx, elapsed.Nanoseconds())
 	if err != nil {
 		return nil, err
 	}
+	p.PartialProcessingTimes[cipher.Idx] = &elapsed
+	p.metrics.partialDecryptionTime.ObserveDuration(elapsed, p.Scheme())
+	p.logger.Info("cipher no %d: partial processing time: %d ns", cipher.Idx, elapsed.Nanoseconds())
 
+	p.ciphers[cipher.Idx] = cipher
 	p.ReceivedCiphers[cipher.Idx].Store(true)
 
 	if remainingBatches == 0 {
 		start = time.Now()
-		result, err := p.GetResult(false, p.PubKey)
+		// samples and rates can be negative, so the result can be too
+		result, err := p.getResult()
 		elapsed = time.Since(start)
 		p.DecryptionTime = &elapsed
+		p.metrics.decryptionTime.ObserveDuration(elapsed, p.Scheme())
 		p.logger.Info("decryption time: %d ns", p.DecryptionTime.Nanoseconds())
 		if err != nil {
 			return nil, err
@@ -175,6 +296,103 @@ func (p *MultiFEDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
 	return nil, nil
 }
 
+// addPairing multiplies the sum with the pairings of the cipher and its part of the key, and returns the number
+// of ciphers that are yet to be processed
+func (p *MultiFEDecryptor) addPairing(cipher *MultiFECipher) (int, error) {
+	if cipher.Idx < 0 || cipher.Idx >= p.Params.NumClients {
+		return -1, fmt.Errorf("invalid index %d", cipher.Idx)
+	}
+	pairingCnt := 2*p.Params.VecLen + 2*p.Params.SecLevel + 1
+	if len(cipher.Payload) != pairingCnt {
+		return -1, fmt.Errorf("cipher no %d has %d elements, expected %d", cipher.Idx, len(cipher.Payload), pairingCnt)
+	}
+	if !p.startedCiphers[cipher.Idx].CompareAndSwap(false, true) {
+		return -1, fmt.Errorf("cipher no %d has already been processed", cipher.Idx)
+	}
+
+	sum := bn256.GetGTOne()
+	for i := 0; i < pairingCnt; i++ {
+		sum.Add(sum, bn256.Pair(cipher.Payload[i], p.DecryptionKey[cipher.Idx][i]))
+	}
+
+	p.sumMutex.Lock()
+	defer p.sumMutex.Unlock()
+	p.sum.Add(p.sum, sum)
+	p.pendingCnt--
+	return p.pendingCnt, nil
+}
+
+// getResult solves the discrete logarithm of the sum to the public key, with the bound FHMultiIPE uses
+func (p *MultiFEDecryptor) getResult() (*big.Int, error) {
+	bound := new(big.Int).Mul(p.Params.BoundX, p.Params.BoundY)
+	bound.Mul(bound, big.NewInt(int64(p.Params.NumClients*p.Params.VecLen)))
+
+	result, stats, err := p.dlogTables.Solve(p.sum, p.PubKey, bound, true, true)
+	p.DlogStats.Store(stats)
+	return result, err
+}
+
+func (p *MultiFEDecryptor) ReceivedCipherIdxs() []int {
+	idxs := make([]int, 0)
+	for idx := range p.ReceivedCiphers {
+		if p.ReceivedCiphers[idx].Load() {
+			idxs = append(idxs, idx)
+		}
+	}
+	return idxs
+}
+
+// DecryptPartial computes the result of the received ciphers with the restricted key
+func (p *MultiFEDecryptor) DecryptPartial(params FEDecryptionParams) (*big.Int, error) {
+	start := time.Now()
+	result, err := p.DecryptSubset(params, p.ReceivedCipherIdxs())
+	elapsed := time.Since(start)
+	p.DecryptionTime = &elapsed
+	p.metrics.decryptionTime.ObserveDuration(elapsed, p.Scheme())
+	p.logger.Info("partial decryption time: %d ns", elapsed.Nanoseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	p.Result = result
+	p.Partial = true
+	p.ResultReady.Store(true)
+	return result, nil
+}
+
+// DecryptSubset pairs the ciphers with the restricted key, which is zero for the rest of them, and solves
+// the discrete logarithm of the product, with the bound of all the ciphers, so that the cached table is used
+func (p *MultiFEDecryptor) DecryptSubset(params FEDecryptionParams, idxs []int) (*big.Int, error) {
+	feParams, ok := params.(*MultiFEDecryptionParams)
+	if !ok {
+		return nil, fmt.Errorf("expected %T, got %T", feParams, params)
+	}
+	pairingCnt := 2*p.Params.VecLen + 2*p.Params.SecLevel + 1
+	if len(feParams.DecryptionKey) != p.Params.NumClients {
+		return nil, fmt.Errorf("restricted key has %d parts, expected %d", len(feParams.DecryptionKey), p.Params.NumClients)
+	}
+
+	sum := bn256.GetGTOne()
+	for _, idx := range idxs {
+		if !p.ReceivedCiphers[idx].Load() {
+			return nil, fmt.Errorf("cipher no %d hasn't been received", idx)
+		}
+		for i := 0; i < pairingCnt; i++ {
+			sum.Add(sum, bn256.Pair(p.ciphers[idx].Payload[i], feParams.DecryptionKey[idx][i]))
+		}
+	}
+
+	bound := new(big.Int).Mul(p.Params.BoundX, p.Params.BoundY)
+	bound.Mul(bound, big.NewInt(int64(p.Params.NumClients*p.Params.VecLen)))
+	result, stats, err := p.dlogTables.Solve(sum, feParams.PubKey, bound, true, true)
+	p.DlogStats.Store(stats)
+	return result, err
+}
+
+func (p *MultiFEDecryptor) Scheme() string {
+	return SchemeFHMultiIPE
+}
+
 func (p *MultiFEDecryptor) GetStats() any {
 	stats := struct {
 		Finished               bool           `json:"finished"`
@@ -183,14 +401,19 @@ func (p *MultiFEDecryptor) GetStats() any {
 		TotalCiphers           int            `json:"total_ciphers"`
 		ReceivedCiphers        int            `json:"received_ciphers"`
 		PartialProcessingTimes map[int]*int64 `json:"partial_processing_times"`
+		Partial                bool           `json:"partial,omitempty"`
+
+		Dlog *DlogStats `json:"dlog,omitempty"`
 	}{}
 
 	stats.Finished = p.ResultReady.Load()
-	if stats.Finished {
+	stats.Partial = p.Partial
+	if stats.Finished && !stats.Partial {
 		stats.TotalDecryptionTime = &p.TotalDecryptionTime
 	}
 	stats.TotalCiphers = p.SchemaParams.NumClients
 	stats.DecryptionTime = GetIntPtrFromDuration(p.DecryptionTime)
+	stats.Dlog = p.DlogStats.Load()
 
 	stats.PartialProcessingTimes = make(map[int]*int64)
 	for i := 0; i < stats.TotalCiphers; i++ {
@@ -213,29 +436,93 @@ func (p *DummyDecryptor) AddCipher(feCipher FECipher) (*big.Int, error) {
 	samplesCnt := len(cipher.Samples)
 	sum := big.NewInt(0)
 	for i := 0; i < samplesCnt; i++ {
-		product := big.NewInt(0).Add(cipher.Samples[i], p.DummyDecryptionParams.Rates[cipher.Idx][i])
+		product := big.NewInt(0).Mul(cipher.Samples[i], p.DummyDecryptionParams.Rates[cipher.Idx][i])
 		sum = sum.Add(sum, product)
 	}
+	p.resultMutex.Lock()
 	p.Result.Add(p.Result, sum)
+	p.ciphers[cipher.Idx] = cipher
+	p.resultMutex.Unlock()
 	elapsed := time.Since(start)
 	p.DecryptionTime.Add(elapsed.Nanoseconds())
+	p.metrics.partialDecryptionTime.ObserveDuration(elapsed, p.Scheme())
 	p.logger.Info("cipher processing time: %d ns", elapsed.Nanoseconds())
 
 	if atomic.AddInt64(&p.RemainingCiphers, -1) == 0 {
 		p.logger.Info("total decryption time: %d ns", p.DecryptionTime.Load())
+		p.ResultReady.Store(true)
 		return p.Result, nil
 	} else {
 		return nil, nil
 	}
 }
 
+func (p *DummyDecryptor) ReceivedCipherIdxs() []int {
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+
+	idxs := make([]int, 0)
+	for idx, cipher := range p.ciphers {
+		if cipher != nil {
+			idxs = append(idxs, idx)
+		}
+	}
+	return idxs
+}
+
+// DecryptPartial sums the products of the received samples and the restricted rates
+func (p *DummyDecryptor) DecryptPartial(params FEDecryptionParams) (*big.Int, error) {
+	result, err := p.DecryptSubset(params, p.ReceivedCipherIdxs())
+	if err != nil {
+		return nil, err
+	}
+
+	p.resultMutex.Lock()
+	p.Result = result
+	p.Partial = true
+	p.resultMutex.Unlock()
+	p.ResultReady.Store(true)
+	return result, nil
+}
+
+func (p *DummyDecryptor) DecryptSubset(params FEDecryptionParams, idxs []int) (*big.Int, error) {
+	feParams, ok := params.(*DummyDecryptionParams)
+	if !ok {
+		return nil, fmt.Errorf("expected %T, got %T", feParams, params)
+	}
+	if len(feParams.Rates) != len(p.ciphers) {
+		return nil, fmt.Errorf("restricted rates have %d rows, expected %d", len(feParams.Rates), len(p.ciphers))
+	}
+
+	p.resultMutex.Lock()
+	defer p.resultMutex.Unlock()
+
+	result := big.NewInt(0)
+	for _, idx := range idxs {
+		cipher := p.ciphers[idx]
+		if cipher == nil {
+			return nil, fmt.Errorf("cipher no %d hasn't been received", idx)
+		}
+		for i, sample := range cipher.Samples {
+			result.Add(result, new(big.Int).Mul(sample, feParams.Rates[idx][i]))
+		}
+	}
+	return result, nil
+}
+
+func (p *DummyDecryptor) Scheme() string {
+	return SchemeDummy
+}
+
 func (p *DummyDecryptor) GetStats() any {
 	stats := struct {
 		Finished       bool   `json:"finished"`
 		DecryptionTime *int64 `json:"decryption_time"`
+		Partial        bool   `json:"partial,omitempty"`
 	}{}
 
 	stats.Finished = p.ResultReady.Load()
+	stats.Partial = p.Partial
 	decryptionTime := p.DecryptionTime.Load()
 	stats.DecryptionTime = &decryptionTime
 	return stats
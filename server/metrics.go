@@ -0,0 +1,45 @@
+package server
+
+import (
+	. "fe/common"
+)
+
+// reasons for rejecting a cipher, used as the "reason" label of fe_ciphers_rejected_total
+const (
+	rejectedInvalidTask   = "invalid task"
+	rejectedInvalidCipher = "invalid cipher"
+	rejectedCommitment    = "invalid commitment"
+	rejectedTaskStopped   = "task stopped"
+	rejectedDecryption    = "decryption failed"
+	rejectedLate          = "late"
+	rejectedDuplicate     = "duplicate"
+	rejectedForbidden     = "forbidden" // submitted with the credential of another sensor
+)
+
+// serverMetrics are the metrics of the Server; timings are labeled by FE scheme
+type serverMetrics struct {
+	partialDecryptionTime *Histogram
+	decryptionTime        *Histogram
+	ciphersReceived       *Counter
+	ciphersRejected       *Counter
+	dlogTableLookups      *Counter
+	batchesMissing        *Counter
+	partialResults        *Counter
+}
+
+func newServerMetrics(registry *MetricsRegistry) *serverMetrics {
+	return &serverMetrics{
+		partialDecryptionTime: registry.NewHistogram("fe_partial_decryption_duration_seconds", "Time spent processing a single cipher before the result can be decrypted.",
+			DurationBuckets, "scheme"),
+		decryptionTime: registry.NewHistogram("fe_decryption_duration_seconds", "Time spent decrypting the result once all ciphers are processed.",
+			DurationBuckets, "scheme"),
+		ciphersReceived: registry.NewCounter("fe_ciphers_received_total", "Ciphers accepted from sensors."),
+		ciphersRejected: registry.NewCounter("fe_ciphers_rejected_total", "Ciphers from sensors that have been rejected or discarded.",
+			"reason"),
+		dlogTableLookups: registry.NewCounter("fe_dlog_table_lookups_total", "Lookups of cached discrete logarithm tables, by where the table was found (memory, disk, or built).",
+			"source"),
+		batchesMissing: registry.NewCounter("fe_batches_missing_total", "Batches that haven't been received before the deadline of their task."),
+		partialResults: registry.NewCounter("fe_partial_results_total", "Attempts to bill tasks with missing batches from the received ciphers, by outcome (computed or failed).",
+			"outcome"),
+	}
+}
@@ -1,19 +1,28 @@
 package server
 
 import (
+	"fe/client"
 	. "fe/common"
+	"sync/atomic"
+	"time"
 )
 
 type Sensor struct {
 	Id        UUID        `json:"id"`
 	Customers []*Customer `json:"customers"`
 	*RemoteHttpServer
+
+	// PublicKey verifies the signatures of the sensor's batch commitments; empty if the sensor hasn't sent it
+	PublicKey string `json:"public_key,omitempty"`
+
+	clockSync atomic.Pointer[ClockSync] // the last measured offset of the sensor's clock, nil if never measured
 }
 
-func (server *Server) NewSensor(uuid UUID, ip IP) *Sensor {
+func (server *Server) NewSensor(uuid UUID, ip IP, publicKey string) *Sensor {
 	sensor := &Sensor{
 		Id:        uuid,
 		Customers: make([]*Customer, 0),
+		PublicKey: publicKey,
 		RemoteHttpServer: &RemoteHttpServer{
 			IP:     ip,
 			Logger: GetLogger("http client", server.HttpLogger),
@@ -39,14 +48,61 @@ func (s *Sensor) RemoveFromCustomer(g *Customer) {
 	}
 }
 
-func (s *Sensor) SubmitTask(taskId UUID, samplingParams SamplingParams, authorityIp IP) (statusCode int, responseBody []byte, e error) {
-	//method := "POST"
-	url := "/task"
-	body := SensorTaskRequest{
+// MeasureClockOffset measures the offset of the sensor's clock from clock, and stores it
+func (s *Sensor) MeasureClockOffset(clock Clock, samples int) (ClockSync, error) {
+	clockSync, err := client.NewSensor(s.RemoteHttpServer).MeasureClockOffset(clock, samples)
+	if err != nil {
+		return ClockSync{}, err
+	}
+	s.clockSync.Store(&clockSync)
+	return clockSync, nil
+}
+
+// GetClockSync returns the last measured offset of the sensor's clock, or nil if it has never been measured
+func (s *Sensor) GetClockSync() *ClockSync {
+	return s.clockSync.Load()
+}
+
+// GetClockOffset returns the last measured offset of the sensor's clock, or 0 if it has never been measured
+func (s *Sensor) GetClockOffset() time.Duration {
+	if clockSync := s.clockSync.Load(); clockSync != nil {
+		return clockSync.Offset
+	}
+	return 0
+}
+
+// forTask returns the client of the sensor, whose requests carry the correlation id of the task
+func (s *Sensor) forTask(taskId UUID) *client.Sensor {
+	return client.NewSensor(s.ForTask(taskId))
+}
+
+func (s *Sensor) SubmitTask(taskId UUID, samplingParams SamplingParams, authorityIp IP, scheme string, dmcfeParams *DMCFETaskParams) error {
+	return s.forTask(taskId).SubmitTask(SensorTaskRequest{
 		TaskId:         taskId,
 		SamplingParams: samplingParams,
 		AuthorityIP:    authorityIp,
-	}
+		ClockOffset:    Duration(s.GetClockOffset()),
+		Scheme:         scheme,
+		DMCFE:          dmcfeParams,
+	})
+}
+
+//region decentralized DMCFE
 
-	return s.POST(url, body, BodyJSON)
+// FetchDMCFEPubKeys fetches the public keys of the sensor's DMCFE clients for the task
+func (s *Sensor) FetchDMCFEPubKeys(taskId UUID) (*DMCFEPubKeys, error) {
+	return s.forTask(taskId).DMCFEPubKeys(taskId)
 }
+
+// SendDMCFEPubKeys sends the public keys of all the DMCFE clients of the task to the sensor
+func (s *Sensor) SendDMCFEPubKeys(taskId UUID, pubKeys *DMCFEPubKeys) error {
+	return s.forTask(taskId).SetDMCFEPubKeys(taskId, pubKeys)
+}
+
+// FetchDMCFEKeyShares sends the rates to the sensor, and fetches the key shares of its DMCFE clients for them;
+// the sensor refuses to derive key shares for rates it doesn't approve
+func (s *Sensor) FetchDMCFEKeyShares(taskId UUID, rates []int) (*DMCFEKeyShares, error) {
+	return s.forTask(taskId).DMCFEKeyShares(taskId, rates)
+}
+
+//endregion
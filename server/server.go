@@ -13,12 +13,42 @@ type Server struct {
 
 	Authority *Authority
 	*Host[Task]
+
+	// Authenticator authenticates the callers of the endpoints, see GetEndpoints; nil if they're unauthenticated
+	Authenticator *Authenticator
+	// authorityCredential is sent to the authority and the share holders
+	authorityCredential string
+
+	// shareHolders hold the shares of the master secrets in the threshold mode
+	shareHolders      []*ShareHolder
+	shareHoldersMutex sync.RWMutex
+
+	config     *ServerConfig
+	metrics    *serverMetrics
+	dlogTables *DlogTables
 }
 
-func InitServer() *Server {
-	server := &Server{}
-	server.Host = InitHost[Task](ServerLogDir, ServerLogFilename, ServerTaskDaemonChanSize, server.GetEndpoints())
-	return server
+func InitServer(config *ServerConfig, clock Clock) (*Server, error) {
+	var err error
+	server := &Server{config: config}
+	server.Host, err = InitHost[Task](&config.HostConfig, clock, server.GetEndpoints())
+	if err != nil {
+		return nil, err
+	}
+	server.metrics = newServerMetrics(server.Metrics)
+	server.dlogTables = newDlogTables(config, server.metrics, server.Logger)
+
+	if server.Authenticator, err = NewAuthenticator(&config.AuthConfig, server.Clock); err != nil {
+		return nil, err
+	}
+	if server.Authenticator == nil {
+		server.Logger.Warn("no API keys or JWT secret are configured, the endpoints are unauthenticated")
+	}
+	server.HttpServer.SetAuthenticator(server.Authenticator)
+	if server.authorityCredential, err = ReadCredentialFile(config.AuthorityCredentialFile); err != nil {
+		return nil, err
+	}
+	return server, nil
 }
 
 func (server *Server) IsAuthoritySet() bool {
@@ -34,10 +64,10 @@ func (server *Server) GetCustomer(uuid UUID) (*Customer, error) {
 	return customer.(*Customer), nil
 }
 
-func (server *Server) AddSensorToCustomer(uuid UUID, ip IP, customer *Customer) {
+func (server *Server) AddSensorToCustomer(uuid UUID, ip IP, publicKey string, customer *Customer) {
 	sensor, exists := server.sensors.Load(uuid)
 	if !exists {
-		sensor = server.NewSensor(uuid, ip)
+		sensor = server.NewSensor(uuid, ip, publicKey)
 		server.sensors.Store(uuid, sensor)
 	}
 
@@ -48,6 +78,11 @@ func (server *Server) AddTask(task *Task) {
 	server.tasks.Store(task.Id, task)
 }
 
+// RemoveTask removes a task that hasn't been accepted by the task daemon
+func (server *Server) RemoveTask(taskId UUID) {
+	server.tasks.Delete(taskId)
+}
+
 func (server *Server) GetTask(taskId UUID) (*Task, error) {
 	taskAny, exists := server.tasks.Load(taskId)
 	if !exists {
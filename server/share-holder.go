@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fe/client"
+	. "fe/common"
+	"fmt"
+)
+
+// ShareHolder is an authority instance that holds shares of the master secrets of tasks, in the threshold mode
+type ShareHolder struct {
+	*RemoteHttpServer
+}
+
+func (server *Server) NewShareHolder(ip IP) *ShareHolder {
+	return &ShareHolder{
+		RemoteHttpServer: &RemoteHttpServer{
+			IP:         ip,
+			Logger:     GetLogger("http client", server.HttpLogger),
+			Credential: server.authorityCredential,
+		},
+	}
+}
+
+// AddShareHolder registers a share holder; returns false if it is already registered
+func (server *Server) AddShareHolder(ip IP) bool {
+	server.shareHoldersMutex.Lock()
+	defer server.shareHoldersMutex.Unlock()
+
+	for _, shareHolder := range server.shareHolders {
+		if shareHolder.IP.String() == ip.String() {
+			return false
+		}
+	}
+	server.shareHolders = append(server.shareHolders, server.NewShareHolder(ip))
+	return true
+}
+
+// GetShareHolders returns the registered share holders, in the order of registration
+func (server *Server) GetShareHolders() []*ShareHolder {
+	server.shareHoldersMutex.RLock()
+	defer server.shareHoldersMutex.RUnlock()
+
+	shareHolders := make([]*ShareHolder, len(server.shareHolders))
+	copy(shareHolders, server.shareHolders)
+	return shareHolders
+}
+
+// FetchPartialKey sends the rates to the share holder, and fetches the partial key it derives for them from
+// its share of the task
+func (h *ShareHolder) FetchPartialKey(taskId UUID, rates []int) (*ThresholdPartialKey, error) {
+	partialKey, err := client.NewAuthority(h.ForTask(taskId)).PartialKey(taskId, rates)
+	if err != nil {
+		return nil, err
+	}
+	if partialKey.DecryptionParams == nil {
+		return nil, fmt.Errorf("invalid partial key of share holder %s", h.IP.String())
+	}
+	return partialKey, nil
+}
+
+// FetchStatus fetches the shares the share holder holds; an error means the share holder is unreachable
+func (h *ShareHolder) FetchStatus() (*ShareHolderStatus, error) {
+	return client.NewAuthority(h.RemoteHttpServer).Shares()
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	. "fe/common"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statement formats, as chosen with the format query param of the statement endpoints
+const (
+	StatementJSON = "json"
+	StatementCSV  = "csv"
+	StatementHTML = "html"
+)
+
+// RenderStatement renders the period statement in format, as a File named after the customer and the period
+func RenderStatement(period *PeriodStatement, format string) (File, error) {
+	name := fmt.Sprintf("statement-%s-%d", period.CustomerId, period.From)
+	if period.To != 0 {
+		name += fmt.Sprintf("-%d", period.To)
+	}
+
+	switch format {
+	case StatementJSON:
+		data, err := json.MarshalIndent(period, "", "  ")
+		if err != nil {
+			return File{}, err
+		}
+		return File{Name: name + ".json", ContentType: BodyJSON, Data: data}, nil
+
+	case StatementCSV:
+		data, err := renderStatementCSV(period)
+		if err != nil {
+			return File{}, err
+		}
+		return File{Name: name + ".csv", ContentType: "text/csv; charset=utf-8", Data: data}, nil
+
+	case StatementHTML:
+		data, err := renderStatementHTML(period)
+		if err != nil {
+			return File{}, err
+		}
+		return File{Name: name + ".html", ContentType: "text/html; charset=utf-8", Data: data}, nil
+
+	default:
+		return File{}, fmt.Errorf("unknown statement format %q, expected %s, %s or %s", format, StatementJSON, StatementCSV, StatementHTML)
+	}
+}
+
+//region CSV
+
+var statementCSVHeader = []string{
+	"task_id", "customer_id", "sensors", "tariff_id", "tariff_description", "period_start", "period_end",
+	"rates_count", "sampling_period", "rates_min", "rates_max", "rates_mean", "rates_hash",
+	"result", "scale", "amount", "partial", "missing_batches", "hash",
+}
+
+// renderStatementCSV renders a row per statement, and a last row with the total and the hash of the period statement
+func renderStatementCSV(period *PeriodStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	if err := writer.Write(statementCSVHeader); err != nil {
+		return nil, err
+	}
+	for _, s := range period.Statements {
+		sensors := make([]string, len(s.Sensors))
+		for idx, sensorId := range s.Sensors {
+			sensors[idx] = string(sensorId)
+		}
+
+		row := []string{
+			string(s.TaskId), string(s.CustomerId), strings.Join(sensors, " "), string(s.TariffId), s.TariffDescription,
+			formatTimestamp(s.PeriodStart), formatTimestamp(s.PeriodEnd),
+			strconv.Itoa(s.Rates.Count), strconv.Itoa(s.Rates.SamplingPeriod), s.Rates.Min, s.Rates.Max, s.Rates.Mean, s.Rates.Hash,
+			strconv.FormatInt(s.Result, 10), strconv.Itoa(s.Scale), s.Amount, strconv.FormatBool(s.Partial),
+			formatMissingBatches(s.MissingBatches), s.Hash,
+		}
+		if err := writer.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	total := make([]string, len(statementCSVHeader))
+	total[0] = "total"
+	total[1] = string(period.CustomerId)
+	total[5] = formatTimestamp(period.From)
+	total[6] = formatTimestamp(period.To)
+	total[14] = strconv.Itoa(period.Scale)
+	total[15] = period.Total
+	total[16] = strconv.FormatBool(period.Partial)
+	total[18] = period.Hash
+	if err := writer.Write(total); err != nil {
+		return nil, err
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+//endregion
+
+//region HTML
+
+var statementTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"timestamp":      formatTimestamp,
+	"missingBatches": formatMissingBatches,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Statement of customer {{.CustomerId}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+td.amount { text-align: right; }
+.hash { font-family: monospace; font-size: 0.8em; }
+</style>
+</head>
+<body>
+<h1>Billing statement</h1>
+<p>
+Customer: {{.CustomerId}}<br>
+Period: {{timestamp .From}} &ndash; {{if .To}}{{timestamp .To}}{{else}}now{{end}}<br>
+Total: <strong>{{.Total}}</strong>{{if .Partial}} (some tasks are billed for the received batches only){{end}}
+</p>
+<table>
+<tr><th>Task</th><th>Period</th><th>Sensors</th><th>Tariff</th><th>Rates</th><th>Amount</th><th>Hash</th></tr>
+{{range .Statements}}
+<tr>
+<td>{{.TaskId}}</td>
+<td>{{timestamp .PeriodStart}}<br>{{timestamp .PeriodEnd}}</td>
+<td>{{range .Sensors}}{{.}}<br>{{end}}</td>
+<td>{{.TariffDescription}}<br><span class="hash">{{.TariffId}}</span></td>
+<td>{{.Rates.Count}} rates, every {{.Rates.SamplingPeriod}} s<br>min {{.Rates.Min}}, max {{.Rates.Max}}, mean {{.Rates.Mean}}</td>
+<td class="amount">{{.Amount}}{{if .Partial}}<br>partial, missing: {{missingBatches .MissingBatches}}{{end}}</td>
+<td class="hash">{{.Hash}}</td>
+</tr>
+{{end}}
+</table>
+<p class="hash">Statement hash: {{.Hash}}</p>
+</body>
+</html>
+`))
+
+func renderStatementHTML(period *PeriodStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := statementTemplate.Execute(&buf, period); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//endregion
+
+// formatTimestamp formats the timestamp as RFC 3339, in UTC; 0 is formatted as an empty string
+func formatTimestamp(timestamp int64) string {
+	if timestamp == 0 {
+		return ""
+	}
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+// formatMissingBatches formats the missing batches as "sensor:batch,batch" pairs, ordered by sensor id
+func formatMissingBatches(missingBatches map[UUID][]int) string {
+	sensorIds := make([]string, 0, len(missingBatches))
+	for sensorId := range missingBatches {
+		sensorIds = append(sensorIds, string(sensorId))
+	}
+	sort.Strings(sensorIds)
+
+	parts := make([]string, len(sensorIds))
+	for idx, sensorId := range sensorIds {
+		batches := make([]string, len(missingBatches[UUID(sensorId)]))
+		for batchIdx, batch := range missingBatches[UUID(sensorId)] {
+			batches[batchIdx] = strconv.Itoa(batch)
+		}
+		parts[idx] = sensorId + ":" + strings.Join(batches, ",")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	. "fe/common"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// A billing statement is issued for every task that has a result, and the statements of a customer's tasks that
+// start in a subscription period are collected into a PeriodStatement. Every statement carries a hash of its
+// contents, so the customer can check that a statement hasn't been altered since it was issued; the hash of
+// a PeriodStatement covers its statements too. The statements are rendered as JSON, CSV or HTML,
+// see statement-render.go.
+
+// Statement is the billing statement of a task
+type Statement struct {
+	TaskId     UUID   `json:"task_id"`
+	CustomerId UUID   `json:"customer_id"`
+	Sensors    []UUID `json:"sensors"`
+
+	// tariffs can't be changed once they're added, so the id identifies the version of the tariff
+	TariffId          UUID   `json:"tariff_id"`
+	TariffDescription string `json:"tariff_description"`
+
+	PeriodStart int64 `json:"period_start"` // timestamp of the start of the first batch
+	PeriodEnd   int64 `json:"period_end"`   // timestamp of the end of the last batch
+
+	Rates RatesSummary `json:"rates"`
+
+	Result int64  `json:"result"` // fixed-point encoded, with Scale decimal digits
+	Scale  int    `json:"scale"`
+	Amount string `json:"amount"`
+
+	// a partial statement bills the received batches only; the missing ones are listed by sensor id
+	Partial        bool           `json:"partial"`
+	MissingBatches map[UUID][]int `json:"missing_batches,omitempty"`
+
+	Hash string `json:"hash"` // see ComputeHash
+}
+
+// RatesSummary summarizes the rates the task is billed with; a rate applies to a sample of every sensor
+type RatesSummary struct {
+	Count          int    `json:"count"`
+	SamplingPeriod int    `json:"sampling_period"` // in seconds
+	Min            string `json:"min"`
+	Max            string `json:"max"`
+	Mean           string `json:"mean"` // rounded to the scale of the rates
+	Hash           string `json:"hash"` // SHA-256 of the fixed-point encoded rates, see HashRates
+}
+
+// PeriodStatement collects the statements of a customer's tasks that start in [From, To)
+type PeriodStatement struct {
+	CustomerId UUID        `json:"customer_id"`
+	From       int64       `json:"from"`
+	To         int64       `json:"to,omitempty"` // 0 if the period isn't bounded
+	Statements []Statement `json:"statements"`
+
+	// Total is the sum of the amounts of the statements, with Scale decimal digits
+	Total   string `json:"total"`
+	Scale   int    `json:"scale"`
+	Partial bool   `json:"partial"` // any of the statements is partial
+
+	Hash        string `json:"hash"`         // see ComputeHash
+	GeneratedAt int64  `json:"generated_at"` // not covered by the hash
+}
+
+//region hashing
+
+// ComputeHash returns the hex encoded SHA-256 of the JSON encoded statement without its hash
+func (s Statement) ComputeHash() string {
+	s.Hash = ""
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ComputeHash returns the hex encoded SHA-256 of the JSON encoded period statement, with its statements, without its
+// hash and generation time
+func (p PeriodStatement) ComputeHash() string {
+	p.Hash = ""
+	p.GeneratedAt = 0
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+//endregion
+
+// Statement returns the billing statement of the task; it fails if the task has no result yet
+func (t *Task) Statement() (*Statement, error) {
+	result := t.Result
+	if result == nil {
+		return nil, fmt.Errorf("task %s has no result yet", t.Id)
+	}
+
+	sensors := make([]UUID, len(t.Sensors))
+	for idx, sensor := range t.Sensors {
+		sensors[idx] = sensor.Id
+	}
+
+	statement := &Statement{
+		TaskId:            t.Id,
+		CustomerId:        t.CustomerId,
+		Sensors:           sensors,
+		TariffId:          t.Tariff.id,
+		TariffDescription: t.Tariff.Description,
+		PeriodStart:       int64(t.Start),
+		PeriodEnd:         t.End().Unix(),
+		Rates:             summarizeRates(t.Rates, t.Tariff),
+		Result:            result.Int64(),
+		Scale:             t.Tariff.ResultScale(),
+		Amount:            FormatFixedPoint(result, t.Tariff.ResultScale()),
+		Partial:           t.Status == "partial",
+	}
+	if statement.Partial {
+		statement.MissingBatches = t.GetMissingBatches()
+	}
+	statement.Hash = statement.ComputeHash()
+	return statement, nil
+}
+
+func summarizeRates(rates []int, tariff *Tariff) RatesSummary {
+	summary := RatesSummary{
+		Count:          len(rates),
+		SamplingPeriod: tariff.SamplingPeriod,
+		Hash:           HashRates(rates),
+	}
+	if len(rates) == 0 {
+		return summary
+	}
+
+	minRate, maxRate := rates[0], rates[0]
+	sum := big.NewInt(0)
+	for _, rate := range rates {
+		if rate < minRate {
+			minRate = rate
+		}
+		if rate > maxRate {
+			maxRate = rate
+		}
+		sum.Add(sum, big.NewInt(int64(rate)))
+	}
+
+	// rounded half away from zero
+	count := big.NewInt(int64(len(rates)))
+	mean, remainder := new(big.Int).QuoRem(sum, count, new(big.Int))
+	if new(big.Int).Abs(new(big.Int).Lsh(remainder, 1)).Cmp(count) >= 0 {
+		mean.Add(mean, big.NewInt(int64(sum.Sign())))
+	}
+
+	summary.Min = FormatFixedPoint(big.NewInt(int64(minRate)), tariff.RateScale)
+	summary.Max = FormatFixedPoint(big.NewInt(int64(maxRate)), tariff.RateScale)
+	summary.Mean = FormatFixedPoint(mean, tariff.RateScale)
+	return summary
+}
+
+// PeriodStatement returns the statements of the customer's tasks that have a result, and start in [from, to);
+// to is ignored if it's 0
+func (server *Server) PeriodStatement(customerId UUID, from, to int64) *PeriodStatement {
+	statements := make([]Statement, 0)
+	server.tasks.Range(func(_, value any) bool {
+		task := value.(*Task)
+		start := int64(task.Start)
+		if task.CustomerId != customerId || start < from || (to != 0 && start >= to) {
+			return true
+		}
+		if statement, err := task.Statement(); err == nil {
+			statements = append(statements, *statement)
+		}
+		return true
+	})
+
+	sort.Slice(statements, func(i, j int) bool {
+		a, b := statements[i], statements[j]
+		if a.PeriodStart != b.PeriodStart {
+			return a.PeriodStart < b.PeriodStart
+		}
+		return a.TaskId < b.TaskId
+	})
+	return server.newPeriodStatement(customerId, from, to, statements)
+}
+
+// TaskStatement returns the period statement of the task only, for the period of the task; it fails if the task has
+// no result yet
+func (server *Server) TaskStatement(task *Task) (*PeriodStatement, error) {
+	statement, err := task.Statement()
+	if err != nil {
+		return nil, err
+	}
+	return server.newPeriodStatement(task.CustomerId, statement.PeriodStart, statement.PeriodEnd, []Statement{*statement}), nil
+}
+
+// newPeriodStatement sums up the statements, and hashes the period statement
+func (server *Server) newPeriodStatement(customerId UUID, from, to int64, statements []Statement) *PeriodStatement {
+	period := &PeriodStatement{
+		CustomerId:  customerId,
+		From:        from,
+		To:          to,
+		Statements:  statements,
+		GeneratedAt: server.Clock.Now().Unix(),
+	}
+
+	// the results are rescaled to the largest scale, so they can be summed exactly
+	for _, statement := range period.Statements {
+		if statement.Scale > period.Scale {
+			period.Scale = statement.Scale
+		}
+		period.Partial = period.Partial || statement.Partial
+	}
+	total := big.NewInt(0)
+	for _, statement := range period.Statements {
+		rescaled := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(period.Scale-statement.Scale)), nil)
+		total.Add(total, rescaled.Mul(rescaled, big.NewInt(statement.Result)))
+	}
+	period.Total = FormatFixedPoint(total, period.Scale)
+
+	period.Hash = period.ComputeHash()
+	return period
+}
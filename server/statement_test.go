@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	. "fe/common"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStatementTask returns a finished task of the customer, of 2 batches sampled as the tariff says; result is nil
+// if the task has no result yet
+func newStatementTask(customerId UUID, tariff *Tariff, start int, result *big.Int) *Task {
+	return &Task{
+		Id:         NewUUID(),
+		Status:     "finished",
+		Sensors:    []*Sensor{{Id: "sensor-0"}, {Id: "sensor-1"}},
+		CustomerId: customerId,
+		SamplingParams: SamplingParams{
+			Start:          start,
+			SamplingPeriod: tariff.SamplingPeriod,
+			BatchParams:    BatchParams{BatchSize: tariff.BatchSize, BatchCnt: 2},
+		},
+		Tariff: tariff,
+		Rates:  []int{-25, 75, 10, 11},
+		Result: result,
+	}
+}
+
+func TestStatement(t *testing.T) {
+	tariff := addTestTariff(func(tariff *Tariff) {
+		tariff.Description = "day and night"
+		tariff.BatchSize = 2
+	})
+
+	if _, err := newStatementTask("customer-0", tariff, 1000, nil).Statement(); err == nil {
+		t.Error("statement of a task without a result issued")
+	}
+
+	task := newStatementTask("customer-0", tariff, 1000, big.NewInt(-1234))
+	statement, err := task.Statement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statement.PeriodStart != 1000 || statement.PeriodEnd != 1000+2*2*60 {
+		t.Errorf("period [%d, %d], expected [1000, 1240]", statement.PeriodStart, statement.PeriodEnd)
+	}
+	if statement.Scale != 3 || statement.Amount != "-1.234" || statement.Partial {
+		t.Errorf("amount %s with scale %d (partial %t), expected -1.234 with scale 3", statement.Amount, statement.Scale, statement.Partial)
+	}
+	if statement.TariffId != tariff.id || statement.TariffDescription != "day and night" || len(statement.Sensors) != 2 {
+		t.Errorf("tariff %s (%s), sensors %v", statement.TariffId, statement.TariffDescription, statement.Sensors)
+	}
+
+	t.Run("hash", func(t *testing.T) {
+		if statement.Hash == "" || statement.Hash != statement.ComputeHash() {
+			t.Errorf("hash %s, expected %s", statement.Hash, statement.ComputeHash())
+		}
+		altered := *statement
+		altered.Amount = "-0.234"
+		if altered.ComputeHash() == statement.Hash {
+			t.Error("hash of an altered statement unchanged")
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		task.Status = "partial"
+		task.MissingBatches = map[UUID][]int{"sensor-1": {1}}
+		partial, err := task.Statement()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !partial.Partial || len(partial.MissingBatches["sensor-1"]) != 1 {
+			t.Errorf("partial %t, missing batches %v", partial.Partial, partial.MissingBatches)
+		}
+		if partial.Hash == statement.Hash {
+			t.Error("partial statement has the hash of the full one")
+		}
+	})
+}
+
+func TestSummarizeRates(t *testing.T) {
+	tests := []struct {
+		name      string
+		rates     []int
+		min       string
+		max       string
+		mean      string
+		rateScale int
+	}{
+		{"scaled", []int{-25, 75, 10, 11}, "-0.25", "0.75", "0.18", 2},
+		{"half up", []int{1, 2}, "1", "2", "2", 0},
+		{"negative half", []int{-1, -2}, "-2", "-1", "-2", 0},
+		{"below half", []int{0, 0, 1}, "0", "1", "0", 0},
+		{"no rates", []int{}, "", "", "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			summary := summarizeRates(test.rates, &Tariff{SamplingPeriod: 60, RateScale: test.rateScale})
+			if summary.Count != len(test.rates) || summary.SamplingPeriod != 60 || summary.Hash != HashRates(test.rates) {
+				t.Errorf("count %d, sampling period %d, hash %s", summary.Count, summary.SamplingPeriod, summary.Hash)
+			}
+			if summary.Min != test.min || summary.Max != test.max || summary.Mean != test.mean {
+				t.Errorf("min %s, max %s, mean %s, expected %s, %s, %s", summary.Min, summary.Max, summary.Mean,
+					test.min, test.max, test.mean)
+			}
+		})
+	}
+}
+
+func TestPeriodStatement(t *testing.T) {
+	server, clock := newTestServer(t)
+	// results with 3 and 1 decimal digits
+	tariff := addTestTariff(func(tariff *Tariff) {})
+	coarseTariff := addTestTariff(func(tariff *Tariff) {
+		tariff.SampleScale = 0
+		tariff.RateScale = 1
+	})
+
+	first := newStatementTask("customer-0", tariff, 100, big.NewInt(1500))
+	second := newStatementTask("customer-0", coarseTariff, 200, big.NewInt(25))
+	for _, task := range []*Task{
+		second, first,
+		newStatementTask("customer-0", tariff, 300, big.NewInt(1)), // after the period
+		newStatementTask("customer-0", tariff, 50, big.NewInt(1)),  // before the period
+		newStatementTask("customer-0", tariff, 150, nil),           // without a result
+		newStatementTask("customer-1", tariff, 150, big.NewInt(1)), // of another customer
+	} {
+		server.AddTask(task)
+	}
+
+	period := server.PeriodStatement("customer-0", 100, 300)
+	if len(period.Statements) != 2 || period.Statements[0].TaskId != first.Id || period.Statements[1].TaskId != second.Id {
+		t.Fatalf("statements %v, expected the ones of the tasks %s and %s, in order", period.Statements, first.Id, second.Id)
+	}
+	// 1.500 + 2.5
+	if period.Total != "4.000" || period.Scale != 3 || period.Partial {
+		t.Errorf("total %s with scale %d (partial %t), expected 4.000 with scale 3", period.Total, period.Scale, period.Partial)
+	}
+
+	t.Run("unbounded", func(t *testing.T) {
+		if unbounded := server.PeriodStatement("customer-0", 0, 0); len(unbounded.Statements) != 4 {
+			t.Errorf("%d statements, expected 4", len(unbounded.Statements))
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		if period.Hash != period.ComputeHash() {
+			t.Errorf("hash %s, expected %s", period.Hash, period.ComputeHash())
+		}
+
+		// the generation time isn't hashed, the statements are
+		clock.Advance(time.Minute)
+		if regenerated := server.PeriodStatement("customer-0", 100, 300); regenerated.Hash != period.Hash {
+			t.Errorf("hash %s of the regenerated statement, expected %s", regenerated.Hash, period.Hash)
+		}
+		altered := *period
+		altered.Statements = []Statement{period.Statements[0]}
+		if altered.ComputeHash() == period.Hash {
+			t.Error("hash of a statement with altered statements unchanged")
+		}
+	})
+
+	t.Run("task", func(t *testing.T) {
+		taskPeriod, err := server.TaskStatement(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(taskPeriod.Statements) != 1 || taskPeriod.Total != "2.5" || taskPeriod.From != 200 || taskPeriod.To != second.End().Unix() {
+			t.Errorf("statement %+v, expected the one of the task only", taskPeriod)
+		}
+	})
+}
+
+func TestRenderStatement(t *testing.T) {
+	server, _ := newTestServer(t)
+	tariff := addTestTariff(func(tariff *Tariff) { tariff.Description = "<b>peak</b>" })
+	task := newStatementTask("customer-0", tariff, 100, big.NewInt(1500))
+	task.Status = "partial"
+	task.MissingBatches = map[UUID][]int{"sensor-1": {0, 1}, "sensor-0": {1}}
+	server.AddTask(task)
+	period := server.PeriodStatement("customer-0", 100, 0)
+
+	t.Run("json", func(t *testing.T) {
+		file, err := RenderStatement(period, StatementJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Name != "statement-customer-0-100.json" || file.ContentType != BodyJSON {
+			t.Errorf("file %s of type %s", file.Name, file.ContentType)
+		}
+		var decoded PeriodStatement
+		if err = json.Unmarshal(file.Data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.ComputeHash() != period.Hash {
+			t.Error("hash of the decoded statement differs")
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		file, err := RenderStatement(period, StatementCSV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := csv.NewReader(bytes.NewReader(file.Data)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 || len(rows[1]) != len(statementCSVHeader) {
+			t.Fatalf("rows %v, expected the header, the statement and the total", rows)
+		}
+		if rows[1][15] != "1.500" || rows[1][17] != "sensor-0:1 sensor-1:0,1" || rows[1][18] != period.Statements[0].Hash {
+			t.Errorf("statement row %v", rows[1])
+		}
+		if rows[2][0] != "total" || rows[2][15] != period.Total || rows[2][18] != period.Hash || rows[2][6] != "" {
+			t.Errorf("total row %v", rows[2])
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		file, err := RenderStatement(period, StatementHTML)
+		if err != nil {
+			t.Fatal(err)
+		}
+		html := string(file.Data)
+		if !strings.Contains(html, period.Hash) || !strings.Contains(html, "1970-01-01T00:01:40Z") {
+			t.Error("hash or period missing from the HTML statement")
+		}
+		if strings.Contains(html, "<b>peak</b>") {
+			t.Error("tariff description not escaped")
+		}
+	})
+
+	if _, err := RenderStatement(period, "pdf"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
@@ -1,25 +1,38 @@
 package server
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
 	. "fe/common"
+	"fmt"
+	"math/rand"
 	"sync"
-	"sync/atomic"
 )
 
+// Tariff describes how a customer is billed. Samples and rates are decimal values, that can be negative (e.g. for
+// the energy exported by the customer); they are fixed-point encoded with SampleScale and RateScale decimal digits.
 type Tariff struct {
 	id             UUID
-	Description    string `json:"description"`
-	SamplingPeriod int    `json:"samplingPeriod"`
-	BatchSize      int    `json:"batchSize"`
-	MaxSampleValue int    `json:"maxSampleValue"`
-	MaxTariffValue int    `json:"maxTariffValue"`
+	Description    string  `json:"description"`
+	SamplingPeriod int     `json:"sampling_period"`
+	BatchSize      int     `json:"batch_size"`
+	MinSampleValue float64 `json:"min_sample_value"`
+	MaxSampleValue float64 `json:"max_sample_value"`
+	MinTariffValue float64 `json:"min_tariff_value"`
+	MaxTariffValue float64 `json:"max_tariff_value"`
+	SampleScale    int     `json:"sample_scale"`
+	RateScale      int     `json:"rate_scale"`
 }
 
 var tariffMap = sync.Map{}
 
 func GetTariff(tariffId UUID) (*Tariff, bool) {
 	tariff, exists := tariffMap.Load(tariffId)
-	return tariff.(*Tariff), exists
+	if !exists {
+		return nil, false
+	}
+	return tariff.(*Tariff), true
 }
 
 func NewTariff() *Tariff {
@@ -32,22 +45,76 @@ func SaveTariff(tariff *Tariff) {
 	tariffMap.Store(tariff.id, tariff)
 }
 
-func (r *Tariff) GenerateRates(vectorCnt int) ([]int, error) {
-	rateGen := NewRepeatedSequenceGenerator()
-	if !ratesGenerator.CompareAndSwap(nil, rateGen) {
-		rateGen = ratesGenerator.Load()
+// Validate checks the tariff, and that its bounds can be encoded
+func (r *Tariff) Validate() error {
+	if r.SamplingPeriod < 1 || r.BatchSize < 1 {
+		return fmt.Errorf("sampling period and batch size must be positive")
 	}
 
-	var idx int
-	rateGen.Reset(&idx)
+	sampleMin, sampleMax, err := r.SampleBounds()
+	if err != nil {
+		return err
+	}
+	if sampleMin > sampleMax {
+		return fmt.Errorf("min sample value %g is greater than max sample value %g", r.MinSampleValue, r.MaxSampleValue)
+	}
 
-	ratesCnt := vectorCnt * r.BatchSize
-	rates := make([]int, 0)
+	rateMin, rateMax, err := r.RateBounds()
+	if err != nil {
+		return err
+	}
+	if rateMin > rateMax {
+		return fmt.Errorf("min tariff value %g is greater than max tariff value %g", r.MinTariffValue, r.MaxTariffValue)
+	}
+	return nil
+}
+
+// SampleBounds returns the fixed-point encoded bounds of the samples
+func (r *Tariff) SampleBounds() (int, int, error) {
+	return encodeBounds(r.MinSampleValue, r.MaxSampleValue, r.SampleScale)
+}
+
+// RateBounds returns the fixed-point encoded bounds of the rates
+func (r *Tariff) RateBounds() (int, int, error) {
+	return encodeBounds(r.MinTariffValue, r.MaxTariffValue, r.RateScale)
+}
 
-	for idx < ratesCnt {
-		rates = append(rates, rateGen.ReadSample(r.MaxSampleValue, &idx))
+// ResultScale is the scale of the fixed-point encoded result, a sum of products of samples and rates
+func (r *Tariff) ResultScale() int {
+	return r.SampleScale + r.RateScale
+}
+
+func encodeBounds(minValue, maxValue float64, scale int) (int, int, error) {
+	encodedMin, err := EncodeFixedPoint(minValue, scale)
+	if err != nil {
+		return 0, 0, err
+	}
+	encodedMax, err := EncodeFixedPoint(maxValue, scale)
+	if err != nil {
+		return 0, 0, err
+	}
+	return encodedMin, encodedMax, nil
+}
+
+// GenerateRates generates the fixed-point encoded rates for vectorCnt batches; the rates are derived from the tariff
+// alone, so that whoever has the tariff can regenerate them, and check the rates a task is billed with (see bundle.go)
+func (r *Tariff) GenerateRates(vectorCnt int) ([]int, error) {
+	minRate, maxRate, err := r.RateBounds()
+	if err != nil {
+		return nil, err
+	}
+
+	rateGen := rand.New(rand.NewSource(r.seed()))
+	rates := make([]int, vectorCnt*r.BatchSize)
+	for idx := range rates {
+		rates[idx] = minRate + rateGen.Intn(maxRate-minRate+1)
 	}
 	return rates, nil
 }
 
-var ratesGenerator atomic.Pointer[RepeatedSequenceGenerator]
+// seed returns the seed of the rates, from the hash of the tariff
+func (r *Tariff) seed() int64 {
+	data, _ := json.Marshal(r)
+	hash := sha256.Sum256(data)
+	return int64(binary.BigEndian.Uint64(hash[:8]))
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTariffValidate(t *testing.T) {
+	valid := Tariff{SamplingPeriod: 60, BatchSize: 4, MinSampleValue: -1.5, MaxSampleValue: 10, MinTariffValue: -0.25,
+		MaxTariffValue: 0.75, SampleScale: 1, RateScale: 2}
+
+	tests := []struct {
+		name   string
+		modify func(tariff *Tariff)
+		valid  bool
+	}{
+		{"valid", func(tariff *Tariff) {}, true},
+		{"no sampling period", func(tariff *Tariff) { tariff.SamplingPeriod = 0 }, false},
+		{"no batch size", func(tariff *Tariff) { tariff.BatchSize = 0 }, false},
+		{"sample bounds swapped", func(tariff *Tariff) { tariff.MinSampleValue = 11 }, false},
+		{"rate bounds swapped", func(tariff *Tariff) { tariff.MaxTariffValue = -1 }, false},
+		{"invalid scale", func(tariff *Tariff) { tariff.RateScale = -1 }, false},
+		{"sample out of range", func(tariff *Tariff) { tariff.MaxSampleValue = 1e18 }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tariff := valid
+			test.modify(&tariff)
+			err := tariff.Validate()
+			if test.valid && err != nil {
+				t.Errorf("valid tariff rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid tariff accepted")
+			}
+		})
+	}
+}
+
+func TestTariffBounds(t *testing.T) {
+	tariff := Tariff{MinSampleValue: -1.5, MaxSampleValue: 10, MinTariffValue: -0.25, MaxTariffValue: 0.75,
+		SampleScale: 1, RateScale: 2}
+
+	if minSample, maxSample, err := tariff.SampleBounds(); err != nil || minSample != -15 || maxSample != 100 {
+		t.Errorf("sample bounds [%d, %d] (%v), expected [-15, 100]", minSample, maxSample, err)
+	}
+	if minRate, maxRate, err := tariff.RateBounds(); err != nil || minRate != -25 || maxRate != 75 {
+		t.Errorf("rate bounds [%d, %d] (%v), expected [-25, 75]", minRate, maxRate, err)
+	}
+	if scale := tariff.ResultScale(); scale != 3 {
+		t.Errorf("result scale %d, expected 3", scale)
+	}
+}
+
+func TestGenerateRates(t *testing.T) {
+	tariff := &Tariff{SamplingPeriod: 60, BatchSize: 3, MinTariffValue: -0.5, MaxTariffValue: 0.5, RateScale: 1}
+
+	rates, err := tariff.GenerateRates(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 12 {
+		t.Fatalf("%d rates, expected 12", len(rates))
+	}
+	for idx, rate := range rates {
+		if rate < -5 || rate > 5 {
+			t.Errorf("rate no %d is %d, out of [-5, 5]", idx, rate)
+		}
+	}
+
+	// the rates are derived from the tariff alone
+	regenerated, err := (&Tariff{SamplingPeriod: 60, BatchSize: 3, MinTariffValue: -0.5, MaxTariffValue: 0.5, RateScale: 1}).GenerateRates(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rates, regenerated) {
+		t.Errorf("rates %v regenerated as %v", rates, regenerated)
+	}
+	tariff.Description = "another tariff"
+	if other, _ := tariff.GenerateRates(4); slices.Equal(rates, other) {
+		t.Error("another tariff generates the same rates")
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	. "fe/common"
+	"github.com/fentec-project/bn256"
+	"github.com/fentec-project/gofe/data"
+)
+
+// With SchemeDecentralizedDMCFE, the authority isn't used; every sensor generates the keys of its own clients,
+// and the server only relays the public keys, and combines the key shares that the sensors derive for the rates.
+
+// ExchangeDMCFEPubKeys fetches the public keys of the clients of all the Sensors, and sends all of them to every
+// Sensor, so the sensors can set their shares; the Task must already be submitted to the sensors
+func (t *Task) ExchangeDMCFEPubKeys() bool {
+	pubKeys := make([]*bn256.G1, 0, len(t.Sensors)*t.BatchSize)
+	for _, sensor := range t.Sensors {
+		t.logger.Info("fetching DMCFE public keys of sensor %s", sensor.Id)
+		sensorPubKeys, err := sensor.FetchDMCFEPubKeys(t.Id)
+		if err != nil {
+			t.logger.Err(err)
+			t.logger.Error("fetching DMCFE public keys of sensor %s failed", sensor.Id)
+			return false
+		}
+
+		if len(sensorPubKeys.PubKeys) != t.BatchSize {
+			t.logger.Error("sensor %s sent %d DMCFE public keys, expected %d", sensor.Id, len(sensorPubKeys.PubKeys), t.BatchSize)
+			return false
+		}
+		pubKeys = append(pubKeys, sensorPubKeys.PubKeys...)
+	}
+
+	for _, sensor := range t.Sensors {
+		t.logger.Info("sending DMCFE public keys to sensor %s", sensor.Id)
+		if err := sensor.SendDMCFEPubKeys(t.Id, &DMCFEPubKeys{PubKeys: pubKeys}); err != nil {
+			t.logger.Err(err)
+			t.logger.Error("sending DMCFE public keys to sensor %s failed", sensor.Id)
+			return false
+		}
+	}
+
+	t.schemaParamsFetched.Store(true)
+	t.logger.Info("DMCFE public keys exchanged")
+	return true
+}
+
+// CollectDMCFEKeyShares generates the rates, and collects the key shares for them from all the Sensors; their sum
+// is the decryption key, so the result can be decrypted only if every sensor approves the rates
+func (t *Task) CollectDMCFEKeyShares() bool {
+	rates, err := t.Tariff.GenerateRates(t.BatchCnt)
+	if err != nil {
+		t.logger.Err(err)
+		return false
+	}
+	t.Rates = rates
+	t.logger.Debug("generated rates: %v", rates)
+
+	decryptionKeys := make([]data.VectorG2, t.BatchCnt)
+	for _, sensor := range t.Sensors {
+		t.logger.Info("fetching DMCFE key shares of sensor %s", sensor.Id)
+		keyShares, err := sensor.FetchDMCFEKeyShares(t.Id, rates)
+		if err != nil {
+			t.logger.Err(err)
+			t.logger.Error("fetching DMCFE key shares of sensor %s failed", sensor.Id)
+			return false
+		}
+
+		if len(keyShares.KeyShares) != t.BatchCnt {
+			t.logger.Error("sensor %s sent %d DMCFE key shares, expected %d", sensor.Id, len(keyShares.KeyShares), t.BatchCnt)
+			return false
+		}
+
+		for batchIdx, keyShare := range keyShares.KeyShares {
+			if decryptionKeys[batchIdx] == nil {
+				decryptionKeys[batchIdx] = keyShare
+			} else {
+				decryptionKeys[batchIdx] = decryptionKeys[batchIdx].Add(keyShare)
+			}
+		}
+	}
+	attempt := t.ratesSubmittedCnt.Add(1)
+	t.events.Publish(eventRatesSent, ratesSentEvent{Attempt: int(attempt)})
+
+	ratesMatrix, err := DMCFERates(rates, len(t.Sensors), t.BatchSize)
+	if err != nil {
+		t.logger.Err(err)
+		return false
+	}
+
+	decryptionParams := &DMCFEDecryptionParams{
+		SensorCnt: len(t.Sensors),
+		BatchCnt:  t.BatchCnt,
+		BatchSize: t.BatchSize,
+		Bound: DMCFEBound(len(t.Sensors)*t.BatchSize, ValueBound(t.MinSampleValue, t.MaxSampleValue),
+			ValueBound(t.MinRateValue, t.MaxRateValue)),
+		Label:          string(t.Id),
+		DecryptionKeys: decryptionKeys,
+		Rates:          ratesMatrix,
+	}
+
+	if !t.setFEDecryptor(decryptionParams) {
+		return false
+	}
+	t.logger.Info("DMCFE key shares collected")
+	return true
+}
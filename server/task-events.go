@@ -0,0 +1,107 @@
+package server
+
+import (
+	. "fe/common"
+	"math/big"
+	"time"
+)
+
+// The task publishes its events to its EventLog, which is streamed at GET /v1/tasks/:id/events, so the operators don't
+// have to poll GET /v1/tasks/:id. The stream ends after the result, or after the task fails.
+
+const (
+	eventCreated     = "created"      // the task has been created; taskCreatedEvent
+	eventSchemaReady = "schema_ready" // the authority has generated the fe params
+	eventSubmitted   = "submitted"    // the task has been submitted to a sensor; sensorEvent
+	eventRatesSent   = "rates_sent"   // the rates have been sent to the authority; ratesSentEvent
+	eventKeyReady    = "key_ready"    // the decryption key has been derived, or combined
+	eventCipher      = "cipher"       // a cipher has been added to the decryptor; cipherEvent
+	eventProgress    = "progress"     // a running total has been computed; progressEvent
+	eventIncomplete  = "incomplete"   // the submissions have been closed with missing batches; incompleteEvent
+	eventResult      = "result"       // the result has been decrypted; resultEvent
+	eventFailed      = "failed"       // the task can't be completed; failedEvent
+)
+
+type taskCreatedEvent struct {
+	Scheme    string `json:"scheme"`
+	SensorCnt int    `json:"sensor_cnt"`
+	BatchCnt  int    `json:"batch_cnt"`
+	Deadline  int64  `json:"deadline"`
+}
+
+type sensorEvent struct {
+	SensorId UUID `json:"sensor_id"`
+}
+
+type ratesSentEvent struct {
+	Attempt int `json:"attempt"`
+}
+
+type cipherEvent struct {
+	SensorId UUID `json:"sensor_id"`
+	Batch    int  `json:"batch"`
+
+	// ProcessingTime is the time spent adding the cipher to the decryptor, in nanoseconds; for the last cipher,
+	// it includes decrypting the result
+	ProcessingTime int64  `json:"processing_time"`
+	Error          string `json:"error,omitempty"`
+}
+
+type progressEvent struct {
+	Batches int    `json:"batches"`
+	Result  int64  `json:"result"` // fixed-point encoded
+	Amount  string `json:"amount"`
+}
+
+type incompleteEvent struct {
+	MissingBatches map[UUID][]int `json:"missing_batches"`
+}
+
+type resultEvent struct {
+	Result  int64  `json:"result"` // fixed-point encoded
+	Amount  string `json:"amount"`
+	Partial bool   `json:"partial,omitempty"`
+}
+
+type failedEvent struct {
+	Reason string `json:"reason"`
+}
+
+// publishCipher publishes that the cipher of batch no batchIdx of the sensor has been added, in elapsed
+func (t *Task) publishCipher(sensorId UUID, batchIdx int, elapsed time.Duration, err error) {
+	event := cipherEvent{
+		SensorId:       sensorId,
+		Batch:          batchIdx,
+		ProcessingTime: elapsed.Nanoseconds(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	t.events.Publish(eventCipher, event)
+}
+
+// publishResult publishes the result of the task, which ends the event stream
+func (t *Task) publishResult(result *big.Int, partial bool) {
+	t.events.Publish(eventResult, resultEvent{
+		Result:  result.Int64(),
+		Amount:  FormatFixedPoint(result, t.Tariff.ResultScale()),
+		Partial: partial,
+	})
+	t.events.Close()
+}
+
+// fail publishes that the task can't be completed, which ends the event stream; it's ignored if the stream has
+// already ended, e.g. if the task has been stopped, or it has already failed
+func (t *Task) fail(reason string) {
+	if t.events.Closed() {
+		return
+	}
+	t.logger.Error("task failed: %s", reason)
+	t.events.Publish(eventFailed, failedEvent{Reason: reason})
+	t.events.Close()
+}
+
+// Events returns a stream of the task's events after the event with id lastEventId
+func (t *Task) Events(lastEventId int) *EventStream {
+	return t.events.Subscribe(lastEventId)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	. "fe/common"
+	"fmt"
+)
+
+// The decryptors need all the ciphers of a task, so a task with missing batches would never be billed. At the
+// deadline, the server asks the authority for a key restricted to the received ciphers, with the rates of the missing
+// ones zeroed, and bills the task for the received batches only; the task is then "partial", and the missing batches
+// are listed. The authority may refuse the key, see authority/partial-key.go.
+//
+// With the DMCFE schemes, every batch is decrypted with a key of its own as soon as all the sensors have submitted
+// it, so the decrypted batches are billed without a restricted key; the batches that some sensors haven't submitted
+// are missing for all of them. Of the other schemes, only SchemeFHMultiIPE and SchemeDummy support restricted keys,
+// so the tasks of the rest fail if batches are missing.
+
+const (
+	partialResultComputed = "computed"
+	partialResultFailed   = "failed"
+)
+
+// finalisePartial computes the result of the received ciphers; it must be called after the submissions are closed
+func (t *Task) finalisePartial() {
+	if stopped := t.awaitAddedCiphers(); stopped {
+		return
+	}
+
+	decryptor, ok := t.feDecryptor.(PartialDecryptor)
+	if !ok {
+		t.fail(fmt.Sprintf("scheme %s can't bill the received batches only", t.Scheme))
+		return
+	}
+
+	// the ciphers that failed to be added are missing too
+	cipherCnt := len(t.Sensors) * t.BatchCnt
+	received := make([]bool, cipherCnt)
+	receivedIdxs := decryptor.ReceivedCipherIdxs()
+	for _, idx := range receivedIdxs {
+		received[idx] = true
+	}
+	if len(receivedIdxs) == 0 {
+		t.fail("no ciphers received")
+		return
+	}
+
+	missingCiphers := make([]int, 0)
+	missingBatches := make(map[UUID][]int)
+	for idx := 0; idx < cipherCnt; idx++ {
+		if !received[idx] {
+			sensorId := t.Sensors[idx/t.BatchCnt].Id
+			missingCiphers = append(missingCiphers, idx)
+			missingBatches[sensorId] = append(missingBatches[sensorId], idx%t.BatchCnt)
+		}
+	}
+	if unreceived := t.GetMissingBatches(); countBatches(unreceived) < len(missingCiphers) {
+		t.logger.Warn("%d received ciphers can't be billed", len(missingCiphers)-countBatches(unreceived))
+		t.markIncomplete(missingBatches, len(missingCiphers)-countBatches(unreceived))
+	}
+
+	var decryptionParams FEDecryptionParams
+	if !DecryptsBatches(t.Scheme) {
+		t.logger.Info("requesting a key restricted to %d of %d ciphers", len(receivedIdxs), cipherCnt)
+		decryptionParamsId, err := t.Authority.SendPartialRates(t.Id, t.Rates, missingCiphers)
+		if err != nil {
+			t.failPartial(err)
+			return
+		}
+
+		var data []byte
+		decryptionParams, data, err = t.awaitDecryptionParams(decryptionParamsId)
+		if err == errTaskStopped {
+			return
+		} else if err != nil {
+			t.failPartial(err)
+			return
+		}
+		t.recordKey(&t.partialKey, decryptionParamsId, data)
+	}
+
+	result, err := decryptor.DecryptPartial(decryptionParams)
+	if err != nil {
+		t.failPartial(err)
+		return
+	}
+
+	t.Result = result
+	t.Status = "partial"
+	t.metrics.partialResults.Inc(partialResultComputed)
+	t.logger.Info("partial result computed from %d of %d ciphers", len(receivedIdxs), cipherCnt)
+	t.logger.Debug("result: %d", result)
+	t.publishResult(result, true)
+}
+
+func (t *Task) failPartial(err error) {
+	t.logger.Err(err)
+	t.metrics.partialResults.Inc(partialResultFailed)
+	t.fail("computing the partial result failed")
+}
+
+// countBatches returns the number of batches of all the sensors
+func countBatches(batches map[UUID][]int) int {
+	cnt := 0
+	for _, sensorBatches := range batches {
+		cnt += len(sensorBatches)
+	}
+	return cnt
+}
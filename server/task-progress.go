@@ -0,0 +1,149 @@
+package server
+
+import (
+	. "fe/common"
+	"math/big"
+	"time"
+)
+
+// With the running total enabled, the task is billed for its first batches after every ProgressWindow batches of
+// all the sensors are received, with prefix keys, that is keys restricted to the first batches, derived by the
+// authority. The authority decides how short the windows can be, see authority/progress.go.
+
+// ProgressPoint is the running total of the task after the first Batches batches of every sensor
+type ProgressPoint struct {
+	Batches    int
+	End        time.Time // when the last batch of the window has been sampled
+	Result     *big.Int  // fixed-point encoded
+	ComputedAt time.Time
+}
+
+// notifyProgress wakes up trackProgress, without blocking
+func (t *Task) notifyProgress() {
+	select {
+	case t.progressChan <- true:
+	default:
+	}
+}
+
+// trackProgress computes the running total at the end of every window, once all its ciphers are added; it returns
+// after the last window before the end of the task, or when a window can't be completed
+func (t *Task) trackProgress() {
+	// the ciphers are added to the decryptor only after the decryption params are fetched
+	select {
+	case <-t.decryptionParamsFetchedChan:
+	case <-t.stopChan:
+		return
+	}
+
+	decryptor, ok := t.feDecryptor.(PartialDecryptor)
+	if !ok {
+		t.logger.Warn("scheme %s doesn't support running totals", t.Scheme)
+		return
+	}
+
+	for batches := t.ProgressWindow; batches < t.BatchCnt; batches += t.ProgressWindow {
+		idxs := t.prefixCipherIdxs(batches)
+		for !receivedAll(decryptor, idxs) {
+			if t.submissionsClosed.Load() {
+				t.addingCiphers.Wait()
+				if receivedAll(decryptor, idxs) {
+					break
+				}
+				t.logger.Warn("running total stopped before %d batches, as some of them are missing", batches)
+				return
+			}
+
+			select {
+			case <-t.progressChan:
+			case <-t.stopChan:
+				return
+			}
+		}
+
+		if stopped := t.computeProgress(decryptor, batches, idxs); stopped {
+			return
+		}
+	}
+}
+
+// computeProgress gets the prefix key of the first batches of every sensor, and adds the running total of their
+// ciphers idxs to the progress; it returns true if the task has been stopped in the meantime
+func (t *Task) computeProgress(decryptor PartialDecryptor, batches int, idxs []int) (stopped bool) {
+	t.logger.Info("requesting prefix key of %d batches", batches)
+	decryptionParamsId, err := t.Authority.SendPrefixRates(t.Id, t.Rates, batches)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("running total of %d batches skipped", batches)
+		return false
+	}
+
+	decryptionParams, _, err := t.awaitDecryptionParams(decryptionParamsId)
+	if err == errTaskStopped {
+		return true
+	} else if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("running total of %d batches skipped", batches)
+		return false
+	}
+
+	result, err := decryptor.DecryptSubset(decryptionParams, idxs)
+	if err != nil {
+		t.logger.Err(err)
+		t.logger.Error("running total of %d batches skipped", batches)
+		return false
+	}
+
+	point := ProgressPoint{
+		Batches:    batches,
+		End:        t.batchEnd(batches - 1),
+		Result:     result,
+		ComputedAt: t.clock.Now(),
+	}
+	t.progressMutex.Lock()
+	t.progress = append(t.progress, point)
+	t.progressMutex.Unlock()
+	t.events.Publish(eventProgress, progressEvent{
+		Batches: batches,
+		Result:  result.Int64(),
+		Amount:  FormatFixedPoint(result, t.Tariff.ResultScale()),
+	})
+
+	t.logger.Info("running total of %d of %d batches computed", batches, t.BatchCnt)
+	t.logger.Debug("running total: %d", result)
+	return false
+}
+
+// prefixCipherIdxs returns the indices of the ciphers of the first batches of every sensor
+func (t *Task) prefixCipherIdxs(batches int) []int {
+	idxs := make([]int, 0, len(t.Sensors)*batches)
+	for sensorIdx := range t.Sensors {
+		for batchIdx := 0; batchIdx < batches; batchIdx++ {
+			idxs = append(idxs, sensorIdx*t.BatchCnt+batchIdx)
+		}
+	}
+	return idxs
+}
+
+func receivedAll(decryptor PartialDecryptor, idxs []int) bool {
+	received := make(map[int]bool)
+	for _, idx := range decryptor.ReceivedCipherIdxs() {
+		received[idx] = true
+	}
+	for _, idx := range idxs {
+		if !received[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetProgress returns the running totals computed so far, from the shortest prefix
+func (t *Task) GetProgress() []ProgressPoint {
+	t.progressMutex.Lock()
+	defer t.progressMutex.Unlock()
+
+	progress := make([]ProgressPoint, len(t.progress))
+	copy(progress, t.progress)
+	return progress
+}
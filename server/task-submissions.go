@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	. "fe/common"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Sensors may be offline when their batches are encrypted, so they upload the ciphers later. A task accepts ciphers
+// until its deadline, that is its end plus the grace period; at the deadline, the batches that haven't been received
+// are marked as missing, the ciphers that arrive later are rejected, and the task is billed for the received
+// batches only (see task-partial.go).
+
+var (
+	errLateCipher      = errors.New("the deadline for submitting ciphers has passed")
+	errDuplicateCipher = errors.New("the batch has already been received")
+)
+
+// End returns the time the last batch of the task is sampled
+func (t *Task) End() time.Time {
+	return t.batchEnd(t.BatchCnt - 1)
+}
+
+// batchEnd returns the time batch no batchIdx is sampled
+func (t *Task) batchEnd(batchIdx int) time.Time {
+	duration := time.Duration((batchIdx+1)*t.BatchSize*t.SamplingPeriod) * time.Second
+	return time.Unix(int64(t.Start), 0).Add(duration)
+}
+
+// Deadline returns the time after which no ciphers are accepted
+func (t *Task) Deadline() time.Time {
+	return t.End().Add(t.GracePeriod)
+}
+
+// CheckCipher returns an error if the cipher isn't a cipher of the task's scheme, or if it's encrypted for another
+// batch than batch no batchIdx of the sensor; otherwise, a sensor could submit a cipher in the slot of another sensor
+// or batch
+func (t *Task) CheckCipher(sensorId UUID, batchIdx int, feCipher FECipher) error {
+	sensorIdx, err := t.getSensorIdx(sensorId)
+	if err != nil {
+		return err
+	}
+
+	var schemes []string
+	idx := sensorIdx*t.BatchCnt + batchIdx
+	cipherIdx := idx // the ciphers of the single-input schemes have no index
+	switch cipher := feCipher.(type) {
+	case *SingleFECipher:
+		schemes = []string{SchemeFHIPE}
+	case *LWECipher:
+		schemes = []string{SchemeLWE}
+	case *MultiFECipher:
+		schemes, cipherIdx = []string{SchemeFHMultiIPE}, cipher.Idx
+	case *MultiInputCipher:
+		schemes, cipherIdx = []string{SchemeDamgardMulti, SchemePaillierMulti}, cipher.Idx
+	case *DummyCipher:
+		schemes, cipherIdx = []string{SchemeDummy}, cipher.Idx
+	case *DMCFECipher:
+		schemes = []string{SchemeDMCFE, SchemeDecentralizedDMCFE}
+		if cipher.SensorIdx != sensorIdx || cipher.BatchIdx != batchIdx {
+			return fmt.Errorf("batch no %d of sensor no %d is submitted as batch no %d of sensor no %d",
+				cipher.BatchIdx, cipher.SensorIdx, batchIdx, sensorIdx)
+		}
+	}
+
+	if !slices.Contains(schemes, t.Scheme) {
+		return fmt.Errorf("the cipher isn't a cipher of scheme %s", t.Scheme)
+	}
+	if cipherIdx != idx {
+		return fmt.Errorf("cipher no %d is submitted as batch no %d of sensor no %d", cipherIdx, batchIdx, sensorIdx)
+	}
+	return nil
+}
+
+// AcceptCipher records that batch no batchIdx of the sensor has been received, with its encoded cipher and its
+// commitment; it returns an error if the batch is out of range, if it has already been received, or if the deadline
+// has passed. An accepted cipher must be passed to AddCipher.
+func (t *Task) AcceptCipher(sensorId UUID, batchIdx int, cipher []byte, commitment *BatchCommitment) error {
+	sensorIdx, err := t.getSensorIdx(sensorId)
+	if err != nil {
+		return err
+	}
+	if batchIdx < 0 || batchIdx >= t.BatchCnt {
+		return fmt.Errorf("batch no %d out of range (%d batches)", batchIdx, t.BatchCnt)
+	}
+
+	t.submissionsMutex.RLock()
+	defer t.submissionsMutex.RUnlock()
+	if t.submissionsClosed.Load() {
+		return errLateCipher
+	}
+	if !t.receivedBatches[sensorIdx][batchIdx].CompareAndSwap(false, true) {
+		return errDuplicateCipher
+	}
+	t.submittedCiphers[sensorIdx][batchIdx].Store(&submittedCipher{data: cipher, commitment: commitment})
+	t.addingCiphers.Add(1)
+
+	if late := t.clock.Now().Sub(t.End()); late > 0 {
+		t.logger.Info("batch no %d of sensor %s received %s after the end of the task", batchIdx, sensorId, late.Round(time.Second))
+	}
+	return nil
+}
+
+// watchDeadline closes the submissions at the deadline, unless the task is stopped first
+func (t *Task) watchDeadline() {
+	if stopped := t.sleep(t.Deadline().Sub(t.clock.Now())); stopped {
+		return
+	}
+	t.closeSubmissions()
+}
+
+// closeSubmissions stops accepting ciphers, marks the batches that haven't been received as missing, and computes
+// the result of the received ones
+func (t *Task) closeSubmissions() {
+	t.submissionsMutex.Lock()
+	t.submissionsClosed.Store(true)
+	t.submissionsMutex.Unlock()
+	t.notifyProgress()
+
+	missingBatches := make(map[UUID][]int)
+	missingCnt := 0
+	for sensorIdx, sensor := range t.Sensors {
+		for batchIdx := range t.receivedBatches[sensorIdx] {
+			if !t.receivedBatches[sensorIdx][batchIdx].Load() {
+				missingBatches[sensor.Id] = append(missingBatches[sensor.Id], batchIdx)
+				missingCnt++
+			}
+		}
+	}
+
+	if missingCnt > 0 {
+		t.logger.Warn("submissions closed, %d batches missing: %v", missingCnt, missingBatches)
+		t.markIncomplete(missingBatches, missingCnt)
+		t.finalisePartial()
+		return
+	}
+
+	// the result is computed once all the ciphers are added to the decryptor, unless some of them couldn't be,
+	// in which case their batches are missing too
+	t.logger.Info("submissions closed, all batches received")
+	t.missingBatchesMutex.Lock()
+	t.MissingBatches = missingBatches
+	t.missingBatchesMutex.Unlock()
+	if stopped := t.awaitAddedCiphers(); stopped || t.Result != nil {
+		return
+	}
+	t.logger.Warn("some of the received ciphers couldn't be added to the decryptor")
+	t.finalisePartial()
+}
+
+// markIncomplete records and publishes that missingCnt batches are missing
+func (t *Task) markIncomplete(missingBatches map[UUID][]int, missingCnt int) {
+	t.missingBatchesMutex.Lock()
+	t.MissingBatches = missingBatches
+	t.missingBatchesMutex.Unlock()
+
+	t.Status = "incomplete"
+	t.events.Publish(eventIncomplete, incompleteEvent{MissingBatches: missingBatches})
+	t.metrics.batchesMissing.Add(float64(missingCnt))
+}
+
+// awaitAddedCiphers waits until the accepted ciphers are added to the decryptor, which happens only after
+// the decryption params are fetched; it returns true if the task is stopped first
+func (t *Task) awaitAddedCiphers() (stopped bool) {
+	select {
+	case <-t.decryptionParamsFetchedChan:
+	case <-t.stopChan:
+		return true
+	}
+	t.addingCiphers.Wait()
+	return false
+}
+
+// GetMissingBatches returns the batches that haven't been received before the deadline, by sensor;
+// nil before the deadline
+func (t *Task) GetMissingBatches() map[UUID][]int {
+	t.missingBatchesMutex.Lock()
+	defer t.missingBatchesMutex.Unlock()
+	return t.MissingBatches
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	. "fe/common"
+	"testing"
+)
+
+func TestCheckCipher(t *testing.T) {
+	task := &Task{
+		Sensors:        []*Sensor{{Id: "sensor-0"}, {Id: "sensor-1"}},
+		SamplingParams: SamplingParams{BatchParams: BatchParams{BatchCnt: 3}},
+	}
+
+	tests := []struct {
+		name     string
+		scheme   string
+		sensorId UUID
+		batchIdx int
+		cipher   FECipher
+		valid    bool
+	}{
+		{"own slot", SchemeFHMultiIPE, "sensor-1", 2, &MultiFECipher{Idx: 5}, true},
+		{"another batch", SchemeFHMultiIPE, "sensor-1", 1, &MultiFECipher{Idx: 5}, false},
+		{"another sensor", SchemeDamgardMulti, "sensor-0", 2, &MultiInputCipher{Idx: 5}, false},
+		{"out of range", SchemeDummy, "sensor-1", 2, &DummyCipher{Idx: 6}, false},
+		{"dmcfe", SchemeDecentralizedDMCFE, "sensor-1", 0, &DMCFECipher{SensorIdx: 1, BatchIdx: 0}, true},
+		{"dmcfe of another sensor", SchemeDMCFE, "sensor-0", 0, &DMCFECipher{SensorIdx: 1, BatchIdx: 0}, false},
+		{"another scheme", SchemePaillierMulti, "sensor-0", 0, &MultiFECipher{Idx: 0}, false},
+		{"unknown sensor", SchemeFHMultiIPE, "sensor-2", 0, &MultiFECipher{Idx: 6}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task.Scheme = test.scheme
+			err := task.CheckCipher(test.sensorId, test.batchIdx, test.cipher)
+			if test.valid && err != nil {
+				t.Errorf("valid cipher rejected: %s", err)
+			} else if !test.valid && err == nil {
+				t.Error("invalid cipher accepted")
+			}
+		})
+	}
+}
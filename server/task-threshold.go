@@ -0,0 +1,56 @@
+package server
+
+import (
+	. "fe/common"
+)
+
+// In the threshold mode, the authority splits the master secret of a task among the share holders, and the server
+// combines the decryption key from the partial keys of at least Threshold of them, so the task can be decrypted
+// even if some share holders are down.
+
+// DeriveThresholdDecryptionKey generates the rates, and fetches partial keys for them from the share holders, until
+// Threshold of them are collected; the share holders that fail are skipped
+func (t *Task) DeriveThresholdDecryptionKey() bool {
+	rates, err := t.Tariff.GenerateRates(t.BatchCnt)
+	if err != nil {
+		t.logger.Err(err)
+		return false
+	}
+	t.Rates = rates
+	t.logger.Debug("generated rates: %v", rates)
+	attempt := t.ratesSubmittedCnt.Add(1)
+	t.events.Publish(eventRatesSent, ratesSentEvent{Attempt: int(attempt)})
+
+	partialKeys := make([]*ThresholdPartialKey, 0, t.Threshold)
+	for _, shareHolder := range t.ShareHolders {
+		if len(partialKeys) == t.Threshold {
+			break
+		}
+
+		t.logger.Info("fetching partial key from share holder %s", shareHolder.IP.String())
+		partialKey, err := shareHolder.FetchPartialKey(t.Id, rates)
+		if err != nil {
+			t.logger.Err(err)
+			t.logger.Warn("fetching partial key from share holder %s failed", shareHolder.IP.String())
+			continue
+		}
+		partialKeys = append(partialKeys, partialKey)
+	}
+
+	if len(partialKeys) < t.Threshold {
+		t.logger.Error("collected %d partial keys, %d needed", len(partialKeys), t.Threshold)
+		return false
+	}
+
+	decryptionParams, err := CombinePartialKeys(partialKeys)
+	if err != nil {
+		t.logger.Err(err)
+		return false
+	}
+
+	if !t.setFEDecryptor(decryptionParams) {
+		return false
+	}
+	t.logger.Info("decryption key combined from %d partial keys", len(partialKeys))
+	return true
+}
@@ -1,24 +1,78 @@
 package server
 
-// StartTaskWorker starts a taskWorker goroutine for provided Task
-func StartTaskWorker(task *Task) {
-	go taskWorker(task)
+import (
+	. "fe/common"
+)
+
+// StartTaskWorker starts a taskWorker as a Runnable goroutine for provided Task
+func StartTaskWorker(task *Task) *Runnable {
+	taskWorkerHandle := NewRunnable("task worker "+string(task.Id), task.clock, task.logger)
+	go taskWorker(taskWorkerHandle, task)
+	return taskWorkerHandle
 }
 
 // taskWorker submits Task to its sensors and derives the decryption key
-func taskWorker(task *Task) {
-
-	// Generating FE params
-	ok := task.GetFESchemaParams()
-	if !ok {
+func taskWorker(r *Runnable, task *Task) {
+	if exiting := r.Start(); exiting {
+		r.Close()
 		return
 	}
 
-	// in parallel:
-	// - derive functional encryption key
-	// - send task to the server(s)
+	go task.watchDeadline()
+	if task.ProgressWindow > 0 {
+		go task.trackProgress()
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		if !UsesAuthority(task.Scheme) {
+			// the sensors set up the keys themselves, so they must have the task first
+			if task.SubmitToSensors() && task.ExchangeDMCFEPubKeys() {
+				task.CollectDMCFEKeyShares()
+			}
+			if !task.decryptionParamsFetched.Load() {
+				task.fail("deriving the decryption key failed")
+			}
+			done <- true
+			return
+		}
 
-	go task.SubmitToSensors()
+		// Generating FE params
+		ok := task.GetFESchemaParams()
+		if !ok {
+			task.fail("fetching fe params failed")
+		} else {
+			// in parallel:
+			// - derive functional encryption key
+			// - send task to the server(s)
 
-	task.DeriveDecryptionKey()
+			go task.SubmitToSensors()
+
+			if task.Threshold > 0 {
+				task.DeriveThresholdDecryptionKey()
+			} else {
+				task.DeriveDecryptionKey()
+			}
+			if !task.decryptionParamsFetched.Load() {
+				task.fail("deriving the decryption key failed")
+			}
+		}
+		done <- true
+	}()
+
+	for {
+		select {
+		case <-done:
+			r.Done()
+
+		case <-r.ExitChan:
+			// if stopped, interrupt polling the authority and discard ciphers that wait for the decryption params;
+			// if done, the task keeps receiving ciphers
+			if r.GetState() != RunnableDone {
+				task.Stop()
+			}
+			r.Close()
+			return
+		}
+	}
 }
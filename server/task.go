@@ -2,11 +2,12 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	. "fe/common"
 	"fmt"
 	"math/big"
-	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -17,6 +18,10 @@ type Task struct {
 	Sensors   []*Sensor
 	Authority *Authority
 
+	// ShareHolders and Threshold are set only in the threshold mode (in SetScheme)
+	ShareHolders []*ShareHolder
+	Threshold    int
+
 	// creation parameters
 	CustomerId UUID
 	SamplingParams
@@ -24,13 +29,33 @@ type Task struct {
 	Tariff *Tariff
 	Rates  []int
 
+	// fixed-point encoded bounds of the rates
+	MinRateValue int
+	MaxRateValue int
+
 	DecryptionParamsId UUID
 
 	EncryptionEnabled bool
+	Scheme            string // resolved in SetScheme
 	feDecryptor       FEDecryptor
 
 	Result *big.Int
 
+	// late ciphers are accepted for GracePeriod after the end of the task, see task-submissions.go
+	GracePeriod         time.Duration
+	receivedBatches     [][]atomic.Bool // by sensor idx and batch idx
+	submissionsClosed   atomic.Bool
+	submissionsMutex    sync.RWMutex   // closing the submissions waits for the ciphers being accepted
+	addingCiphers       sync.WaitGroup // accepted ciphers that haven't been added to the feDecryptor yet
+	MissingBatches      map[UUID][]int // set when the submissions are closed
+	missingBatchesMutex sync.Mutex
+
+	// the running total is updated every ProgressWindow batches, see task-progress.go
+	ProgressWindow int
+	progress       []ProgressPoint
+	progressMutex  sync.Mutex
+	progressChan   chan bool // signals that a cipher has been added, or that the submissions are closed
+
 	// status flags
 	schemaParamsFetched     atomic.Bool
 	submittedToSensors      []atomic.Bool
@@ -40,20 +65,37 @@ type Task struct {
 	// total ciphers?
 
 	decryptionParamsFetchedChan chan bool // when the key is derived, this channel will be closed
+	stopChan                    chan bool // when the task worker is stopped, this channel will be closed
+	stopOnce                    sync.Once
+
+	events *EventLog // see task-events.go
 
-	logger *Logger
+	// the ciphers, with the sensors' commitments, and the keys the task is billed with, see bundle.go
+	submittedCiphers [][]atomic.Pointer[submittedCipher] // by sensor idx and batch idx
+	billingKey       atomic.Pointer[keyRecord]           // the key of all the ciphers
+	partialKey       atomic.Pointer[keyRecord]           // the key restricted to the received ciphers
+
+	config     *ServerConfig
+	clock      Clock
+	metrics    *serverMetrics
+	dlogTables *DlogTables
+	logger     *Logger
 }
 
 // NewTask creates a new Task from common.ServerTaskRequest
 func (server *Server) NewTask(taskRequest ServerTaskRequest) *Task {
 	id := NewUUID()
 	tariff, _ := GetTariff(taskRequest.TariffId)
+	minSampleValue, maxSampleValue, _ := tariff.SampleBounds() // the tariff is validated when it's added
+	minRateValue, maxRateValue, _ := tariff.RateBounds()
 	task := &Task{
 		Id:         id,
 		Status:     "created",
 		CustomerId: taskRequest.CustomerId,
 		Authority:  server.Authority,
 
+		ShareHolders: server.GetShareHolders(),
+
 		SamplingParams: SamplingParams{
 			Start:          taskRequest.Start,
 			SamplingPeriod: tariff.SamplingPeriod,
@@ -61,14 +103,31 @@ func (server *Server) NewTask(taskRequest ServerTaskRequest) *Task {
 				BatchSize: tariff.BatchSize,
 				BatchCnt:  taskRequest.Duration / (tariff.SamplingPeriod * tariff.BatchSize), // this is number of batches per sensor !!
 			},
-			MaxSampleValue: tariff.MaxSampleValue,
+			MinSampleValue: minSampleValue,
+			MaxSampleValue: maxSampleValue,
 		},
+		MinRateValue:      minRateValue,
+		MaxRateValue:      maxRateValue,
 		EncryptionEnabled: taskRequest.EnableEncryption,
+		Scheme:            taskRequest.Scheme,
+		GracePeriod:       time.Duration(server.config.CipherGracePeriod),
+		ProgressWindow:    taskRequest.ProgressWindow,
 
 		decryptionParamsFetchedChan: make(chan bool, 1),
+		stopChan:                    make(chan bool),
+		progressChan:                make(chan bool, 1),
+		events:                      NewEventLog(server.Clock),
 		Tariff:                      tariff,
-		logger:                      GetLoggerForFile("", string(id)),
+		config:                      server.config,
+		clock:                       server.Clock,
+		metrics:                     server.metrics,
+		dlogTables:                  server.dlogTables,
+		logger:                      GetLoggerForFile("", string(id)).WithField(TaskIdField, id),
+	}
+	if taskRequest.GracePeriod > 0 {
+		task.GracePeriod = time.Duration(taskRequest.GracePeriod) * time.Second
 	}
+
 	taskRequestJson, _ := json.MarshalIndent(taskRequest, "", "  ")
 	task.logger.Info("Task params: %s", string(taskRequestJson))
 	return task
@@ -98,6 +157,12 @@ func (t *Task) SetSensors(g *Customer) error {
 	sensorCnt := len(g.Sensors)
 	t.logger.Info("setting sensors for task %s", t.Id)
 	t.submittedToSensors = make([]atomic.Bool, sensorCnt)
+	t.receivedBatches = make([][]atomic.Bool, sensorCnt)
+	t.submittedCiphers = make([][]atomic.Pointer[submittedCipher], sensorCnt)
+	for idx := range t.receivedBatches {
+		t.receivedBatches[idx] = make([]atomic.Bool, t.BatchCnt)
+		t.submittedCiphers[idx] = make([]atomic.Pointer[submittedCipher], t.BatchCnt)
+	}
 	t.Sensors = make([]*Sensor, sensorCnt)
 	copy(t.Sensors, g.Sensors)
 
@@ -105,27 +170,112 @@ func (t *Task) SetSensors(g *Customer) error {
 	return nil
 }
 
+// SetScheme sets the default scheme if the Task doesn't specify one, and checks that the scheme can be used with
+// the Task's Sensors; it must be called after SetSensors
+func (t *Task) SetScheme() error {
+	scheme, threshold, err := resolveScheme(t.config, t.Scheme, t.EncryptionEnabled, len(t.Sensors), t.BatchCnt, len(t.ShareHolders))
+	if err != nil {
+		t.logger.Err(err)
+		return err
+	}
+
+	t.Scheme = scheme
+	t.Threshold = threshold
+	if threshold > 0 {
+		t.logger.Info("using %d of %d share holders", threshold, len(t.ShareHolders))
+	}
+	t.logger.Info("using scheme %s", t.Scheme)
+	return nil
+}
+
+// resolveScheme returns the scheme of a task, that is the default one if scheme is empty, and its threshold, that is
+// 0 unless the task uses the threshold mode; an error is returned if the scheme can't be used with the task
+func resolveScheme(config *ServerConfig, scheme string, encryptionEnabled bool, sensorCnt, batchCnt, shareHolderCnt int) (string, int, error) {
+	threshold := config.AuthorityThreshold
+	if scheme == "" {
+		if threshold > 0 && encryptionEnabled {
+			scheme = SchemeDamgardMulti
+		} else {
+			scheme = DefaultScheme(encryptionEnabled, sensorCnt, batchCnt)
+		}
+	}
+
+	if err := CheckScheme(scheme, encryptionEnabled, sensorCnt, batchCnt); err != nil {
+		return "", 0, err
+	}
+
+	// in the threshold mode, no single authority may hold the master secret
+	if threshold == 0 || !UsesAuthority(scheme) || scheme == SchemeDummy {
+		return scheme, 0, nil
+	}
+	if !SupportsThreshold(scheme) {
+		return "", 0, fmt.Errorf("scheme %s doesn't support the threshold mode", scheme)
+	}
+	if shareHolderCnt < threshold {
+		return "", 0, fmt.Errorf("threshold is %d, but only %d share holders are set", threshold, shareHolderCnt)
+	}
+	return scheme, threshold, nil
+}
+
+// CheckSensorClocks measures the clock offsets of the Task's Sensors; a sensor whose offset exceeds the tolerance
+// samples a different time window than the rates assume, so it is reported, and if RefuseClockOffset is set,
+// an error is returned. Sensors whose offset couldn't be measured are handled the same way.
+func (t *Task) CheckSensorClocks() error {
+	tolerance := time.Duration(t.config.ClockOffsetTolerance)
+	errs := make([]string, 0)
+
+	for _, sensor := range t.Sensors {
+		clockSync, err := sensor.MeasureClockOffset(t.clock, t.config.ClockSyncSamples)
+		if err != nil {
+			t.logger.Err(err)
+			errs = append(errs, fmt.Sprintf("clock offset of sensor %s couldn't be measured", sensor.Id))
+			continue
+		}
+
+		t.logger.Info("clock offset of sensor %s: %s (delay %s)", sensor.Id, clockSync.Offset, clockSync.Delay)
+		if clockSync.Offset > tolerance || clockSync.Offset < -tolerance {
+			t.logger.Warn("clock offset of sensor %s exceeds the tolerance of %s", sensor.Id, tolerance)
+			errs = append(errs, fmt.Sprintf("clock offset of sensor %s is %s, tolerance is %s", sensor.Id, clockSync.Offset, tolerance))
+		}
+	}
+
+	if len(errs) > 0 && t.config.RefuseClockOffset {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // SubmitToSensors sends the SensorTaskRequest to all Sensors in the Task's Customer (captured during SetSensors)
 func (t *Task) SubmitToSensors() bool {
+	var authorityIp IP
+	if UsesAuthority(t.Scheme) {
+		authorityIp = t.Authority.IP
+	}
+
 	// todo add parallel execution
 	for idx, sensor := range t.Sensors {
 		// assert that it isn't already sent
 
 		t.logger.Info("submitting task to sensor %s", sensor.Id)
 
-		statusCode, _, err := sensor.SubmitTask(t.Id, t.SamplingParams, t.Authority.IP)
-		if err != nil {
-			t.logger.Err(err)
-			t.logger.Error("submission to sensor %s failed", sensor.Id)
-			return false
+		var dmcfeParams *DMCFETaskParams
+		if !UsesAuthority(t.Scheme) {
+			dmcfeParams = &DMCFETaskParams{
+				SensorIdx:    idx,
+				SensorCnt:    len(t.Sensors),
+				MinRateValue: t.MinRateValue,
+				MaxRateValue: t.MaxRateValue,
+			}
 		}
 
-		if statusCode != http.StatusAccepted {
-			t.logger.Error("submission to sensor %s failed", sensor.Id)
+		if err := sensor.SubmitTask(t.Id, t.SamplingParams, authorityIp, t.Scheme, dmcfeParams); err != nil {
+			t.logger.Err(err)
+			t.fail(fmt.Sprintf("submission to sensor %s failed", sensor.Id))
 			return false
 		}
 
 		t.submittedToSensors[idx].Store(true)
+		t.events.Publish(eventSubmitted, sensorEvent{SensorId: sensor.Id})
 		t.logger.Info("task submitted to sensor %s", sensor.Id)
 		// todo check whether start time has already passed
 	}
@@ -138,26 +288,43 @@ func (t *Task) GetFESchemaParams() bool {
 		sensorIds[idx] = sensor.Id
 	}
 
+	var shareHolderIps []IP
+	if t.Threshold > 0 {
+		shareHolderIps = make([]IP, len(t.ShareHolders))
+		for idx, shareHolder := range t.ShareHolders {
+			shareHolderIps[idx] = shareHolder.IP
+		}
+	}
+
 	t.logger.Info("submitting task to authority")
-	err := t.Authority.SubmitTask(t.Id, sensorIds, t.BatchParams, t.Tariff.MaxTariffValue, t.MaxSampleValue, t.EncryptionEnabled)
+	err := t.Authority.SubmitTask(t.Id, sensorIds, t.BatchParams, t.MinRateValue, t.MaxRateValue, t.MinSampleValue, t.MaxSampleValue,
+		t.EncryptionEnabled, t.Scheme, shareHolderIps, t.Threshold, t.ProgressWindow)
 	if err != nil {
 		t.logger.Err(err)
 		return false
 	}
 
+	pollingInterval := time.Duration(t.config.SchemaParamsPollingInterval)
 	for {
-		time.Sleep(SchemaParamsPollingInterval)
+		if stopped := t.sleep(pollingInterval); stopped {
+			t.logger.Info("stopped while waiting for fe params")
+			return false
+		}
 		status, err := t.Authority.FetchSchemaParamsStatus(t.Id)
-		*status = strings.Replace(*status, "\"", "", -1)
-		switch *status {
+		if err != nil {
+			t.logger.Err(err)
+			return false
+		}
+		switch status {
 		case StatusCreated:
-			t.logger.Info("fe params not yet ready, polling again in %d ns", SchemaParamsPollingInterval.Nanoseconds())
+			t.logger.Info("fe params not yet ready, polling again in %d ns", pollingInterval.Nanoseconds())
 			continue
 		case StatusError, StatusInvalid:
-			t.logger.Err(err)
+			t.logger.Error("fe params status %s", status)
 			return false
 		case StatusReady:
 			t.schemaParamsFetched.Store(true)
+			t.events.Publish(eventSchemaReady, nil)
 			t.logger.Info("fe params ready")
 			return true
 		}
@@ -172,42 +339,79 @@ func (t *Task) DeriveDecryptionKey() {
 	}
 
 	for {
-		time.Sleep(DecryptionParamsPollingInterval)
+		decryptionParams, data, err := t.awaitDecryptionParams(decryptionParamsId)
+		switch err {
+		case nil:
+			t.recordKey(&t.billingKey, decryptionParamsId, data)
+			if t.setFEDecryptor(decryptionParams) {
+				t.logger.Info("fe decryption params fetched")
+			}
+			return
+		case errRatesInvalid:
+			t.logger.Info("rates invalid, regenerating")
+			if decryptionParamsId, ok = t.SendRates(); !ok {
+				return
+			}
+		case errTaskStopped:
+			t.logger.Info("stopped while waiting for fe decryption params")
+			return
+		default:
+			t.logger.Err(err)
+			return
+		}
+	}
+}
+
+var (
+	errRatesInvalid = errors.New("rates invalid")
+	errTaskStopped  = errors.New("task stopped")
+)
+
+// awaitDecryptionParams polls the authority until the decryption params with decryptionParamsId are derived,
+// and fetches them, with their encoding
+func (t *Task) awaitDecryptionParams(decryptionParamsId UUID) (FEDecryptionParams, []byte, error) {
+	pollingInterval := time.Duration(t.config.DecryptionParamsPollingInterval)
+	for {
+		if stopped := t.sleep(pollingInterval); stopped {
+			return nil, nil, errTaskStopped
+		}
 		status, err := t.Authority.FetchDecryptionParamsStatus(t.Id, decryptionParamsId)
-		*status = strings.Replace(*status, "\"", "", -1)
-		switch *status {
+		if err != nil {
+			return nil, nil, err
+		}
+		switch status {
 		case StatusCreated:
-			t.logger.Info("fe decryption params not yet ready, polling again in %d ns", DecryptionParamsPollingInterval.Nanoseconds())
+			t.logger.Info("fe decryption params not yet ready, polling again in %d ns", pollingInterval.Nanoseconds())
 			continue
 		case StatusError:
-			t.logger.Err(err)
-			return
+			return nil, nil, fmt.Errorf("deriving fe decryption params failed")
+		case StatusInvalid:
+			return nil, nil, errRatesInvalid
 		case StatusReady:
 			t.logger.Info("fe decryption params ready")
 			t.logger.Info("fetching fe decryption params")
-			decryptionParams, err := t.Authority.FetchDecryptionParams(t.Id, decryptionParamsId)
-			if err != nil {
-				t.logger.Err(err)
-				return
-			}
-
-			t.feDecryptor, err = NewFEDecryptor(decryptionParams, t.logger)
-			if err != nil {
-				t.logger.Err(err)
-				return
-			}
-
-			t.decryptionParamsFetched.Store(true)
-			close(t.decryptionParamsFetchedChan)
-			t.logger.Info("fe decryption params fetched")
-			return
-		case StatusInvalid:
-			t.logger.Info("rates invalid, regenerating")
-			decryptionParamsId, ok = t.SendRates()
+			return t.Authority.FetchDecryptionParams(t.Id, decryptionParamsId)
+		default:
+			return nil, nil, fmt.Errorf("unknown fe decryption params status %s", status)
 		}
 	}
 }
 
+// setFEDecryptor creates the FEDecryptor from the decryption params, and lets the waiting ciphers through
+func (t *Task) setFEDecryptor(decryptionParams FEDecryptionParams) bool {
+	feDecryptor, err := NewFEDecryptor(decryptionParams, t.dlogTables, t.metrics, t.logger)
+	if err != nil {
+		t.logger.Err(err)
+		return false
+	}
+
+	t.feDecryptor = feDecryptor
+	t.decryptionParamsFetched.Store(true)
+	close(t.decryptionParamsFetchedChan)
+	t.events.Publish(eventKeyReady, nil)
+	return true
+}
+
 func (t *Task) SendRates() (UUID, bool) {
 	rates, err := t.Tariff.GenerateRates(t.BatchCnt)
 	if err != nil {
@@ -215,6 +419,7 @@ func (t *Task) SendRates() (UUID, bool) {
 		return "", false
 	}
 
+	t.Rates = rates
 	t.logger.Debug("generated rates: %v", rates)
 	t.logger.Info("sending rates")
 	decryptionParamsId, err := t.Authority.SendRates(t.Id, rates)
@@ -223,16 +428,44 @@ func (t *Task) SendRates() (UUID, bool) {
 		t.logger.Error("sending rates failed")
 		return "", false
 	}
-	// todo handle error
 
 	t.logger.Info("rates sent successfully")
-	t.ratesSubmittedCnt.Add(1)
+	attempt := t.ratesSubmittedCnt.Add(1)
+	t.events.Publish(eventRatesSent, ratesSentEvent{Attempt: int(attempt)})
 	return decryptionParamsId, true
 }
 
-// potentially blocking method, should be done in goroutine
-func (t *Task) AddCipher(feCipher FECipher) {
-	_, opened := <-t.decryptionParamsFetchedChan
+// Stop interrupts polling the authority and adding ciphers that wait for the decryption params.
+func (t *Task) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopChan)
+		t.events.Close()
+	})
+}
+
+// sleep waits for d to pass, and returns true if the Task has been stopped in the meantime
+func (t *Task) sleep(d time.Duration) (stopped bool) {
+	select {
+	case <-t.clock.After(d):
+		return false
+	case <-t.stopChan:
+		return true
+	}
+}
+
+// potentially blocking method, should be done in goroutine; the cipher of batch no batchIdx of the sensor must have
+// been accepted by AcceptCipher
+func (t *Task) AddCipher(sensorId UUID, batchIdx int, feCipher FECipher) {
+	defer t.addingCiphers.Done()
+
+	var opened bool
+	select {
+	case _, opened = <-t.decryptionParamsFetchedChan:
+	case <-t.stopChan:
+		t.logger.Info("task stopped, cipher discarded")
+		t.metrics.ciphersRejected.Inc(rejectedTaskStopped)
+		return
+	}
 
 	if opened {
 		t.logger.Err(fmt.Errorf("key derived channel nas NOT closed"))
@@ -240,13 +473,19 @@ func (t *Task) AddCipher(feCipher FECipher) {
 	}
 
 	t.logger.Info("adding cipher")
+	start := time.Now()
 	result, err := t.feDecryptor.AddCipher(feCipher)
+	t.publishCipher(sensorId, batchIdx, time.Since(start), err)
 	if err != nil {
 		t.logger.Err(err)
+		t.metrics.ciphersRejected.Inc(rejectedDecryption)
 	}
 
 	if result != nil {
 		t.Result = result
 		t.logger.Debug("result: %d", result)
+		t.publishResult(result, false)
+	} else if err == nil {
+		t.notifyProgress()
 	}
 }
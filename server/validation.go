@@ -0,0 +1,156 @@
+package server
+
+import (
+	. "fe/common"
+	"fmt"
+	"math/big"
+)
+
+// TaskValidation is the outcome of validating a ServerTaskRequest; the task is created only if there are no Errors,
+// while Warnings are only reported. The limits are set only if the request is valid enough to compute them.
+type TaskValidation struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+
+	Scheme    string `json:"scheme,omitempty"`
+	Threshold int    `json:"threshold,omitempty"`
+	SensorCnt int    `json:"sensor_cnt,omitempty"`
+	BatchCnt  int    `json:"batch_cnt,omitempty"`
+
+	// ResultBound is the bound of the absolute value of the fixed-point encoded result
+	ResultBound *big.Int        `json:"result_bound,omitempty"`
+	Decryption  *DecryptionCost `json:"decryption,omitempty"`
+}
+
+func (v *TaskValidation) addError(format string, args ...any) {
+	v.Errors = append(v.Errors, fmt.Sprintf(format, args...))
+}
+
+func (v *TaskValidation) addWarning(format string, args ...any) {
+	v.Warnings = append(v.Warnings, fmt.Sprintf(format, args...))
+}
+
+// ValidateTaskRequest checks everything that can be checked before a task is created, and collects all violations,
+// instead of stopping at the first one
+func (server *Server) ValidateTaskRequest(taskRequest ServerTaskRequest) *TaskValidation {
+	v := &TaskValidation{
+		Errors:   make([]string, 0),
+		Warnings: make([]string, 0),
+	}
+	defer func() {
+		v.Valid = len(v.Errors) == 0
+	}()
+
+	//region request
+
+	tariff, tariffExists := GetTariff(taskRequest.TariffId)
+	if !tariffExists {
+		v.addError("tariff with id %s does not exist", taskRequest.TariffId)
+	} else {
+		batchDuration := tariff.SamplingPeriod * tariff.BatchSize
+		if taskRequest.Duration <= 0 || taskRequest.Duration%batchDuration != 0 {
+			v.addError("subscription duration must be a positive multiple of the time needed to generate one batch (%d)", batchDuration)
+		} else {
+			v.BatchCnt = taskRequest.Duration / batchDuration
+		}
+	}
+
+	if taskRequest.GracePeriod < 0 {
+		v.addError("grace period can't be negative")
+	}
+
+	if now := server.Clock.Now().Unix(); int64(taskRequest.Start) <= now {
+		v.addError("start %d is not in the future (server time is %d)", taskRequest.Start, now)
+	}
+
+	customer, err := server.GetCustomer(taskRequest.CustomerId)
+	if err != nil {
+		v.addError("%s", err.Error())
+	} else {
+		customer.mutex.RLock()
+		v.SensorCnt = len(customer.Sensors)
+		customer.mutex.RUnlock()
+		if v.SensorCnt == 0 {
+			v.addError("no sensors in customer %s; tasks can be created for customers with at least one sensor", customer.Uuid)
+		}
+	}
+
+	//endregion
+
+	// the scheme and the limits depend on the sensor and batch counts
+	if !tariffExists || v.BatchCnt == 0 || v.SensorCnt == 0 {
+		return v
+	}
+
+	//region scheme
+
+	scheme, threshold, err := resolveScheme(server.config, taskRequest.Scheme, taskRequest.EnableEncryption, v.SensorCnt, v.BatchCnt, len(server.GetShareHolders()))
+	if err != nil {
+		v.addError("%s", err.Error())
+		return v
+	}
+	v.Scheme = scheme
+	v.Threshold = threshold
+
+	if UsesAuthority(scheme) && !server.IsAuthoritySet() {
+		v.addError("authority must be set before task creation")
+	}
+
+	if taskRequest.ProgressWindow < 0 {
+		v.addError("progress window can't be negative")
+	} else if taskRequest.ProgressWindow > 0 {
+		if !SupportsProgress(scheme) {
+			v.addError("scheme %s doesn't support running totals", scheme)
+		}
+		if taskRequest.ProgressWindow >= v.BatchCnt {
+			v.addError("progress window must be shorter than the task (%d batches)", v.BatchCnt)
+		}
+	}
+
+	//endregion
+
+	//region limits
+
+	// the tariff is validated when it's added
+	minSampleValue, maxSampleValue, _ := tariff.SampleBounds()
+	minRateValue, maxRateValue, _ := tariff.RateBounds()
+	sampleBound := ValueBound(minSampleValue, maxSampleValue)
+	rateBound := ValueBound(minRateValue, maxRateValue)
+
+	v.ResultBound = ResultBound(v.SensorCnt, v.BatchCnt, tariff.BatchSize, sampleBound, rateBound)
+	if !v.ResultBound.IsInt64() {
+		v.addError("result bound %s doesn't fit in int64; reduce the duration, the batch size or the tariff's bounds", v.ResultBound)
+	}
+
+	if !taskRequest.EnableEncryption {
+		return v
+	}
+
+	cost := EstimateDecryptionCost(scheme, v.SensorCnt, v.BatchCnt, tariff.BatchSize, sampleBound, rateBound)
+	v.Decryption = &cost
+	if cost.Searches == 0 {
+		return v
+	}
+
+	if cost.Steps.Cmp(big.NewInt(int64(server.config.MaxDecryptionSteps))) > 0 {
+		v.addError("decryption with scheme %s needs up to %s discrete logarithm steps per search, at most %d are allowed; reduce the duration, the batch size or the tariff's bounds",
+			scheme, cost.Steps, server.config.MaxDecryptionSteps)
+	} else if cost.Steps.Cmp(big.NewInt(int64(server.config.WarnDecryptionSteps))) > 0 {
+		v.addWarning("decryption with scheme %s needs up to %s discrete logarithm steps per search (%d searches), it may be slow",
+			scheme, cost.Steps, cost.Searches)
+	}
+
+	//endregion
+
+	return v
+}
+
+// errors returns the Errors as a slice of errors, as accepted by ErrorResponse
+func (v *TaskValidation) errors() []error {
+	errs := make([]error, len(v.Errors))
+	for idx, err := range v.Errors {
+		errs[idx] = fmt.Errorf("%s", err)
+	}
+	return errs
+}
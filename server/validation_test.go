@@ -0,0 +1,175 @@
+package server
+
+import (
+	. "fe/common"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer returns a Server with a simulated clock, whose logs are written to a temp dir
+func newTestServer(t *testing.T) (*Server, *SimulatedClock) {
+	t.Helper()
+
+	config := DefaultServerConfig()
+	config.LogDir = t.TempDir()
+	clock := NewSimulatedClock(time.Unix(1_700_000_000, 0))
+	server, err := InitServer(config, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, clock
+}
+
+// addTestTariff saves a tariff whose samples are bounded by 100 and rates by 75, once fixed-point encoded
+func addTestTariff(modify func(tariff *Tariff)) *Tariff {
+	tariff := NewTariff()
+	tariff.SamplingPeriod = 60
+	tariff.BatchSize = 4
+	tariff.MinSampleValue = -1.5
+	tariff.MaxSampleValue = 10
+	tariff.MinTariffValue = -0.25
+	tariff.MaxTariffValue = 0.75
+	tariff.SampleScale = 1
+	tariff.RateScale = 2
+	modify(tariff)
+	SaveTariff(tariff)
+	return tariff
+}
+
+// addTestCustomer adds a customer with sensorCnt sensors
+func addTestCustomer(server *Server, sensorCnt int) *Customer {
+	customer := server.AddCustomer()
+	for i := 0; i < sensorCnt; i++ {
+		customer.AddSensor(server.NewSensor(NewUUID(), IP{}, ""))
+	}
+	return customer
+}
+
+func TestValidateTaskRequest(t *testing.T) {
+	server, clock := newTestServer(t)
+	server.Authority = server.NewAuthority(IP{})
+	tariff := addTestTariff(func(tariff *Tariff) {})
+	customer := addTestCustomer(server, 2)
+	emptyCustomer := addTestCustomer(server, 0)
+
+	// 3 batches of 2 sensors
+	valid := ServerTaskRequest{
+		CustomerId:       customer.Uuid,
+		Start:            int(clock.Now().Unix()) + 60,
+		Duration:         3 * 4 * 60,
+		TariffId:         tariff.id,
+		EnableEncryption: true,
+	}
+
+	tests := []struct {
+		name   string
+		modify func(request *ServerTaskRequest)
+		valid  bool
+	}{
+		{"valid", func(request *ServerTaskRequest) {}, true},
+		{"unencrypted", func(request *ServerTaskRequest) { request.EnableEncryption = false }, true},
+		{"progress", func(request *ServerTaskRequest) { request.ProgressWindow = 2 }, true},
+		{"unknown tariff", func(request *ServerTaskRequest) { request.TariffId = NewUUID() }, false},
+		{"no duration", func(request *ServerTaskRequest) { request.Duration = 0 }, false},
+		{"partial batch", func(request *ServerTaskRequest) { request.Duration = 3*4*60 + 60 }, false},
+		{"negative grace period", func(request *ServerTaskRequest) { request.GracePeriod = -1 }, false},
+		{"start in the past", func(request *ServerTaskRequest) { request.Start = int(clock.Now().Unix()) }, false},
+		{"unknown customer", func(request *ServerTaskRequest) { request.CustomerId = NewUUID() }, false},
+		{"customer without sensors", func(request *ServerTaskRequest) { request.CustomerId = emptyCustomer.Uuid }, false},
+		{"unknown scheme", func(request *ServerTaskRequest) { request.Scheme = "rsa" }, false},
+		{"single-input scheme", func(request *ServerTaskRequest) { request.Scheme = SchemeFHIPE }, false},
+		{"negative progress window", func(request *ServerTaskRequest) { request.ProgressWindow = -1 }, false},
+		{"progress window of the task", func(request *ServerTaskRequest) { request.ProgressWindow = 3 }, false},
+		{"progress without support", func(request *ServerTaskRequest) {
+			request.Scheme = SchemeDMCFE
+			request.ProgressWindow = 1
+		}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := valid
+			test.modify(&request)
+			v := server.ValidateTaskRequest(request)
+			if v.Valid != (len(v.Errors) == 0) {
+				t.Errorf("valid is %t, with errors %v", v.Valid, v.Errors)
+			}
+			if test.valid && !v.Valid {
+				t.Errorf("valid task rejected: %s", strings.Join(v.Errors, "; "))
+			} else if !test.valid && v.Valid {
+				t.Error("invalid task accepted")
+			}
+		})
+	}
+
+	t.Run("all violations", func(t *testing.T) {
+		request := valid
+		request.Duration = 0
+		request.GracePeriod = -1
+		request.CustomerId = emptyCustomer.Uuid
+		if v := server.ValidateTaskRequest(request); len(v.Errors) != 3 {
+			t.Errorf("errors %v, expected the ones of the duration, the grace period and the customer", v.Errors)
+		}
+	})
+
+	t.Run("limits", func(t *testing.T) {
+		v := server.ValidateTaskRequest(valid)
+		if v.Scheme != SchemeFHMultiIPE || v.SensorCnt != 2 || v.BatchCnt != 3 {
+			t.Errorf("scheme %s, %d sensors, %d batches", v.Scheme, v.SensorCnt, v.BatchCnt)
+		}
+		// 2 sensors * 3 batches * 4 samples * 100 * 75
+		if v.ResultBound.Cmp(big.NewInt(180000)) != 0 {
+			t.Errorf("result bound %s, expected 180000", v.ResultBound)
+		}
+		if v.Decryption == nil || v.Decryption.Searches != 1 || v.Decryption.Steps.Cmp(big.NewInt(850)) != 0 {
+			t.Errorf("decryption cost %+v, expected a search of 850 steps", v.Decryption)
+		}
+	})
+
+	t.Run("authority not set", func(t *testing.T) {
+		noAuthority, _ := newTestServer(t)
+		request := valid
+		request.CustomerId = addTestCustomer(noAuthority, 2).Uuid
+		if v := noAuthority.ValidateTaskRequest(request); v.Valid {
+			t.Error("task accepted without an authority")
+		}
+		request.Scheme = SchemeDecentralizedDMCFE
+		if v := noAuthority.ValidateTaskRequest(request); !v.Valid {
+			t.Errorf("decentralized task rejected without an authority: %s", strings.Join(v.Errors, "; "))
+		}
+	})
+
+	t.Run("result overflow", func(t *testing.T) {
+		large := addTestTariff(func(tariff *Tariff) {
+			tariff.MaxSampleValue = 1e14
+			tariff.MaxTariffValue = 1e6
+		})
+		request := valid
+		request.TariffId = large.id
+		request.EnableEncryption = false
+		v := server.ValidateTaskRequest(request)
+		if v.Valid || !strings.Contains(strings.Join(v.Errors, "; "), "int64") {
+			t.Errorf("errors %v, expected the result bound not to fit in int64", v.Errors)
+		}
+	})
+
+	t.Run("decryption cost", func(t *testing.T) {
+		limited, _ := newTestServer(t)
+		limited.Authority = limited.NewAuthority(IP{})
+		request := valid
+		request.CustomerId = addTestCustomer(limited, 2).Uuid
+
+		limited.config.WarnDecryptionSteps = 800
+		v := limited.ValidateTaskRequest(request)
+		if !v.Valid || len(v.Warnings) != 1 {
+			t.Errorf("errors %v and warnings %v, expected a warning about the decryption steps", v.Errors, v.Warnings)
+		}
+
+		limited.config.MaxDecryptionSteps = 800
+		if v = limited.ValidateTaskRequest(request); v.Valid {
+			t.Error("task accepted above the max decryption steps")
+		}
+	})
+}
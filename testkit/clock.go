@@ -0,0 +1,16 @@
+package testkit
+
+import (
+	. "fe/common"
+	"time"
+)
+
+// offsetClock is a Clock that is ahead of another Clock by offset; timers and tickers are unaffected
+type offsetClock struct {
+	Clock
+	offset time.Duration
+}
+
+func (c offsetClock) Now() time.Time {
+	return c.Clock.Now().Add(c.offset)
+}
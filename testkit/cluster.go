@@ -0,0 +1,424 @@
+package testkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fe/authority"
+	"fe/client"
+	. "fe/common"
+	"fe/sensor"
+	"fe/server"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Options configures a Cluster; zero values are replaced with defaults.
+type Options struct {
+	SensorCnt int
+
+	// Clock is the clock of all the hosts; nil uses RealClock
+	Clock *SimulatedClock
+
+	// SensorClockOffsets are the offsets of the sensors' clocks from the server's clock, by sensor index;
+	// missing offsets are 0
+	SensorClockOffsets    []time.Duration
+	CompensateClockOffset bool // see SensorConfig.CompensateClockOffset
+	RefuseClockOffset     bool // see ServerConfig.RefuseClockOffset
+
+	// NoAuthority starts the cluster without the authority, for tasks whose scheme doesn't use it
+	NoAuthority bool
+
+	// Unauthenticated starts the hosts without API keys, so that their endpoints are unauthenticated
+	Unauthenticated bool
+
+	// ShareHolderCnt authorities are started as share holders of the threshold mode, with the given Threshold;
+	// the threshold mode is disabled if Threshold is 0
+	ShareHolderCnt int
+	Threshold      int
+
+	// EncryptionWorkers and MaxQueuedBatches configure the encryption pools of the sensors, see SensorConfig;
+	// 0 uses the defaults
+	EncryptionWorkers int
+	MaxQueuedBatches  int
+
+	// DlogTableDir is the directory the server caches the discrete logarithm tables in; if empty, they are cached
+	// only in memory, so they aren't shared between Clusters
+	DlogTableDir string
+
+	// PollingInterval is the interval between polling for params, and between the retries of the outboxes
+	PollingInterval time.Duration
+
+	LogDir   string // a new temporary directory, if empty
+	LogLevel string
+}
+
+// Cluster is a server, an authority and sensors, running in this process on httptest servers. The authority is set
+// on the server (unless Options.NoAuthority is set), as are the share holders, and all the sensors are added
+// to a single customer.
+//
+// As the log files are shared by the whole process, Clusters must not run in parallel.
+type Cluster struct {
+	Server    *server.Server
+	Authority *authority.Authority
+	Sensors   []*sensor.Sensor
+
+	ShareHolders []*authority.Authority
+
+	ServerClient       *client.Server
+	AuthorityClient    *client.Authority
+	SensorClients      []*client.Sensor
+	ShareHolderClients []*client.Authority
+
+	CustomerId  UUID
+	AuditTokens []string // the customer's audit tokens, issued by the Sensors
+
+	// OperatorKey is the API key of all the clients of the Cluster, and CustomerKey the one issued to the customer;
+	// both are empty if the hosts are unauthenticated
+	OperatorKey string
+	CustomerKey string
+	Clock       *SimulatedClock
+
+	options                Options
+	clock                  Clock // Clock, or RealClock if there's none
+	httpServers            []*httptest.Server
+	hosts                  []*HttpServer // served by httpServers
+	shareHolderHttpServers []*httptest.Server
+	shutdownStarted        bool
+}
+
+// StartCluster starts and connects all the hosts; if it fails, everything that was started is shut down.
+func StartCluster(options Options) (*Cluster, error) {
+	if options.SensorCnt == 0 {
+		options.SensorCnt = 1
+	}
+	if options.PollingInterval == 0 {
+		options.PollingInterval = time.Second
+	}
+	if options.LogLevel == "" {
+		options.LogLevel = "info"
+	}
+	if options.LogDir == "" {
+		logDir, err := os.MkdirTemp("", "fe-testkit-")
+		if err != nil {
+			return nil, err
+		}
+		options.LogDir = logDir
+	}
+
+	GobInit()
+	gin.SetMode(gin.ReleaseMode)
+	gin.DefaultWriter = io.Discard
+
+	c := &Cluster{
+		Sensors:       make([]*sensor.Sensor, options.SensorCnt),
+		SensorClients: make([]*client.Sensor, options.SensorCnt),
+		AuditTokens:   make([]string, options.SensorCnt),
+
+		ShareHolders:       make([]*authority.Authority, options.ShareHolderCnt),
+		ShareHolderClients: make([]*client.Authority, options.ShareHolderCnt),
+		Clock:              options.Clock,
+		options:            options,
+		clock:              RealClock{},
+		httpServers:        make([]*httptest.Server, 0),
+	}
+	if c.Clock != nil {
+		c.clock = c.Clock
+	}
+
+	if err := c.start(); err != nil {
+		c.Shutdown()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cluster) start() error {
+	var err error
+
+	//region hosts
+
+	serverConfig := DefaultServerConfig()
+	serverConfig.HostConfig = c.hostConfig("server")
+	serverConfig.SchemaParamsPollingInterval = Duration(c.options.PollingInterval)
+	serverConfig.DecryptionParamsPollingInterval = Duration(c.options.PollingInterval)
+	serverConfig.RefuseClockOffset = c.options.RefuseClockOffset
+	serverConfig.AuthorityThreshold = c.options.Threshold
+	serverConfig.DlogTableDir = c.options.DlogTableDir
+	var apiKeysFile, serverCredentialFile, authorityCredentialFile string
+	if !c.options.Unauthenticated {
+		files, err := c.writeAPIKeys()
+		for _, file := range files {
+			defer os.Remove(file)
+		}
+		if err != nil {
+			return err
+		}
+		apiKeysFile, serverCredentialFile, authorityCredentialFile = files[0], files[1], files[2]
+	}
+	serverConfig.APIKeysFile = apiKeysFile
+	serverConfig.AuthorityCredentialFile = serverCredentialFile
+	if c.Server, err = server.InitServer(serverConfig, c.clock); err != nil {
+		return err
+	}
+	c.Server.StartTaskDaemon(server.StartTaskWorker)
+	remote, err := c.serve(c.Server.HttpServer)
+	if err != nil {
+		return err
+	}
+	remote.Credential = c.OperatorKey
+	c.ServerClient = client.NewServer(remote)
+
+	if !c.options.NoAuthority {
+		authorityConfig := DefaultAuthorityConfig()
+		authorityConfig.HostConfig = c.hostConfig("authority")
+		authorityConfig.APIKeysFile = apiKeysFile
+		authorityConfig.ShareHolderCredentialFile = authorityCredentialFile
+		if c.Authority, err = authority.InitAuthority(authorityConfig, c.clock); err != nil {
+			return err
+		}
+		c.Authority.StartTaskDaemon(authority.StartTaskWorker)
+		if remote, err = c.serve(c.Authority.HttpServer); err != nil {
+			return err
+		}
+		remote.Credential = c.OperatorKey
+		c.AuthorityClient = client.NewAuthority(remote)
+	}
+
+	for idx := range c.ShareHolders {
+		shareHolderConfig := DefaultAuthorityConfig()
+		shareHolderConfig.HostConfig = c.hostConfig("share-holder-" + strconv.Itoa(idx))
+		shareHolderConfig.APIKeysFile = apiKeysFile
+		if c.ShareHolders[idx], err = authority.InitAuthority(shareHolderConfig, c.clock); err != nil {
+			return err
+		}
+		c.ShareHolders[idx].StartTaskDaemon(authority.StartTaskWorker)
+		if remote, err = c.serve(c.ShareHolders[idx].HttpServer); err != nil {
+			return err
+		}
+		remote.Credential = c.OperatorKey
+		c.ShareHolderClients[idx] = client.NewAuthority(remote)
+		c.shareHolderHttpServers = append(c.shareHolderHttpServers, c.httpServers[len(c.httpServers)-1])
+	}
+
+	for idx := range c.Sensors {
+		sensorConfig := DefaultSensorConfig()
+		sensorConfig.HostConfig = c.hostConfig("sensor-" + strconv.Itoa(idx))
+		sensorConfig.APIKeysFile = apiKeysFile
+		sensorConfig.EncryptionParamsPollingInterval = Duration(c.options.PollingInterval)
+		sensorConfig.CompensateClockOffset = c.options.CompensateClockOffset
+		// the sensors of a cluster are short-lived, so their outboxes are kept only in memory
+		sensorConfig.OutboxDir = ""
+		sensorConfig.OutboxRetryInterval = Duration(c.options.PollingInterval)
+		if c.options.EncryptionWorkers > 0 {
+			sensorConfig.EncryptionWorkers = c.options.EncryptionWorkers
+		}
+		if c.options.MaxQueuedBatches > 0 {
+			sensorConfig.MaxQueuedBatches = c.options.MaxQueuedBatches
+		}
+
+		sensorClock := c.clock
+		if idx < len(c.options.SensorClockOffsets) {
+			sensorClock = offsetClock{Clock: c.clock, offset: c.options.SensorClockOffsets[idx]}
+		}
+		if c.Sensors[idx], err = sensor.InitSensor(sensorConfig, sensorClock); err != nil {
+			return err
+		}
+		c.Sensors[idx].StartTaskDaemon(sensor.StartTaskWorker)
+		if remote, err = c.serve(c.Sensors[idx].HttpServer); err != nil {
+			return err
+		}
+		remote.Credential = c.OperatorKey
+		c.SensorClients[idx] = client.NewSensor(remote)
+	}
+
+	//endregion
+
+	//region setup
+
+	if c.AuthorityClient != nil {
+		if err = c.ServerClient.SetAuthority(c.AuthorityClient.IP); err != nil {
+			return fmt.Errorf("setting authority failed: %s", err)
+		}
+	}
+
+	for idx, shareHolderClient := range c.ShareHolderClients {
+		if err = c.ServerClient.AddShareHolder(shareHolderClient.IP); err != nil {
+			return fmt.Errorf("setting share holder no %d failed: %s", idx, err)
+		}
+	}
+
+	customer, err := c.ServerClient.CreateCustomer()
+	if err != nil {
+		return fmt.Errorf("creating customer failed: %s", err)
+	}
+	c.CustomerId = customer.Id
+	c.CustomerKey = customer.APIKey
+
+	for idx, sensorClient := range c.SensorClients {
+		if err = sensorClient.SetServer(c.ServerClient.IP); err != nil {
+			return fmt.Errorf("setting server to sensor no %d failed: %s", idx, err)
+		}
+		sensorCustomer, err := sensorClient.SetCustomer(customer.Id)
+		if err != nil {
+			return fmt.Errorf("setting customer to sensor no %d failed: %s", idx, err)
+		}
+		c.AuditTokens[idx] = sensorCustomer.AuditToken
+
+		// the operator adds the sensor, as the sensor has no credential to register itself with
+		sensorKey, err := c.ServerClient.AddSensor(customer.Id, RegisterSensorRequest{
+			SensorId:  c.Sensors[idx].Id,
+			IP:        sensorClient.IP,
+			PublicKey: c.Sensors[idx].Signer.PublicKey(),
+		})
+		if err != nil {
+			return fmt.Errorf("adding sensor no %d failed: %s", idx, err)
+		}
+		if sensorKey != "" {
+			if err = sensorClient.SetServerCredential(sensorKey); err != nil {
+				return fmt.Errorf("setting server credential to sensor no %d failed: %s", idx, err)
+			}
+			// the sensor authenticates to the authority with the same key, as if the operator had listed it there
+			if c.Authority != nil {
+				c.Authority.Authenticator.AddAPIKey(sensorKey, Principal{Role: RoleSensor, Subject: c.Sensors[idx].Id})
+			}
+		}
+	}
+
+	//endregion
+
+	return nil
+}
+
+// serve starts an httptest.Server for httpServer, and returns the client for it
+func (c *Cluster) serve(httpServer *HttpServer) (*RemoteHttpServer, error) {
+	testServer := httptest.NewUnstartedServer(nil)
+	c.httpServers = append(c.httpServers, testServer)
+	c.hosts = append(c.hosts, httpServer)
+
+	address := testServer.Listener.Addr().(*net.TCPAddr)
+	ip := IP{
+		Scheme: "http",
+		IPv4:   address.IP,
+		Port:   strconv.Itoa(address.Port),
+	}
+
+	handler, err := httpServer.Handler(ip)
+	if err != nil {
+		return nil, err
+	}
+	testServer.Config.Handler = handler
+	testServer.Start()
+
+	return &RemoteHttpServer{IP: ip, Logger: GetDiscardLogger()}, nil
+}
+
+// Shutdown stops all the hosts; as log files are shared by the whole process,
+// logs written after the first host is shut down are discarded
+func (c *Cluster) Shutdown() {
+	if c.shutdownStarted {
+		return
+	}
+	c.shutdownStarted = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the event streams are ended first, as closing a test server waits for the requests being served
+	for _, host := range c.hosts {
+		_ = host.StopHttpServer(ctx)
+	}
+	for _, testServer := range c.httpServers {
+		testServer.Close()
+	}
+
+	for _, s := range c.Sensors {
+		if s != nil {
+			s.Shutdown(ctx)
+		}
+	}
+	if c.Server != nil {
+		c.Server.Shutdown(ctx)
+	}
+	if c.Authority != nil {
+		c.Authority.Shutdown(ctx)
+	}
+	for _, shareHolder := range c.ShareHolders {
+		if shareHolder != nil {
+			shareHolder.Shutdown(ctx)
+		}
+	}
+}
+
+// StopShareHolder closes the http server of the share holder, so it can't be reached anymore
+func (c *Cluster) StopShareHolder(idx int) {
+	c.shareHolderHttpServers[idx].Close()
+}
+
+// writeAPIKeys generates OperatorKey, and the keys the server and the authority authenticate to the other hosts with,
+// and writes them to a new API keys file, see AuthConfig.APIKeysFile; the credential files of the server and the
+// authority are returned after it
+func (c *Cluster) writeAPIKeys() ([]string, error) {
+	keys := []APIKey{
+		{Principal: Principal{Role: RoleOperator}},
+		{Principal: Principal{Role: RoleServer}},
+		{Principal: Principal{Role: RoleAuthority}},
+	}
+	files := make([]string, 0, len(keys))
+	for idx := range keys {
+		data := make([]byte, 32)
+		if _, err := rand.Read(data); err != nil {
+			return files, err
+		}
+		keys[idx].Key = hex.EncodeToString(data)
+	}
+	c.OperatorKey = keys[0].Key
+
+	keysData, err := json.Marshal(keys)
+	if err != nil {
+		return files, err
+	}
+	for _, data := range [][]byte{keysData, []byte(keys[1].Key), []byte(keys[2].Key)} {
+		file, err := os.CreateTemp("", "fe-testkit-credentials-*")
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file.Name())
+		_, err = file.Write(data)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+// Now returns the time of the Cluster's clock
+func (c *Cluster) Now() time.Time {
+	return c.clock.Now()
+}
+
+// hostConfig returns the HostConfig for a host of the Cluster; the address is ignored, as the hosts are served
+// by httptest servers
+func (c *Cluster) hostConfig(name string) HostConfig {
+	logConfig := DefaultLogConfig(c.options.LogDir, name)
+	logConfig.LogLevel = c.options.LogLevel
+
+	return HostConfig{
+		Scheme:          "http",
+		IPv4:            "127.0.0.1",
+		Port:            "0",
+		TaskChanSize:    15,
+		LogConfig:       logConfig,
+		ShutdownTimeout: Duration(10 * time.Second),
+	}
+}
@@ -0,0 +1,240 @@
+package testkit
+
+import (
+	"errors"
+	"fe/authority"
+	"fe/client"
+	. "fe/common"
+	"fe/server"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+const (
+	hour = 60 * 60
+	day  = 24 * hour
+)
+
+// startSimulatedCluster starts a Cluster on a SimulatedClock, which is shut down at the end of the test
+func startSimulatedCluster(t *testing.T, options Options) *Cluster {
+	t.Helper()
+
+	options.Clock = NewSimulatedClock(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	options.PollingInterval = time.Minute
+	options.LogDir = t.TempDir()
+	c, err := StartCluster(options)
+	if err != nil {
+		t.Fatalf("starting cluster failed: %s", err)
+	}
+	t.Cleanup(c.Shutdown)
+	return c
+}
+
+// testTask is a task of BatchCnt batches of BatchSize samples, sampled every SamplingPeriod seconds
+type testTask struct {
+	Scheme         string
+	SamplingPeriod int
+	BatchSize      int
+	BatchCnt       int
+	GracePeriod    int // in seconds; 0 uses the server's default
+}
+
+// runTask adds the task, that starts in an hour on the Cluster's clock, waits for its result and checks it against
+// the samples of the sensors; it returns the details of the task
+func runTask(t *testing.T, c *Cluster, task testTask) *TaskDetails {
+	t.Helper()
+
+	tariffId, err := c.AddTariff(server.Tariff{
+		Description:    "test",
+		SamplingPeriod: task.SamplingPeriod,
+		BatchSize:      task.BatchSize,
+		MaxSampleValue: 300,
+		MaxTariffValue: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := c.Now().Add(time.Hour)
+	taskId, err := c.AddTask(ServerTaskRequest{
+		Start:            int(start.Unix()),
+		Duration:         task.SamplingPeriod * task.BatchSize * task.BatchCnt,
+		TariffId:         tariffId,
+		EnableEncryption: task.Scheme != SchemeDummy,
+		Scheme:           task.Scheme,
+		GracePeriod:      task.GracePeriod,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.WaitForResult(taskId, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := c.ExpectedResult(taskId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("result is %d, expected %d", result, expected)
+	}
+
+	details, err := c.ServerClient.Task(taskId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return details
+}
+
+// TestMonthLongTask runs a task that samples three sensors every six hours for 30 days, with a batch a day
+func TestMonthLongTask(t *testing.T) {
+	for _, scheme := range []string{SchemeFHMultiIPE, SchemeDamgardMulti, SchemeDecentralizedDMCFE, SchemeDummy} {
+		t.Run(scheme, func(t *testing.T) {
+			c := startSimulatedCluster(t, Options{SensorCnt: 3})
+			start := c.Now()
+
+			details := runTask(t, c, testTask{Scheme: scheme, SamplingPeriod: 6 * hour, BatchSize: 4, BatchCnt: 30})
+			if len(details.MissingBatches) > 0 {
+				t.Errorf("batches are missing: %v", details.MissingBatches)
+			}
+
+			if elapsed := c.Now().Sub(start); elapsed < 30*day*time.Second {
+				t.Errorf("the clock has advanced by %s only", elapsed)
+			}
+		})
+	}
+}
+
+// TestSamplingSchedule checks that the batches are sampled exactly on schedule, even by the sensors whose clocks
+// are off, as the clock is advanced only once the sensors have settled
+func TestSamplingSchedule(t *testing.T) {
+	offsets := []time.Duration{0, 3 * time.Second, -2 * time.Second}
+	c := startSimulatedCluster(t, Options{SensorCnt: len(offsets), SensorClockOffsets: offsets, CompensateClockOffset: true})
+	start := c.Now().Add(time.Hour)
+	samplingPeriod, batchSize, batchCnt := hour, 6, 8
+
+	details := runTask(t, c, testTask{Scheme: SchemeFHMultiIPE, SamplingPeriod: samplingPeriod, BatchSize: batchSize, BatchCnt: batchCnt})
+
+	for idx, sensorClient := range c.SensorClients {
+		commitments, err := sensorClient.Commitments(details.TaskId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(commitments) != batchCnt {
+			t.Fatalf("sensor no %d has %d commitments, expected %d", idx, len(commitments), batchCnt)
+		}
+
+		for _, commitment := range commitments {
+			// sampled on the sensor's clock
+			batchEnd := time.Duration((commitment.BatchIdx+1)*batchSize*samplingPeriod) * time.Second
+			expected := start.Add(batchEnd).Add(offsets[idx])
+			if sampledAt := time.Unix(0, commitment.SampledAt); !sampledAt.Equal(expected) {
+				t.Errorf("batch no %d of sensor no %d sampled at %s, expected %s", commitment.BatchIdx, idx, sampledAt.UTC(), expected.UTC())
+			}
+		}
+	}
+}
+
+// TestPartialBill runs a task with a sensor whose clock is two hours behind, so that its last batch is sampled after
+// the deadline; the task is billed for the received batches only, which with the DMCFE schemes excludes the last
+// batch of every sensor, and its bundle verifies
+func TestPartialBill(t *testing.T) {
+	for _, scheme := range []string{SchemeFHMultiIPE, SchemeDummy, SchemeDMCFE, SchemeDecentralizedDMCFE} {
+		t.Run(scheme, func(t *testing.T) {
+			c := startSimulatedCluster(t, Options{SensorCnt: 3, SensorClockOffsets: []time.Duration{0, 0, -2 * time.Hour}})
+
+			details := runTask(t, c, testTask{Scheme: scheme, SamplingPeriod: hour, BatchSize: 2, BatchCnt: 6, GracePeriod: 60})
+
+			if details.Status != "partial" {
+				t.Errorf("task is %s, expected partial", details.Status)
+			}
+			expected := map[UUID][]int{c.Sensors[2].Id: {5}}
+			if DecryptsBatches(scheme) {
+				for _, sensor := range c.Sensors {
+					expected[sensor.Id] = []int{5}
+				}
+			}
+			if !maps.EqualFunc(details.MissingBatches, expected, slices.Equal[[]int]) {
+				t.Errorf("missing batches are %v, expected %v", details.MissingBatches, expected)
+			}
+
+			if !UsesAuthority(scheme) {
+				return
+			}
+			var bundle server.Bundle
+			if err := c.ServerClient.TaskBundle(details.TaskId, &bundle); err != nil {
+				t.Fatal(err)
+			}
+			for _, check := range server.VerifyBundle(&bundle, server.PinnedKeys{}, "") {
+				if check.Err != nil {
+					t.Errorf("bundle check %s failed: %s", check.Name, check.Err)
+				}
+			}
+		})
+	}
+}
+
+// TestThreshold runs a task whose master secret is split among three share holders, two of which must derive partial
+// keys for the decryption key; the authority keeps none of the secret once the sensors have their encryption params
+func TestThreshold(t *testing.T) {
+	c := startSimulatedCluster(t, Options{SensorCnt: 2, ShareHolderCnt: 3, Threshold: 2})
+
+	details := runTask(t, c, testTask{Scheme: SchemeDamgardMulti, SamplingPeriod: hour, BatchSize: 3, BatchCnt: 4})
+	if len(details.MissingBatches) > 0 {
+		t.Errorf("batches are missing: %v", details.MissingBatches)
+	}
+
+	task, err := c.Authority.GetTask(details.TaskId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secKeys := task.FEParamGenerator.(*authority.DamgardMultiParamGenerator).SecKeys
+	if secKeys.Msk != nil {
+		t.Error("the authority has kept the master secret keys")
+	}
+	for idx, otp := range secKeys.Otp {
+		if otp != nil {
+			t.Errorf("the authority has kept the one-time pad of client no %d", idx)
+		}
+	}
+}
+
+// TestAuthorization checks that only the operator adds sensors, and that the authority lets each host call only its
+// own endpoints
+func TestAuthorization(t *testing.T) {
+	c := startSimulatedCluster(t, Options{SensorCnt: 2})
+
+	// expectStatus checks that err is an APIError of the status
+	expectStatus := func(name string, err error, status int) {
+		t.Helper()
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Status != status {
+			t.Errorf("%s: got %v, expected status %d", name, err, status)
+		}
+	}
+	authorityClient := func(credential string) *client.Authority {
+		return client.NewAuthority(&RemoteHttpServer{IP: c.AuthorityClient.IP, Logger: GetDiscardLogger(), Credential: credential})
+	}
+
+	customerClient := client.NewServer(&RemoteHttpServer{IP: c.ServerClient.IP, Logger: GetDiscardLogger(), Credential: c.CustomerKey})
+	_, err := customerClient.AddSensor(c.CustomerId, RegisterSensorRequest{SensorId: NewUUID(), IP: c.SensorClients[0].IP})
+	expectStatus("customer adding a sensor", err, http.StatusForbidden)
+
+	taskId := NewUUID()
+	_, err = authorityClient("").SchemaParamsStatus(taskId)
+	expectStatus("unauthenticated request to the authority", err, http.StatusUnauthorized)
+	_, err = authorityClient(c.CustomerKey).SchemaParamsStatus(taskId)
+	expectStatus("customer's request to the authority", err, http.StatusUnauthorized)
+
+	sensorKey := c.Sensors[0].GetServer().Credential
+	_, err = authorityClient(sensorKey).SchemaParamsStatus(taskId)
+	expectStatus("sensor's request for the schema status", err, http.StatusForbidden)
+	_, err = authorityClient(sensorKey).EncryptionParams(taskId, c.Sensors[1].Id)
+	expectStatus("sensor's request for the encryption params of another sensor", err, http.StatusForbidden)
+	_, err = authorityClient(sensorKey).EncryptionParams(taskId, c.Sensors[0].Id)
+	expectStatus("sensor's request for its encryption params", err, http.StatusNotFound)
+}
@@ -0,0 +1,146 @@
+package testkit
+
+import (
+	. "fe/common"
+	"fe/server"
+	"reflect"
+	"time"
+)
+
+// taskWatch follows the events of a task on the server and on the sensors, so that WaitForResult doesn't have to
+// poll. With a SimulatedClock, it also tells when the hosts have settled, that is when only advancing the clock can
+// move the task forward: every goroutine that waits for the clock has set its timer, and no batch, cipher or
+// submission of the task is being processed.
+type taskWatch struct {
+	cluster *Cluster
+	task    *server.Task
+	server  *eventCounter
+	sensors []*eventCounter // nil until the task is submitted to the sensor
+}
+
+// eventCounter counts the events of a task by their type
+type eventCounter struct {
+	stream  *EventStream
+	counts  map[string]int
+	changed <-chan struct{} // closed when there are new events
+}
+
+func newEventCounter(stream *EventStream) *eventCounter {
+	return &eventCounter{stream: stream, counts: make(map[string]int)}
+}
+
+// update counts the events published since the last update
+func (e *eventCounter) update() {
+	events, changed, _ := e.stream.Next()
+	for _, event := range events {
+		e.counts[event.Type]++
+	}
+	e.changed = changed
+}
+
+func (c *Cluster) watchTask(taskId UUID) (*taskWatch, error) {
+	task, err := c.Server.GetTask(taskId)
+	if err != nil {
+		return nil, err
+	}
+	return &taskWatch{
+		cluster: c,
+		task:    task,
+		server:  newEventCounter(task.Events(-1)),
+		sensors: make([]*eventCounter, len(c.Sensors)),
+	}, nil
+}
+
+// update counts the new events, and returns the channels that are closed when the task or the clock changes
+func (w *taskWatch) update() []<-chan struct{} {
+	w.server.update()
+	changed := []<-chan struct{}{w.server.changed}
+
+	for idx, counter := range w.sensors {
+		if counter == nil {
+			task, err := w.cluster.Sensors[idx].GetTask(w.task.Id)
+			if err != nil {
+				continue
+			}
+			counter = newEventCounter(task.Events(-1))
+			w.sensors[idx] = counter
+		}
+		counter.update()
+		changed = append(changed, counter.changed)
+	}
+
+	if w.cluster.Clock != nil {
+		_, clockChanged := w.cluster.Clock.WatchTimers()
+		changed = append(changed, clockChanged)
+	}
+	return changed
+}
+
+// settled returns true if the hosts have settled, given the last update; it's meant for a SimulatedClock only.
+// The timers the hosts must have set are counted from the state of the task; the ones that aren't accounted for
+// (e.g. of the outboxes retrying the submissions) can only make the hosts seem settled too early.
+func (w *taskWatch) settled() bool {
+	expectedTimers := 0
+	submittedCiphers := 0
+
+	for _, sensor := range w.sensors {
+		if sensor == nil {
+			continue
+		}
+
+		sampled := sensor.counts["sampled"]
+		if sampled < w.task.BatchCnt {
+			expectedTimers++ // the next sample
+		}
+		paramsReady := sensor.counts["encryption_params"] > 0
+		if !paramsReady && UsesAuthority(w.task.Scheme) {
+			expectedTimers++ // polling the authority for the encryption params
+		}
+
+		// until the params are ready, the sampled batches wait for them; the queued ciphers wait for the outbox
+		settledBatches := sensor.counts["submitted"] + sensor.counts["failed"] + sensor.counts["queued"]
+		if paramsReady && sampled > settledBatches {
+			return false
+		}
+		submittedCiphers += sensor.counts["submitted"]
+	}
+
+	usesAuthority := UsesAuthority(w.task.Scheme)
+	schemaReady := !usesAuthority || w.server.counts["schema_ready"] > 0
+	keyReady := w.server.counts["key_ready"] > 0
+
+	if w.cluster.Now().Before(w.task.Deadline()) {
+		expectedTimers++ // closing the submissions
+	}
+	if usesAuthority && (!schemaReady || w.task.Threshold == 0 && !keyReady) {
+		expectedTimers++ // polling the authority for the params
+	}
+
+	// once the schema params are ready, the task is submitted to the sensors without waiting for the clock,
+	// as are the ciphers added to the decryptor once the key is ready
+	if schemaReady && w.server.counts["submitted"] < len(w.task.Sensors) {
+		return false
+	}
+	if keyReady && w.server.counts["cipher"] < submittedCiphers {
+		return false
+	}
+	// with the decentralized scheme, the keys are set up right after the task is submitted, without waiting for
+	// the clock
+	if !usesAuthority && !keyReady {
+		return false
+	}
+
+	pending, _ := w.cluster.Clock.WatchTimers()
+	return pending >= expectedTimers
+}
+
+// waitForChange blocks until one of changed is closed, and returns false if timeout fires first
+func waitForChange(changed []<-chan struct{}, timeout <-chan time.Time) bool {
+	cases := make([]reflect.SelectCase, 0, len(changed)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timeout)})
+	for _, ch := range changed {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	chosen, _, _ := reflect.Select(cases)
+	return chosen != 0
+}
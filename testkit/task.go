@@ -0,0 +1,117 @@
+package testkit
+
+import (
+	. "fe/common"
+	"fe/server"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// AddTariff adds tariff to the server, and returns its id
+func (c *Cluster) AddTariff(tariff server.Tariff) (UUID, error) {
+	tariffId, err := c.ServerClient.AddTariff(tariff)
+	if err != nil {
+		return "", fmt.Errorf("adding tariff failed: %s", err)
+	}
+	return tariffId, nil
+}
+
+// AddTask adds a task for the Cluster's customer to the server, and returns its id; CustomerId of the request is
+// overwritten
+func (c *Cluster) AddTask(taskRequest ServerTaskRequest) (UUID, error) {
+	taskRequest.CustomerId = c.CustomerId
+	taskId, err := c.ServerClient.AddTask(taskRequest)
+	if err != nil {
+		return "", fmt.Errorf("adding task failed: %s", err)
+	}
+	return taskId, nil
+}
+
+// WaitForResult waits until the server decrypts the result of the task, or until timeout (on the wall clock)
+// expires; it fails as soon as the task fails. If the Cluster has a SimulatedClock, the clock is fast-forwarded
+// from one pending timer to the next, each time the hosts have settled (see taskWatch), so the task runs as fast as
+// the hosts can process it, and it takes the same course however fast they are.
+func (c *Cluster) WaitForResult(taskId UUID, timeout time.Duration) (int64, error) {
+	watch, err := c.watchTask(taskId)
+	if err != nil {
+		return 0, err
+	}
+
+	timeoutTimer := time.NewTimer(timeout)
+	defer timeoutTimer.Stop()
+
+	for {
+		changed := watch.update()
+		if watch.server.counts["result"] > 0 {
+			return c.getResult(taskId)
+		}
+		if watch.server.counts["failed"] > 0 {
+			return 0, fmt.Errorf("task %s has failed", taskId)
+		}
+
+		if c.Clock != nil && watch.settled() && c.Clock.AdvanceToNext() {
+			continue
+		}
+
+		if !waitForChange(changed, timeoutTimer.C) {
+			return 0, fmt.Errorf("task %s has no result after %s", taskId, timeout)
+		}
+	}
+}
+
+func (c *Cluster) getResult(taskId UUID) (int64, error) {
+	details, err := c.ServerClient.Task(taskId)
+	if err != nil {
+		return 0, fmt.Errorf("fetching task details failed: %s", err)
+	}
+	return details.Result, nil
+}
+
+// ExpectedResult calculates the result of the task from the samples of all the sensors and the rates generated
+// by the server, without the batches that were missing at the deadline; it is meant to be called after WaitForResult.
+func (c *Cluster) ExpectedResult(taskId UUID) (int64, error) {
+	task, err := c.Server.GetTask(taskId)
+	if err != nil {
+		return 0, err
+	}
+	rates := task.Rates
+	if rates == nil {
+		return 0, fmt.Errorf("rates of task %s haven't been generated", taskId)
+	}
+
+	missingBatches := task.GetMissingBatches()
+
+	disclosures, err := c.DiscloseSamples(taskId)
+	if err != nil {
+		return 0, err
+	}
+
+	var expected int64
+	for idx, disclosure := range disclosures {
+		// every sensor's batch is multiplied by the same rates
+		for _, batch := range disclosure.Batches {
+			if slices.Contains(missingBatches[c.Sensors[idx].Id], batch.BatchIdx) {
+				continue
+			}
+			for sampleIdx, sample := range batch.Samples {
+				expected += sample * int64(rates[batch.BatchIdx*task.BatchSize+sampleIdx])
+			}
+		}
+	}
+
+	return expected, nil
+}
+
+// DiscloseSamples fetches the samples of the task from every sensor, with the customer's audit tokens
+func (c *Cluster) DiscloseSamples(taskId UUID) ([]*SampleDisclosure, error) {
+	disclosures := make([]*SampleDisclosure, len(c.SensorClients))
+	for idx, sensorClient := range c.SensorClients {
+		disclosure, err := sensorClient.Samples(taskId, c.AuditTokens[idx])
+		if err != nil {
+			return nil, fmt.Errorf("fetching samples of sensor no %d failed: %s", idx, err)
+		}
+		disclosures[idx] = disclosure
+	}
+	return disclosures, nil
+}